@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"geektime-go/cache"
 	"geektime-go/cache/HW_graceful_shutdown/service"
 	"log"
 	"net/http"
@@ -10,28 +12,49 @@ import (
 
 // 注意要从命令行启动，否则不同的 IDE 可能会吞掉关闭信号
 func main() {
+	// 每分鐘保存一次快照，兩次快照之間的修改記錄在 AOF 裡面，重啟的時候恢復
+	localCache, err := cache.OpenBuildInMapCache(time.Second,
+		cache.BuildInMapCacheWithSnapshot("cache.snapshot", time.Minute),
+		cache.BuildInMapCacheWithAOF("cache.aof"),
+		cache.BuildInMapCacheWithPersistenceErrorHandler(func(err error) {
+			log.Printf("保存快照失败: %v", err)
+		}))
+	if err != nil {
+		log.Fatalf("恢复缓存失败: %v", err)
+	}
+
 	s1 := service.NewServer("business", "localhost:8080")
 	s1.Handle("/", http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
 		_, _ = writer.Write([]byte("hello"))
 	}))
 	s2 := service.NewServer("admin", "localhost:8081")
-	app := service.NewApp([]*service.Server{s1, s2}, service.WithShutdownCallbacks(StoreCacheToDBCallback))
-	app.StartAndServe()
+	app := service.NewApp([]service.Server{s1, s2}, service.WithShutdownHooks(service.Hook{
+		Name: "cache",
+		Fn:   StoreCache(localCache),
+	}))
+	if err := app.StartAndServe(); err != nil {
+		log.Println(err)
+	}
 }
 
-func StoreCacheToDBCallback(ctx context.Context) {
-	done := make(chan struct{}, 1)
-	go func() {
-		// 你的业务逻辑，比如说这里我们模拟的是将本地缓存刷新到数据库里面
-		// 这里我们简单的睡一段时间来模拟
-		log.Printf("刷新缓存中……")
-		time.Sleep(5 * time.Second)
-		done <- struct{}{}
-	}()
-	select {
-	case <-ctx.Done():
-		log.Printf("刷新缓存超时")
-	case <-done:
-		log.Printf("缓存被刷新到了 DB")
+// StoreCache 退出之前把本地缓存保存到磁盘
+func StoreCache(c *cache.BuildInMapCache) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		done := make(chan error, 1)
+		go func() {
+			log.Printf("保存缓存中……")
+			// Close 会保存最后一次快照
+			done <- c.Close()
+		}()
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("保存缓存超时: %w", ctx.Err())
+		case err := <-done:
+			if err != nil {
+				return fmt.Errorf("保存缓存失败: %w", err)
+			}
+			log.Printf("缓存已保存到磁盘")
+			return nil
+		}
 	}
 }
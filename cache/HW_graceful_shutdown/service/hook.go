@@ -0,0 +1,247 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	errDuplicateHook = errors.New("service: Hook 的名字重複")
+	errUnknownHook   = errors.New("service: 依賴的 Hook 不存在")
+	errHookCycle     = errors.New("service: Hook 之間存在循環依賴")
+	errReservedHook  = errors.New("service: Hook 的名字使用了保留的前綴")
+	errHookSkipped   = errors.New("service: 依賴的 Hook 失敗，沒有執行")
+)
+
+// callbackHookPrefix WithShutdownCallbacks 生成的 Hook 的名字前綴，用戶的 Hook 不能使用
+const callbackHookPrefix = "service:callback-"
+
+// Hook 有名字的回調，用於啟動和優雅退出
+// 執行順序：Priority 大的先執行；After 裡面的 Hook 執行完之後才會執行
+// 啟動的時候 After 裡面的 Hook 失敗 (包括被跳過) 則跳過這個 Hook；優雅退出的時候不管它們是否成功都會執行
+// 沒有先後關係的 Hook 並發執行
+//
+//	WithShutdownHooks(
+//		Hook{Name: "cache", Fn: flushCache},
+//		Hook{Name: "db", After: []string{"cache"}, Fn: closeDB},
+//	)
+type Hook struct {
+	Name     string
+	Priority int
+	After    []string
+	// Timeout 為 0 的時候使用 App 的 cbTimeout
+	Timeout time.Duration
+	Fn      func(ctx context.Context) error
+
+	// callback 是否為 WithShutdownCallbacks 生成的 Hook
+	callback bool
+}
+
+// HookResult Hook 的執行結果，超時的時候 Err 為 context.DeadlineExceeded
+// 被跳過的時候 Skipped 為 true，Err 為 errHookSkipped
+type HookResult struct {
+	Name     string
+	Err      error
+	Skipped  bool
+	Duration time.Duration
+}
+
+// WithShutdownHooks 在關閉服務器之後、釋放資源之前執行
+func WithShutdownHooks(hooks ...Hook) Option {
+	return func(app *App) {
+		app.shutdownHooks = append(app.shutdownHooks, hooks...)
+	}
+}
+
+// WithStartupHooks 在啟動服務器之前執行，順序規則和 WithShutdownHooks 一樣
+// 任何一個失敗的時候都不會啟動服務器，見 StartAndServe
+func WithStartupHooks(hooks ...Hook) Option {
+	return func(app *App) {
+		app.startupHooks = append(app.startupHooks, hooks...)
+	}
+}
+
+// hookDeps 每個 Hook 需要等待的 Hook 的下標，包括 After 和優先級更高的 Hook
+func hookDeps(hooks []Hook) ([][]int, error) {
+	idx := make(map[string]int, len(hooks))
+	for i, h := range hooks {
+		if !h.callback && strings.HasPrefix(h.Name, callbackHookPrefix) {
+			return nil, fmt.Errorf("%w, hook: %s", errReservedHook, h.Name)
+		}
+		if _, ok := idx[h.Name]; ok {
+			return nil, fmt.Errorf("%w, hook: %s", errDuplicateHook, h.Name)
+		}
+		idx[h.Name] = i
+	}
+	deps := make([][]int, len(hooks))
+	for i, h := range hooks {
+		for j, other := range hooks {
+			if other.Priority > h.Priority {
+				deps[i] = append(deps[i], j)
+			}
+		}
+		for _, name := range h.After {
+			j, ok := idx[name]
+			if !ok {
+				return nil, fmt.Errorf("%w, hook: %s, after: %s", errUnknownHook, h.Name, name)
+			}
+			deps[i] = append(deps[i], j)
+		}
+	}
+	// 0 未訪問，1 訪問中，2 已經確認沒有循環
+	state := make([]int, len(hooks))
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case 1:
+			return fmt.Errorf("%w, hook: %s", errHookCycle, hooks[i].Name)
+		case 2:
+			return nil
+		}
+		state[i] = 1
+		for _, j := range deps[i] {
+			if err := visit(j); err != nil {
+				return err
+			}
+		}
+		state[i] = 2
+		return nil
+	}
+	for i := range hooks {
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+	}
+	return deps, nil
+}
+
+// runHooks 每個 Hook 一個 goroutine，等依賴的 Hook 都結束之後執行
+// skipFailed 為 true 的時候，After 裡面有 Hook 失敗就跳過，用於啟動
+// 結果的順序和 hooks 一樣
+func runHooks(hooks []Hook, deps [][]int, timeout time.Duration, skipFailed bool) []HookResult {
+	idx := make(map[string]int, len(hooks))
+	for i, h := range hooks {
+		idx[h.Name] = i
+	}
+	res := make([]HookResult, len(hooks))
+	done := make([]chan struct{}, len(hooks))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+	for i := range hooks {
+		go func(i int) {
+			defer close(done[i])
+			for _, j := range deps[i] {
+				<-done[j]
+			}
+			if skipFailed {
+				for _, name := range hooks[i].After {
+					if res[idx[name]].Err != nil {
+						res[i] = HookResult{
+							Name:    hooks[i].Name,
+							Err:     fmt.Errorf("%w, after: %s", errHookSkipped, name),
+							Skipped: true,
+						}
+						return
+					}
+				}
+			}
+			res[i] = runHook(hooks[i], timeout)
+		}(i)
+	}
+	for _, d := range done {
+		<-d
+	}
+	return res
+}
+
+// runHook 超時之後不再等待 Fn 返回
+func runHook(h Hook, timeout time.Duration) HookResult {
+	if h.Timeout > 0 {
+		timeout = h.Timeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	start := time.Now()
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- h.Fn(ctx)
+	}()
+	var err error
+	select {
+	case err = <-errCh:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	return HookResult{Name: h.Name, Err: err, Duration: time.Since(start)}
+}
+
+// ShutdownReport 一次優雅退出的結果
+type ShutdownReport struct {
+	// Inflight 等待超時、強制關閉服務器的時候還在處理的請求數量
+	Inflight int64
+	// Servers 關閉失敗的 Server，key 為 Server 的名字
+	Servers map[string]error
+	Hooks   []HookResult
+}
+
+// Err 所有的錯誤，沒有錯誤的時候返回 nil
+// 返回的錯誤支持 errors.Is 和 errors.As 判斷裡面的任意一個錯誤
+func (r *ShutdownReport) Err() error {
+	var errs multiError
+	if r.Inflight > 0 {
+		errs = append(errs, fmt.Errorf("%d 個請求沒有處理完", r.Inflight))
+	}
+	// 按照名字排序，保證錯誤信息穩定
+	names := make([]string, 0, len(r.Servers))
+	for name := range r.Servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		errs = append(errs, fmt.Errorf("server %s: %w", name, r.Servers[name]))
+	}
+	for _, h := range r.Hooks {
+		if h.Err != nil {
+			errs = append(errs, fmt.Errorf("hook %s: %w", h.Name, h.Err))
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+type multiError []error
+
+func (m multiError) Error() string {
+	msgs := make([]string, 0, len(m))
+	for _, err := range m {
+		msgs = append(msgs, err.Error())
+	}
+	return "service: " + strings.Join(msgs, "; ")
+}
+
+// Is 和 As 逐個判斷裡面的錯誤
+// Go 1.20 之前 errors 包不支持 Unwrap() []error，所以需要自己實現
+func (m multiError) Is(target error) bool {
+	for _, err := range m {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m multiError) As(target any) bool {
+	for _, err := range m {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHookDeps(t *testing.T) {
+	fn := func(ctx context.Context) error { return nil }
+	testCases := []struct {
+		name    string
+		hooks   []Hook
+		wantErr error
+	}{
+		{
+			name: "ok",
+			hooks: []Hook{
+				{Name: "db", After: []string{"cache"}, Fn: fn},
+				{Name: "cache", Priority: 1, Fn: fn},
+				{Name: "log", Fn: fn},
+			},
+		},
+		{
+			name: "duplicate",
+			hooks: []Hook{
+				{Name: "db", Fn: fn},
+				{Name: "db", Fn: fn},
+			},
+			wantErr: errDuplicateHook,
+		},
+		{
+			name: "unknown",
+			hooks: []Hook{
+				{Name: "db", After: []string{"cache"}, Fn: fn},
+			},
+			wantErr: errUnknownHook,
+		},
+		{
+			name: "cycle",
+			hooks: []Hook{
+				{Name: "db", After: []string{"cache"}, Fn: fn},
+				{Name: "cache", After: []string{"db"}, Fn: fn},
+			},
+			wantErr: errHookCycle,
+		},
+		{
+			// 優先級高的 Hook 依賴優先級低的 Hook
+			name: "priority cycle",
+			hooks: []Hook{
+				{Name: "db", Fn: fn},
+				{Name: "cache", Priority: 1, After: []string{"db"}, Fn: fn},
+			},
+			wantErr: errHookCycle,
+		},
+		{
+			// 不能和 WithShutdownCallbacks 生成的 Hook 衝突
+			name: "reserved",
+			hooks: []Hook{
+				{Name: "service:callback-0", Fn: fn},
+			},
+			wantErr: errReservedHook,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := hookDeps(tc.hooks)
+			assert.True(t, errors.Is(err, tc.wantErr), "err: %v", err)
+			if tc.wantErr != nil {
+				assert.Panics(t, func() {
+					NewApp(nil, WithShutdownHooks(tc.hooks...))
+				})
+			}
+		})
+	}
+}
+
+func TestRunHooks(t *testing.T) {
+	var mu sync.Mutex
+	var order []string
+	record := func(name string, d time.Duration, err error) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			time.Sleep(d)
+			mu.Lock()
+			defer mu.Unlock()
+			order = append(order, name)
+			return err
+		}
+	}
+	errFlush := errors.New("flush failed")
+	hooks := []Hook{
+		// db 等 cache，cache 雖然比較慢，而且失敗了，db 也要等它結束
+		{Name: "db", After: []string{"cache"}, Fn: record("db", 0, nil)},
+		{Name: "cache", Fn: record("cache", time.Millisecond*50, errFlush)},
+		// 優先級最高，最先執行
+		{Name: "metrics", Priority: 1, Fn: record("metrics", time.Millisecond*10, nil)},
+		{Name: "slow", Timeout: time.Millisecond * 10, Fn: func(ctx context.Context) error {
+			time.Sleep(time.Second)
+			return nil
+		}},
+	}
+	deps, err := hookDeps(hooks)
+	require.NoError(t, err)
+	start := time.Now()
+	res := runHooks(hooks, deps, time.Second, false)
+	// 超時的 Hook 不會拖慢其他 Hook
+	assert.Less(t, time.Since(start), time.Millisecond*500)
+
+	assert.Equal(t, []string{"metrics", "cache", "db"}, order)
+	require.Len(t, res, 4)
+	assert.Equal(t, "db", res[0].Name)
+	assert.NoError(t, res[0].Err)
+	assert.Equal(t, errFlush, res[1].Err)
+	assert.NoError(t, res[2].Err)
+	assert.Equal(t, context.DeadlineExceeded, res[3].Err)
+}
+
+func TestRunHooks_SkipFailed(t *testing.T) {
+	var mu sync.Mutex
+	var order []string
+	record := func(name string, err error) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			mu.Lock()
+			defer mu.Unlock()
+			order = append(order, name)
+			return err
+		}
+	}
+	errConfig := errors.New("config failed")
+	hooks := []Hook{
+		{Name: "config", Priority: 1, Fn: record("config", errConfig)},
+		// 依賴的 Hook 失敗了，跳過
+		{Name: "db", After: []string{"config"}, Fn: record("db", nil)},
+		// 依賴的 Hook 被跳過，同樣跳過
+		{Name: "cache", After: []string{"db"}, Fn: record("cache", nil)},
+		// 只是優先級比較低，照樣執行
+		{Name: "log", Fn: record("log", nil)},
+	}
+	deps, err := hookDeps(hooks)
+	require.NoError(t, err)
+	res := runHooks(hooks, deps, time.Second, true)
+	assert.Equal(t, []string{"config", "log"}, order)
+	require.Len(t, res, 4)
+	assert.Equal(t, errConfig, res[0].Err)
+	assert.False(t, res[0].Skipped)
+	for _, r := range res[1:3] {
+		assert.True(t, r.Skipped)
+		assert.True(t, errors.Is(r.Err, errHookSkipped))
+	}
+	assert.NoError(t, res[3].Err)
+}
+
+func TestShutdownReport_Err(t *testing.T) {
+	errServer := errors.New("server failed")
+	report := &ShutdownReport{
+		Inflight: 2,
+		Servers:  map[string]error{"web": errServer, "admin": errServer, "rpc": errServer},
+		Hooks: []HookResult{
+			{Name: "cache", Err: context.DeadlineExceeded},
+			{Name: "db"},
+		},
+	}
+	err := report.Err()
+	assert.True(t, errors.Is(err, errServer))
+	var hookErr interface{ Timeout() bool }
+	assert.True(t, errors.As(err, &hookErr))
+	assert.False(t, errors.Is(err, context.Canceled))
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	// server 按照名字排序，每次的錯誤信息都一樣
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, "service: 2 個請求沒有處理完; server admin: server failed; "+
+			"server rpc: server failed; server web: server failed; "+
+			"hook cache: context deadline exceeded", report.Err().Error())
+	}
+
+	assert.NoError(t, (&ShutdownReport{Hooks: []HookResult{{Name: "db"}}}).Err())
+}
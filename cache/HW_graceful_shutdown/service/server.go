@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"geektime-go/web"
+	"net"
+	"net/http"
+	"sync/atomic"
+)
+
+// ErrServerClosed Shutdown 之後 Start 返回的錯誤，和 http.ErrServerClosed 是同一個
+var ErrServerClosed = http.ErrServerClosed
+
+// Server 本身可以是很多种 Server，例如 http server
+// 或者 RPC server
+// App 只依賴這個接口，一個進程裡面的 HTTP 和 RPC 服務在同樣的超時時間內一起關閉
+type Server interface {
+	// Name 只用於日誌
+	Name() string
+	// Start 阻塞直到服務關閉，Shutdown 之後返回 ErrServerClosed
+	Start() error
+	// RejectNew 拒絕新的請求，正在處理的請求不受影響
+	RejectNew()
+	// Inflight 正在處理的請求數量，RejectNew 之後 App 等待它變成 0
+	Inflight() int64
+	// Shutdown 等待正在處理的請求結束之後關閉，ctx 超時的時候直接關閉並返回 ctx.Err()
+	Shutdown(ctx context.Context) error
+}
+
+var (
+	_ Server = (*HTTPServer)(nil)
+	_ Server = (*RPCServer)(nil)
+)
+
+// HTTPServer 基於 http.Server 的 Server
+type HTTPServer struct {
+	srv  *http.Server
+	name string
+	mux  *serverMux
+	// NewServer 創建的時候才有，用於 Handle
+	serveMux *http.ServeMux
+}
+
+// serverMux 既可以看做是装饰器模式，也可以看做委托模式
+type serverMux struct {
+	reject   atomic.Bool
+	inflight atomic.Int64
+	http.Handler
+}
+
+func (s *serverMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// 先計數再檢查 reject：沒有被拒絕的請求一定在 RejectNew 之前計數了，
+	// 所以 RejectNew 之後看到 Inflight 為 0 的時候，不會再有請求進來
+	s.inflight.Add(1)
+	defer s.inflight.Add(-1)
+	if s.reject.Load() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte("服务已关闭"))
+		return
+	}
+	s.Handler.ServeHTTP(w, r)
+}
+
+// NewServer 使用 http.ServeMux 路由的 HTTPServer，透過 Handle 註冊路由
+func NewServer(name string, addr string) *HTTPServer {
+	serveMux := http.NewServeMux()
+	res := NewHandlerServer(name, addr, serveMux)
+	res.serveMux = serveMux
+	return res
+}
+
+// NewHandlerServer 把任意的 http.Handler 包裝成 HTTPServer
+func NewHandlerServer(name string, addr string, handler http.Handler) *HTTPServer {
+	mux := &serverMux{Handler: handler}
+	return &HTTPServer{
+		name: name,
+		mux:  mux,
+		srv: &http.Server{
+			Addr:    addr,
+			Handler: mux,
+		},
+	}
+}
+
+// NewWebServer 適配 web.HttpServer，web.HttpServer 自己沒有辦法關閉
+func NewWebServer(name string, addr string, server *web.HttpServer) *HTTPServer {
+	return NewHandlerServer(name, addr, server)
+}
+
+// Handle 只能用於 NewServer 創建的 HTTPServer，其他的在自己的 Handler 上註冊路由
+func (s *HTTPServer) Handle(pattern string, handler http.Handler) {
+	if s.serveMux == nil {
+		panic("service: 只有 NewServer 創建的 HTTPServer 可以使用 Handle")
+	}
+	s.serveMux.Handle(pattern, handler)
+}
+
+func (s *HTTPServer) Name() string {
+	return s.name
+}
+
+func (s *HTTPServer) Start() error {
+	return s.srv.ListenAndServe()
+}
+
+func (s *HTTPServer) RejectNew() {
+	s.mux.reject.Store(true)
+}
+
+func (s *HTTPServer) Inflight() int64 {
+	return s.mux.inflight.Load()
+}
+
+func (s *HTTPServer) Shutdown(ctx context.Context) error {
+	// 透過 http.Server 關閉，超時的時候 http.Server 不會關閉正在處理請求的連接，需要 Close
+	if err := s.srv.Shutdown(ctx); err != nil {
+		_ = s.srv.Close()
+		return err
+	}
+	return nil
+}
+
+// NetServer 在 net.Listener 上提供服務，並且自己支持優雅退出，e.g. micro/rpc.Server
+type NetServer interface {
+	Serve(l net.Listener) error
+	RejectNew()
+	Inflight() int64
+	Shutdown(ctx context.Context) error
+}
+
+// RPCServer 適配 NetServer，e.g.
+//
+//	s := rpc.NewServer()
+//	s.RegisterService(&UserServiceServer{})
+//	srv := service.NewRPCServer("user", "tcp", ":8082", s)
+type RPCServer struct {
+	name    string
+	network string
+	addr    string
+	srv     NetServer
+	closed  atomic.Bool
+}
+
+func NewRPCServer(name string, network string, addr string, srv NetServer) *RPCServer {
+	return &RPCServer{
+		name:    name,
+		network: network,
+		addr:    addr,
+		srv:     srv,
+	}
+}
+
+func (s *RPCServer) Name() string {
+	return s.name
+}
+
+// Start Shutdown 之後統一返回 ErrServerClosed，不管底層返回的是什麼錯誤
+func (s *RPCServer) Start() error {
+	l, err := net.Listen(s.network, s.addr)
+	if err != nil {
+		return err
+	}
+	err = s.srv.Serve(l)
+	if s.closed.Load() {
+		return ErrServerClosed
+	}
+	return err
+}
+
+func (s *RPCServer) RejectNew() {
+	s.srv.RejectNew()
+}
+
+func (s *RPCServer) Inflight() int64 {
+	return s.srv.Inflight()
+}
+
+func (s *RPCServer) Shutdown(ctx context.Context) error {
+	s.closed.Store(true)
+	return s.srv.Shutdown(ctx)
+}
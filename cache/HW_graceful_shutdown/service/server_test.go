@@ -0,0 +1,149 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"geektime-go/web"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPServer(t *testing.T) {
+	testCases := []struct {
+		name   string
+		server func() *HTTPServer
+	}{
+		{
+			name: "mux",
+			server: func() *HTTPServer {
+				s := NewServer("mux", "127.0.0.1:0")
+				s.Handle("/hello", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					_, _ = w.Write([]byte("hello"))
+				}))
+				return s
+			},
+		},
+		{
+			name: "web",
+			server: func() *HTTPServer {
+				h := web.NewHttpServer()
+				h.Get("/hello", func(ctx *web.Context) {
+					ctx.RespStatusCode = http.StatusOK
+					ctx.RespData = []byte("hello")
+				})
+				return NewWebServer("web", "127.0.0.1:0", h)
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := tc.server()
+			assert.Equal(t, tc.name, s.Name())
+
+			resp := httptest.NewRecorder()
+			s.srv.Handler.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/hello", nil))
+			assert.Equal(t, http.StatusOK, resp.Code)
+			assert.Equal(t, "hello", resp.Body.String())
+
+			s.RejectNew()
+			resp = httptest.NewRecorder()
+			s.srv.Handler.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/hello", nil))
+			assert.Equal(t, http.StatusServiceUnavailable, resp.Code)
+
+			require.NoError(t, s.Shutdown(context.Background()))
+			assert.Equal(t, ErrServerClosed, s.Start())
+		})
+	}
+}
+
+func TestHTTPServer_Inflight(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	s := NewHandlerServer("inflight", "127.0.0.1:0", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	}))
+	done := make(chan int, 1)
+	go func() {
+		resp := httptest.NewRecorder()
+		s.srv.Handler.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/", nil))
+		done <- resp.Code
+	}()
+	<-started
+	assert.Equal(t, int64(1), s.Inflight())
+
+	// 被拒絕的請求處理完之後不再計數
+	s.RejectNew()
+	resp := httptest.NewRecorder()
+	s.srv.Handler.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, resp.Code)
+	assert.Equal(t, int64(1), s.Inflight())
+
+	close(release)
+	assert.Equal(t, http.StatusOK, <-done)
+	assert.Equal(t, int64(0), s.Inflight())
+}
+
+func TestHTTPServer_Handle(t *testing.T) {
+	s := NewHandlerServer("handler", "127.0.0.1:0", http.NotFoundHandler())
+	assert.Panics(t, func() {
+		s.Handle("/", http.NotFoundHandler())
+	})
+}
+
+// fakeNetServer 模擬 micro/rpc.Server，Shutdown 的時候關閉 listener
+type fakeNetServer struct {
+	l        net.Listener
+	serving  chan struct{}
+	rejected bool
+}
+
+func (f *fakeNetServer) Serve(l net.Listener) error {
+	f.l = l
+	close(f.serving)
+	_, err := l.Accept()
+	return err
+}
+
+func (f *fakeNetServer) RejectNew() {
+	f.rejected = true
+}
+
+func (f *fakeNetServer) Inflight() int64 {
+	return 0
+}
+
+func (f *fakeNetServer) Shutdown(ctx context.Context) error {
+	return f.l.Close()
+}
+
+func TestRPCServer(t *testing.T) {
+	f := &fakeNetServer{serving: make(chan struct{})}
+	s := NewRPCServer("rpc", "tcp", "127.0.0.1:0", f)
+	assert.Equal(t, "rpc", s.Name())
+	startErr := make(chan error, 1)
+	go func() {
+		startErr <- s.Start()
+	}()
+	select {
+	case <-f.serving:
+	case <-time.After(time.Second):
+		t.Fatal("RPCServer 沒有啟動")
+	}
+
+	s.RejectNew()
+	assert.True(t, f.rejected)
+	require.NoError(t, s.Shutdown(context.Background()))
+	// 底層返回的是 listener 關閉的錯誤
+	assert.True(t, errors.Is(<-startErr, ErrServerClosed))
+}
+
+func TestRPCServer_StartFailed(t *testing.T) {
+	s := NewRPCServer("rpc", "tcp", "invalid address", &fakeNetServer{})
+	assert.Error(t, s.Start())
+}
@@ -2,8 +2,9 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
-	"net/http"
 	"os"
 	"os/signal"
 	"sync"
@@ -26,51 +27,89 @@ type Option func(*App)
 // - 我们还希望用户知道，他的回调必须要在一定时间内处理完毕，而且他必须显式处理超时错误
 type ShutdownCallback func(ctx context.Context)
 
-// 你需要实现这个方法
+// WithShutdownCallbacks 相當於沒有依賴關係的 Hook，名字為 service:callback-0、service:callback-1……
+// 這個前綴是保留的，用戶的 Hook 不能使用
 func WithShutdownCallbacks(cbs ...ShutdownCallback) Option {
 	return func(app *App) {
-		app.cbs = cbs
+		for _, cb := range cbs {
+			c := cb
+			app.shutdownHooks = append(app.shutdownHooks, Hook{
+				Name:     fmt.Sprintf("%s%d", callbackHookPrefix, len(app.shutdownHooks)),
+				callback: true,
+				Fn: func(ctx context.Context) error {
+					c(ctx)
+					return nil
+				},
+			})
+		}
+	}
+}
+
+// WithShutdownReporter 優雅退出結束之後，釋放資源之前調用，默認輸出到日誌
+func WithShutdownReporter(f func(report *ShutdownReport)) Option {
+	return func(app *App) {
+		app.reporter = f
 	}
 }
 
 // 这里我已经预先定义好了各种可配置字段
 type App struct {
-	servers []*Server
+	servers []Server
 
 	// 优雅退出整个超时时间，默认30秒
 	shutdownTimeout time.Duration
-	// 优雅退出时候等待处理已有请求时间，默认10秒钟
+	// 优雅退出时候等待处理已有请求的最长时间，默认10秒钟
+	// 所有 Server 的 Inflight 都变成 0 的时候提前结束，剩下的时间留给 Server 关闭
 	waitTime time.Duration
-	// 自定义回调超时时间，默认三秒钟
+	// 自定义回调超时时间，默认三秒钟，Hook 可以单独设置
 	cbTimeout time.Duration
 
-	cbs []ShutdownCallback
+	startupHooks  []Hook
+	shutdownHooks []Hook
+	// 每個 Hook 需要等待的 Hook，見 hookDeps
+	startupDeps  [][]int
+	shutdownDeps [][]int
+	reporter     func(report *ShutdownReport)
 }
 
 // NewApp 创建 App 实例，注意设置默认值，同时使用这些选项
-func NewApp(servers []*Server, opts ...Option) *App {
+// Hook 的名字重复、依赖的 Hook 不存在或者存在循环依赖的时候 panic
+func NewApp(servers []Server, opts ...Option) *App {
 	app := &App{
 		servers:         servers,
 		shutdownTimeout: time.Second * 20,
 		waitTime:        time.Second * 10,
 		cbTimeout:       time.Second * 3,
+		reporter:        logReport,
 	}
 	for _, opt := range opts {
 		opt(app)
 	}
+	var err error
+	if app.startupDeps, err = hookDeps(app.startupHooks); err != nil {
+		panic(err)
+	}
+	if app.shutdownDeps, err = hookDeps(app.shutdownHooks); err != nil {
+		panic(err)
+	}
 	return app
 }
 
 // StartAndServe 你主要要实现这个方法
-func (app *App) StartAndServe() {
+// 启动回调失败的时候不会启动服务器，也不会执行关闭回调，直接返回错误
+// 优雅退出之后返回 ShutdownReport.Err
+func (app *App) StartAndServe() error {
+	if err := app.startup(); err != nil {
+		return err
+	}
 	for _, s := range app.servers {
 		srv := s
 		go func() {
 			if err := srv.Start(); err != nil {
-				if err == http.ErrServerClosed {
-					log.Printf("服务器%s已关闭", srv.name)
+				if errors.Is(err, ErrServerClosed) {
+					log.Printf("服务器%s已关闭", srv.Name())
 				} else {
-					log.Printf("服务器%s异常退出", srv.name)
+					log.Printf("服务器%s异常退出: %v", srv.Name(), err)
 				}
 			}
 		}()
@@ -90,125 +129,122 @@ func (app *App) StartAndServe() {
 		go func() {
 			select {
 			case <-c:
-				log.Println("強制退出")
+				log.Printf("強制退出，仍有 %d 個請求在處理", app.inflight())
 				os.Exit(1)
 			case <-time.After(app.shutdownTimeout):
-				log.Println("超時強制退出")
+				log.Printf("超時強制退出，仍有 %d 個請求在處理", app.inflight())
 				os.Exit(1)
 			}
 		}()
 	}
-	app.shutdown()
+	return app.shutdown().Err()
+}
+
+// startup 执行启动回调，返回第一个失败的错误，被跳過的回調只記錄日誌
+func (app *App) startup() error {
+	log.Println("开始执行启动回调")
+	var err error
+	for _, res := range runHooks(app.startupHooks, app.startupDeps, app.cbTimeout, true) {
+		switch {
+		case res.Skipped:
+			log.Printf("启动回调%s被跳过: %v", res.Name, res.Err)
+		case res.Err != nil && err == nil:
+			err = fmt.Errorf("service: 启动回调 %s 失败: %w", res.Name, res.Err)
+		}
+	}
+	return err
 }
 
 // shutdown 你要设计这里面的执行步骤。
-func (app *App) shutdown() {
+func (app *App) shutdown() *ShutdownReport {
+	report := &ShutdownReport{Servers: map[string]error{}}
 	log.Println("开始关闭应用，停止接收新请求")
 	// 你需要在这里让所有的 server 拒绝新请求
 	for _, srv := range app.servers {
-		// 本身是 http.ServeMux 的對象
-		// 而且又用了裝飾器模式封裝成新對象，所以控制是獨立的對象本身
-		// 只要自身關閉即可
-		srv.rejectReq()
+		// 每個 Server 自己決定怎麼拒絕，e.g. HTTP 返回 503，RPC 返回錯誤
+		srv.RejectNew()
 	}
 
 	log.Println("等待正在执行请求完结")
-	time.Sleep(app.waitTime)
+	// 等待請求和關閉服務器共用 waitTime，超時之後 Shutdown 會直接關閉連接
+	ctx, cancel := context.WithTimeout(context.Background(), app.waitTime)
+	defer cancel()
+	if report.Inflight = app.waitInflight(ctx); report.Inflight > 0 {
+		log.Printf("等待超时，强制关闭时仍有 %d 个请求在处理", report.Inflight)
+	}
 
 	log.Println("开始关闭服务器")
 	// 并发关闭服务器，同时要注意协调所有的 server 都关闭之后才能步入下一个阶段
 	var wg sync.WaitGroup
-	ctx := context.Background()
+	var mu sync.Mutex
 	for _, s := range app.servers {
 		wg.Add(1)
-		go func(s *Server) {
+		go func(s Server) {
 			defer wg.Done()
-			err := s.stop(ctx)
-			if err != nil {
-				log.Println("關閉服務失敗")
-				return
+			log.Printf("服务器%s关闭中", s.Name())
+			if err := s.Shutdown(ctx); err != nil {
+				log.Printf("關閉服務%s失敗: %v", s.Name(), err)
+				mu.Lock()
+				report.Servers[s.Name()] = err
+				mu.Unlock()
 			}
 		}(s)
 	}
 	wg.Wait()
 
 	log.Println("开始执行自定义回调")
-	// 并发执行回调，要注意协调所有的回调都执行完才会步入下一个阶段
-	wg.Add(len(app.servers))
-	for _, cb := range app.cbs {
-		c := cb
-		go func() {
-			defer wg.Done()
-			ctxTO, cancel := context.WithTimeout(context.Background(), app.cbTimeout)
-			defer cancel()
-			c(ctxTO)
-		}()
-	}
-	wg.Wait()
+	// 按照优先级和依赖关系执行，没有先后关系的回调并发执行
+	report.Hooks = runHooks(app.shutdownHooks, app.shutdownDeps, app.cbTimeout, false)
+	app.reporter(report)
 
 	// 释放资源
 	log.Println("开始释放资源")
 	// 这一个步骤不需要你干什么，这是假装我们整个应用自己要释放一些资源
 	app.close()
+	return report
 }
 
-func (app *App) close() {
-	// 在这里释放掉一些可能的资源
-	time.Sleep(time.Second)
-	log.Println("应用关闭")
-}
-
-// Server 本身可以是很多种 Server，例如 http server
-// 或者 RPC server
-// 理论上来说，如果你设计一个脚手架的框架，那么 Server 应该是一个接口
-type Server struct {
-	srv  *http.Server
-	name string
-	mux  *serverMux
-}
-
-// serverMux 既可以看做是装饰器模式，也可以看做委托模式
-type serverMux struct {
-	reject bool
-	*http.ServeMux
-}
-
-func (s *serverMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// 只是在考虑到 CPU 高速缓存的时候，会存在短时间的不一致性
-	if s.reject {
-		w.WriteHeader(http.StatusServiceUnavailable)
-		_, _ = w.Write([]byte("服务已关闭"))
-		return
+func logReport(report *ShutdownReport) {
+	for _, h := range report.Hooks {
+		if h.Err != nil {
+			log.Printf("回调%s失败，耗时 %s: %v", h.Name, h.Duration, h.Err)
+			continue
+		}
+		log.Printf("回调%s完成，耗时 %s", h.Name, h.Duration)
 	}
-	s.ServeMux.ServeHTTP(w, r)
 }
 
-func NewServer(name string, addr string) *Server {
-	mux := &serverMux{ServeMux: http.NewServeMux()}
-	return &Server{
-		name: name,
-		mux:  mux,
-		srv: &http.Server{
-			Addr:    addr,
-			Handler: mux,
-		},
+// inflightPollInterval 等待請求處理完的時候檢查 Inflight 的間隔
+const inflightPollInterval = time.Millisecond * 10
+
+// waitInflight 等待所有 Server 的請求處理完，返回 ctx 超時的時候還在處理的請求數量
+func (app *App) waitInflight(ctx context.Context) int64 {
+	ticker := time.NewTicker(inflightPollInterval)
+	defer ticker.Stop()
+	for {
+		n := app.inflight()
+		if n == 0 {
+			return 0
+		}
+		select {
+		case <-ctx.Done():
+			return n
+		case <-ticker.C:
+		}
 	}
 }
 
-func (s *Server) Handle(pattern string, handler http.Handler) {
-	s.mux.Handle(pattern, handler)
-}
-
-func (s *Server) Start() error {
-	return s.srv.ListenAndServe()
-}
-
-func (s *Server) rejectReq() {
-	s.mux.reject = true
+// inflight 所有 Server 正在處理的請求數量
+func (app *App) inflight() int64 {
+	var res int64
+	for _, srv := range app.servers {
+		res += srv.Inflight()
+	}
+	return res
 }
 
-func (s *Server) stop(ctx context.Context) error {
-	log.Printf("服务器%s关闭中", s.name)
-	// 透過 http.Server 關閉
-	return s.srv.Shutdown(ctx)
+func (app *App) close() {
+	// 在这里释放掉一些可能的资源
+	time.Sleep(time.Second)
+	log.Println("应用关闭")
 }
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeServer 只用於測試 App 的關閉流程
+type fakeServer struct {
+	inflight    atomic.Int64
+	started     atomic.Bool
+	shutdownErr error
+}
+
+func (f *fakeServer) Name() string {
+	return "fake"
+}
+
+func (f *fakeServer) Start() error {
+	f.started.Store(true)
+	return nil
+}
+
+func (f *fakeServer) RejectNew() {}
+
+func (f *fakeServer) Inflight() int64 {
+	return f.inflight.Load()
+}
+
+func (f *fakeServer) Shutdown(ctx context.Context) error {
+	return f.shutdownErr
+}
+
+func TestApp_waitInflight(t *testing.T) {
+	testCases := []struct {
+		name     string
+		inflight []int64
+		// 多久之後所有請求都處理完，0 表示一直處理不完
+		finishAfter time.Duration
+		timeout     time.Duration
+
+		wantRemaining int64
+		wantMax       time.Duration
+	}{
+		{
+			name:     "no inflight",
+			inflight: []int64{0, 0},
+			timeout:  time.Second,
+			wantMax:  time.Millisecond * 100,
+		},
+		{
+			name:        "finished before timeout",
+			inflight:    []int64{1, 2},
+			finishAfter: time.Millisecond * 50,
+			timeout:     time.Second,
+			wantMax:     time.Millisecond * 500,
+		},
+		{
+			name:          "timeout",
+			inflight:      []int64{1, 2},
+			timeout:       time.Millisecond * 50,
+			wantRemaining: 3,
+			wantMax:       time.Millisecond * 500,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			servers := make([]Server, 0, len(tc.inflight))
+			fakes := make([]*fakeServer, 0, len(tc.inflight))
+			for _, n := range tc.inflight {
+				f := &fakeServer{}
+				f.inflight.Store(n)
+				servers = append(servers, f)
+				fakes = append(fakes, f)
+			}
+			if tc.finishAfter > 0 {
+				time.AfterFunc(tc.finishAfter, func() {
+					for _, f := range fakes {
+						f.inflight.Store(0)
+					}
+				})
+			}
+			app := NewApp(servers)
+			ctx, cancel := context.WithTimeout(context.Background(), tc.timeout)
+			defer cancel()
+			start := time.Now()
+			assert.Equal(t, tc.wantRemaining, app.waitInflight(ctx))
+			assert.Less(t, time.Since(start), tc.wantMax)
+		})
+	}
+}
+
+func TestApp_shutdown(t *testing.T) {
+	errShutdown := errors.New("shutdown failed")
+	var called atomic.Int64
+	var reported *ShutdownReport
+	app := NewApp([]Server{&fakeServer{shutdownErr: errShutdown}},
+		WithShutdownCallbacks(func(ctx context.Context) {
+			called.Add(1)
+		}, func(ctx context.Context) {
+			called.Add(1)
+		}),
+		WithShutdownHooks(Hook{Name: "db", After: []string{"service:callback-0"}, Fn: func(ctx context.Context) error {
+			return ctx.Err()
+		}}),
+		WithShutdownReporter(func(report *ShutdownReport) {
+			reported = report
+		}))
+	report := app.shutdown()
+	assert.Same(t, report, reported)
+	// 回調的數量和 Server 的數量不一樣，所有的回調都要執行完
+	assert.Equal(t, int64(2), called.Load())
+	assert.Equal(t, map[string]error{"fake": errShutdown}, report.Servers)
+	assert.Equal(t, []string{"service:callback-0", "service:callback-1", "db"},
+		[]string{report.Hooks[0].Name, report.Hooks[1].Name, report.Hooks[2].Name})
+	assert.True(t, errors.Is(report.Err(), errShutdown))
+}
+
+func TestApp_StartupFailed(t *testing.T) {
+	errStartup := errors.New("startup failed")
+	var order []string
+	srv := &fakeServer{}
+	app := NewApp([]Server{srv}, WithStartupHooks(
+		Hook{Name: "config", Priority: 1, Fn: func(ctx context.Context) error {
+			order = append(order, "config")
+			return nil
+		}},
+		Hook{Name: "db", Fn: func(ctx context.Context) error {
+			order = append(order, "db")
+			return errStartup
+		}},
+		// db 失敗了，不會執行
+		Hook{Name: "cache", After: []string{"db"}, Fn: func(ctx context.Context) error {
+			order = append(order, "cache")
+			return nil
+		}},
+	))
+	err := app.StartAndServe()
+	assert.True(t, errors.Is(err, errStartup))
+	assert.False(t, errors.Is(err, errHookSkipped))
+	assert.Equal(t, []string{"config", "db"}, order)
+	assert.False(t, srv.started.Load())
+}
@@ -1,32 +1,127 @@
 package cache
 
 import (
+	"container/list"
 	"context"
-	"github.com/gotomicro/ekit/list"
+	"errors"
+	"fmt"
+	"geektime-go/cache/event"
+	"geektime-go/cache/stats"
 	"sync"
 	"time"
 )
 
+var errEntryTooLarge = errors.New("cache: 鍵值對超過內存上限")
+
 type MaxMemoryCache struct {
 	Cache
-	max  int64 // 控制總量 （value）
+	max  int64 // 控制總量，大小由 sizer 計算
 	used int64
 
 	// 雖然效能會影響，但是可以較好控制內存，不會有併發問題
 	// 可以用原子操作替換，但是內存控制就不一定準確了
 	mutex *sync.Mutex
-	// 按照正常的設計，這邊需要的是一個接近 Java 的 LinkedHashMap 的結構
-	keys *list.LinkedList[string]
+	// 最近使用的在末尾，配合 entryMeta.elem 做到 O(1) 的 LRU
+	lru   *list.List
+	sizer Sizer
+
+	// 軟限制，大於 0 的時候 used 超過 soft 就在後台淘汰到 low
+	soft    int64
+	low     int64
+	trigger chan struct{}
+	done    chan struct{}
+	once    sync.Once
+
+	counters stats.Counters
+	// 每個 key 的元數據，底層 Cache 沒有提供的信息都記錄在這裡
+	entries map[string]*entryMeta
+	// 最後一次寫入的版本，單調遞增
+	version uint64
+
+	events *event.Bus
+
+	// 底層 Cache 的回調可能是 MaxMemoryCache 調用底層 Cache 的時候同步觸發的 (已經持有 mutex)，
+	// 也可能是底層 Cache 自己的 goroutine 異步觸發的 (e.g. 定時過期、Redis 的 keyspace 通知)，
+	// 所以回調只記錄到 pending，統一在持有 mutex 的時候由 drain 處理
+	pendingMu sync.Mutex
+	pending   []evictedEntry
+}
+
+// evictedEntry 底層 Cache 回調的鍵值對
+type evictedEntry struct {
+	key string
+	val []byte
+}
+
+type entryMeta struct {
+	size     int64
+	accesses uint64
+	// 為 0 表示不過期
+	deadline time.Time
+	version  uint64
+	elem     *list.Element
+}
+
+// Sizer 估算一個鍵值對佔用的內存
+type Sizer func(key string, val []byte) int64
+
+// EntryOverhead EntrySizer 給每個鍵值對額外加上的大小
+// 包括 key 和 val 的 header、entryMeta 和 LRU 節點，是 64 位平台上的估算值
+const EntryOverhead = 160
+
+// ValueSizer 只計算值的大小，默認的 Sizer
+func ValueSizer(key string, val []byte) int64 {
+	return int64(len(val))
+}
+
+// EntrySizer 計算鍵、值和元數據的大小，比較接近實際佔用的內存
+func EntrySizer(key string, val []byte) int64 {
+	return int64(len(key)+len(val)) + EntryOverhead
+}
+
+type MaxMemoryCacheOption func(cache *MaxMemoryCache)
+
+func MaxMemoryCacheWithSizer(sizer Sizer) MaxMemoryCacheOption {
+	return func(cache *MaxMemoryCache) {
+		cache.sizer = sizer
+	}
+}
+
+// MaxMemoryCacheWithSoftLimit 超過 soft 的時候在後台淘汰到 low，寫入不需要等待淘汰
+// max 仍然是硬限制，超過 max 的時候 Set 會同步淘汰
+// 需要滿足 0 < low <= soft <= max，不需要的時候調用 Close 停止後台的 goroutine
+func MaxMemoryCacheWithSoftLimit(soft, low int64) MaxMemoryCacheOption {
+	return func(cache *MaxMemoryCache) {
+		cache.soft = soft
+		cache.low = low
+	}
 }
 
 //var _ Cache = (*MaxMemoryCache)(nil)
 
-func NewMaxMemoryCache(max int64, cache Cache) *MaxMemoryCache {
+var _ CacheV1 = (*MaxMemoryCache)(nil)
+
+func NewMaxMemoryCache(max int64, cache Cache, opts ...MaxMemoryCacheOption) *MaxMemoryCache {
 	ret := &MaxMemoryCache{
 		max:   max,
 		Cache: cache,
 		mutex: &sync.Mutex{},
-		keys:  list.NewLinkedList[string](),
+		lru:   list.New(),
+		sizer: ValueSizer,
+
+		entries: make(map[string]*entryMeta),
+		events:  event.NewBus(),
+		done:    make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(ret)
+	}
+	if ret.soft > 0 {
+		if ret.low <= 0 || ret.low > ret.soft || ret.soft > ret.max {
+			panic("cache: 軟限制需要滿足 0 < low <= soft <= max")
+		}
+		ret.trigger = make(chan struct{}, 1)
+		go ret.loop()
 	}
 	ret.Cache.OnEvicted(ret.evicted)
 	return ret
@@ -34,49 +129,161 @@ func NewMaxMemoryCache(max int64, cache Cache) *MaxMemoryCache {
 
 func (m *MaxMemoryCache) Set(ctx context.Context, key string, val []byte,
 	expiration time.Duration) error {
-	m.mutex.Lock()
-	defer m.mutex.Unlock()
-	// 懶惰刪除檢查
-	_, _ = m.Cache.LoadAndDelete(ctx, key)
-	for m.used+int64(len(val)) > m.max {
-		k, err := m.keys.Get(0)
-		if err != nil {
+	m.lock()
+	defer m.unlock()
+	return m.set(ctx, key, val, expiration)
+}
+
+// set 所有寫操作的入口，需要持有鎖
+func (m *MaxMemoryCache) set(ctx context.Context, key string, val []byte,
+	expiration time.Duration) error {
+	size := m.sizer(key, val)
+	if size > m.max {
+		return fmt.Errorf("%w, key: %s, size: %d, max: %d", errEntryTooLarge, key, size, m.max)
+	}
+	// 覆蓋舊的值，底層 Cache 直接覆蓋，不會觸發回調，所以在這裡扣掉舊的大小
+	if meta, ok := m.entries[key]; ok {
+		m.forget(key, meta)
+	}
+	for m.used+size > m.max && m.lru.Len() > 0 {
+		if err := m.evictOldest(ctx); err != nil {
 			return err
 		}
-		_ = m.Cache.Delete(ctx, k)
 	}
 	err := m.Cache.Set(ctx, key, val, expiration)
-	if err == nil {
-		m.used = m.used + int64(len(val))
-		_ = m.keys.Append(key)
+	// 在 track 之前處理，舊的值過期的回調不會影響新的值
+	m.drain(event.TypeExpire)
+	if err != nil {
+		// 舊的值可能還在底層 Cache 裡面，刪掉避免佔用沒有被計算的內存
+		_ = m.Cache.Delete(ctx, key)
+		m.drain(0, key)
+		return err
+	}
+	m.events.Publish(event.Event{Key: key, Val: val, Type: event.TypeSet})
+	m.version++
+	meta := &entryMeta{size: size, version: m.version}
+	if expiration > 0 {
+		meta.deadline = time.Now().Add(expiration)
+	}
+	m.track(key, meta)
+	m.counters.Set()
+	if m.soft > 0 && m.used > m.soft {
+		select {
+		case m.trigger <- struct{}{}:
+		default:
+		}
 	}
 	return nil
 }
 
+// track 開始計算 key 的大小，放到 LRU 的末尾
+func (m *MaxMemoryCache) track(key string, meta *entryMeta) {
+	meta.elem = m.lru.PushBack(key)
+	m.entries[key] = meta
+	m.used += meta.size
+}
+
+// forget 不再計算 key 的大小，不會修改底層 Cache
+func (m *MaxMemoryCache) forget(key string, meta *entryMeta) {
+	m.lru.Remove(meta.elem)
+	delete(m.entries, key)
+	m.used -= meta.size
+}
+
+// evictOldest 淘汰最久沒有使用的 key，底層 Cache 的回調負責 forget
+func (m *MaxMemoryCache) evictOldest(ctx context.Context) error {
+	key := m.lru.Front().Value.(string)
+	err := m.Cache.Delete(ctx, key)
+	m.drain(event.TypeEvict, key)
+	if err != nil {
+		return err
+	}
+	// 底層 Cache 沒有調用回調 (e.g. key 已經不在了) 也要保證 used 減少，避免死循環
+	m.untrack(key)
+	m.counters.Evict()
+	return nil
+}
+
+// loop 軟限制模式下在後台淘汰，每次持有鎖最多淘汰 evictBatch 個 key
+func (m *MaxMemoryCache) loop() {
+	for {
+		select {
+		case <-m.trigger:
+			for m.evictBatch() {
+			}
+		case <-m.done:
+			return
+		}
+	}
+}
+
+const evictBatch = 128
+
+// evictBatch 返回是否還需要繼續淘汰
+func (m *MaxMemoryCache) evictBatch() bool {
+	m.lock()
+	defer m.unlock()
+	for i := 0; i < evictBatch; i++ {
+		if m.used <= m.low || m.lru.Len() == 0 {
+			return false
+		}
+		if err := m.evictOldest(context.Background()); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
 func (m *MaxMemoryCache) Get(ctx context.Context, key string) ([]byte, error) {
 	// 加鎖，預防懶惰刪除的情況
-	m.mutex.Lock()
-	defer m.mutex.Unlock()
+	m.lock()
+	defer m.unlock()
+	return m.get(ctx, key)
+}
 
+func (m *MaxMemoryCache) get(ctx context.Context, key string) ([]byte, error) {
 	val, err := m.Cache.Get(ctx, key)
-	if err == nil {
-		// 因為 LRU 策略
-		// 所以在 linked list 先刪除，移到末尾
-		m.deleteKey(key)
-		_ = m.keys.Append(key)
+	// 底層 Cache 可能在 Get 的時候刪除過期的 key
+	m.drain(event.TypeExpire)
+	if err != nil {
+		m.counters.Miss()
+		return val, err
 	}
-	return val, err
+	meta, ok := m.entries[key]
+	if !ok {
+		// 底層 Cache 裡面已經有的 key (e.g. 包裝之前寫入的)，從第一次讀取開始計算
+		meta = &entryMeta{size: m.sizer(key, val)}
+		m.track(key, meta)
+	}
+	// 因為 LRU 策略，移到末尾
+	m.lru.MoveToBack(meta.elem)
+	meta.accesses++
+	m.counters.Hit()
+	return val, nil
 }
 
 func (m *MaxMemoryCache) Delete(ctx context.Context, key string) error {
-	m.mutex.Lock()
-	defer m.mutex.Unlock()
-	return m.Cache.Delete(ctx, key)
+	m.lock()
+	defer m.unlock()
+	return m.delete(ctx, key)
+}
+
+func (m *MaxMemoryCache) delete(ctx context.Context, key string) error {
+	if _, ok := m.entries[key]; ok {
+		m.counters.Delete()
+	}
+	err := m.Cache.Delete(ctx, key)
+	m.drain(event.TypeDelete, key)
+	if err != nil {
+		return err
+	}
+	m.untrack(key)
+	return nil
 }
 
 func (m *MaxMemoryCache) OnEvicted(f func(key string, val []byte)) {
-	m.mutex.Lock()
-	defer m.mutex.Unlock()
+	m.lock()
+	defer m.unlock()
 	m.Cache.OnEvicted(func(key string, val []byte) {
 		m.evicted(key, val)
 		f(key, val)
@@ -84,25 +291,124 @@ func (m *MaxMemoryCache) OnEvicted(f func(key string, val []byte)) {
 }
 
 func (m *MaxMemoryCache) LoadAndDelete(ctx context.Context, key string) ([]byte, error) {
-	m.mutex.Lock()
-	defer m.mutex.Unlock()
-	return m.Cache.LoadAndDelete(ctx, key)
+	m.lock()
+	defer m.unlock()
+	val, err := m.Cache.LoadAndDelete(ctx, key)
+	m.drain(event.TypeDelete, key)
+	if err == nil {
+		m.counters.Delete()
+		m.untrack(key)
+	}
+	return val, err
 }
 
+// untrack 底層 Cache 刪除之後沒有調用回調的時候，保證不再計算 key 的大小
+func (m *MaxMemoryCache) untrack(key string) {
+	if meta, ok := m.entries[key]; ok {
+		m.forget(key, meta)
+	}
+}
+
+// evicted 底層 Cache 刪除 key 的回調，只記錄下來，不修改其他狀態
 func (m *MaxMemoryCache) evicted(key string, val []byte) {
-	m.used = m.used - int64(len(val))
-	m.deleteKey(key)
+	m.pendingMu.Lock()
+	m.pending = append(m.pending, evictedEntry{key: key, val: val})
+	m.pendingMu.Unlock()
+	// 拿不到鎖說明有 goroutine 持有鎖 (同步回調的時候就是調用方自己)，由它在 unlock 的時候處理
+	if m.mutex.TryLock() {
+		m.unlock()
+	}
+}
+
+// lock 加鎖之後先處理之前異步回調的 key，保證讀到的 entries 和 used 是最新的
+func (m *MaxMemoryCache) lock() {
+	m.mutex.Lock()
+	m.drain(event.TypeExpire)
 }
 
-func (m *MaxMemoryCache) deleteKey(key string) {
-	for i := 0; i < m.keys.Len(); i++ {
-		k, err := m.keys.Get(i)
-		if err != nil {
+// unlock 解鎖之前處理 pending，解鎖之後再檢查一次，
+// 避免回調在 drain 之後、Unlock 之前記錄了 key，但是 TryLock 又失敗了
+func (m *MaxMemoryCache) unlock() {
+	for {
+		m.drain(event.TypeExpire)
+		m.mutex.Unlock()
+		m.pendingMu.Lock()
+		n := len(m.pending)
+		m.pendingMu.Unlock()
+		if n == 0 || !m.mutex.TryLock() {
 			return
 		}
-		if k == key {
-			_, _ = m.keys.Delete(i)
-			return
+	}
+}
+
+// drain 處理底層 Cache 的回調，需要持有鎖，大小以記錄的為準
+// keys 是調用方剛剛通過底層 Cache 刪除的，事件類型為 typ，0 表示不發布；
+// 其他 key 都是底層 Cache 自己過期刪除的，事件類型為 event.TypeExpire
+func (m *MaxMemoryCache) drain(typ event.Type, keys ...string) {
+	m.pendingMu.Lock()
+	pending := m.pending
+	m.pending = nil
+	m.pendingMu.Unlock()
+	for _, e := range pending {
+		meta, ok := m.entries[e.key]
+		if !ok {
+			continue
+		}
+		m.forget(e.key, meta)
+		t := event.TypeExpire
+		for _, key := range keys {
+			if key == e.key {
+				t = typ
+				break
+			}
+		}
+		if t == event.TypeExpire {
+			m.counters.Expire()
+		}
+		if t != 0 {
+			m.events.Publish(event.Event{Key: e.key, Val: e.val, Type: t})
 		}
 	}
 }
+
+// Subscribe 訂閱數據變更，包括底層 Cache 過期刪除的 key (TypeExpire)
+func (m *MaxMemoryCache) Subscribe(opts ...event.SubscribeOption) *event.Subscription {
+	return m.events.Subscribe(opts...)
+}
+
+// Close 關閉所有的訂閱，停止軟限制的後台淘汰，不會關閉底層 Cache
+func (m *MaxMemoryCache) Close() error {
+	m.once.Do(func() {
+		close(m.done)
+	})
+	return m.events.Close()
+}
+
+// Used 目前值佔用的總大小
+func (m *MaxMemoryCache) Used() int64 {
+	m.lock()
+	defer m.unlock()
+	return m.used
+}
+
+// Stats Expirations 依賴底層 Cache 過期的時候調用 OnEvicted 的回調
+func (m *MaxMemoryCache) Stats() stats.Stats {
+	res := m.counters.Snapshot()
+	m.lock()
+	defer m.unlock()
+	res.Keys = m.lru.Len()
+	res.UsedBytes = m.used
+	res.MaxBytes = m.max
+	return res
+}
+
+// KeyStats 大小由 Sizer 計算，和 max 的計算方式一樣
+func (m *MaxMemoryCache) KeyStats() []stats.KeyInfo {
+	m.lock()
+	defer m.unlock()
+	res := make([]stats.KeyInfo, 0, len(m.entries))
+	for key, meta := range m.entries {
+		res = append(res, stats.KeyInfo{Key: key, Size: meta.size, Accesses: meta.accesses})
+	}
+	return res
+}
@@ -0,0 +1,212 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+var (
+	errKeyNotFound     = errors.New("cache: key not found")
+	errNotInteger      = errors.New("cache: 值不是整數")
+	errIntegerOverflow = errors.New("cache: 整數溢出")
+)
+
+var (
+	_ BatchCache  = (*MaxMemoryCache)(nil)
+	_ AtomicCache = (*MaxMemoryCache)(nil)
+	_ TTLCache    = (*MaxMemoryCache)(nil)
+)
+
+// lookup 以 entries 判斷 key 是否存在，需要持有鎖
+// 底層 Cache 的錯誤無法區分 key 不存在和其他錯誤，所以不能用 Get 判斷
+func (m *MaxMemoryCache) lookup(key string, now time.Time) (*entryMeta, bool) {
+	meta, ok := m.entries[key]
+	if !ok || !meta.deadline.IsZero() && meta.deadline.Before(now) {
+		return nil, false
+	}
+	return meta, true
+}
+
+// ttl 剩餘的過期時間，0 表示不過期
+func (meta *entryMeta) ttl(now time.Time) time.Duration {
+	if meta.deadline.IsZero() {
+		return 0
+	}
+	// 剛好過期的時候至少保留 1 毫秒，避免變成不過期
+	if d := meta.deadline.Sub(now); d > time.Millisecond {
+		return d
+	}
+	return time.Millisecond
+}
+
+func (m *MaxMemoryCache) MGet(ctx context.Context, keys ...string) (map[string][]byte, error) {
+	m.lock()
+	defer m.unlock()
+	res := make(map[string][]byte, len(keys))
+	for _, key := range keys {
+		if val, err := m.get(ctx, key); err == nil {
+			res[key] = val
+		}
+	}
+	return res, nil
+}
+
+func (m *MaxMemoryCache) MSet(ctx context.Context, entries map[string][]byte, expiration time.Duration) error {
+	m.lock()
+	defer m.unlock()
+	for key, val := range entries {
+		if err := m.set(ctx, key, val, expiration); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MaxMemoryCache) MDelete(ctx context.Context, keys ...string) (int, error) {
+	now := time.Now()
+	m.lock()
+	defer m.unlock()
+	cnt := 0
+	for _, key := range keys {
+		if _, ok := m.lookup(key, now); !ok {
+			continue
+		}
+		if err := m.delete(ctx, key); err != nil {
+			return cnt, err
+		}
+		cnt++
+	}
+	return cnt, nil
+}
+
+func (m *MaxMemoryCache) SetNX(ctx context.Context, key string, val []byte, expiration time.Duration) (bool, error) {
+	m.lock()
+	defer m.unlock()
+	if _, ok := m.lookup(key, time.Now()); ok {
+		return false, nil
+	}
+	return true, m.set(ctx, key, val, expiration)
+}
+
+func (m *MaxMemoryCache) GetAndSet(ctx context.Context, key string, val []byte, expiration time.Duration) ([]byte, bool, error) {
+	m.lock()
+	defer m.unlock()
+	var old []byte
+	_, loaded := m.lookup(key, time.Now())
+	if loaded {
+		var err error
+		if old, err = m.Cache.Get(ctx, key); err != nil {
+			return nil, false, err
+		}
+	}
+	if err := m.set(ctx, key, val, expiration); err != nil {
+		return nil, false, err
+	}
+	return old, loaded, nil
+}
+
+func (m *MaxMemoryCache) GetWithVersion(ctx context.Context, key string) ([]byte, uint64, error) {
+	m.lock()
+	defer m.unlock()
+	meta, ok := m.lookup(key, time.Now())
+	if !ok {
+		m.counters.Miss()
+		return nil, 0, fmt.Errorf("%w, key: %s", errKeyNotFound, key)
+	}
+	val, err := m.get(ctx, key)
+	if err != nil {
+		return nil, 0, err
+	}
+	return val, meta.version, nil
+}
+
+func (m *MaxMemoryCache) CompareAndSwap(ctx context.Context, key string, version uint64,
+	val []byte, expiration time.Duration) (bool, error) {
+	m.lock()
+	defer m.unlock()
+	meta, ok := m.lookup(key, time.Now())
+	if version == 0 && ok || version != 0 && (!ok || meta.version != version) {
+		return false, nil
+	}
+	return true, m.set(ctx, key, val, expiration)
+}
+
+// Incr 值需要是十進制的整數，保留原本的過期時間
+func (m *MaxMemoryCache) Incr(ctx context.Context, key string, delta int64) (int64, error) {
+	now := time.Now()
+	m.lock()
+	defer m.unlock()
+	meta, ok := m.lookup(key, now)
+	if !ok {
+		return delta, m.set(ctx, key, []byte(strconv.FormatInt(delta, 10)), 0)
+	}
+	data, err := m.Cache.Get(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	val, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w, key: %s", errNotInteger, key)
+	}
+	if delta > 0 && val > math.MaxInt64-delta || delta < 0 && val < math.MinInt64-delta {
+		return 0, fmt.Errorf("%w, key: %s", errIntegerOverflow, key)
+	}
+	val += delta
+	return val, m.set(ctx, key, []byte(strconv.FormatInt(val, 10)), meta.ttl(now))
+}
+
+func (m *MaxMemoryCache) Decr(ctx context.Context, key string, delta int64) (int64, error) {
+	if delta == math.MinInt64 {
+		return 0, fmt.Errorf("%w, key: %s", errIntegerOverflow, key)
+	}
+	return m.Incr(ctx, key, -delta)
+}
+
+func (m *MaxMemoryCache) TTL(ctx context.Context, key string) (time.Duration, error) {
+	now := time.Now()
+	m.lock()
+	defer m.unlock()
+	meta, ok := m.lookup(key, now)
+	if !ok {
+		return 0, fmt.Errorf("%w, key: %s", errKeyNotFound, key)
+	}
+	if meta.deadline.IsZero() {
+		return NoExpiration, nil
+	}
+	return meta.deadline.Sub(now), nil
+}
+
+// Expire 底層 Cache 不支持修改過期時間，所以是重新寫入
+func (m *MaxMemoryCache) Expire(ctx context.Context, key string, expiration time.Duration) (bool, error) {
+	m.lock()
+	defer m.unlock()
+	if _, ok := m.lookup(key, time.Now()); !ok {
+		return false, nil
+	}
+	if expiration <= 0 {
+		return true, m.delete(ctx, key)
+	}
+	val, err := m.Cache.Get(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	return true, m.set(ctx, key, val, expiration)
+}
+
+func (m *MaxMemoryCache) Persist(ctx context.Context, key string) (bool, error) {
+	m.lock()
+	defer m.unlock()
+	meta, ok := m.lookup(key, time.Now())
+	if !ok || meta.deadline.IsZero() {
+		return false, nil
+	}
+	val, err := m.Cache.Get(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	return true, m.set(ctx, key, val, 0)
+}
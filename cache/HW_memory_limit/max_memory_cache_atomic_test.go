@@ -0,0 +1,99 @@
+package cache
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestMaxMemoryCache_Batch(t *testing.T) {
+	ctx := context.Background()
+	cache := NewMaxMemoryCache(10, &mockCache{data: map[string][]byte{}})
+	require.NoError(t, cache.MSet(ctx, map[string][]byte{"key1": []byte("val1"), "key2": []byte("val2")}, 0))
+	vals, err := cache.MGet(ctx, "key1", "key2", "key3")
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"key1": []byte("val1"), "key2": []byte("val2")}, vals)
+
+	n, err := cache.MDelete(ctx, "key1", "key3")
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, int64(4), cache.Used())
+}
+
+func TestMaxMemoryCache_Atomic(t *testing.T) {
+	ctx := context.Background()
+	cache := NewMaxMemoryCache(100, &mockCache{data: map[string][]byte{}})
+
+	ok, err := cache.SetNX(ctx, "key1", []byte("val1"), 0)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = cache.SetNX(ctx, "key1", []byte("val2"), 0)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	old, loaded, err := cache.GetAndSet(ctx, "key1", []byte("val2"), 0)
+	require.NoError(t, err)
+	assert.True(t, loaded)
+	assert.Equal(t, []byte("val1"), old)
+
+	val, version, err := cache.GetWithVersion(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("val2"), val)
+	_, _, err = cache.GetWithVersion(ctx, "key2")
+	assert.ErrorIs(t, err, errKeyNotFound)
+
+	ok, err = cache.CompareAndSwap(ctx, "key1", version+1, []byte("val3"), 0)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	ok, err = cache.CompareAndSwap(ctx, "key1", version, []byte("val3"), 0)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = cache.CompareAndSwap(ctx, "key2", 0, []byte("val2"), 0)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	n, err := cache.Incr(ctx, "cnt", 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), n)
+	n, err = cache.Decr(ctx, "cnt", 12)
+	require.NoError(t, err)
+	assert.Equal(t, int64(-2), n)
+	_, err = cache.Incr(ctx, "key1", 1)
+	assert.ErrorIs(t, err, errNotInteger)
+	// 值的大小變化也要計算
+	assert.Equal(t, int64(10), cache.Used())
+}
+
+func TestMaxMemoryCache_TTL(t *testing.T) {
+	ctx := context.Background()
+	cache := NewMaxMemoryCache(100, &mockCache{data: map[string][]byte{}})
+	require.NoError(t, cache.Set(ctx, "key1", []byte("val1"), 0))
+
+	ttl, err := cache.TTL(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, NoExpiration, ttl)
+	_, err = cache.TTL(ctx, "key2")
+	assert.ErrorIs(t, err, errKeyNotFound)
+
+	ok, err := cache.Expire(ctx, "key1", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ttl, err = cache.TTL(ctx, "key1")
+	require.NoError(t, err)
+	assert.True(t, ttl > 0 && ttl <= time.Minute)
+
+	ok, err = cache.Persist(ctx, "key1")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = cache.Persist(ctx, "key1")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	ok, err = cache.Expire(ctx, "key1", 0)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	_, err = cache.TTL(ctx, "key1")
+	assert.ErrorIs(t, err, errKeyNotFound)
+}
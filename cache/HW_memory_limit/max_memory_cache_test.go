@@ -3,8 +3,12 @@ package cache
 import (
 	"context"
 	"errors"
-	"github.com/gotomicro/ekit/list"
+	"fmt"
+	"geektime-go/cache/event"
+	"geektime-go/cache/stats"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
 	"testing"
 	"time"
 )
@@ -38,12 +42,7 @@ func TestMaxMemoryCache_Set(t *testing.T) {
 		{
 			name: "override-used-incr",
 			cache: func() *MaxMemoryCache {
-				ret := NewMaxMemoryCache(10, &mockCache{data: map[string][]byte{
-					"key1": []byte("value1"),
-				}})
-				ret.keys = list.NewLinkedListOf[string]([]string{"key1"})
-				ret.used = 6
-				return ret
+				return newTestMaxMemoryCache(t, 10, "key1", "value1")
 			},
 			key:      "key1",
 			val:      []byte("value1-new"),
@@ -53,12 +52,7 @@ func TestMaxMemoryCache_Set(t *testing.T) {
 		{
 			name: "override-used-decr",
 			cache: func() *MaxMemoryCache {
-				ret := NewMaxMemoryCache(10, &mockCache{data: map[string][]byte{
-					"key1": []byte("value1"),
-				}})
-				ret.keys = list.NewLinkedListOf[string]([]string{"key1"})
-				ret.used = 6
-				return ret
+				return newTestMaxMemoryCache(t, 10, "key1", "value1")
 			},
 			key:      "key1",
 			val:      []byte("val1"),
@@ -69,14 +63,7 @@ func TestMaxMemoryCache_Set(t *testing.T) {
 			//進行淘汰
 			name: "delete",
 			cache: func() *MaxMemoryCache {
-				ret := NewMaxMemoryCache(10, &mockCache{data: map[string][]byte{
-					"key1": []byte("value1"),
-					"key2": []byte("value2"),
-					"key3": []byte("value3"),
-				}})
-				ret.keys = list.NewLinkedListOf[string]([]string{"key3"})
-				ret.used = 6
-				return ret
+				return newTestMaxMemoryCache(t, 10, "key3", "value3")
 			},
 			key:      "key4",
 			val:      []byte("value4"),
@@ -87,33 +74,121 @@ func TestMaxMemoryCache_Set(t *testing.T) {
 			//進行淘汰多次
 			name: "multi-delete",
 			cache: func() *MaxMemoryCache {
-				ret := NewMaxMemoryCache(25, &mockCache{data: map[string][]byte{
-					"key1": []byte("value1"),
-					"key2": []byte("value2"),
-					"key3": []byte("value3"),
-				}})
-				ret.keys = list.NewLinkedListOf[string]([]string{"key1", "key2", "key3"})
-				ret.used = 18
-				return ret
+				return newTestMaxMemoryCache(t, 25, "key1", "value1", "key2", "value2", "key3", "value3")
 			},
 			key:      "key4",
 			val:      []byte("value4, value4, value4"),
 			wantKeys: []string{"key4"},
 			wantUsed: 22,
 		},
+		{
+			// 只淘汰最久沒有使用的
+			name: "lru",
+			cache: func() *MaxMemoryCache {
+				ret := newTestMaxMemoryCache(t, 18, "key1", "value1", "key2", "value2", "key3", "value3")
+				_, err := ret.Get(context.Background(), "key1")
+				require.NoError(t, err)
+				return ret
+			},
+			key:      "key4",
+			val:      []byte("value4"),
+			wantKeys: []string{"key3", "key1", "key4"},
+			wantUsed: 18,
+		},
+		{
+			name: "too large",
+			cache: func() *MaxMemoryCache {
+				return newTestMaxMemoryCache(t, 10, "key1", "value1")
+			},
+			key:      "key2",
+			val:      []byte("value2-too-large"),
+			wantKeys: []string{"key1"},
+			wantErr:  fmt.Errorf("%w, key: key2, size: 16, max: 10", errEntryTooLarge),
+			wantUsed: 6,
+		},
+		{
+			name: "set failed",
+			cache: func() *MaxMemoryCache {
+				ret := newTestMaxMemoryCache(t, 10, "key1", "value1")
+				ret.Cache.(*mockCache).setErr = errors.New("set failed")
+				return ret
+			},
+			key:      "key1",
+			val:      []byte("val1"),
+			wantKeys: []string{},
+			wantErr:  errors.New("set failed"),
+			wantUsed: 0,
+		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			cache := tc.cache()
 			err := cache.Set(context.Background(), tc.key, tc.val, time.Minute)
-			assert.Equal(t, tc.wantKeys, cache.keys.AsSlice())
+			assert.Equal(t, tc.wantKeys, lruKeys(cache))
 			assert.Equal(t, tc.wantErr, err)
 			assert.Equal(t, tc.wantUsed, cache.used)
 		})
 	}
 }
 
+func TestMaxMemoryCache_Sizer(t *testing.T) {
+	ctx := context.Background()
+	cache := NewMaxMemoryCache(EntryOverhead*2+10, &mockCache{data: map[string][]byte{}},
+		MaxMemoryCacheWithSizer(EntrySizer))
+	require.NoError(t, cache.Set(ctx, "key1", []byte("value1"), 0))
+	assert.Equal(t, int64(EntryOverhead+10), cache.Used())
+	// 計算 key 的大小之後放不下兩個
+	require.NoError(t, cache.Set(ctx, "key2", []byte("value2"), 0))
+	assert.Equal(t, []string{"key2"}, lruKeys(cache))
+	assert.Equal(t, int64(EntryOverhead+10), cache.Used())
+}
+
+func TestMaxMemoryCache_SoftLimit(t *testing.T) {
+	ctx := context.Background()
+	cache := NewMaxMemoryCache(30, &mockCache{data: map[string][]byte{}},
+		MaxMemoryCacheWithSoftLimit(20, 10))
+	defer cache.Close()
+	// 沒有超過軟限制
+	require.NoError(t, cache.Set(ctx, "key1", []byte("value1"), 0))
+	require.NoError(t, cache.Set(ctx, "key2", []byte("value2"), 0))
+	require.NoError(t, cache.Set(ctx, "key3", []byte("value3"), 0))
+	assert.Equal(t, int64(18), cache.Used())
+	// 超過軟限制，寫入不會同步淘汰，後台淘汰到 10 以下
+	require.NoError(t, cache.Set(ctx, "key4", []byte("value4"), 0))
+	assert.Eventually(t, func() bool {
+		return cache.Used() <= 10
+	}, time.Second, time.Millisecond*10)
+	cache.mutex.Lock()
+	assert.Equal(t, []string{"key4"}, lruKeys(cache))
+	cache.mutex.Unlock()
+
+	assert.Panics(t, func() {
+		NewMaxMemoryCache(30, &mockCache{}, MaxMemoryCacheWithSoftLimit(40, 10))
+	})
+	assert.Panics(t, func() {
+		NewMaxMemoryCache(30, &mockCache{}, MaxMemoryCacheWithSoftLimit(20, 25))
+	})
+}
+
+// newTestMaxMemoryCache kvs 為依次寫入的 key 和 value
+func newTestMaxMemoryCache(t *testing.T, max int64, kvs ...string) *MaxMemoryCache {
+	ret := NewMaxMemoryCache(max, &mockCache{data: map[string][]byte{}})
+	for i := 0; i < len(kvs); i += 2 {
+		require.NoError(t, ret.Set(context.Background(), kvs[i], []byte(kvs[i+1]), time.Minute))
+	}
+	return ret
+}
+
+// lruKeys 從最久沒有使用的開始
+func lruKeys(m *MaxMemoryCache) []string {
+	res := make([]string, 0, m.lru.Len())
+	for e := m.lru.Front(); e != nil; e = e.Next() {
+		res = append(res, e.Value.(string))
+	}
+	return res
+}
+
 func TestMaxMemoryCache_Get(t *testing.T) {
 	testCases := []struct {
 		name  string
@@ -152,14 +227,76 @@ func TestMaxMemoryCache_Get(t *testing.T) {
 			cache := tc.cache()
 			_, err := cache.Get(context.Background(), tc.key)
 			assert.Equal(t, tc.wantErr, err)
-			assert.Equal(t, tc.wantKeys, cache.keys.AsSlice())
+			assert.Equal(t, tc.wantKeys, lruKeys(cache))
 		})
 	}
 }
 
+func TestMaxMemoryCache_Stats(t *testing.T) {
+	ctx := context.Background()
+	cache := NewMaxMemoryCache(15, &mockCache{data: map[string][]byte{}})
+	assert.NoError(t, cache.Set(ctx, "key1", []byte("value1"), time.Minute))
+	assert.NoError(t, cache.Set(ctx, "key2", []byte("value2"), time.Minute))
+	for i := 0; i < 2; i++ {
+		_, err := cache.Get(ctx, "key2")
+		assert.NoError(t, err)
+	}
+	_, err := cache.Get(ctx, "key9")
+	assert.Equal(t, errNotFound, err)
+	// 淘汰 key1
+	assert.NoError(t, cache.Set(ctx, "key3", []byte("value3"), time.Minute))
+
+	assert.Equal(t, stats.Stats{
+		Hits:      2,
+		Misses:    1,
+		Sets:      3,
+		Evictions: 1,
+		Keys:      2,
+		UsedBytes: 12,
+		MaxBytes:  15,
+	}, cache.Stats())
+	assert.Equal(t, int64(12), cache.Used())
+	assert.Equal(t, []stats.KeyInfo{
+		{Key: "key2", Size: 6, Accesses: 2},
+		{Key: "key3", Size: 6},
+	}, stats.TopKeys(cache.KeyStats(), stats.OrderByAccesses, 10))
+}
+
+func TestMaxMemoryCache_Subscribe(t *testing.T) {
+	ctx := context.Background()
+	mock := &mockCache{data: map[string][]byte{}}
+	cache := NewMaxMemoryCache(10, mock)
+	sub := cache.Subscribe()
+	assert.NoError(t, cache.Set(ctx, "key1", []byte("value1"), time.Minute))
+	// 覆蓋只有 TypeSet
+	assert.NoError(t, cache.Set(ctx, "key1", []byte("val1"), time.Minute))
+	assert.NoError(t, cache.Set(ctx, "key2", []byte("value2"), time.Minute))
+	// 淘汰 key1
+	assert.NoError(t, cache.Set(ctx, "key3", []byte("v3"), time.Minute))
+	assert.NoError(t, cache.Delete(ctx, "key2"))
+	// 底層 Cache 過期刪除
+	mock.f("key3", []byte("v3"))
+	assert.NoError(t, cache.Close())
+
+	var events []Event
+	for e := range sub.Events() {
+		events = append(events, e)
+	}
+	assert.Equal(t, []Event{
+		{Key: "key1", Val: []byte("value1"), Type: event.TypeSet},
+		{Key: "key1", Val: []byte("val1"), Type: event.TypeSet},
+		{Key: "key2", Val: []byte("value2"), Type: event.TypeSet},
+		{Key: "key1", Val: []byte("val1"), Type: event.TypeEvict},
+		{Key: "key3", Val: []byte("v3"), Type: event.TypeSet},
+		{Key: "key2", Val: []byte("value2"), Type: event.TypeDelete},
+		{Key: "key3", Val: []byte("v3"), Type: event.TypeExpire},
+	}, events)
+}
+
 type mockCache struct {
-	f    func(key string, val []byte)
-	data map[string][]byte
+	f      func(key string, val []byte)
+	data   map[string][]byte
+	setErr error
 }
 
 func (m *mockCache) Get(ctx context.Context, key string) ([]byte, error) {
@@ -171,6 +308,9 @@ func (m *mockCache) Get(ctx context.Context, key string) ([]byte, error) {
 }
 
 func (m *mockCache) Set(ctx context.Context, key string, val []byte, expiration time.Duration) error {
+	if m.setErr != nil {
+		return m.setErr
+	}
 	m.data[key] = val
 	return nil
 }
@@ -196,3 +336,106 @@ func (m *mockCache) LoadAndDelete(ctx context.Context, key string) ([]byte, erro
 func (m *mockCache) OnEvicted(f func(key string, val []byte)) {
 	m.f = f
 }
+
+// TestMaxMemoryCache_AsyncExpire 底層 Cache 在自己的 goroutine 過期刪除，需要配合 -race 運行
+func TestMaxMemoryCache_AsyncExpire(t *testing.T) {
+	ctx := context.Background()
+	mock := &asyncMockCache{data: map[string][]byte{}, expired: make(chan string, 1024)}
+	cache := NewMaxMemoryCache(10000, mock)
+	sub := cache.Subscribe(event.SubscribeWithTypes(event.TypeExpire), event.SubscribeWithBuffer(1024))
+	done := make(chan struct{})
+	go mock.expire(done)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				key := fmt.Sprintf("key%d-%d", i, j)
+				assert.NoError(t, cache.Set(ctx, key, []byte("value"), time.Minute))
+				mock.expired <- key
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(mock.expired)
+	<-done
+
+	assert.Equal(t, int64(0), cache.Used())
+	res := cache.Stats()
+	assert.Equal(t, 0, res.Keys)
+	assert.Equal(t, uint64(400), res.Expirations)
+	assert.NoError(t, cache.Close())
+	cnt := 0
+	for range sub.Events() {
+		cnt++
+	}
+	assert.Equal(t, 400, cnt)
+}
+
+// asyncMockCache 過期刪除在 expire 的 goroutine 裡面調用回調，不持有 MaxMemoryCache 的鎖
+type asyncMockCache struct {
+	mu      sync.Mutex
+	f       func(key string, val []byte)
+	data    map[string][]byte
+	expired chan string
+}
+
+func (m *asyncMockCache) expire(done chan struct{}) {
+	defer close(done)
+	for key := range m.expired {
+		m.mu.Lock()
+		val, ok := m.data[key]
+		delete(m.data, key)
+		f := m.f
+		m.mu.Unlock()
+		if ok {
+			f(key, val)
+		}
+	}
+}
+
+func (m *asyncMockCache) Get(ctx context.Context, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	val, ok := m.data[key]
+	if ok {
+		return val, nil
+	}
+	return nil, errNotFound
+}
+
+func (m *asyncMockCache) Set(ctx context.Context, key string, val []byte, expiration time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data[key] = val
+	return nil
+}
+
+func (m *asyncMockCache) Delete(ctx context.Context, key string) error {
+	_, err := m.LoadAndDelete(ctx, key)
+	if err == errNotFound {
+		return nil
+	}
+	return err
+}
+
+func (m *asyncMockCache) LoadAndDelete(ctx context.Context, key string) ([]byte, error) {
+	m.mu.Lock()
+	val, ok := m.data[key]
+	delete(m.data, key)
+	f := m.f
+	m.mu.Unlock()
+	if !ok {
+		return nil, errNotFound
+	}
+	f(key, val)
+	return val, nil
+}
+
+func (m *asyncMockCache) OnEvicted(f func(key string, val []byte)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.f = f
+}
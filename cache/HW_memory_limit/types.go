@@ -2,6 +2,7 @@ package cache
 
 import (
 	"context"
+	"geektime-go/cache/event"
 	"time"
 )
 
@@ -25,12 +26,40 @@ type CacheV1 interface {
 
 	LoadAndDelete(ctx context.Context, key string) ([]byte, error)
 
-	Subscribe() <-chan Event
+	// Subscribe 訂閱數據變更，不再需要的時候調用 Subscription.Close
+	Subscribe(opts ...event.SubscribeOption) *event.Subscription
 }
 
-type Event struct {
-	Key string
-	Val any
-	// 增删改查
-	Type int
+// Event 數據變更的事件，Type 為 event.TypeSet、TypeDelete、TypeExpire、TypeEvict
+type Event = event.Event
+
+type EventType = event.Type
+
+// NoExpiration TTL 返回的值，表示 key 沒有過期時間
+const NoExpiration time.Duration = -1
+
+// BatchCache 批量操作，語義和 geektime-go/cache 的 BatchCache 一樣
+type BatchCache interface {
+	// MGet 只返回存在的 key
+	MGet(ctx context.Context, keys ...string) (map[string][]byte, error)
+	MSet(ctx context.Context, entries map[string][]byte, expiration time.Duration) error
+	MDelete(ctx context.Context, keys ...string) (int, error)
+}
+
+// AtomicCache 原子的讀改寫操作，Incr 的值以十進制字符串保存，和 Redis 一樣
+type AtomicCache interface {
+	SetNX(ctx context.Context, key string, val []byte, expiration time.Duration) (bool, error)
+	GetAndSet(ctx context.Context, key string, val []byte, expiration time.Duration) (old []byte, loaded bool, err error)
+	GetWithVersion(ctx context.Context, key string) ([]byte, uint64, error)
+	// CompareAndSwap version 為 0 表示 key 不存在的時候才寫入
+	CompareAndSwap(ctx context.Context, key string, version uint64, val []byte, expiration time.Duration) (bool, error)
+	Incr(ctx context.Context, key string, delta int64) (int64, error)
+	Decr(ctx context.Context, key string, delta int64) (int64, error)
+}
+
+type TTLCache interface {
+	// TTL 沒有過期時間返回 NoExpiration
+	TTL(ctx context.Context, key string) (time.Duration, error)
+	Expire(ctx context.Context, key string, expiration time.Duration) (bool, error)
+	Persist(ctx context.Context, key string) (bool, error)
 }
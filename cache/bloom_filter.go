@@ -0,0 +1,197 @@
+package cache
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"sync"
+)
+
+var (
+	errInvalidBloomFilter  = errors.New("cache: 布隆過濾器數據不合法")
+	errBloomFilterMismatch = errors.New("cache: 布隆過濾器的大小或者哈希函數數量不一致")
+)
+
+// Filter 判斷 key 是否可能存在
+// Contains 返回 false 表示 key 一定不存在，返回 true 表示可能存在
+type Filter interface {
+	Add(key string)
+	Contains(key string) bool
+}
+
+var _ Filter = (*BloomFilter)(nil)
+
+// BloomFilter 布隆過濾器，用於防止緩存穿透
+// 數據源裡面所有的 key 都要加進來，之後 Contains 返回 false 的 key 就不需要再查數據源
+//
+//	f := NewBloomFilterWithEstimates(1_000_000, 0.01)
+//	c := NewReadThroughCache(cache, load, time.Minute, ReadThroughCacheWithFilter(f))
+type BloomFilter struct {
+	mu   sync.RWMutex
+	bits []uint64
+	// m 為位數，k 為哈希函數的數量
+	m uint64
+	k uint64
+}
+
+// NewBloomFilter m 為位數，k 為哈希函數的數量
+func NewBloomFilter(m uint64, k uint64) *BloomFilter {
+	if m == 0 {
+		m = 1
+	}
+	if k == 0 {
+		k = 1
+	}
+	return &BloomFilter{
+		bits: make([]uint64, (m+63)/64),
+		m:    m,
+		k:    k,
+	}
+}
+
+// NewBloomFilterWithEstimates n 為預計的元素數量，fp 為期望的誤判率
+func NewBloomFilterWithEstimates(n uint64, fp float64) *BloomFilter {
+	return NewBloomFilter(EstimateBloomFilter(n, fp))
+}
+
+// EstimateBloomFilter 按照預計的元素數量和期望的誤判率計算位數和哈希函數的數量
+//
+//	m = -n * ln(fp) / ln(2)^2
+//	k = m / n * ln(2)
+func EstimateBloomFilter(n uint64, fp float64) (m uint64, k uint64) {
+	if n == 0 {
+		n = 1
+	}
+	if fp <= 0 || fp >= 1 {
+		fp = 0.01
+	}
+	m = uint64(math.Ceil(-float64(n) * math.Log(fp) / (math.Ln2 * math.Ln2)))
+	k = uint64(math.Max(1, math.Round(float64(m)/float64(n)*math.Ln2)))
+	return m, k
+}
+
+func (b *BloomFilter) Add(key string) {
+	h1, h2 := bloomHash(key)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i := uint64(0); i < b.k; i++ {
+		idx := (h1 + i*h2) % b.m
+		b.bits[idx/64] |= 1 << (idx % 64)
+	}
+}
+
+func (b *BloomFilter) Contains(key string) bool {
+	h1, h2 := bloomHash(key)
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for i := uint64(0); i < b.k; i++ {
+		idx := (h1 + i*h2) % b.m
+		if b.bits[idx/64]&(1<<(idx%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Merge 合併另一個過濾器，合併之後包含兩者所有的 key
+// 兩者的位數和哈希函數的數量必須一樣
+func (b *BloomFilter) Merge(other *BloomFilter) error {
+	other.mu.RLock()
+	m, k := other.m, other.k
+	bits := make([]uint64, len(other.bits))
+	copy(bits, other.bits)
+	other.mu.RUnlock()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.m != m || b.k != k {
+		return errBloomFilterMismatch
+	}
+	for i, w := range bits {
+		b.bits[i] |= w
+	}
+	return nil
+}
+
+// MarshalBinary 序列化，可以持久化下來，重啟的時候不需要掃描數據源重建
+func (b *BloomFilter) MarshalBinary() ([]byte, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	res := make([]byte, bloomHeaderLen+len(b.bits)*8)
+	putBloomHeader(res, bloomMagic, b.m, b.k)
+	for i, w := range b.bits {
+		binary.BigEndian.PutUint64(res[bloomHeaderLen+i*8:], w)
+	}
+	return res, nil
+}
+
+func (b *BloomFilter) UnmarshalBinary(data []byte) error {
+	m, k, err := parseBloomHeader(data, bloomMagic)
+	if err != nil {
+		return err
+	}
+	// 先檢查 m 再計算 words，避免 m 接近 2^64 的時候溢出
+	if m > uint64(len(data)-bloomHeaderLen)*8 {
+		return errInvalidBloomFilter
+	}
+	words := (m + 63) / 64
+	if uint64(len(data)-bloomHeaderLen) != words*8 {
+		return errInvalidBloomFilter
+	}
+	bits := make([]uint64, words)
+	for i := range bits {
+		bits[i] = binary.BigEndian.Uint64(data[bloomHeaderLen+i*8:])
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.bits, b.m, b.k = bits, m, k
+	return nil
+}
+
+const (
+	bloomMagic         = "BF01"
+	countingBloomMagic = "CB01"
+	// magic + m + k
+	bloomHeaderLen = 4 + 8 + 8
+	// maxBloomHashes 誤判率為 2^-64 的時候需要的哈希函數數量，反序列化的時候超過就認為數據損壞
+	maxBloomHashes = 64
+)
+
+func putBloomHeader(data []byte, magic string, m, k uint64) {
+	copy(data, magic)
+	binary.BigEndian.PutUint64(data[4:], m)
+	binary.BigEndian.PutUint64(data[12:], k)
+}
+
+func parseBloomHeader(data []byte, magic string) (m uint64, k uint64, err error) {
+	if len(data) < bloomHeaderLen || string(data[:4]) != magic {
+		return 0, 0, errInvalidBloomFilter
+	}
+	m = binary.BigEndian.Uint64(data[4:])
+	k = binary.BigEndian.Uint64(data[12:])
+	if m == 0 || k == 0 || k > maxBloomHashes {
+		return 0, 0, errInvalidBloomFilter
+	}
+	return m, k, nil
+}
+
+// bloomHash 用兩個哈希值模擬 k 個哈希函數: g_i = h1 + i * h2
+// 參考 Less Hashing, Same Performance: Building a Better Bloom Filter
+func bloomHash(key string) (uint64, uint64) {
+	const (
+		offset = 14695981039346656037
+		prime  = 1099511628211
+	)
+	h := uint64(offset)
+	for i := 0; i < len(key); i++ {
+		h ^= uint64(key[i])
+		h *= prime
+	}
+	// splitmix64 的 finalizer，從 h 得到第二個哈希值
+	h2 := h + 0x9e3779b97f4a7c15
+	h2 = (h2 ^ (h2 >> 30)) * 0xbf58476d1ce4e5b9
+	h2 = (h2 ^ (h2 >> 27)) * 0x94d049bb133111eb
+	h2 ^= h2 >> 31
+	// 保證是奇數，避免 h2 為 0 的時候所有哈希函數都一樣
+	return h, h2 | 1
+}
@@ -0,0 +1,112 @@
+package cache
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestEstimateBloomFilter(t *testing.T) {
+	testCases := []struct {
+		name  string
+		n     uint64
+		fp    float64
+		wantM uint64
+		wantK uint64
+	}{
+		{name: "1%", n: 1000, fp: 0.01, wantM: 9586, wantK: 7},
+		{name: "0.1%", n: 1000, fp: 0.001, wantM: 14378, wantK: 10},
+		{name: "invalid fp", n: 1000, fp: 0, wantM: 9586, wantK: 7},
+		{name: "zero n", n: 0, fp: 0.01, wantM: 10, wantK: 7},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, k := EstimateBloomFilter(tc.n, tc.fp)
+			assert.Equal(t, tc.wantM, m)
+			assert.Equal(t, tc.wantK, k)
+		})
+	}
+}
+
+func TestBloomFilter(t *testing.T) {
+	const n = 10000
+	f := NewBloomFilterWithEstimates(n, 0.01)
+	for i := 0; i < n; i++ {
+		f.Add("user:" + strconv.Itoa(i))
+	}
+	// 不會漏判
+	for i := 0; i < n; i++ {
+		require.True(t, f.Contains("user:"+strconv.Itoa(i)))
+	}
+	// 誤判率接近 1%
+	fp := 0
+	for i := n; i < n*11; i++ {
+		if f.Contains("user:" + strconv.Itoa(i)) {
+			fp++
+		}
+	}
+	assert.Less(t, float64(fp)/float64(n*10), 0.02)
+}
+
+func TestBloomFilter_Merge(t *testing.T) {
+	a, b := NewBloomFilter(1024, 3), NewBloomFilter(1024, 3)
+	a.Add("key1")
+	b.Add("key2")
+	require.NoError(t, a.Merge(b))
+	assert.True(t, a.Contains("key1"))
+	assert.True(t, a.Contains("key2"))
+	assert.False(t, b.Contains("key1"))
+
+	assert.Equal(t, errBloomFilterMismatch, a.Merge(NewBloomFilter(1024, 4)))
+	assert.Equal(t, errBloomFilterMismatch, a.Merge(NewBloomFilter(2048, 3)))
+}
+
+func TestBloomFilter_Marshal(t *testing.T) {
+	f := NewBloomFilter(1000, 5)
+	for i := 0; i < 100; i++ {
+		f.Add(strconv.Itoa(i))
+	}
+	data, err := f.MarshalBinary()
+	require.NoError(t, err)
+
+	var res BloomFilter
+	require.NoError(t, res.UnmarshalBinary(data))
+	assert.Equal(t, f.m, res.m)
+	assert.Equal(t, f.k, res.k)
+	assert.Equal(t, f.bits, res.bits)
+	for i := 0; i < 100; i++ {
+		assert.True(t, res.Contains(strconv.Itoa(i)))
+	}
+
+	testCases := []struct {
+		name string
+		data []byte
+	}{
+		{name: "empty", data: nil},
+		{name: "counting", data: func() []byte {
+			data, _ := NewCountingBloomFilter(1000, 5).MarshalBinary()
+			return data
+		}()},
+		{name: "truncated", data: data[:len(data)-1]},
+		// m = 2^64-1 的時候 (m+63)/64 溢出為 0，只有頭部也不能通過檢查
+		{name: "overflow m", data: corruptBloomHeader(math.MaxUint64, 5)[:bloomHeaderLen]},
+		{name: "overflow m with payload", data: corruptBloomHeader(math.MaxUint64, 5)},
+		{name: "m too large", data: corruptBloomHeader(65, 5)},
+		{name: "zero k", data: corruptBloomHeader(64, 0)},
+		{name: "k too large", data: corruptBloomHeader(64, maxBloomHashes+1)},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, errInvalidBloomFilter, new(BloomFilter).UnmarshalBinary(tc.data))
+		})
+	}
+}
+
+// corruptBloomHeader 只有一個 uint64 的數據，頭部的 m 和 k 由參數指定
+func corruptBloomHeader(m, k uint64) []byte {
+	data := make([]byte, bloomHeaderLen+8)
+	putBloomHeader(data, bloomMagic, m, k)
+	return data
+}
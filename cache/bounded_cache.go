@@ -0,0 +1,145 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	errEntryTooLarge = errors.New("cache: entry weight exceeds capacity")
+)
+
+// BoundedCache 有容量上限的本地緩存，超出上限的時候按照 EvictionPolicy 淘汰
+// 預設每個 key 的權重為 1，也就是按照 key 的數量限制
+// 透過 BoundedCacheWithWeigher 可以改成按照字節數等權重限制
+// 過期的 key 在 Get 的時候刪除
+type BoundedCache struct {
+	// Get 也會修改淘汰策略的狀態，所以不能用讀寫鎖
+	mu        sync.Mutex
+	data      map[string]*boundedItem
+	policy    EvictionPolicy
+	maxWeight int64
+	weight    int64
+	weigher   func(key string, val any) int64
+	onEvicted func(key string, val any)
+}
+
+type boundedItem struct {
+	item
+	weight int64
+}
+
+type BoundedCacheOption func(cache *BoundedCache)
+
+// NewBoundedCache maxWeight 為權重上限，預設為 key 的數量上限
+func NewBoundedCache(maxWeight int64, policy EvictionPolicy, opts ...BoundedCacheOption) *BoundedCache {
+	res := &BoundedCache{
+		data:      make(map[string]*boundedItem, 100),
+		policy:    policy,
+		maxWeight: maxWeight,
+		weigher: func(key string, val any) int64 {
+			return 1
+		},
+		onEvicted: func(key string, val any) {},
+	}
+	for _, opt := range opts {
+		opt(res)
+	}
+	return res
+}
+
+// BoundedCacheWithWeigher 計算每個 key 的權重，e.g. 按照值的字節數
+func BoundedCacheWithWeigher(f func(key string, val any) int64) BoundedCacheOption {
+	return func(cache *BoundedCache) {
+		cache.weigher = f
+	}
+}
+
+func BoundedCacheWithOnEvictedCallback(f func(key string, val any)) BoundedCacheOption {
+	return func(cache *BoundedCache) {
+		cache.onEvicted = f
+	}
+}
+
+func (b *BoundedCache) Set(ctx context.Context, key string, value any, expiration time.Duration) error {
+	w := b.weigher(key, value)
+	if w > b.maxWeight {
+		return fmt.Errorf("%w, key: %s", errEntryTooLarge, key)
+	}
+	var dl time.Time
+	if expiration > 0 {
+		dl = time.Now().Add(expiration)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if itm, ok := b.data[key]; ok {
+		b.weight = b.weight - itm.weight + w
+		itm.val, itm.deadline, itm.weight = value, dl, w
+		b.policy.Access(key)
+	} else {
+		b.data[key] = &boundedItem{item: item{val: value, deadline: dl}, weight: w}
+		b.weight += w
+		b.policy.Add(key)
+	}
+	for b.weight > b.maxWeight {
+		victim, ok := b.policy.Evict()
+		if !ok {
+			break
+		}
+		b.delete(victim)
+	}
+	return nil
+}
+
+func (b *BoundedCache) Get(ctx context.Context, key string) (any, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	itm, ok := b.data[key]
+	if !ok {
+		return nil, fmt.Errorf("%w, key: %s", errKeyNotFound, key)
+	}
+	if itm.deadlineBefore(time.Now()) {
+		b.policy.Remove(key)
+		b.delete(key)
+		return nil, fmt.Errorf("%w, key: %s", errKeyNotFound, key)
+	}
+	b.policy.Access(key)
+	return itm.val, nil
+}
+
+func (b *BoundedCache) Delete(ctx context.Context, key string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.policy.Remove(key)
+	b.delete(key)
+	return nil
+}
+
+// Len 緩存中 key 的數量，包括已經過期但還沒被刪除的
+func (b *BoundedCache) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.data)
+}
+
+// Weight 當前的總權重
+func (b *BoundedCache) Weight() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.weight
+}
+
+// delete 只刪除數據，調用方負責維護淘汰策略
+func (b *BoundedCache) delete(key string) {
+	itm, ok := b.data[key]
+	if !ok {
+		return
+	}
+	delete(b.data, key)
+	b.weight -= itm.weight
+	b.onEvicted(key, itm.val)
+}
@@ -0,0 +1,289 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBoundedCache_Set(t *testing.T) {
+	testCases := []struct {
+		name  string
+		cache func(evicted *[]string) *BoundedCache
+		keys  []string
+		vals  []string
+
+		wantErr     error
+		wantEvicted []string
+		wantKeys    []string
+		wantWeight  int64
+	}{
+		{
+			name: "by count",
+			cache: func(evicted *[]string) *BoundedCache {
+				return NewBoundedCache(2, NewLRUPolicy(),
+					BoundedCacheWithOnEvictedCallback(func(key string, val any) {
+						*evicted = append(*evicted, key)
+					}))
+			},
+			keys:        []string{"key1", "key2", "key3"},
+			vals:        []string{"a", "b", "c"},
+			wantEvicted: []string{"key1"},
+			wantKeys:    []string{"key2", "key3"},
+			wantWeight:  2,
+		},
+		{
+			name: "override",
+			cache: func(evicted *[]string) *BoundedCache {
+				return NewBoundedCache(2, NewLRUPolicy(),
+					BoundedCacheWithOnEvictedCallback(func(key string, val any) {
+						*evicted = append(*evicted, key)
+					}))
+			},
+			keys:       []string{"key1", "key2", "key1"},
+			vals:       []string{"a", "b", "c"},
+			wantKeys:   []string{"key1", "key2"},
+			wantWeight: 2,
+		},
+		{
+			name: "by weight",
+			cache: func(evicted *[]string) *BoundedCache {
+				return NewBoundedCache(10, NewLRUPolicy(),
+					BoundedCacheWithWeigher(func(key string, val any) int64 {
+						return int64(len(val.(string)))
+					}),
+					BoundedCacheWithOnEvictedCallback(func(key string, val any) {
+						*evicted = append(*evicted, key)
+					}))
+			},
+			keys:        []string{"key1", "key2", "key3"},
+			vals:        []string{"value1", "val2", "value3"},
+			wantEvicted: []string{"key1"},
+			wantKeys:    []string{"key2", "key3"},
+			wantWeight:  10,
+		},
+		{
+			name: "too large",
+			cache: func(evicted *[]string) *BoundedCache {
+				return NewBoundedCache(4, NewLRUPolicy(),
+					BoundedCacheWithWeigher(func(key string, val any) int64 {
+						return int64(len(val.(string)))
+					}))
+			},
+			keys:    []string{"key1"},
+			vals:    []string{"value1"},
+			wantErr: fmt.Errorf("%w, key: %s", errEntryTooLarge, "key1"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var evicted []string
+			c := tc.cache(&evicted)
+			var err error
+			for i, key := range tc.keys {
+				err = c.Set(context.Background(), key, tc.vals[i], time.Minute)
+			}
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantEvicted, evicted)
+			assert.Equal(t, tc.wantWeight, c.Weight())
+			assert.Equal(t, len(tc.wantKeys), c.Len())
+			for _, key := range tc.wantKeys {
+				_, err = c.Get(context.Background(), key)
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestBoundedCache_Get(t *testing.T) {
+	evicted := 0
+	c := NewBoundedCache(2, NewLRUPolicy(),
+		BoundedCacheWithOnEvictedCallback(func(key string, val any) {
+			evicted++
+		}))
+	require.NoError(t, c.Set(context.Background(), "key1", 1, time.Millisecond))
+	require.NoError(t, c.Set(context.Background(), "key2", 2, 0))
+
+	time.Sleep(time.Millisecond * 10)
+	_, err := c.Get(context.Background(), "key1")
+	assert.Equal(t, fmt.Errorf("%w, key: %s", errKeyNotFound, "key1"), err)
+	assert.Equal(t, 1, evicted)
+	assert.Equal(t, int64(1), c.Weight())
+
+	val, err := c.Get(context.Background(), "key2")
+	require.NoError(t, err)
+	assert.Equal(t, 2, val)
+
+	require.NoError(t, c.Delete(context.Background(), "key2"))
+	assert.Equal(t, 0, c.Len())
+	assert.Equal(t, 2, evicted)
+}
+
+// 命中率基準測試，容量固定為 1000 個 key
+// 默認的 trace 都是生成的 (zipf、循環、zipf 加掃描)，只能用於比較不同策略的相對表現
+// 真實的 trace 透過環境變量 HIT_RATIO_TRACE 指定，多個文件用 os.PathListSeparator 分隔，格式見 loadTrace
+//
+//	go test -run none -bench BenchmarkHitRatio ./cache/
+//	HIT_RATIO_TRACE=/path/to/P1.lis:/path/to/sprite.trc go test -run none -bench BenchmarkHitRatio ./cache/
+func BenchmarkHitRatio(b *testing.B) {
+	const capacity = 1000
+	policies := []struct {
+		name   string
+		policy func() EvictionPolicy
+	}{
+		{name: "LRU", policy: func() EvictionPolicy { return NewLRUPolicy() }},
+		{name: "LFU", policy: func() EvictionPolicy { return NewLFUPolicy() }},
+		{name: "ARC", policy: func() EvictionPolicy { return NewARCPolicy(capacity) }},
+		{name: "W-TinyLFU", policy: func() EvictionPolicy { return NewTinyLFUPolicy(capacity) }},
+	}
+	traces := []struct {
+		name  string
+		trace []string
+	}{
+		{name: "zipf", trace: zipfTrace(1, 100000, 10000)},
+		// 循環掃描，key 的數量略大於容量，LRU 的最差情況
+		{name: "loop", trace: loopTrace(100000, capacity+capacity/5)},
+		// 熱點數據中間穿插一次性的掃描
+		{name: "zipf+scan", trace: scanTrace(2, 100000, 10000)},
+	}
+	if env := os.Getenv("HIT_RATIO_TRACE"); env != "" {
+		for _, path := range filepath.SplitList(env) {
+			trace, err := loadTrace(path)
+			if err != nil {
+				b.Fatal(err)
+			}
+			traces = append(traces, struct {
+				name  string
+				trace []string
+			}{name: filepath.Base(path), trace: trace})
+		}
+	}
+
+	for _, tr := range traces {
+		for _, p := range policies {
+			b.Run(tr.name+"/"+p.name, func(b *testing.B) {
+				var ratio float64
+				for i := 0; i < b.N; i++ {
+					ratio = hitRatio(NewBoundedCache(capacity, p.policy()), tr.trace)
+				}
+				b.ReportMetric(ratio*100, "hit%")
+			})
+		}
+	}
+}
+
+func TestLoadTrace(t *testing.T) {
+	dir := t.TempDir()
+	testCases := []struct {
+		name    string
+		content string
+		want    []string
+		wantErr bool
+	}{
+		{name: "arc", content: "100 3 0 1\n7 1 0 2\n", want: []string{"100", "101", "102", "7"}},
+		{name: "lirs", content: "*\n5\n\n6\n5\n", want: []string{"5", "6", "5"}},
+		{name: "invalid", content: "abc\n", wantErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(dir, tc.name)
+			require.NoError(t, os.WriteFile(path, []byte(tc.content), 0o644))
+			trace, err := loadTrace(path)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, trace)
+		})
+	}
+}
+
+// hitRatio 按照 trace 訪問緩存，沒有命中就寫入
+func hitRatio(c *BoundedCache, trace []string) float64 {
+	hits := 0
+	for _, key := range trace {
+		if _, err := c.Get(context.Background(), key); err == nil {
+			hits++
+			continue
+		}
+		_ = c.Set(context.Background(), key, key, 0)
+	}
+	return float64(hits) / float64(len(trace))
+}
+
+func zipfTrace(seed int64, n int, keys uint64) []string {
+	r := rand.New(rand.NewSource(seed))
+	z := rand.NewZipf(r, 1.01, 1, keys-1)
+	res := make([]string, n)
+	for i := range res {
+		res[i] = strconv.FormatUint(z.Uint64(), 10)
+	}
+	return res
+}
+
+func loopTrace(n int, keys int) []string {
+	res := make([]string, n)
+	for i := range res {
+		res[i] = strconv.Itoa(i % keys)
+	}
+	return res
+}
+
+func scanTrace(seed int64, n int, keys uint64) []string {
+	res := zipfTrace(seed, n, keys)
+	scan := 0
+	// 每 10000 次請求插入一段 2000 個只訪問一次的 key
+	for i := 0; i+2000 < len(res); i += 10000 {
+		for j := 0; j < 2000; j++ {
+			res[i+j] = "scan-" + strconv.Itoa(scan)
+			scan++
+		}
+	}
+	return res
+}
+
+// loadTrace 讀取 ARC 或者 LIRS 論文使用的 trace 文件，按行判斷格式
+//   - ARC (e.g. P1.lis)：每行為 "起始塊號 塊數 ..."，展開為連續的塊，後面的字段忽略
+//   - LIRS (e.g. sprite.trc)：每行一個塊號
+//
+// 空行和 "*" 開頭的行會被跳過
+func loadTrace(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var res []string
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "*") {
+			continue
+		}
+		start, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		cnt := uint64(1)
+		if len(fields) > 1 {
+			if cnt, err = strconv.ParseUint(fields[1], 10, 64); err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+			}
+		}
+		for i := uint64(0); i < cnt; i++ {
+			res = append(res, strconv.FormatUint(start+i, 10))
+		}
+	}
+	return res, scanner.Err()
+}
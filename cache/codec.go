@@ -0,0 +1,43 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+)
+
+// Codec 負責 T 和 []byte 之間的轉換
+// 用於把 CacheV2[T] 接到只支持 []byte 的緩存上，e.g. HW_memory_limit 的 Cache、Redis
+// protobuf 的實現在 codec/proto 裡面
+type Codec[T any] interface {
+	Encode(val T) ([]byte, error)
+	Decode(data []byte) (T, error)
+}
+
+type JSONCodec[T any] struct{}
+
+func (JSONCodec[T]) Encode(val T) ([]byte, error) {
+	return json.Marshal(val)
+}
+
+func (JSONCodec[T]) Decode(data []byte) (T, error) {
+	var res T
+	err := json.Unmarshal(data, &res)
+	return res, err
+}
+
+// GobCodec T 為接口的時候，需要先調用 gob.Register 註冊具體類型
+type GobCodec[T any] struct{}
+
+func (GobCodec[T]) Encode(val T) ([]byte, error) {
+	var buf bytes.Buffer
+	// 傳指針，T 為接口的時候 gob 才會寫入具體類型
+	err := gob.NewEncoder(&buf).Encode(&val)
+	return buf.Bytes(), err
+}
+
+func (GobCodec[T]) Decode(data []byte) (T, error) {
+	var res T
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&res)
+	return res, err
+}
@@ -0,0 +1,22 @@
+package proto
+
+import (
+	"google.golang.org/protobuf/proto"
+)
+
+// Codec 實現 cache.Codec，T 為 protobuf 生成的消息指針，e.g. *gen.User
+//
+//	c := cache.NewCodecCache[*gen.User](redisCache, proto.Codec[*gen.User]{})
+type Codec[T proto.Message] struct{}
+
+func (Codec[T]) Encode(val T) ([]byte, error) {
+	return proto.Marshal(val)
+}
+
+func (Codec[T]) Decode(data []byte) (T, error) {
+	var zero T
+	// 即使 zero 是 nil 指針，ProtoReflect 也能拿到消息類型
+	res := zero.ProtoReflect().New().Interface().(T)
+	err := proto.Unmarshal(data, res)
+	return res, err
+}
@@ -0,0 +1,66 @@
+package proto
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestCodec(t *testing.T) {
+	testCases := []struct {
+		name string
+		val  proto.Message
+		// 用具體的類型編碼再解碼
+		roundTrip func(val proto.Message) (proto.Message, error)
+	}{
+		{
+			name: "string",
+			val:  wrapperspb.String("hello"),
+			roundTrip: func(val proto.Message) (proto.Message, error) {
+				return roundTrip[*wrapperspb.StringValue](val.(*wrapperspb.StringValue))
+			},
+		},
+		{
+			name: "timestamp",
+			val:  timestamppb.New(time.Unix(1673776783, 123)),
+			roundTrip: func(val proto.Message) (proto.Message, error) {
+				return roundTrip[*timestamppb.Timestamp](val.(*timestamppb.Timestamp))
+			},
+		},
+		{
+			// 零值的消息編碼之後是空的，解碼之後也不是 nil
+			name: "empty",
+			val:  &wrapperspb.Int64Value{},
+			roundTrip: func(val proto.Message) (proto.Message, error) {
+				return roundTrip[*wrapperspb.Int64Value](val.(*wrapperspb.Int64Value))
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := tc.roundTrip(tc.val)
+			require.NoError(t, err)
+			assert.True(t, proto.Equal(tc.val, res), "want: %v, got: %v", tc.val, res)
+		})
+	}
+}
+
+func TestCodec_DecodeInvalid(t *testing.T) {
+	_, err := Codec[*wrapperspb.StringValue]{}.Decode([]byte{0xff})
+	assert.Error(t, err)
+}
+
+func roundTrip[T proto.Message](val T) (T, error) {
+	c := Codec[T]{}
+	data, err := c.Encode(val)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return c.Decode(data)
+}
@@ -0,0 +1,127 @@
+package cache
+
+import (
+	"context"
+	memlimit "geektime-go/cache/HW_memory_limit"
+	"time"
+)
+
+var _ CacheV2[any] = (*CodecCache[any])(nil)
+
+// CodecCache 把只支持 []byte 的緩存適配為 CacheV2[T]
+//
+//	c := NewCodecCache[User](NewMaxMemoryCache(1024, bytesCache), JSONCodec[User]{})
+type CodecCache[T any] struct {
+	cache memlimit.Cache
+	codec Codec[T]
+}
+
+func NewCodecCache[T any](cache memlimit.Cache, codec Codec[T]) *CodecCache[T] {
+	return &CodecCache[T]{cache: cache, codec: codec}
+}
+
+func (c *CodecCache[T]) Set(ctx context.Context, key string, value T, expiration time.Duration) error {
+	data, err := c.codec.Encode(value)
+	if err != nil {
+		return err
+	}
+	return c.cache.Set(ctx, key, data, expiration)
+}
+
+func (c *CodecCache[T]) Get(ctx context.Context, key string) (T, error) {
+	data, err := c.cache.Get(ctx, key)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return c.codec.Decode(data)
+}
+
+func (c *CodecCache[T]) Delete(ctx context.Context, key string) error {
+	return c.cache.Delete(ctx, key)
+}
+
+func (c *CodecCache[T]) LoadAndDelete(ctx context.Context, key string) (T, error) {
+	data, err := c.cache.LoadAndDelete(ctx, key)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return c.codec.Decode(data)
+}
+
+// OnEvicted 解碼失敗的值會被忽略
+func (c *CodecCache[T]) OnEvicted(f func(key string, val T)) {
+	c.cache.OnEvicted(func(key string, data []byte) {
+		if val, err := c.codec.Decode(data); err == nil {
+			f(key, val)
+		}
+	})
+}
+
+var _ memlimit.Cache = (*BytesCache[any])(nil)
+
+// BytesCache 把 CacheV2[T] 適配為 HW_memory_limit 的 Cache
+// 這樣 MaxMemoryCache 之類的裝飾器也可以用在 TypedCache 上面
+type BytesCache[T any] struct {
+	cache CacheV2[T]
+	codec Codec[T]
+}
+
+func NewBytesCache[T any](cache CacheV2[T], codec Codec[T]) *BytesCache[T] {
+	return &BytesCache[T]{cache: cache, codec: codec}
+}
+
+func (b *BytesCache[T]) Get(ctx context.Context, key string) ([]byte, error) {
+	val, err := b.cache.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return b.codec.Encode(val)
+}
+
+func (b *BytesCache[T]) Set(ctx context.Context, key string, data []byte, expiration time.Duration) error {
+	val, err := b.codec.Decode(data)
+	if err != nil {
+		return err
+	}
+	return b.cache.Set(ctx, key, val, expiration)
+}
+
+func (b *BytesCache[T]) Delete(ctx context.Context, key string) error {
+	return b.cache.Delete(ctx, key)
+}
+
+// LoadAndDelete 底層沒有實現 LoadAndDelete 的時候退化為 Get + Delete，不是原子操作
+func (b *BytesCache[T]) LoadAndDelete(ctx context.Context, key string) ([]byte, error) {
+	var (
+		val T
+		err error
+	)
+	if c, ok := b.cache.(interface {
+		LoadAndDelete(ctx context.Context, key string) (T, error)
+	}); ok {
+		val, err = c.LoadAndDelete(ctx, key)
+	} else if val, err = b.cache.Get(ctx, key); err == nil {
+		err = b.cache.Delete(ctx, key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return b.codec.Encode(val)
+}
+
+// OnEvicted 底層沒有實現 OnEvicted 的時候不會有任何效果，編碼失敗的值會被忽略
+func (b *BytesCache[T]) OnEvicted(f func(key string, val []byte)) {
+	c, ok := b.cache.(interface {
+		OnEvicted(func(key string, val T))
+	})
+	if !ok {
+		return
+	}
+	c.OnEvicted(func(key string, val T) {
+		if data, err := b.codec.Encode(val); err == nil {
+			f(key, data)
+		}
+	})
+}
@@ -0,0 +1,167 @@
+package cache
+
+import (
+	"context"
+	"encoding/gob"
+	memlimit "geektime-go/cache/HW_memory_limit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+type shape interface {
+	Area() int
+}
+
+type square struct {
+	Side int
+}
+
+func (s square) Area() int {
+	return s.Side * s.Side
+}
+
+func TestCodec(t *testing.T) {
+	gob.Register(square{})
+	testCases := []struct {
+		name  string
+		codec Codec[any]
+		val   any
+		want  any
+	}{
+		{
+			name:  "json",
+			codec: anyCodec[testUser]{c: JSONCodec[testUser]{}},
+			val:   testUser{Name: "Tom", Age: 18},
+			want:  testUser{Name: "Tom", Age: 18},
+		},
+		{
+			name:  "gob",
+			codec: anyCodec[testUser]{c: GobCodec[testUser]{}},
+			val:   testUser{Name: "Tom", Age: 18},
+			want:  testUser{Name: "Tom", Age: 18},
+		},
+		{
+			// 接口類型需要保留具體類型
+			name:  "gob interface",
+			codec: anyCodec[shape]{c: GobCodec[shape]{}},
+			val:   square{Side: 3},
+			want:  square{Side: 3},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := tc.codec.Encode(tc.val)
+			require.NoError(t, err)
+			val, err := tc.codec.Decode(data)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, val)
+		})
+	}
+}
+
+// anyCodec 把 Codec[T] 轉成 Codec[any]，方便放進同一個測試用例表
+type anyCodec[T any] struct {
+	c Codec[T]
+}
+
+func (a anyCodec[T]) Encode(val any) ([]byte, error) {
+	return a.c.Encode(val.(T))
+}
+
+func (a anyCodec[T]) Decode(data []byte) (any, error) {
+	return a.c.Decode(data)
+}
+
+func TestCodecCache(t *testing.T) {
+	bytesCache := &mapBytesCache{data: map[string][]byte{}}
+	c := NewCodecCache[testUser](memlimit.NewMaxMemoryCache(100, bytesCache), JSONCodec[testUser]{})
+	var evicted []string
+	c.OnEvicted(func(key string, val testUser) {
+		evicted = append(evicted, val.Name)
+	})
+	ctx := context.Background()
+
+	require.NoError(t, c.Set(ctx, "tom", testUser{Name: "Tom", Age: 18}, time.Minute))
+	assert.Equal(t, `{"Name":"Tom","Age":18}`, string(bytesCache.data["tom"]))
+	u, err := c.Get(ctx, "tom")
+	require.NoError(t, err)
+	assert.Equal(t, testUser{Name: "Tom", Age: 18}, u)
+
+	u, err = c.LoadAndDelete(ctx, "tom")
+	require.NoError(t, err)
+	assert.Equal(t, "Tom", u.Name)
+	assert.Equal(t, []string{"Tom"}, evicted)
+	_, err = c.Get(ctx, "tom")
+	assert.ErrorIs(t, err, errKeyNotFound)
+}
+
+func TestBytesCache(t *testing.T) {
+	local := NewLocalCache[testUser](time.Second)
+	defer func() {
+		_ = local.Unwrap().(*BuildInMapCache).Close()
+	}()
+	// MaxMemoryCache 透過 BytesCache 限制 TypedCache 的內存
+	c := memlimit.NewMaxMemoryCache(30, NewBytesCache[testUser](local, JSONCodec[testUser]{}))
+	ctx := context.Background()
+
+	// {"Name":"Tom","Age":18} 23 個字節
+	require.NoError(t, c.Set(ctx, "tom", []byte(`{"Name":"Tom","Age":18}`), time.Minute))
+	u, err := local.Get(ctx, "tom")
+	require.NoError(t, err)
+	assert.Equal(t, testUser{Name: "Tom", Age: 18}, u)
+
+	// 超出 30 個字節，淘汰 tom
+	require.NoError(t, c.Set(ctx, "jerry", []byte(`{"Name":"Jerry","Age":3}`), time.Minute))
+	_, err = local.Get(ctx, "tom")
+	assert.ErrorIs(t, err, errKeyNotFound)
+
+	data, err := c.LoadAndDelete(ctx, "jerry")
+	require.NoError(t, err)
+	assert.Equal(t, `{"Name":"Jerry","Age":3}`, string(data))
+
+	err = NewBytesCache[testUser](local, JSONCodec[testUser]{}).
+		Set(ctx, "bad", []byte("not json"), time.Minute)
+	assert.Error(t, err)
+}
+
+// mapBytesCache 最簡單的 []byte 緩存，不處理過期時間
+type mapBytesCache struct {
+	data      map[string][]byte
+	onEvicted func(key string, val []byte)
+}
+
+func (m *mapBytesCache) Get(ctx context.Context, key string) ([]byte, error) {
+	val, ok := m.data[key]
+	if !ok {
+		return nil, errKeyNotFound
+	}
+	return val, nil
+}
+
+func (m *mapBytesCache) Set(ctx context.Context, key string, val []byte, expiration time.Duration) error {
+	m.data[key] = val
+	return nil
+}
+
+func (m *mapBytesCache) Delete(ctx context.Context, key string) error {
+	_, err := m.LoadAndDelete(ctx, key)
+	return err
+}
+
+func (m *mapBytesCache) LoadAndDelete(ctx context.Context, key string) ([]byte, error) {
+	val, ok := m.data[key]
+	if !ok {
+		return nil, errKeyNotFound
+	}
+	delete(m.data, key)
+	if m.onEvicted != nil {
+		m.onEvicted(key, val)
+	}
+	return val, nil
+}
+
+func (m *mapBytesCache) OnEvicted(f func(key string, val []byte)) {
+	m.onEvicted = f
+}
@@ -0,0 +1,128 @@
+package cache
+
+import (
+	"sync"
+)
+
+var _ Filter = (*CountingBloomFilter)(nil)
+
+// CountingBloomFilter 每一位換成一個計數器，支持刪除
+// 計數器最大為 255，達到之後不再增加，也不會再減少，避免誤刪其他 key
+type CountingBloomFilter struct {
+	mu       sync.RWMutex
+	counters []uint8
+	m        uint64
+	k        uint64
+}
+
+// NewCountingBloomFilter m 為計數器的數量，k 為哈希函數的數量
+func NewCountingBloomFilter(m uint64, k uint64) *CountingBloomFilter {
+	if m == 0 {
+		m = 1
+	}
+	if k == 0 {
+		k = 1
+	}
+	return &CountingBloomFilter{
+		counters: make([]uint8, m),
+		m:        m,
+		k:        k,
+	}
+}
+
+// NewCountingBloomFilterWithEstimates n 為預計的元素數量，fp 為期望的誤判率
+func NewCountingBloomFilterWithEstimates(n uint64, fp float64) *CountingBloomFilter {
+	return NewCountingBloomFilter(EstimateBloomFilter(n, fp))
+}
+
+func (c *CountingBloomFilter) Add(key string) {
+	h1, h2 := bloomHash(key)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := uint64(0); i < c.k; i++ {
+		idx := (h1 + i*h2) % c.m
+		if c.counters[idx] < 255 {
+			c.counters[idx]++
+		}
+	}
+}
+
+// Remove 刪除 key，key 一定不存在的時候返回 false
+// 只能刪除加進來過的 key，否則會導致其他 key 被誤判為不存在
+func (c *CountingBloomFilter) Remove(key string) bool {
+	h1, h2 := bloomHash(key)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := uint64(0); i < c.k; i++ {
+		if c.counters[(h1+i*h2)%c.m] == 0 {
+			return false
+		}
+	}
+	for i := uint64(0); i < c.k; i++ {
+		idx := (h1 + i*h2) % c.m
+		if c.counters[idx] < 255 {
+			c.counters[idx]--
+		}
+	}
+	return true
+}
+
+func (c *CountingBloomFilter) Contains(key string) bool {
+	h1, h2 := bloomHash(key)
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for i := uint64(0); i < c.k; i++ {
+		if c.counters[(h1+i*h2)%c.m] == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Merge 計數器相加，兩者的計數器數量和哈希函數的數量必須一樣
+func (c *CountingBloomFilter) Merge(other *CountingBloomFilter) error {
+	other.mu.RLock()
+	m, k := other.m, other.k
+	counters := make([]uint8, len(other.counters))
+	copy(counters, other.counters)
+	other.mu.RUnlock()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.m != m || c.k != k {
+		return errBloomFilterMismatch
+	}
+	for i, cnt := range counters {
+		if sum := int(c.counters[i]) + int(cnt); sum < 255 {
+			c.counters[i] = uint8(sum)
+		} else {
+			c.counters[i] = 255
+		}
+	}
+	return nil
+}
+
+func (c *CountingBloomFilter) MarshalBinary() ([]byte, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	res := make([]byte, bloomHeaderLen+len(c.counters))
+	putBloomHeader(res, countingBloomMagic, c.m, c.k)
+	copy(res[bloomHeaderLen:], c.counters)
+	return res, nil
+}
+
+func (c *CountingBloomFilter) UnmarshalBinary(data []byte) error {
+	m, k, err := parseBloomHeader(data, countingBloomMagic)
+	if err != nil {
+		return err
+	}
+	if uint64(len(data)-bloomHeaderLen) != m {
+		return errInvalidBloomFilter
+	}
+	counters := make([]uint8, m)
+	copy(counters, data[bloomHeaderLen:])
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counters, c.m, c.k = counters, m, k
+	return nil
+}
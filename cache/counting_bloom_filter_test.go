@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strconv"
+	"testing"
+)
+
+func TestCountingBloomFilter(t *testing.T) {
+	f := NewCountingBloomFilterWithEstimates(1000, 0.01)
+	for i := 0; i < 1000; i++ {
+		f.Add(strconv.Itoa(i))
+	}
+	for i := 0; i < 500; i++ {
+		require.True(t, f.Remove(strconv.Itoa(i)))
+	}
+	// 刪除之後其他 key 照樣存在
+	for i := 500; i < 1000; i++ {
+		require.True(t, f.Contains(strconv.Itoa(i)))
+	}
+	removed := 0
+	for i := 0; i < 500; i++ {
+		if !f.Contains(strconv.Itoa(i)) {
+			removed++
+		}
+	}
+	assert.Greater(t, removed, 480)
+
+	// 一定不存在的 key 不會影響計數器
+	g := NewCountingBloomFilter(100, 3)
+	g.Add("key1")
+	assert.False(t, g.Remove("key2"))
+	assert.True(t, g.Contains("key1"))
+	assert.True(t, g.Remove("key1"))
+	assert.False(t, g.Contains("key1"))
+}
+
+func TestCountingBloomFilter_Saturate(t *testing.T) {
+	f := NewCountingBloomFilter(1, 1)
+	for i := 0; i < 300; i++ {
+		f.Add("key1")
+	}
+	assert.Equal(t, uint8(255), f.counters[0])
+	// 達到上限之後不再減少
+	assert.True(t, f.Remove("key1"))
+	assert.Equal(t, uint8(255), f.counters[0])
+}
+
+func TestCountingBloomFilter_Merge(t *testing.T) {
+	a, b := NewCountingBloomFilter(1024, 3), NewCountingBloomFilter(1024, 3)
+	a.Add("key1")
+	b.Add("key1")
+	b.Add("key2")
+	require.NoError(t, a.Merge(b))
+	assert.True(t, a.Contains("key2"))
+	// key1 加了兩次，刪除一次照樣存在
+	assert.True(t, a.Remove("key1"))
+	assert.True(t, a.Contains("key1"))
+	assert.Equal(t, errBloomFilterMismatch, a.Merge(NewCountingBloomFilter(1024, 4)))
+}
+
+func TestCountingBloomFilter_Marshal(t *testing.T) {
+	f := NewCountingBloomFilter(1000, 5)
+	f.Add("key1")
+	f.Add("key1")
+	data, err := f.MarshalBinary()
+	require.NoError(t, err)
+
+	var res CountingBloomFilter
+	require.NoError(t, res.UnmarshalBinary(data))
+	assert.Equal(t, f.counters, res.counters)
+	assert.True(t, res.Remove("key1"))
+	assert.True(t, res.Contains("key1"))
+
+	bf, err := NewBloomFilter(1000, 5).MarshalBinary()
+	require.NoError(t, err)
+	assert.Equal(t, errInvalidBloomFilter, res.UnmarshalBinary(bf))
+}
@@ -0,0 +1,253 @@
+// Package event 緩存數據變更的事件
+//
+//	sub := c.Subscribe(event.SubscribeWithPrefix("user:"), event.SubscribeWithBuffer(128))
+//	defer sub.Close()
+//	for e := range sub.Events() {
+//		log.Println(e.Type, e.Key)
+//	}
+package event
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Type 事件類型
+type Type int
+
+const (
+	// TypeSet 寫入或者覆蓋
+	TypeSet Type = iota + 1
+	// TypeDelete 用戶主動刪除
+	TypeDelete
+	// TypeExpire 過期被刪除
+	TypeExpire
+	// TypeEvict 容量不足被淘汰
+	TypeEvict
+)
+
+func (t Type) String() string {
+	switch t {
+	case TypeSet:
+		return "set"
+	case TypeDelete:
+		return "delete"
+	case TypeExpire:
+		return "expire"
+	case TypeEvict:
+		return "evict"
+	default:
+		return "unknown"
+	}
+}
+
+type Event struct {
+	Key string
+	// TypeSet 為新的值，其他為被刪除的值
+	Val  any
+	Type Type
+}
+
+// Policy 訂閱者的緩衝區滿了的時候怎麼處理
+type Policy int
+
+const (
+	// PolicyDrop 丟棄新的事件，不影響緩存的寫入
+	PolicyDrop Policy = iota
+	// PolicyBlock 阻塞發布事件的一方，直到緩衝區有空間或者訂閱被關閉
+	// 事件是在緩存的鎖裡面發布的，所以處理得慢會拖慢整個緩存，
+	// 而且不能在處理事件的 goroutine 裡面修改同一個緩存，否則會死鎖
+	PolicyBlock
+)
+
+// Bus 把事件分發給所有的訂閱者，同一個 Bus 發布的事件對每個訂閱者都是有序的
+type Bus struct {
+	mu     sync.RWMutex
+	subs   map[*Subscription]struct{}
+	closed bool
+	// 訂閱者的數量，沒有訂閱者的時候 Publish 不需要加鎖
+	count atomic.Int32
+}
+
+func NewBus() *Bus {
+	return &Bus{subs: make(map[*Subscription]struct{})}
+}
+
+type SubscribeOption func(sub *Subscription)
+
+// SubscribeWithBuffer 緩衝區大小，默認 64
+func SubscribeWithBuffer(size int) SubscribeOption {
+	return func(sub *Subscription) {
+		sub.buffer = size
+	}
+}
+
+// SubscribeWithPolicy 緩衝區滿了的時候的處理方式，默認 PolicyDrop
+func SubscribeWithPolicy(policy Policy) SubscribeOption {
+	return func(sub *Subscription) {
+		sub.policy = policy
+	}
+}
+
+// SubscribeWithPrefix 只接收 key 有這些前綴的事件
+func SubscribeWithPrefix(prefixes ...string) SubscribeOption {
+	return func(sub *Subscription) {
+		sub.prefixes = prefixes
+	}
+}
+
+// SubscribeWithTypes 只接收這些類型的事件
+func SubscribeWithTypes(types ...Type) SubscribeOption {
+	return func(sub *Subscription) {
+		sub.types = types
+	}
+}
+
+// Subscribe Bus 已經關閉的時候返回的訂閱已經被關閉
+func (b *Bus) Subscribe(opts ...SubscribeOption) *Subscription {
+	sub := &Subscription{
+		bus:    b,
+		buffer: 64,
+		done:   make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(sub)
+	}
+	sub.ch = make(chan Event, sub.buffer)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(sub.done)
+		close(sub.ch)
+		return sub
+	}
+	b.subs[sub] = struct{}{}
+	b.count.Add(1)
+	return sub
+}
+
+func (b *Bus) Publish(e Event) {
+	if b.count.Load() == 0 {
+		return
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for sub := range b.subs {
+		sub.deliver(e)
+	}
+}
+
+// Close 關閉所有的訂閱，之後的 Publish 不會有任何效果
+func (b *Bus) Close() error {
+	b.mu.RLock()
+	for sub := range b.subs {
+		sub.stop()
+	}
+	b.mu.RUnlock()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	for sub := range b.subs {
+		close(sub.ch)
+		delete(b.subs, sub)
+	}
+	b.count.Store(0)
+	return nil
+}
+
+func (b *Bus) unsubscribe(sub *Subscription) {
+	// 先讓阻塞在這個訂閱上的 Publish 返回，釋放讀鎖
+	sub.stop()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subs[sub]; !ok {
+		return
+	}
+	delete(b.subs, sub)
+	b.count.Add(-1)
+	close(sub.ch)
+}
+
+type Subscription struct {
+	bus      *Bus
+	ch       chan Event
+	buffer   int
+	policy   Policy
+	prefixes []string
+	types    []Type
+
+	done     chan struct{}
+	stopOnce sync.Once
+	dropped  atomic.Uint64
+}
+
+// Events 訂閱被關閉之後 channel 也會被關閉
+func (s *Subscription) Events() <-chan Event {
+	return s.ch
+}
+
+// Dropped PolicyDrop 下因為緩衝區滿了而丟棄的事件數量
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Close 取消訂閱，可以重複調用
+// 緩衝區裡面還沒有讀取的事件依舊可以讀到
+func (s *Subscription) Close() error {
+	s.bus.unsubscribe(s)
+	return nil
+}
+
+func (s *Subscription) stop() {
+	s.stopOnce.Do(func() {
+		close(s.done)
+	})
+}
+
+func (s *Subscription) match(e Event) bool {
+	if len(s.types) > 0 {
+		found := false
+		for _, t := range s.types {
+			if t == e.Type {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(s.prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range s.prefixes {
+		if strings.HasPrefix(e.Key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Subscription) deliver(e Event) {
+	if !s.match(e) {
+		return
+	}
+	if s.policy == PolicyBlock {
+		select {
+		case s.ch <- e:
+		case <-s.done:
+		}
+		return
+	}
+	select {
+	case s.ch <- e:
+	default:
+		s.dropped.Add(1)
+	}
+}
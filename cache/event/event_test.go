@@ -0,0 +1,133 @@
+package event
+
+import (
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBus_Subscribe(t *testing.T) {
+	bus := NewBus()
+	all := bus.Subscribe()
+	users := bus.Subscribe(SubscribeWithPrefix("user:", "admin:"))
+	deletes := bus.Subscribe(SubscribeWithTypes(TypeDelete, TypeExpire))
+
+	events := []Event{
+		{Key: "user:1", Val: "Tom", Type: TypeSet},
+		{Key: "order:1", Val: 100, Type: TypeSet},
+		{Key: "admin:1", Val: "Jerry", Type: TypeDelete},
+		{Key: "user:1", Val: "Tom", Type: TypeExpire},
+	}
+	for _, e := range events {
+		bus.Publish(e)
+	}
+	assert.Equal(t, events, drain(all))
+	assert.Equal(t, []Event{events[0], events[2], events[3]}, drain(users))
+	assert.Equal(t, []Event{events[2], events[3]}, drain(deletes))
+}
+
+func TestSubscription_Close(t *testing.T) {
+	bus := NewBus()
+	sub := bus.Subscribe()
+	bus.Publish(Event{Key: "key1", Type: TypeSet})
+	assert.NoError(t, sub.Close())
+	assert.NoError(t, sub.Close())
+	bus.Publish(Event{Key: "key2", Type: TypeSet})
+
+	// 關閉之前的事件依舊可以讀到，然後 channel 被關閉
+	e, ok := <-sub.Events()
+	assert.True(t, ok)
+	assert.Equal(t, "key1", e.Key)
+	_, ok = <-sub.Events()
+	assert.False(t, ok)
+	assert.Equal(t, int32(0), bus.count.Load())
+}
+
+func TestBus_Close(t *testing.T) {
+	bus := NewBus()
+	sub1 := bus.Subscribe()
+	sub2 := bus.Subscribe(SubscribeWithPolicy(PolicyBlock), SubscribeWithBuffer(0))
+	assert.NoError(t, bus.Close())
+	assert.NoError(t, sub1.Close())
+	_, ok := <-sub1.Events()
+	assert.False(t, ok)
+	_, ok = <-sub2.Events()
+	assert.False(t, ok)
+
+	// 關閉之後訂閱
+	sub3 := bus.Subscribe()
+	_, ok = <-sub3.Events()
+	assert.False(t, ok)
+	bus.Publish(Event{Key: "key1"})
+}
+
+func TestSubscription_Drop(t *testing.T) {
+	bus := NewBus()
+	sub := bus.Subscribe(SubscribeWithBuffer(2))
+	for i := 0; i < 5; i++ {
+		bus.Publish(Event{Key: "key", Val: i, Type: TypeSet})
+	}
+	assert.Equal(t, uint64(3), sub.Dropped())
+	// 保留最早的事件
+	assert.Equal(t, []Event{
+		{Key: "key", Val: 0, Type: TypeSet},
+		{Key: "key", Val: 1, Type: TypeSet},
+	}, drain(sub))
+}
+
+func TestSubscription_Block(t *testing.T) {
+	bus := NewBus()
+	sub := bus.Subscribe(SubscribeWithBuffer(1), SubscribeWithPolicy(PolicyBlock))
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 10; i++ {
+			bus.Publish(Event{Key: "key", Val: i, Type: TypeSet})
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		select {
+		case e := <-sub.Events():
+			assert.Equal(t, i, e.Val)
+		case <-time.After(time.Second):
+			t.Fatal("等待事件超時")
+		}
+	}
+	wg.Wait()
+	assert.Equal(t, uint64(0), sub.Dropped())
+
+	// 阻塞中的 Publish 在訂閱關閉之後返回
+	bus.Publish(Event{Key: "key", Type: TypeSet})
+	done := make(chan struct{})
+	go func() {
+		bus.Publish(Event{Key: "key", Type: TypeSet})
+		close(done)
+	}()
+	time.Sleep(time.Millisecond * 10)
+	assert.NoError(t, sub.Close())
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Publish 沒有返回")
+	}
+}
+
+func TestType_String(t *testing.T) {
+	assert.Equal(t, "set", TypeSet.String())
+	assert.Equal(t, "evict", TypeEvict.String())
+	assert.Equal(t, "unknown", Type(0).String())
+}
+
+func drain(sub *Subscription) []Event {
+	var res []Event
+	for {
+		select {
+		case e := <-sub.Events():
+			res = append(res, e)
+		default:
+			return res
+		}
+	}
+}
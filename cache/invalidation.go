@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var (
+	errTransportClosed = errors.New("cache: transport 已經關閉")
+)
+
+// Invalidation 失效通知，收到之後刪除本地緩存裡面的 Keys
+type Invalidation struct {
+	// Node 發出通知的節點，節點會忽略自己發出的通知
+	Node string   `json:"node"`
+	Keys []string `json:"keys"`
+}
+
+// Transport 在節點之間廣播失效通知
+type Transport interface {
+	// Publish 廣播給其他節點，實現可以選擇是否發給自己
+	Publish(ctx context.Context, msg Invalidation) error
+	// Subscribe 只能調用一次，Close 之後 channel 會被關閉
+	Subscribe() (<-chan Invalidation, error)
+	Close() error
+}
+
+// MemoryBroker 在進程內廣播，用於測試
+// 每個節點透過 NewTransport 拿到自己的 Transport
+type MemoryBroker struct {
+	mu         sync.RWMutex
+	transports map[*memoryTransport]struct{}
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{transports: map[*memoryTransport]struct{}{}}
+}
+
+func (m *MemoryBroker) NewTransport() Transport {
+	res := &memoryTransport{
+		broker: m,
+		ch:     make(chan Invalidation, 128),
+		closed: make(chan struct{}),
+	}
+	m.mu.Lock()
+	m.transports[res] = struct{}{}
+	m.mu.Unlock()
+	return res
+}
+
+type memoryTransport struct {
+	broker     *MemoryBroker
+	ch         chan Invalidation
+	subscribed bool
+	closeOnce  sync.Once
+	closed     chan struct{}
+}
+
+// Publish 發給所有節點，包括自己；某個節點處理不過來的時候會阻塞直到 ctx 結束
+func (m *memoryTransport) Publish(ctx context.Context, msg Invalidation) error {
+	select {
+	case <-m.closed:
+		return errTransportClosed
+	default:
+	}
+	m.broker.mu.RLock()
+	defer m.broker.mu.RUnlock()
+	for t := range m.broker.transports {
+		select {
+		case t.ch <- msg:
+		case <-t.closed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (m *memoryTransport) Subscribe() (<-chan Invalidation, error) {
+	m.broker.mu.Lock()
+	defer m.broker.mu.Unlock()
+	if m.subscribed {
+		return nil, errors.New("cache: 重複訂閱")
+	}
+	m.subscribed = true
+	return m.ch, nil
+}
+
+func (m *memoryTransport) Close() error {
+	err := errTransportClosed
+	m.closeOnce.Do(func() {
+		close(m.closed)
+		// 等正在進行的 Publish 結束，之後才能安全地關閉 channel
+		m.broker.mu.Lock()
+		delete(m.broker.transports, m)
+		m.broker.mu.Unlock()
+		close(m.ch)
+		err = nil
+	})
+	return err
+}
@@ -0,0 +1,244 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// maxInvalidationFrame 一條失效通知的最大字節數
+const maxInvalidationFrame = 1 << 20
+
+var _ Transport = (*TCPTransport)(nil)
+
+// TCPTransport 節點之間兩兩建立 TCP 連接 (full mesh)，適合節點數量不多的部署
+// 每條消息為 4 字節的長度 + JSON
+//
+//	t, err := NewTCPTransport(":7001", "10.0.0.2:7001", "10.0.0.3:7001")
+//	c := NewMultiLevelCache(l1, l2, MultiLevelCacheWithTransport(t))
+type TCPTransport struct {
+	l     net.Listener
+	peers []string
+	// 連接對方的超時時間
+	dialTimeout time.Duration
+
+	mu sync.Mutex
+	// 發送用的連接，key 為對方的地址，斷開之後下一次 Publish 重新連接
+	out map[string]*peerConn
+	// 接收用的連接
+	in         map[net.Conn]struct{}
+	subscribed bool
+	closed     bool
+
+	ch   chan Invalidation
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewTCPTransport addr 為監聽地址，peers 為其他節點的監聽地址
+// Publish 不會發給自己
+func NewTCPTransport(addr string, peers ...string) (*TCPTransport, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	res := &TCPTransport{
+		l:           l,
+		peers:       peers,
+		dialTimeout: time.Second * 3,
+		out:         map[string]*peerConn{},
+		in:          map[net.Conn]struct{}{},
+		ch:          make(chan Invalidation, 128),
+		done:        make(chan struct{}),
+	}
+	res.wg.Add(1)
+	go res.accept()
+	return res, nil
+}
+
+// Addr 實際監聽的地址，監聽 :0 的時候可以用來拿到端口
+func (t *TCPTransport) Addr() net.Addr {
+	return t.l.Addr()
+}
+
+// Publish 發給所有的 peer，返回第一個錯誤，某個 peer 失敗不會影響其他 peer
+// 連接斷開的時候會重新連接一次
+func (t *TCPTransport) Publish(ctx context.Context, msg Invalidation) error {
+	t.mu.Lock()
+	closed := t.closed
+	t.mu.Unlock()
+	if closed {
+		return errTransportClosed
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	frame := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(frame, uint32(len(data)))
+	copy(frame[4:], data)
+
+	var res error
+	for _, peer := range t.peers {
+		err = t.send(ctx, peer, frame)
+		if err != nil {
+			// 之前的連接可能已經斷開了，重試一次
+			err = t.send(ctx, peer, frame)
+		}
+		if err != nil && res == nil {
+			res = fmt.Errorf("cache: 發送失效通知給 %s 失敗: %w", peer, err)
+		}
+	}
+	return res
+}
+
+func (t *TCPTransport) Subscribe() (<-chan Invalidation, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.subscribed {
+		return nil, errors.New("cache: 重複訂閱")
+	}
+	t.subscribed = true
+	return t.ch, nil
+}
+
+// Close 關閉監聽和所有的連接，等待接收的 goroutine 都結束之後關閉 channel
+func (t *TCPTransport) Close() error {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return errTransportClosed
+	}
+	t.closed = true
+	close(t.done)
+	err := t.l.Close()
+	for _, conn := range t.out {
+		_ = conn.Close()
+	}
+	for conn := range t.in {
+		_ = conn.Close()
+	}
+	t.mu.Unlock()
+
+	t.wg.Wait()
+	close(t.ch)
+	return err
+}
+
+func (t *TCPTransport) send(ctx context.Context, peer string, frame []byte) error {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return errTransportClosed
+	}
+	conn, ok := t.out[peer]
+	t.mu.Unlock()
+	if !ok {
+		d := net.Dialer{Timeout: t.dialTimeout}
+		c, err := d.DialContext(ctx, "tcp", peer)
+		if err != nil {
+			return err
+		}
+		t.mu.Lock()
+		if t.closed {
+			t.mu.Unlock()
+			_ = c.Close()
+			return errTransportClosed
+		}
+		// 併發的 Publish 可能已經建好連接了
+		if conn, ok = t.out[peer]; ok {
+			_ = c.Close()
+		} else {
+			conn = &peerConn{Conn: c}
+			t.out[peer] = conn
+		}
+		t.mu.Unlock()
+	}
+
+	err := conn.write(ctx, frame)
+	if err != nil {
+		t.mu.Lock()
+		if t.out[peer] == conn {
+			delete(t.out, peer)
+		}
+		t.mu.Unlock()
+		_ = conn.Close()
+	}
+	return err
+}
+
+// peerConn 同一個連接上的寫需要串行，避免兩條消息交錯
+type peerConn struct {
+	net.Conn
+	mu sync.Mutex
+}
+
+func (p *peerConn) write(ctx context.Context, frame []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	dl, _ := ctx.Deadline()
+	_ = p.SetWriteDeadline(dl)
+	_, err := p.Write(frame)
+	return err
+}
+
+func (t *TCPTransport) accept() {
+	defer t.wg.Done()
+	for {
+		conn, err := t.l.Accept()
+		if err != nil {
+			return
+		}
+		t.mu.Lock()
+		if t.closed {
+			t.mu.Unlock()
+			_ = conn.Close()
+			return
+		}
+		t.in[conn] = struct{}{}
+		t.wg.Add(1)
+		t.mu.Unlock()
+		go t.receive(conn)
+	}
+}
+
+func (t *TCPTransport) receive(conn net.Conn) {
+	defer func() {
+		t.mu.Lock()
+		delete(t.in, conn)
+		t.mu.Unlock()
+		_ = conn.Close()
+		t.wg.Done()
+	}()
+	r := bufio.NewReader(conn)
+	header := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return
+		}
+		n := binary.BigEndian.Uint32(header)
+		if n > maxInvalidationFrame {
+			return
+		}
+		data := make([]byte, n)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return
+		}
+		var msg Invalidation
+		if err := json.Unmarshal(data, &msg); err != nil {
+			continue
+		}
+		select {
+		case t.ch <- msg:
+		case <-t.done:
+			return
+		}
+	}
+}
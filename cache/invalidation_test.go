@@ -0,0 +1,100 @@
+package cache
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestMemoryBroker(t *testing.T) {
+	broker := NewMemoryBroker()
+	a, b := broker.NewTransport(), broker.NewTransport()
+	cha, err := a.Subscribe()
+	require.NoError(t, err)
+	_, err = a.Subscribe()
+	assert.Error(t, err)
+	chb, err := b.Subscribe()
+	require.NoError(t, err)
+
+	msg := Invalidation{Node: "a", Keys: []string{"key1"}}
+	require.NoError(t, a.Publish(context.Background(), msg))
+	// 包括自己
+	assert.Equal(t, msg, <-cha)
+	assert.Equal(t, msg, <-chb)
+
+	require.NoError(t, b.Close())
+	_, ok := <-chb
+	assert.False(t, ok)
+	assert.Equal(t, errTransportClosed, b.Close())
+	assert.Equal(t, errTransportClosed, b.Publish(context.Background(), msg))
+	// 關閉的節點不會再收到
+	require.NoError(t, a.Publish(context.Background(), msg))
+	assert.Equal(t, msg, <-cha)
+
+	// 沒人消費的時候阻塞到 ctx 結束
+	for i := 0; i < cap(a.(*memoryTransport).ch); i++ {
+		require.NoError(t, a.Publish(context.Background(), msg))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, a.Publish(ctx, msg))
+	require.NoError(t, a.Close())
+}
+
+func TestTCPTransport(t *testing.T) {
+	a, err := NewTCPTransport("127.0.0.1:0")
+	require.NoError(t, err)
+	b, err := NewTCPTransport("127.0.0.1:0")
+	require.NoError(t, err)
+	c, err := NewTCPTransport("127.0.0.1:0")
+	require.NoError(t, err)
+	a.peers = []string{b.Addr().String(), c.Addr().String()}
+	chb, err := b.Subscribe()
+	require.NoError(t, err)
+	chc, err := c.Subscribe()
+	require.NoError(t, err)
+
+	msg := Invalidation{Node: "a", Keys: []string{"key1", "key2"}}
+	require.NoError(t, a.Publish(context.Background(), msg))
+	assert.Equal(t, msg, <-chb)
+	assert.Equal(t, msg, <-chc)
+
+	// c 重啟之後，a 重新連接
+	addr := c.Addr().String()
+	require.NoError(t, c.Close())
+	_, ok := <-chc
+	assert.False(t, ok)
+	c, err = NewTCPTransport(addr)
+	require.NoError(t, err)
+	chc, err = c.Subscribe()
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		// 舊的連接第一次寫可能成功，要等到發現斷開並重連
+		if a.Publish(context.Background(), msg) != nil {
+			return false
+		}
+		select {
+		case got := <-chc:
+			return assert.Equal(t, msg, got)
+		case <-time.After(time.Millisecond * 10):
+			return false
+		}
+	}, time.Second*3, time.Millisecond*10)
+
+	// 一個 peer 不可用不影響其他 peer
+	require.NoError(t, c.Close())
+	for len(chb) > 0 {
+		<-chb
+	}
+	assert.Eventually(t, func() bool {
+		return a.Publish(context.Background(), msg) != nil
+	}, time.Second*3, time.Millisecond*10)
+	assert.Equal(t, msg, <-chb)
+
+	require.NoError(t, a.Close())
+	require.NoError(t, b.Close())
+	assert.Equal(t, errTransportClosed, a.Close())
+	assert.Equal(t, errTransportClosed, a.Publish(context.Background(), msg))
+}
@@ -0,0 +1,275 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"geektime-go/cache/stats"
+	"math"
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+var _ Cache = (*LoadingCache)(nil)
+
+// LoadingCache 防止緩存擊穿
+//   - 同一個 key 併發的加載會被合併，只有一個請求會打到數據源
+//   - XFetch: 快要過期的時候，按照加載耗時以一定的概率提前在後台刷新
+//     加載越慢、越接近過期，提前刷新的概率越大，避免熱點 key 過期的一瞬間所有請求都未命中
+//   - stale-while-revalidate: 過期之後的 staleTTL 內照樣返回舊值，同時在後台刷新
+//   - 負緩存: 數據不存在的結果也會緩存 negativeTTL，防止緩存穿透
+//
+// 數據以 *loadedEntry 的形式存在底層的 Cache 裡面，
+// 不要繞過 LoadingCache 直接讀寫底層的 Cache
+type LoadingCache struct {
+	Cache
+	group singleflight
+
+	// XFetch 的參數，越大越傾向提前刷新，0 表示不提前刷新
+	beta           float64
+	staleTTL       time.Duration
+	negativeTTL    time.Duration
+	isNotFound     func(err error) bool
+	refreshTimeout time.Duration
+
+	stats loadingStats
+	// 加載耗時的分佈，包括失敗的加載
+	latency *stats.Histogram
+}
+
+// loadedEntry 除了數據本身，還記錄了邏輯上的過期時間和加載耗時
+type loadedEntry struct {
+	val any
+	// 負緩存的時候為加載返回的錯誤
+	err error
+	// 邏輯上的過期時間，為 0 表示不過期
+	// 底層 Cache 的過期時間是 expiry + staleTTL
+	expiry time.Time
+	// 加載耗時
+	delta time.Duration
+}
+
+type loadingStats struct {
+	hits           atomic.Uint64
+	misses         atomic.Uint64
+	loads          atomic.Uint64
+	loadErrors     atomic.Uint64
+	coalesced      atomic.Uint64
+	earlyRefreshes atomic.Uint64
+	staleHits      atomic.Uint64
+	negativeHits   atomic.Uint64
+}
+
+// LoadingStats LoadingCache 的統計數據
+type LoadingStats struct {
+	Hits   uint64
+	Misses uint64
+	// Loads 真正調用 loader 的次數，包括後台刷新
+	Loads      uint64
+	LoadErrors uint64
+	// Coalesced 因為已經有其他請求在加載，而沒有調用 loader 的次數
+	Coalesced      uint64
+	EarlyRefreshes uint64
+	// StaleHits 返回已經過期的舊值的次數，也計入 Hits
+	StaleHits uint64
+	// NegativeHits 命中負緩存的次數，也計入 Hits
+	NegativeHits uint64
+}
+
+type LoadingCacheOption func(cache *LoadingCache)
+
+func NewLoadingCache(cache Cache, opts ...LoadingCacheOption) *LoadingCache {
+	res := &LoadingCache{
+		Cache: cache,
+		beta:  1,
+		isNotFound: func(err error) bool {
+			return false
+		},
+		refreshTimeout: time.Second * 10,
+		latency:        stats.NewHistogram(),
+	}
+	for _, opt := range opts {
+		opt(res)
+	}
+	return res
+}
+
+// LoadingCacheWithLoadHistogram 自定義加載耗時的分佈，e.g. 使用不同的分桶，或者多個緩存共用
+func LoadingCacheWithLoadHistogram(h *stats.Histogram) LoadingCacheOption {
+	return func(cache *LoadingCache) {
+		cache.latency = h
+	}
+}
+
+// LoadingCacheWithBeta XFetch 的 beta，預設為 1，0 表示不提前刷新
+func LoadingCacheWithBeta(beta float64) LoadingCacheOption {
+	return func(cache *LoadingCache) {
+		cache.beta = beta
+	}
+}
+
+// LoadingCacheWithStaleTTL 過期之後還能返回舊值的時間
+func LoadingCacheWithStaleTTL(ttl time.Duration) LoadingCacheOption {
+	return func(cache *LoadingCache) {
+		cache.staleTTL = ttl
+	}
+}
+
+// LoadingCacheWithNegativeTTL isNotFound 判斷 loader 返回的錯誤是否表示數據不存在，
+// e.g. errors.Is(err, sql.ErrNoRows)，這樣的錯誤會被緩存 ttl
+func LoadingCacheWithNegativeTTL(ttl time.Duration, isNotFound func(err error) bool) LoadingCacheOption {
+	return func(cache *LoadingCache) {
+		cache.negativeTTL = ttl
+		cache.isNotFound = isNotFound
+	}
+}
+
+// LoadingCacheWithRefreshTimeout 後台刷新的超時時間，預設 10 秒
+func LoadingCacheWithRefreshTimeout(timeout time.Duration) LoadingCacheOption {
+	return func(cache *LoadingCache) {
+		cache.refreshTimeout = timeout
+	}
+}
+
+// GetOrLoad 未命中的時候調用 loader 加載，併發的加載會被合併
+// ttl 不大於 0 的時候表示不過期
+func (l *LoadingCache) GetOrLoad(ctx context.Context, key string, loader LoadFunc, ttl time.Duration) (any, error) {
+	val, err := l.Cache.Get(ctx, key)
+	if err == nil {
+		e, ok := val.(*loadedEntry)
+		if !ok {
+			l.stats.hits.Add(1)
+			return val, nil
+		}
+		return l.hit(key, e, loader, ttl)
+	}
+	if !errors.Is(err, errKeyNotFound) {
+		return nil, err
+	}
+
+	l.stats.misses.Add(1)
+	val, err, shared := l.group.do(ctx, key, func() (any, error) {
+		return l.load(ctx, key, loader, ttl)
+	})
+	if shared {
+		l.stats.coalesced.Add(1)
+	}
+	return val, err
+}
+
+// Get 只讀緩存，不會加載，過期的舊值和負緩存都視為不存在
+func (l *LoadingCache) Get(ctx context.Context, key string) (any, error) {
+	val, err := l.Cache.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	e, ok := val.(*loadedEntry)
+	if !ok {
+		return val, nil
+	}
+	if e.err != nil || (!e.expiry.IsZero() && !time.Now().Before(e.expiry)) {
+		return nil, fmt.Errorf("%w, key: %s", errKeyNotFound, key)
+	}
+	return e.val, nil
+}
+
+func (l *LoadingCache) Set(ctx context.Context, key string, value any, expiration time.Duration) error {
+	return l.set(ctx, key, &loadedEntry{val: value}, expiration)
+}
+
+// Stats 返回統計數據的快照
+func (l *LoadingCache) Stats() LoadingStats {
+	return LoadingStats{
+		Hits:           l.stats.hits.Load(),
+		Misses:         l.stats.misses.Load(),
+		Loads:          l.stats.loads.Load(),
+		LoadErrors:     l.stats.loadErrors.Load(),
+		Coalesced:      l.stats.coalesced.Load(),
+		EarlyRefreshes: l.stats.earlyRefreshes.Load(),
+		StaleHits:      l.stats.staleHits.Load(),
+		NegativeHits:   l.stats.negativeHits.Load(),
+	}
+}
+
+func (l *LoadingCache) hit(key string, e *loadedEntry, loader LoadFunc, ttl time.Duration) (any, error) {
+	l.stats.hits.Add(1)
+	if e.err != nil {
+		l.stats.negativeHits.Add(1)
+		return nil, e.err
+	}
+	if e.expiry.IsZero() {
+		return e.val, nil
+	}
+	now := time.Now()
+	switch {
+	case !now.Before(e.expiry):
+		l.stats.staleHits.Add(1)
+		l.refresh(key, loader, ttl)
+	case l.shouldRefreshEarly(e, now):
+		if l.refresh(key, loader, ttl) {
+			l.stats.earlyRefreshes.Add(1)
+		}
+	}
+	return e.val, nil
+}
+
+// shouldRefreshEarly XFetch: now - delta * beta * ln(rand()) >= expiry
+// 參考 Optimal Probabilistic Cache Stampede Prevention
+func (l *LoadingCache) shouldRefreshEarly(e *loadedEntry, now time.Time) bool {
+	if l.beta <= 0 || e.delta <= 0 {
+		return false
+	}
+	r := rand.Float64()
+	if r == 0 {
+		return true
+	}
+	gap := -float64(e.delta) * l.beta * math.Log(r)
+	return !now.Add(time.Duration(gap)).Before(e.expiry)
+}
+
+// refresh 在後台刷新，已經有加載在進行的時候返回 false
+func (l *LoadingCache) refresh(key string, loader LoadFunc, ttl time.Duration) bool {
+	started := l.group.doAsync(key, func() (any, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), l.refreshTimeout)
+		defer cancel()
+		return l.load(ctx, key, loader, ttl)
+	})
+	if !started {
+		l.stats.coalesced.Add(1)
+	}
+	return started
+}
+
+// LoadLatency 加載耗時的分佈，可以註冊到 stats.Registry
+func (l *LoadingCache) LoadLatency() *stats.Histogram {
+	return l.latency
+}
+
+func (l *LoadingCache) load(ctx context.Context, key string, loader LoadFunc, ttl time.Duration) (any, error) {
+	l.stats.loads.Add(1)
+	start := time.Now()
+	val, err := loader(ctx, key)
+	delta := time.Since(start)
+	l.latency.Observe(delta)
+	if err != nil {
+		l.stats.loadErrors.Add(1)
+		if l.negativeTTL > 0 && l.isNotFound(err) {
+			_ = l.Cache.Set(ctx, key, &loadedEntry{err: err, delta: delta}, l.negativeTTL)
+		}
+		return nil, err
+	}
+	if err = l.set(ctx, key, &loadedEntry{val: val, delta: delta}, ttl); err != nil {
+		return val, fmt.Errorf("%w, key: %s, err: %v", errFailedToRefreshCache, key, err)
+	}
+	return val, nil
+}
+
+// set 底層 Cache 多保留 staleTTL
+func (l *LoadingCache) set(ctx context.Context, key string, e *loadedEntry, ttl time.Duration) error {
+	if ttl <= 0 {
+		return l.Cache.Set(ctx, key, e, 0)
+	}
+	e.expiry = time.Now().Add(ttl)
+	return l.Cache.Set(ctx, key, e, ttl+l.staleTTL)
+}
@@ -0,0 +1,293 @@
+package cache
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"geektime-go/cache/stats"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLoadingCache_Coalesce(t *testing.T) {
+	c := NewLoadingCache(NewBuildInMapCache(time.Minute))
+	var loads int32
+	release := make(chan struct{})
+	loader := func(ctx context.Context, key string) (any, error) {
+		atomic.AddInt32(&loads, 1)
+		<-release
+		return "db " + key, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			val, err := c.GetOrLoad(context.Background(), "key1", loader, time.Minute)
+			assert.NoError(t, err)
+			assert.Equal(t, "db key1", val)
+		}()
+	}
+	// 等所有請求都未命中之後再放行
+	assert.Eventually(t, func() bool {
+		return c.Stats().Misses == 100
+	}, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&loads))
+	assert.Equal(t, LoadingStats{Misses: 100, Loads: 1, Coalesced: 99}, c.Stats())
+
+	val, err := c.GetOrLoad(context.Background(), "key1", loader, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, "db key1", val)
+	assert.Equal(t, uint64(1), c.Stats().Hits)
+}
+
+func TestLoadingCache_WaiterContext(t *testing.T) {
+	c := NewLoadingCache(NewBuildInMapCache(time.Minute))
+	release := make(chan struct{})
+	loading := make(chan struct{})
+	go func() {
+		_, _ = c.GetOrLoad(context.Background(), "key1", func(ctx context.Context, key string) (any, error) {
+			close(loading)
+			<-release
+			return "val", nil
+		}, time.Minute)
+	}()
+	<-loading
+
+	// 等待的一方超時不會影響正在進行的加載
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	_, err := c.GetOrLoad(ctx, "key1", func(ctx context.Context, key string) (any, error) {
+		t.Fatal("不應該重複加載")
+		return nil, nil
+	}, time.Minute)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	close(release)
+	assert.Eventually(t, func() bool {
+		val, err := c.Get(context.Background(), "key1")
+		return err == nil && val == "val"
+	}, time.Second, time.Millisecond)
+}
+
+func TestLoadingCache_LoadError(t *testing.T) {
+	errDB := errors.New("db error")
+	testCases := []struct {
+		name string
+		opts []LoadingCacheOption
+		err  error
+
+		wantLoads uint64
+	}{
+		{
+			name:      "not cached",
+			err:       errDB,
+			wantLoads: 2,
+		},
+		{
+			name: "negative",
+			opts: []LoadingCacheOption{LoadingCacheWithNegativeTTL(time.Minute, func(err error) bool {
+				return errors.Is(err, sql.ErrNoRows)
+			})},
+			err:       fmt.Errorf("query user: %w", sql.ErrNoRows),
+			wantLoads: 1,
+		},
+		{
+			// 不是 not found 的錯誤不會緩存
+			name: "negative other error",
+			opts: []LoadingCacheOption{LoadingCacheWithNegativeTTL(time.Minute, func(err error) bool {
+				return errors.Is(err, sql.ErrNoRows)
+			})},
+			err:       errDB,
+			wantLoads: 2,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := NewLoadingCache(NewBuildInMapCache(time.Minute), tc.opts...)
+			loader := func(ctx context.Context, key string) (any, error) {
+				return nil, tc.err
+			}
+			for i := 0; i < 2; i++ {
+				_, err := c.GetOrLoad(context.Background(), "key1", loader, time.Minute)
+				assert.Equal(t, tc.err, err)
+			}
+			assert.Equal(t, tc.wantLoads, c.Stats().Loads)
+			// 負緩存對 Get 來說是不存在
+			_, err := c.Get(context.Background(), "key1")
+			assert.ErrorIs(t, err, errKeyNotFound)
+		})
+	}
+}
+
+func TestLoadingCache_NegativeExpire(t *testing.T) {
+	c := NewLoadingCache(NewBuildInMapCache(time.Minute),
+		LoadingCacheWithNegativeTTL(time.Millisecond*10, func(err error) bool {
+			return errors.Is(err, sql.ErrNoRows)
+		}))
+	var exists atomic.Bool
+	loader := func(ctx context.Context, key string) (any, error) {
+		if !exists.Load() {
+			return nil, sql.ErrNoRows
+		}
+		return "val", nil
+	}
+	_, err := c.GetOrLoad(context.Background(), "key1", loader, time.Minute)
+	assert.Equal(t, sql.ErrNoRows, err)
+	exists.Store(true)
+	_, err = c.GetOrLoad(context.Background(), "key1", loader, time.Minute)
+	assert.Equal(t, sql.ErrNoRows, err)
+	assert.Equal(t, uint64(1), c.Stats().NegativeHits)
+
+	time.Sleep(time.Millisecond * 20)
+	val, err := c.GetOrLoad(context.Background(), "key1", loader, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, "val", val)
+}
+
+func TestLoadingCache_Stale(t *testing.T) {
+	c := NewLoadingCache(NewBuildInMapCache(time.Minute),
+		LoadingCacheWithBeta(0),
+		LoadingCacheWithStaleTTL(time.Second))
+	var version int32
+	loader := func(ctx context.Context, key string) (any, error) {
+		return atomic.AddInt32(&version, 1), nil
+	}
+	val, err := c.GetOrLoad(context.Background(), "key1", loader, time.Millisecond*10)
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), val)
+	time.Sleep(time.Millisecond * 20)
+
+	// 已經過期，對 Get 來說不存在
+	_, err = c.Get(context.Background(), "key1")
+	assert.ErrorIs(t, err, errKeyNotFound)
+
+	// 返回舊值，同時在後台刷新
+	val, err = c.GetOrLoad(context.Background(), "key1", loader, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), val)
+	assert.Eventually(t, func() bool {
+		val, err := c.Get(context.Background(), "key1")
+		return err == nil && val == int32(2)
+	}, time.Second, time.Millisecond)
+	stats := c.Stats()
+	assert.Equal(t, uint64(1), stats.StaleHits)
+	assert.Equal(t, uint64(2), stats.Loads)
+}
+
+func TestLoadingCache_EarlyRefresh(t *testing.T) {
+	testCases := []struct {
+		name  string
+		beta  float64
+		delta time.Duration
+		ttl   time.Duration
+		want  bool
+	}{
+		{
+			name:  "disabled",
+			beta:  0,
+			delta: time.Second,
+			ttl:   time.Millisecond,
+		},
+		{
+			name: "no delta",
+			beta: 1,
+			ttl:  time.Millisecond,
+		},
+		{
+			// 加載耗時遠大於剩下的時間，幾乎一定會提前刷新
+			name:  "almost expired",
+			beta:  1e6,
+			delta: time.Second,
+			ttl:   time.Millisecond,
+			want:  true,
+		},
+		{
+			// 加載耗時遠小於剩下的時間，幾乎不會提前刷新
+			name:  "far from expiry",
+			beta:  1,
+			delta: time.Nanosecond,
+			ttl:   time.Hour,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := NewLoadingCache(NewBuildInMapCache(time.Minute), LoadingCacheWithBeta(tc.beta))
+			now := time.Now()
+			e := &loadedEntry{delta: tc.delta, expiry: now.Add(tc.ttl)}
+			assert.Equal(t, tc.want, c.shouldRefreshEarly(e, now))
+		})
+	}
+
+	c := NewLoadingCache(NewBuildInMapCache(time.Minute), LoadingCacheWithBeta(1e6))
+	var version int32
+	loader := func(ctx context.Context, key string) (any, error) {
+		time.Sleep(time.Millisecond)
+		return atomic.AddInt32(&version, 1), nil
+	}
+	_, err := c.GetOrLoad(context.Background(), "key1", loader, time.Millisecond*100)
+	require.NoError(t, err)
+	val, err := c.GetOrLoad(context.Background(), "key1", loader, time.Millisecond*100)
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), val)
+	assert.Eventually(t, func() bool {
+		val, err := c.Get(context.Background(), "key1")
+		return err == nil && val == int32(2)
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, uint64(1), c.Stats().EarlyRefreshes)
+}
+
+func TestLoadingCache_Panic(t *testing.T) {
+	c := NewLoadingCache(NewBuildInMapCache(time.Minute))
+	loading := make(chan struct{})
+	release := make(chan struct{})
+	go func() {
+		defer func() {
+			assert.Equal(t, "boom", recover())
+		}()
+		_, _ = c.GetOrLoad(context.Background(), "key1", func(ctx context.Context, key string) (any, error) {
+			close(loading)
+			<-release
+			panic("boom")
+		}, time.Minute)
+	}()
+	<-loading
+	done := make(chan error)
+	go func() {
+		_, err := c.GetOrLoad(context.Background(), "key1", nil, time.Minute)
+		done <- err
+	}()
+	assert.Eventually(t, func() bool {
+		return c.Stats().Misses == 2
+	}, time.Second, time.Millisecond)
+	close(release)
+	assert.EqualError(t, <-done, "cache: 加載 key key1 的時候 panic: boom")
+}
+
+func TestLoadingCache_LoadLatency(t *testing.T) {
+	h := stats.NewHistogram(time.Millisecond * 10)
+	c := NewLoadingCache(NewBuildInMapCache(time.Minute), LoadingCacheWithLoadHistogram(h))
+	_, err := c.GetOrLoad(context.Background(), "key1", func(ctx context.Context, key string) (any, error) {
+		time.Sleep(time.Millisecond * 20)
+		return "value1", nil
+	}, time.Minute)
+	require.NoError(t, err)
+	_, err = c.GetOrLoad(context.Background(), "key2", func(ctx context.Context, key string) (any, error) {
+		return nil, errors.New("mock error")
+	}, time.Minute)
+	require.Error(t, err)
+
+	snapshot := c.LoadLatency().Snapshot()
+	assert.Equal(t, uint64(2), snapshot.Count)
+	assert.Equal(t, []uint64{1, 2}, snapshot.Counts)
+}
@@ -4,77 +4,159 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"geektime-go/cache/event"
+	"geektime-go/cache/stats"
+	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 var (
 	errKeyNotFound = errors.New("cache: key not found")
+	errCacheClosed = errors.New("cache: 緩存已經關閉")
 	//errKeyExpired = errors.New("cache：key was expired")
 )
 
 type item struct {
+	// 訪問次數，只用於統計，使用原子操作
+	accesses uint64
 	val      any
 	deadline time.Time
+	// 每次寫入都會更新，用於 CompareAndSwap
+	version uint64
+	// 透過 SetWithTags 加上的標籤
+	tags []string
+	// 在過期索引裡面的位置，沒有過期時間的時候為 nil，只用於 BuildInMapCache
+	expiry *expiryEntry
 }
 
 type BuildInMapCache struct {
 	data map[string]*item
 	//data sync.Map // 無法做到較為精細的控制
 	mu        sync.RWMutex
-	onEvicted func(key string, val any)
+	onEvicted func(key string, val any, reason EvictReason)
 	close     chan struct{}
+	closeOnce sync.Once
+	// 帶有過期時間的 key 的最小堆，後台 goroutine 只需要看堆頂
+	expiries expiryHeap
+	// 最早過期的 key 變了，通知後台 goroutine 重新計時
+	wake     chan struct{}
+	counters stats.Counters
+	events   *event.Bus
+	// 最後一次寫入的版本，單調遞增，刪除之後重新寫入也不會重複
+	version uint64
+	// Close 之後寫操作返回 errCacheClosed，避免修改沒有寫入 AOF 和快照
+	closed bool
+	// 標籤到 key 的索引，見 SetWithTags
+	tags map[string]map[string]struct{}
+	// 所有 key 和值的估算大小，寫入和刪除的時候維護，見 entrySize
+	used int64
+
+	// 持久化相關的字段，見 OpenBuildInMapCache
+	snapshotMu       sync.Mutex
+	codec            Codec[any]
+	snapshotPath     string
+	snapshotInterval time.Duration
+	aofPath          string
+	aof              *os.File
+	persistErr       func(err error)
 }
 
-func (i item) deadlineBefore(t time.Time) bool {
+func (i *item) deadlineBefore(t time.Time) bool {
 	return !i.deadline.IsZero() && i.deadline.Before(t)
 }
 
 type BuildInMapCacheOption func(cache *BuildInMapCache)
 
 func NewBuildInMapCache(interval time.Duration, opts ...BuildInMapCacheOption) *BuildInMapCache {
+	res := newBuildInMapCache(opts...)
+	if res.persistent() {
+		panic("cache: 開啟持久化的時候需要使用 OpenBuildInMapCache")
+	}
+	res.start(interval)
+	return res
+}
+
+func newBuildInMapCache(opts ...BuildInMapCacheOption) *BuildInMapCache {
 	res := &BuildInMapCache{
-		data:      make(map[string]*item, 100),
-		onEvicted: func(key string, val any) {},
-		close:     make(chan struct{}),
+		data:       make(map[string]*item, 100),
+		onEvicted:  func(key string, val any, reason EvictReason) {},
+		close:      make(chan struct{}),
+		wake:       make(chan struct{}, 1),
+		codec:      GobCodec[any]{},
+		persistErr: func(err error) {},
+		events:     event.NewBus(),
 	}
 
 	for _, opt := range opts {
 		opt(res)
 	}
+	return res
+}
 
-	// 檢查過期, goroutine 輪詢
+// start 啟動後台 goroutine，在最早過期的 key 的過期時間喚醒並刪除過期的 key
+// interval 為兩次刪除之間的最小間隔，避免大量 key 在相近的時間過期的時候頻繁喚醒
+func (b *BuildInMapCache) start(interval time.Duration) {
 	go func() {
-		ticker := time.NewTicker(interval)
+		// 沒有開啟定期快照的時候，snapshotC 為 nil，永遠不會觸發
+		var snapshotC <-chan time.Time
+		if b.snapshotPath != "" && b.snapshotInterval > 0 {
+			ticker := time.NewTicker(b.snapshotInterval)
+			defer ticker.Stop()
+			snapshotC = ticker.C
+		}
+		timer := time.NewTimer(0)
+		defer timer.Stop()
+		var last time.Time
+		// reset 重新計時，沒有帶過期時間的 key 的時候停止計時
+		reset := func() {
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			next, ok := b.nextExpiry()
+			if !ok {
+				return
+			}
+			if earliest := last.Add(interval); next.Before(earliest) {
+				next = earliest
+			}
+			timer.Reset(time.Until(next))
+		}
 		for {
 			select {
-			case t := <-ticker.C:
-				res.mu.Lock()
-				i := 0
-				for key, val := range res.data {
-					// 遍歷緩存筆數控制
-					if i > 10000 {
-						return
-					}
-					// 已設置過期時間，且已過期了
-					if val.deadlineBefore(t) {
-						res.delete(key)
-					}
-					i++
+			case now := <-timer.C:
+				cnt, more := b.expireBatch(now)
+				if cnt > 0 {
+					last = now
+				}
+				if more {
+					// 還有過期的 key，先釋放鎖，馬上繼續
+					timer.Reset(0)
+					continue
 				}
-				res.mu.Unlock()
-			case <-res.close:
+				reset()
+			case <-b.wake:
+				reset()
+			case <-snapshotC:
+				if err := b.SaveSnapshot(); err != nil {
+					b.persistErr(err)
+				}
+			case <-b.close:
 				return
 			}
 		}
 	}()
-
-	return res
 }
 
 func BuildInMapCacheWithOnEvictedCallback(f func(key string, val any)) BuildInMapCacheOption {
 	return func(cache *BuildInMapCache) {
-		cache.onEvicted = f
+		cache.onEvicted = func(key string, val any, reason EvictReason) {
+			f(key, val)
+		}
 	}
 }
 
@@ -84,7 +166,7 @@ func (b *BuildInMapCache) Set(ctx context.Context, key string, value any, expira
 	return b.set(ctx, key, value, expiration)
 }
 
-func (b *BuildInMapCache) set(ctx context.Context, key string, value any, expiration time.Duration) error {
+func (b *BuildInMapCache) set(ctx context.Context, key string, value any, expiration time.Duration, tags ...string) error {
 	var dl time.Time
 	if expiration > 0 {
 		//time.AfterFunc(expiration, func() {
@@ -92,7 +174,41 @@ func (b *BuildInMapCache) set(ctx context.Context, key string, value any, expira
 		//})
 		dl = time.Now().Add(expiration)
 	}
-	b.data[key] = &item{val: value, deadline: dl}
+	return b.store(key, value, dl, tags...)
+}
+
+// store 所有寫操作的入口，負責 AOF、版本、標籤、統計和事件
+// tags 為新增的標籤，原本的標籤會保留
+func (b *BuildInMapCache) store(key string, value any, dl time.Time, tags ...string) error {
+	if b.closed {
+		return errCacheClosed
+	}
+	old, exist := b.data[key]
+	// 覆蓋的時候保留標籤，已經過期的 key 視為已經刪除
+	if exist && !old.deadlineBefore(time.Now()) {
+		tags = mergeTags(old.tags, tags)
+	} else {
+		tags = mergeTags(nil, tags)
+	}
+	// AOF 記錄 key 所有的標籤，重放的時候不依賴之前的記錄
+	if b.aof != nil {
+		if err := b.appendSet(key, value, dl, tags); err != nil {
+			return err
+		}
+	}
+	b.version++
+	itm := &item{val: value, deadline: dl, version: b.version}
+	if exist {
+		b.untag(key, old)
+		b.unschedule(old)
+		b.used -= entrySize(key, old.val)
+	}
+	b.data[key] = itm
+	b.used += entrySize(key, value)
+	b.tag(key, itm, tags)
+	b.schedule(key, itm)
+	b.counters.Set()
+	b.events.Publish(event.Event{Key: key, Val: value, Type: event.TypeSet})
 	return nil
 }
 
@@ -105,6 +221,7 @@ func (b *BuildInMapCache) Get(ctx context.Context, key string) (any, error) {
 	itm, ok := b.data[key]
 	b.mu.RUnlock()
 	if !ok {
+		b.counters.Miss()
 		return nil, fmt.Errorf("%w, key: %s", errKeyNotFound, key) // 沒有這個 key，所以找不到
 	}
 	now := time.Now()
@@ -114,39 +231,119 @@ func (b *BuildInMapCache) Get(ctx context.Context, key string) (any, error) {
 		defer b.mu.Unlock()
 		itm, ok = b.data[key]
 		if !ok {
+			b.counters.Miss()
 			return nil, fmt.Errorf("%w, key: %s", errKeyNotFound, key)
 		}
 		// 如果沒有人刪除，就再檢查一次 key 是否過期
-		// 過期就刪除，等輪詢太慢了, 會浪費資源
+		// 過期就刪除，不用等後台 goroutine
 		if itm.deadlineBefore(now) {
-			b.delete(key)
+			b.expire(key, itm)
+			b.counters.Miss()
 			return nil, fmt.Errorf("%w, key: %s", errKeyNotFound, key)
 		}
 	}
+	atomic.AddUint64(&itm.accesses, 1)
+	b.counters.Hit()
 	return itm.val, nil
 }
 
 func (b *BuildInMapCache) Delete(ctx context.Context, key string) error {
 	b.mu.Lock()
 	defer b.mu.Unlock()
-	b.delete(key)
-	return nil
+	if itm, ok := b.data[key]; ok {
+		return b.remove(key, itm)
+	}
+	// 不存在的 key 也寫 AOF，保證重放的時候一定會被刪除
+	return b.appendDelete(key)
 }
 
-func (b *BuildInMapCache) delete(key string) {
+// LoadAndDelete 取出並刪除 key，已經過期的 key 視為不存在
+func (b *BuildInMapCache) LoadAndDelete(ctx context.Context, key string) (any, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	itm, ok := b.data[key]
+	if !ok {
+		return nil, fmt.Errorf("%w, key: %s", errKeyNotFound, key)
+	}
+	if itm.deadlineBefore(time.Now()) {
+		if err := b.appendDelete(key); err != nil {
+			return nil, err
+		}
+		b.expire(key, itm)
+		return nil, fmt.Errorf("%w, key: %s", errKeyNotFound, key)
+	}
+	if err := b.remove(key, itm); err != nil {
+		return nil, err
+	}
+	return itm.val, nil
+}
+
+// Subscribe 訂閱數據變更，BuildInMapCache 沒有容量限制，所以不會有 TypeEvict
+// Close 的時候所有的訂閱都會被關閉
+func (b *BuildInMapCache) Subscribe(opts ...event.SubscribeOption) *event.Subscription {
+	return b.events.Subscribe(opts...)
+}
+
+// OnEvicted 替換 key 被刪除時的回調，效果和 BuildInMapCacheWithOnEvictedCallback 一樣
+func (b *BuildInMapCache) OnEvicted(f func(key string, val any)) {
+	b.OnEvictedWithReason(func(key string, val any, reason EvictReason) {
+		f(key, val)
+	})
+}
+
+func (b *BuildInMapCache) delete(key string, reason EvictReason) {
 	itm, ok := b.data[key]
 	if !ok {
 		return
 	}
 	delete(b.data, key)
-	b.onEvicted(key, itm.val)
+	b.used -= entrySize(key, itm.val)
+	b.unschedule(itm)
+	b.untag(key, itm)
+	b.onEvicted(key, itm.val, reason)
 }
 
+// remove 用戶主動刪除 key
+func (b *BuildInMapCache) remove(key string, itm *item) error {
+	if err := b.appendDelete(key); err != nil {
+		return err
+	}
+	b.delete(key, EvictReasonDelete)
+	b.counters.Delete()
+	b.events.Publish(event.Event{Key: key, Val: itm.val, Type: event.TypeDelete})
+	return nil
+}
+
+// Close 停止後台 goroutine；開啟了持久化的話，保存最後一次快照並關閉 AOF 文件
+// 之後的寫操作都會返回錯誤，讀操作不受影響
 func (b *BuildInMapCache) Close() error {
-	select {
-	case b.close <- struct{}{}:
-		return nil
-	default:
+	// 後台 goroutine 可能還沒有開始等待，所以直接關閉 channel，而不是發送信號
+	closed := false
+	b.closeOnce.Do(func() {
+		close(b.close)
+		closed = true
+	})
+	if !closed {
 		return errors.New("重複關閉")
 	}
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+	_ = b.events.Close()
+	if !b.persistent() {
+		return nil
+	}
+	if b.snapshotPath != "" {
+		if err := b.SaveSnapshot(); err != nil {
+			return err
+		}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.aof == nil {
+		return nil
+	}
+	err := b.aof.Close()
+	b.aof = nil
+	return err
 }
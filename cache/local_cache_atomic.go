@@ -0,0 +1,216 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	errNotInteger      = errors.New("cache: 值不是整數")
+	errIntegerOverflow = errors.New("cache: 整數溢出")
+)
+
+var (
+	_ BatchCache  = (*BuildInMapCache)(nil)
+	_ AtomicCache = (*BuildInMapCache)(nil)
+	_ TTLCache    = (*BuildInMapCache)(nil)
+)
+
+// lookup 返回沒有過期的 key，需要持有鎖
+// 過期的 key 留給 Get 或者後台 goroutine 刪除
+func (b *BuildInMapCache) lookup(key string, now time.Time) (*item, bool) {
+	itm, ok := b.data[key]
+	if !ok || itm.deadlineBefore(now) {
+		return nil, false
+	}
+	return itm, true
+}
+
+func (b *BuildInMapCache) MGet(ctx context.Context, keys ...string) (map[string]any, error) {
+	now := time.Now()
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	res := make(map[string]any, len(keys))
+	for _, key := range keys {
+		itm, ok := b.lookup(key, now)
+		if !ok {
+			b.counters.Miss()
+			continue
+		}
+		atomic.AddUint64(&itm.accesses, 1)
+		b.counters.Hit()
+		res[key] = itm.val
+	}
+	return res, nil
+}
+
+// MSet 開啟 AOF 的時候，寫 AOF 失敗會返回錯誤，前面的 key 已經寫入了
+func (b *BuildInMapCache) MSet(ctx context.Context, entries map[string]any, expiration time.Duration) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for key, val := range entries {
+		if err := b.set(ctx, key, val, expiration); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *BuildInMapCache) MDelete(ctx context.Context, keys ...string) (int, error) {
+	now := time.Now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	cnt := 0
+	for _, key := range keys {
+		itm, ok := b.lookup(key, now)
+		if !ok {
+			continue
+		}
+		if err := b.remove(key, itm); err != nil {
+			return cnt, err
+		}
+		cnt++
+	}
+	return cnt, nil
+}
+
+func (b *BuildInMapCache) SetNX(ctx context.Context, key string, value any, expiration time.Duration) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.lookup(key, time.Now()); ok {
+		return false, nil
+	}
+	return true, b.set(ctx, key, value, expiration)
+}
+
+func (b *BuildInMapCache) GetAndSet(ctx context.Context, key string, value any, expiration time.Duration) (any, bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	itm, loaded := b.lookup(key, time.Now())
+	if err := b.set(ctx, key, value, expiration); err != nil {
+		return nil, false, err
+	}
+	if !loaded {
+		return nil, false, nil
+	}
+	return itm.val, true, nil
+}
+
+func (b *BuildInMapCache) GetWithVersion(ctx context.Context, key string) (any, uint64, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	itm, ok := b.lookup(key, time.Now())
+	if !ok {
+		b.counters.Miss()
+		return nil, 0, fmt.Errorf("%w, key: %s", errKeyNotFound, key)
+	}
+	atomic.AddUint64(&itm.accesses, 1)
+	b.counters.Hit()
+	return itm.val, itm.version, nil
+}
+
+func (b *BuildInMapCache) CompareAndSwap(ctx context.Context, key string, version uint64,
+	value any, expiration time.Duration) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	itm, ok := b.lookup(key, time.Now())
+	if version == 0 && ok || version != 0 && (!ok || itm.version != version) {
+		return false, nil
+	}
+	return true, b.set(ctx, key, value, expiration)
+}
+
+// Incr 原本的值可以是任意的整數類型，結果以 int64 保存
+func (b *BuildInMapCache) Incr(ctx context.Context, key string, delta int64) (int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	itm, ok := b.lookup(key, time.Now())
+	if !ok {
+		return delta, b.set(ctx, key, delta, 0)
+	}
+	val, ok := toInt64(itm.val)
+	if !ok {
+		return 0, fmt.Errorf("%w, key: %s", errNotInteger, key)
+	}
+	if delta > 0 && val > math.MaxInt64-delta || delta < 0 && val < math.MinInt64-delta {
+		return 0, fmt.Errorf("%w, key: %s", errIntegerOverflow, key)
+	}
+	val += delta
+	return val, b.store(key, val, itm.deadline)
+}
+
+func (b *BuildInMapCache) Decr(ctx context.Context, key string, delta int64) (int64, error) {
+	if delta == math.MinInt64 {
+		return 0, fmt.Errorf("%w, key: %s", errIntegerOverflow, key)
+	}
+	return b.Incr(ctx, key, -delta)
+}
+
+func (b *BuildInMapCache) TTL(ctx context.Context, key string) (time.Duration, error) {
+	now := time.Now()
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	itm, ok := b.lookup(key, now)
+	if !ok {
+		return 0, fmt.Errorf("%w, key: %s", errKeyNotFound, key)
+	}
+	if itm.deadline.IsZero() {
+		return NoExpiration, nil
+	}
+	return itm.deadline.Sub(now), nil
+}
+
+func (b *BuildInMapCache) Expire(ctx context.Context, key string, expiration time.Duration) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	itm, ok := b.lookup(key, time.Now())
+	if !ok {
+		return false, nil
+	}
+	if expiration <= 0 {
+		return true, b.remove(key, itm)
+	}
+	return true, b.store(key, itm.val, time.Now().Add(expiration))
+}
+
+func (b *BuildInMapCache) Persist(ctx context.Context, key string) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	itm, ok := b.lookup(key, time.Now())
+	if !ok || itm.deadline.IsZero() {
+		return false, nil
+	}
+	return true, b.store(key, itm.val, time.Time{})
+}
+
+// toInt64 超出 int64 範圍的 uint 視為不是整數
+func toInt64(val any) (int64, bool) {
+	switch v := val.(type) {
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint:
+		return int64(v), uint64(v) <= math.MaxInt64
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		return int64(v), v <= math.MaxInt64
+	default:
+		return 0, false
+	}
+}
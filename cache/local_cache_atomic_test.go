@@ -0,0 +1,161 @@
+package cache
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBuildInMapCache_Batch(t *testing.T) {
+	ctx := context.Background()
+	c := NewBuildInMapCache(time.Minute)
+	defer c.Close()
+	require.NoError(t, c.MSet(ctx, map[string]any{"key1": "val1", "key2": 2}, 0))
+	require.NoError(t, c.MSet(ctx, map[string]any{"key3": "val3"}, time.Millisecond))
+	time.Sleep(time.Millisecond * 5)
+
+	vals, err := c.MGet(ctx, "key1", "key2", "key3", "key4")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"key1": "val1", "key2": 2}, vals)
+
+	n, err := c.MDelete(ctx, "key1", "key3", "key4")
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	vals, err = c.MGet(ctx, "key1", "key2")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"key2": 2}, vals)
+}
+
+func TestBuildInMapCache_Atomic(t *testing.T) {
+	ctx := context.Background()
+	c := NewBuildInMapCache(time.Minute)
+	defer c.Close()
+
+	ok, err := c.SetNX(ctx, "key1", "val1", 0)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = c.SetNX(ctx, "key1", "val2", 0)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	old, loaded, err := c.GetAndSet(ctx, "key1", "val2", 0)
+	require.NoError(t, err)
+	assert.True(t, loaded)
+	assert.Equal(t, "val1", old)
+	_, loaded, err = c.GetAndSet(ctx, "key2", "val2", 0)
+	require.NoError(t, err)
+	assert.False(t, loaded)
+
+	val, version, err := c.GetWithVersion(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, "val2", val)
+	_, _, err = c.GetWithVersion(ctx, "key3")
+	assert.ErrorIs(t, err, errKeyNotFound)
+
+	// 版本不對
+	ok, err = c.CompareAndSwap(ctx, "key1", version+1, "val3", 0)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	ok, err = c.CompareAndSwap(ctx, "key1", version, "val3", 0)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	// 版本已經變了
+	ok, err = c.CompareAndSwap(ctx, "key1", version, "val4", 0)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	// 版本 0 表示 key 不存在的時候才寫入
+	ok, err = c.CompareAndSwap(ctx, "key1", 0, "val4", 0)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	ok, err = c.CompareAndSwap(ctx, "key3", 0, "val3", 0)
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestBuildInMapCache_Incr(t *testing.T) {
+	ctx := context.Background()
+	c := NewBuildInMapCache(time.Minute)
+	defer c.Close()
+
+	val, err := c.Incr(ctx, "cnt", 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), val)
+	val, err = c.Decr(ctx, "cnt", 3)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), val)
+
+	// 保留過期時間
+	require.NoError(t, c.Set(ctx, "uint8", uint8(1), time.Minute))
+	val, err = c.Incr(ctx, "uint8", 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), val)
+	ttl, err := c.TTL(ctx, "uint8")
+	require.NoError(t, err)
+	assert.True(t, ttl > 0 && ttl <= time.Minute)
+
+	require.NoError(t, c.Set(ctx, "str", "abc", 0))
+	_, err = c.Incr(ctx, "str", 1)
+	assert.ErrorIs(t, err, errNotInteger)
+	require.NoError(t, c.Set(ctx, "max", int64(math.MaxInt64), 0))
+	_, err = c.Incr(ctx, "max", 1)
+	assert.ErrorIs(t, err, errIntegerOverflow)
+	_, err = c.Decr(ctx, "cnt", math.MinInt64)
+	assert.ErrorIs(t, err, errIntegerOverflow)
+
+	// 併發
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_, _ = c.Incr(ctx, "concurrent", 1)
+			}
+		}()
+	}
+	wg.Wait()
+	v, err := c.Get(ctx, "concurrent")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1000), v)
+}
+
+func TestBuildInMapCache_TTL(t *testing.T) {
+	ctx := context.Background()
+	c := NewBuildInMapCache(time.Minute)
+	defer c.Close()
+	require.NoError(t, c.Set(ctx, "key1", "val1", 0))
+
+	ttl, err := c.TTL(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, NoExpiration, ttl)
+	_, err = c.TTL(ctx, "key2")
+	assert.ErrorIs(t, err, errKeyNotFound)
+
+	ok, err := c.Expire(ctx, "key1", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ttl, err = c.TTL(ctx, "key1")
+	require.NoError(t, err)
+	assert.True(t, ttl > 0 && ttl <= time.Minute)
+	ok, err = c.Expire(ctx, "key2", time.Minute)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	ok, err = c.Persist(ctx, "key1")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = c.Persist(ctx, "key1")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// 不大於 0 的過期時間直接刪除
+	ok, err = c.Expire(ctx, "key1", 0)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	_, err = c.Get(ctx, "key1")
+	assert.ErrorIs(t, err, errKeyNotFound)
+}
@@ -0,0 +1,141 @@
+package cache
+
+import (
+	"container/heap"
+	"geektime-go/cache/event"
+	"time"
+)
+
+// EvictReason key 被刪除的原因，見 BuildInMapCacheWithOnEvictedReasonCallback
+type EvictReason int
+
+const (
+	// EvictReasonDelete 用戶主動刪除，包括 LoadAndDelete、InvalidateTag 和 Expire(0)
+	EvictReasonDelete EvictReason = iota + 1
+	// EvictReasonExpire 過期被刪除
+	EvictReasonExpire
+)
+
+func (r EvictReason) String() string {
+	switch r {
+	case EvictReasonDelete:
+		return "delete"
+	case EvictReasonExpire:
+		return "expire"
+	default:
+		return "unknown"
+	}
+}
+
+// expireBatchSize 每次持有鎖最多刪除的過期 key 數量，剩下的釋放鎖之後再繼續
+const expireBatchSize = 1000
+
+// BuildInMapCacheWithOnEvictedReasonCallback 和 BuildInMapCacheWithOnEvictedCallback 一樣，多了刪除的原因
+func BuildInMapCacheWithOnEvictedReasonCallback(f func(key string, val any, reason EvictReason)) BuildInMapCacheOption {
+	return func(cache *BuildInMapCache) {
+		cache.onEvicted = f
+	}
+}
+
+// OnEvictedWithReason 替換 key 被刪除時的回調，見 BuildInMapCacheWithOnEvictedReasonCallback
+func (b *BuildInMapCache) OnEvictedWithReason(f func(key string, val any, reason EvictReason)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.onEvicted = f
+}
+
+// expiryEntry 過期索引裡面的一個 key，index 為在堆裡面的位置
+type expiryEntry struct {
+	key      string
+	deadline time.Time
+	index    int
+}
+
+// expiryHeap 按照過期時間排序的最小堆，堆頂就是最早過期的 key
+type expiryHeap []*expiryEntry
+
+func (h expiryHeap) Len() int { return len(h) }
+
+func (h expiryHeap) Less(i, j int) bool { return h[i].deadline.Before(h[j].deadline) }
+
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *expiryHeap) Push(x any) {
+	e := x.(*expiryEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *expiryHeap) Pop() any {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	e.index = -1
+	*h = old[:n-1]
+	return e
+}
+
+// schedule 把有過期時間的 key 加入過期索引，需要持有鎖
+// 新的 key 成為最早過期的 key 的時候喚醒後台 goroutine 重新計時
+func (b *BuildInMapCache) schedule(key string, itm *item) {
+	if itm.deadline.IsZero() {
+		return
+	}
+	itm.expiry = &expiryEntry{key: key, deadline: itm.deadline}
+	heap.Push(&b.expiries, itm.expiry)
+	if itm.expiry.index == 0 {
+		select {
+		case b.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// unschedule 從過期索引裡面移除 key，需要持有鎖
+func (b *BuildInMapCache) unschedule(itm *item) {
+	if itm.expiry == nil {
+		return
+	}
+	if itm.expiry.index >= 0 {
+		heap.Remove(&b.expiries, itm.expiry.index)
+	}
+	itm.expiry = nil
+}
+
+// expire 刪除已經過期的 key，需要持有鎖
+func (b *BuildInMapCache) expire(key string, itm *item) {
+	b.delete(key, EvictReasonExpire)
+	b.counters.Expire()
+	b.events.Publish(event.Event{Key: key, Val: itm.val, Type: event.TypeExpire})
+}
+
+// expireBatch 從堆頂開始刪除過期的 key，最多刪除 expireBatchSize 個
+// 返回刪除的數量，以及是否還有已經過期的 key 沒有刪除
+func (b *BuildInMapCache) expireBatch(now time.Time) (int, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	cnt := 0
+	for ; cnt < expireBatchSize; cnt++ {
+		if len(b.expiries) == 0 || b.expiries[0].deadline.After(now) {
+			return cnt, false
+		}
+		key := b.expiries[0].key
+		b.expire(key, b.data[key])
+	}
+	return cnt, len(b.expiries) > 0 && !b.expiries[0].deadline.After(now)
+}
+
+// nextExpiry 最早過期的 key 的過期時間，沒有帶過期時間的 key 的時候返回 false
+func (b *BuildInMapCache) nextExpiry() (time.Time, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if len(b.expiries) == 0 {
+		return time.Time{}, false
+	}
+	return b.expiries[0].deadline, true
+}
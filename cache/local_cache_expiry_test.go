@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildInMapCache_EvictReason(t *testing.T) {
+	ctx := context.Background()
+	var mu sync.Mutex
+	reasons := map[string]EvictReason{}
+	c := NewBuildInMapCache(time.Millisecond,
+		BuildInMapCacheWithOnEvictedReasonCallback(func(key string, val any, reason EvictReason) {
+			mu.Lock()
+			defer mu.Unlock()
+			reasons[key] = reason
+		}))
+	defer func() {
+		_ = c.Close()
+	}()
+
+	require.NoError(t, c.Set(ctx, "deleted", 1, 0))
+	require.NoError(t, c.Set(ctx, "expired", 2, time.Millisecond*10))
+	require.NoError(t, c.Set(ctx, "loaded", 3, time.Minute))
+	require.NoError(t, c.Delete(ctx, "deleted"))
+	_, err := c.LoadAndDelete(ctx, "loaded")
+	require.NoError(t, err)
+
+	// 不需要 Get，後台 goroutine 在過期時間到了之後就會刪除
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(reasons) == 3
+	}, time.Second, time.Millisecond*5)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, map[string]EvictReason{
+		"deleted": EvictReasonDelete,
+		"expired": EvictReasonExpire,
+		"loaded":  EvictReasonDelete,
+	}, reasons)
+}
+
+func TestBuildInMapCache_ExpiryIndex(t *testing.T) {
+	ctx := context.Background()
+	c := NewBuildInMapCache(time.Millisecond)
+	defer func() {
+		_ = c.Close()
+	}()
+
+	// 覆蓋、Persist 和 Expire 之後，過期索引裡面只有最新的過期時間
+	require.NoError(t, c.Set(ctx, "overwritten", 1, time.Millisecond*10))
+	require.NoError(t, c.Set(ctx, "overwritten", 1, 0))
+	require.NoError(t, c.Set(ctx, "persisted", 2, time.Millisecond*10))
+	ok, err := c.Persist(ctx, "persisted")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	require.NoError(t, c.Set(ctx, "extended", 3, time.Millisecond*10))
+	ok, err = c.Expire(ctx, "extended", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	require.NoError(t, c.Set(ctx, "shortened", 4, time.Minute))
+	ok, err = c.Expire(ctx, "shortened", time.Millisecond*10)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	assert.Eventually(t, func() bool {
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+		_, ok := c.data["shortened"]
+		return !ok
+	}, time.Second, time.Millisecond*5)
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	assert.Len(t, c.data, 3)
+	assert.Len(t, c.expiries, 1)
+	assert.Equal(t, "extended", c.expiries[0].key)
+}
+
+// 過期的 key 超過一批的數量的時候，分多次刪除，中間會釋放鎖
+func TestBuildInMapCache_ExpireBatch(t *testing.T) {
+	ctx := context.Background()
+	c := NewBuildInMapCache(time.Millisecond)
+	defer func() {
+		_ = c.Close()
+	}()
+	n := expireBatchSize*2 + 10
+	for i := 0; i < n; i++ {
+		require.NoError(t, c.Set(ctx, "key"+strconv.Itoa(i), i, time.Millisecond*10))
+	}
+	assert.Eventually(t, func() bool {
+		return c.Stats().Expirations == uint64(n)
+	}, time.Second, time.Millisecond*5)
+	require.NoError(t, c.Set(ctx, "key", 1, 0))
+	assert.Equal(t, 1, c.Stats().Keys)
+}
@@ -0,0 +1,515 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var (
+	errInvalidPersistenceFile = errors.New("cache: 無效的持久化文件")
+)
+
+const (
+	snapshotMagic = "LCS1"
+	aofMagic      = "LCA1"
+
+	// maxRecordBytes key、值或者標籤的最大長度，超過的認為文件已經損壞
+	maxRecordBytes = 1 << 30
+	// readChunk 讀取長數據的時候每次分配的大小，避免損壞的長度直接分配大量內存
+	readChunk = 64 << 10
+
+	opSet    byte = 1
+	opDelete byte = 2
+	// opSetWithTags 帶有標籤的 opSet，沒有標籤的時候仍然寫 opSet，兼容之前的文件
+	opSetWithTags byte = 3
+)
+
+// 快照和 AOF 使用同一種記錄格式，快照裡面只有 opSet 和 opSetWithTags
+// | op 1 byte | key 長度 uvarint | key | deadline UnixNano varint，0 表示不過期 | value 長度 uvarint | value |
+// opDelete 沒有 deadline 和 value
+// opSetWithTags 在 value 後面加上 | 標籤數量 uvarint | 每個標籤: 長度 uvarint | 標籤 |
+// opSet 和 opSetWithTags 記錄的是寫入時 key 所有的標籤，重放的時候直接替換原本的標籤
+// 這樣即使之前的記錄在重放的時候已經過期，也不會丟失標籤
+
+// BuildInMapCacheWithSnapshot 定期把數據保存到 path，interval 為 0 表示只在 Close 的時候保存
+// 保存的時候先寫臨時文件再改名，不會留下寫了一半的快照
+func BuildInMapCacheWithSnapshot(path string, interval time.Duration) BuildInMapCacheOption {
+	return func(cache *BuildInMapCache) {
+		cache.snapshotPath = path
+		cache.snapshotInterval = interval
+	}
+}
+
+// BuildInMapCacheWithAOF 把每一次 Set、Delete 追加到 path
+// 每次保存快照之後 AOF 會被清空，所以一般和 BuildInMapCacheWithSnapshot 一起使用
+// 寫入沒有 fsync，只能保證進程崩潰的時候不丟數據
+func BuildInMapCacheWithAOF(path string) BuildInMapCacheOption {
+	return func(cache *BuildInMapCache) {
+		cache.aofPath = path
+	}
+}
+
+// BuildInMapCacheWithValueCodec 值的編解碼方式，默認為 GobCodec
+// 值的類型為自定義類型的時候，使用 GobCodec 需要先 gob.Register
+func BuildInMapCacheWithValueCodec(codec Codec[any]) BuildInMapCacheOption {
+	return func(cache *BuildInMapCache) {
+		cache.codec = codec
+	}
+}
+
+// BuildInMapCacheWithPersistenceErrorHandler 定期保存快照失敗的回調
+func BuildInMapCacheWithPersistenceErrorHandler(f func(err error)) BuildInMapCacheOption {
+	return func(cache *BuildInMapCache) {
+		cache.persistErr = f
+	}
+}
+
+// OpenBuildInMapCache 創建開啟持久化的緩存
+// 啟動的時候先加載快照，再重放 AOF，已經過期的 key 會被跳過
+// AOF 末尾寫了一半的記錄 (e.g. 進程崩潰) 會被丟棄
+func OpenBuildInMapCache(interval time.Duration, opts ...BuildInMapCacheOption) (*BuildInMapCache, error) {
+	res := newBuildInMapCache(opts...)
+	if res.snapshotPath != "" {
+		if err := res.loadSnapshot(); err != nil {
+			return nil, err
+		}
+	}
+	if res.aofPath != "" {
+		if err := res.openAOF(); err != nil {
+			return nil, err
+		}
+	}
+	res.start(interval)
+	return res, nil
+}
+
+func (b *BuildInMapCache) persistent() bool {
+	return b.snapshotPath != "" || b.aofPath != ""
+}
+
+// Snapshot 把沒有過期的數據寫入 w
+// 只在複製數據的時候持有讀鎖，編碼和寫入 w 的時候不會阻塞讀寫
+func (b *BuildInMapCache) Snapshot(w io.Writer) error {
+	b.mu.RLock()
+	entries := b.snapshotEntries()
+	b.mu.RUnlock()
+	return b.writeSnapshot(w, entries)
+}
+
+type snapshotEntry struct {
+	key string
+	itm item
+}
+
+// snapshotEntries 複製沒有過期的數據，需要持有鎖
+// item 裡面的字段在寫入的時候都是整個替換的，所以淺拷貝就夠了
+func (b *BuildInMapCache) snapshotEntries() []snapshotEntry {
+	now := time.Now()
+	res := make([]snapshotEntry, 0, len(b.data))
+	for key, itm := range b.data {
+		if itm.deadlineBefore(now) {
+			continue
+		}
+		res = append(res, snapshotEntry{
+			key: key,
+			itm: item{val: itm.val, deadline: itm.deadline, tags: itm.tags},
+		})
+	}
+	return res
+}
+
+func (b *BuildInMapCache) writeSnapshot(w io.Writer, entries []snapshotEntry) error {
+	bw := bufio.NewWriter(w)
+	if _, err := bw.WriteString(snapshotMagic); err != nil {
+		return err
+	}
+	var buf []byte
+	for _, e := range entries {
+		val, err := b.codec.Encode(e.itm.val)
+		if err != nil {
+			return fmt.Errorf("cache: 編碼 key %s 失敗: %w", e.key, err)
+		}
+		buf = appendRecord(buf[:0], opSet, e.key, e.itm.deadline, val, e.itm.tags)
+		if _, err = bw.Write(buf); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// Restore 從 r 加載 Snapshot 寫入的數據，已經過期的 key 會被跳過
+// 已經存在的 key 會被覆蓋
+func (b *BuildInMapCache) Restore(r io.Reader) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	br := bufio.NewReader(r)
+	if err := readMagic(br, snapshotMagic); err != nil {
+		return err
+	}
+	_, err := b.replay(br)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("%w: 快照不完整", errInvalidPersistenceFile)
+	}
+	return err
+}
+
+// SaveSnapshot 把數據保存到 BuildInMapCacheWithSnapshot 指定的文件，並從 AOF 裡面去掉快照已經包含的記錄
+// 只在複製數據和整理 AOF 的時候持有鎖，編碼、寫文件和 fsync 的時候不會阻塞讀寫
+func (b *BuildInMapCache) SaveSnapshot() error {
+	if b.snapshotPath == "" {
+		return errors.New("cache: 沒有開啟快照")
+	}
+	// 同一時間只保存一個快照，保證快照和 AOF 的位置一一對應
+	b.snapshotMu.Lock()
+	defer b.snapshotMu.Unlock()
+
+	// 寫操作都持有寫鎖，所以讀鎖下複製的數據和 AOF 的位置是一致的
+	b.mu.RLock()
+	entries := b.snapshotEntries()
+	var offset int64
+	var err error
+	if b.aof != nil {
+		offset, err = b.aof.Seek(0, io.SeekCurrent)
+	}
+	b.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(b.snapshotPath), filepath.Base(b.snapshotPath)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err = b.writeSnapshot(tmp, entries); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), b.snapshotPath); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.aof == nil {
+		return nil
+	}
+	return b.compactAOF(offset)
+}
+
+// compactAOF 去掉 AOF 裡面 offset 之前的記錄，這些修改已經在快照裡面了，需要持有鎖
+// 保存快照期間寫入的記錄先寫到臨時文件再改名，崩潰的時候不會丟失
+// 如果在改名之前崩潰，重放完整的 AOF 也能得到一樣的結果，因為每條記錄都不依賴之前的記錄
+func (b *BuildInMapCache) compactAOF(offset int64) error {
+	end, err := b.aof.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if end == offset {
+		if err = b.aof.Truncate(int64(len(aofMagic))); err != nil {
+			return err
+		}
+		_, err = b.aof.Seek(0, io.SeekEnd)
+		return err
+	}
+	tail := make([]byte, end-offset)
+	if _, err = b.aof.ReadAt(tail, offset); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(b.aofPath), filepath.Base(b.aofPath)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err = f.WriteString(aofMagic); err == nil {
+		_, err = f.Write(tail)
+	}
+	if err == nil {
+		err = f.Chmod(0o644)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), b.aofPath)
+	}
+	if err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return err
+	}
+	old := b.aof
+	b.aof = f
+	return old.Close()
+}
+
+func (b *BuildInMapCache) loadSnapshot() error {
+	f, err := os.Open(b.snapshotPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return b.Restore(f)
+}
+
+func (b *BuildInMapCache) openAOF() error {
+	f, err := os.OpenFile(b.aofPath, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	if info.Size() == 0 {
+		if _, err = f.WriteString(aofMagic); err != nil {
+			_ = f.Close()
+			return err
+		}
+		b.aof = f
+		return nil
+	}
+	br := bufio.NewReader(f)
+	if err = readMagic(br, aofMagic); err != nil {
+		_ = f.Close()
+		return err
+	}
+	n, err := b.replay(br)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		_ = f.Close()
+		return err
+	}
+	// 丟掉末尾不完整的記錄，後面的記錄從最後一條完整記錄之後開始寫
+	end := int64(len(aofMagic)) + n
+	if err = f.Truncate(end); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if _, err = f.Seek(end, io.SeekStart); err != nil {
+		_ = f.Close()
+		return err
+	}
+	b.aof = f
+	return nil
+}
+
+func (b *BuildInMapCache) appendSet(key string, value any, dl time.Time, tags []string) error {
+	val, err := b.codec.Encode(value)
+	if err != nil {
+		return fmt.Errorf("cache: 編碼 key %s 失敗: %w", key, err)
+	}
+	_, err = b.aof.Write(appendRecord(nil, opSet, key, dl, val, tags))
+	return err
+}
+
+// appendDelete 所有刪除操作都會先調用，Close 之後返回 errCacheClosed
+func (b *BuildInMapCache) appendDelete(key string) error {
+	if b.closed {
+		return errCacheClosed
+	}
+	if b.aof == nil {
+		return nil
+	}
+	_, err := b.aof.Write(appendRecord(nil, opDelete, key, time.Time{}, nil, nil))
+	return err
+}
+
+// replay 把記錄應用到 data 上，不觸發 onEvicted
+// 返回最後一條完整記錄結束的位置，記錄不完整的時候返回 io.ErrUnexpectedEOF
+func (b *BuildInMapCache) replay(r *bufio.Reader) (int64, error) {
+	now := time.Now()
+	cr := &countingReader{r: r}
+	var n int64
+	for {
+		op, key, dl, val, tags, err := readRecord(cr)
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+		n = cr.n
+		old, exist := b.data[key]
+		if exist {
+			b.unschedule(old)
+		}
+		switch op {
+		case opSet, opSetWithTags:
+			// 之前的值已經被覆蓋了，所以過期的記錄等同於刪除
+			if !dl.IsZero() && dl.Before(now) {
+				b.drop(key, old, exist)
+				continue
+			}
+			v, err := b.codec.Decode(val)
+			if err != nil {
+				return n, fmt.Errorf("cache: 解碼 key %s 失敗: %w", key, err)
+			}
+			b.version++
+			itm := &item{val: v, deadline: dl, version: b.version}
+			if exist {
+				b.untag(key, old)
+				b.used -= entrySize(key, old.val)
+			}
+			b.data[key] = itm
+			b.used += entrySize(key, v)
+			b.tag(key, itm, tags)
+			b.schedule(key, itm)
+		case opDelete:
+			b.drop(key, old, exist)
+		default:
+			return n, fmt.Errorf("%w: 未知的操作 %d", errInvalidPersistenceFile, op)
+		}
+	}
+}
+
+// drop 重放的時候刪除 key，需要持有鎖
+func (b *BuildInMapCache) drop(key string, old *item, exist bool) {
+	if exist {
+		b.untag(key, old)
+		b.used -= entrySize(key, old.val)
+	}
+	delete(b.data, key)
+}
+
+// appendRecord op 為 opSet 並且有標籤的時候寫入 opSetWithTags
+func appendRecord(buf []byte, op byte, key string, deadline time.Time, val []byte, tags []string) []byte {
+	if op == opSet && len(tags) > 0 {
+		op = opSetWithTags
+	}
+	buf = append(buf, op)
+	buf = binary.AppendUvarint(buf, uint64(len(key)))
+	buf = append(buf, key...)
+	if op == opDelete {
+		return buf
+	}
+	var dl int64
+	if !deadline.IsZero() {
+		dl = deadline.UnixNano()
+	}
+	buf = binary.AppendVarint(buf, dl)
+	buf = binary.AppendUvarint(buf, uint64(len(val)))
+	buf = append(buf, val...)
+	if op != opSetWithTags {
+		return buf
+	}
+	buf = binary.AppendUvarint(buf, uint64(len(tags)))
+	for _, tag := range tags {
+		buf = binary.AppendUvarint(buf, uint64(len(tag)))
+		buf = append(buf, tag...)
+	}
+	return buf
+}
+
+// readRecord 沒有任何數據的時候返回 io.EOF，只讀到一部分的時候返回 io.ErrUnexpectedEOF
+func readRecord(r *countingReader) (op byte, key string, deadline time.Time, val []byte, tags []string, err error) {
+	op, err = r.ReadByte()
+	if err != nil {
+		return
+	}
+	keyBytes, err := readBytes(r)
+	if err != nil {
+		return
+	}
+	key = string(keyBytes)
+	if op == opDelete {
+		return
+	}
+	dl, err := binary.ReadVarint(r)
+	if err != nil {
+		err = unexpectedEOF(err)
+		return
+	}
+	if dl != 0 {
+		deadline = time.Unix(0, dl)
+	}
+	val, err = readBytes(r)
+	if err != nil || op != opSetWithTags {
+		return
+	}
+	cnt, err := binary.ReadUvarint(r)
+	if err != nil {
+		err = unexpectedEOF(err)
+		return
+	}
+	for i := uint64(0); i < cnt; i++ {
+		var tag []byte
+		if tag, err = readBytes(r); err != nil {
+			return
+		}
+		tags = append(tags, string(tag))
+	}
+	return
+}
+
+// readBytes 長度來自文件，不可信，所以超過 readChunk 的時候按照實際讀到的數據分配內存
+// 文件被截斷的時候返回 io.ErrUnexpectedEOF，而不是先分配長度對應的內存
+func readBytes(r *countingReader) ([]byte, error) {
+	l, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if l > maxRecordBytes {
+		return nil, fmt.Errorf("%w: 長度 %d 超過上限", errInvalidPersistenceFile, l)
+	}
+	if l <= readChunk {
+		buf := make([]byte, l)
+		if _, err = io.ReadFull(r, buf); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		return buf, nil
+	}
+	var buf bytes.Buffer
+	buf.Grow(readChunk)
+	if _, err = io.CopyN(&buf, r, int64(l)); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return buf.Bytes(), nil
+}
+
+func readMagic(r io.Reader, magic string) error {
+	buf := make([]byte, len(magic))
+	if _, err := io.ReadFull(r, buf); err != nil || !bytes.Equal(buf, []byte(magic)) {
+		return errInvalidPersistenceFile
+	}
+	return nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// countingReader 記錄讀了多少字節，用於找到 AOF 最後一條完整記錄的位置
+type countingReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
@@ -0,0 +1,304 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/gob"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func init() {
+	gob.Register(testUser{})
+}
+
+func TestBuildInMapCache_SnapshotRestore(t *testing.T) {
+	ctx := context.Background()
+	c := NewBuildInMapCache(time.Minute)
+	require.NoError(t, c.Set(ctx, "int", 123, 0))
+	require.NoError(t, c.Set(ctx, "string", "abc", time.Minute))
+	require.NoError(t, c.Set(ctx, "user", testUser{Name: "Tom", Age: 18}, time.Minute))
+	require.NoError(t, c.Set(ctx, "expired", "abc", time.Millisecond))
+	time.Sleep(time.Millisecond * 10)
+
+	var buf bytes.Buffer
+	require.NoError(t, c.Snapshot(&buf))
+
+	restored := NewBuildInMapCache(time.Minute)
+	require.NoError(t, restored.Restore(bytes.NewReader(buf.Bytes())))
+	testCases := []struct {
+		key     string
+		wantVal any
+	}{
+		{key: "int", wantVal: 123},
+		{key: "string", wantVal: "abc"},
+		{key: "user", wantVal: testUser{Name: "Tom", Age: 18}},
+	}
+	for _, tc := range testCases {
+		val, err := restored.Get(ctx, tc.key)
+		require.NoError(t, err)
+		assert.Equal(t, tc.wantVal, val)
+	}
+	_, err := restored.Get(ctx, "expired")
+	assert.ErrorIs(t, err, errKeyNotFound)
+
+	// 過期時間保持不變
+	assert.True(t, restored.data["int"].deadline.IsZero())
+	assert.True(t, c.data["string"].deadline.Equal(restored.data["string"].deadline))
+
+	// 不完整的快照
+	err = restored.Restore(bytes.NewReader(buf.Bytes()[:buf.Len()-1]))
+	assert.ErrorIs(t, err, errInvalidPersistenceFile)
+	err = restored.Restore(bytes.NewReader([]byte("abc")))
+	assert.ErrorIs(t, err, errInvalidPersistenceFile)
+}
+
+func TestBuildInMapCache_ValueCodec(t *testing.T) {
+	ctx := context.Background()
+	c := NewBuildInMapCache(time.Minute, BuildInMapCacheWithValueCodec(JSONCodec[any]{}))
+	require.NoError(t, c.Set(ctx, "user", map[string]any{"name": "Tom"}, 0))
+	var buf bytes.Buffer
+	require.NoError(t, c.Snapshot(&buf))
+
+	restored := NewBuildInMapCache(time.Minute, BuildInMapCacheWithValueCodec(JSONCodec[any]{}))
+	require.NoError(t, restored.Restore(&buf))
+	val, err := restored.Get(ctx, "user")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"name": "Tom"}, val)
+
+	// 編碼失敗
+	require.NoError(t, c.Set(ctx, "func", func() {}, 0))
+	assert.Error(t, c.Snapshot(&buf))
+}
+
+func TestOpenBuildInMapCache(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	snapshotPath := filepath.Join(dir, "cache.snapshot")
+	aofPath := filepath.Join(dir, "cache.aof")
+	open := func() *BuildInMapCache {
+		c, err := OpenBuildInMapCache(time.Minute,
+			BuildInMapCacheWithSnapshot(snapshotPath, 0),
+			BuildInMapCacheWithAOF(aofPath))
+		require.NoError(t, err)
+		return c
+	}
+
+	// 沒有任何文件的時候啟動
+	c := open()
+	require.NoError(t, c.Set(ctx, "key1", "val1", 0))
+	require.NoError(t, c.Set(ctx, "key2", "val2", time.Minute))
+	require.NoError(t, c.SaveSnapshot())
+	info, err := os.Stat(aofPath)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(aofMagic)), info.Size())
+
+	// 快照之後的修改只在 AOF 裡面
+	require.NoError(t, c.Set(ctx, "key3", "val3", 0))
+	require.NoError(t, c.Delete(ctx, "key1"))
+	_, err = c.LoadAndDelete(ctx, "key2")
+	require.NoError(t, err)
+	require.NoError(t, c.Set(ctx, "key4", "val4", time.Millisecond*10))
+	// 模擬進程崩潰，不調用 Close
+	require.NoError(t, c.aof.Close())
+	time.Sleep(time.Millisecond * 20)
+
+	c = open()
+	assert.Equal(t, map[string]any{"key3": "val3"}, values(c))
+	require.NoError(t, c.Set(ctx, "key5", "val5", 0))
+	require.NoError(t, c.Close())
+
+	// Close 會保存快照
+	info, err = os.Stat(aofPath)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(aofMagic)), info.Size())
+	c = open()
+	assert.Equal(t, map[string]any{"key3": "val3", "key5": "val5"}, values(c))
+	require.NoError(t, c.Close())
+}
+
+func TestOpenBuildInMapCache_TruncatedAOF(t *testing.T) {
+	ctx := context.Background()
+	aofPath := filepath.Join(t.TempDir(), "cache.aof")
+	c, err := OpenBuildInMapCache(time.Minute, BuildInMapCacheWithAOF(aofPath))
+	require.NoError(t, err)
+	require.NoError(t, c.Set(ctx, "key1", "val1", 0))
+	require.NoError(t, c.Set(ctx, "key2", "val2", 0))
+	require.NoError(t, c.Close())
+
+	// 最後一條記錄只寫了一半
+	info, err := os.Stat(aofPath)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(aofPath, info.Size()-2))
+
+	c, err = OpenBuildInMapCache(time.Minute, BuildInMapCacheWithAOF(aofPath))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"key1": "val1"}, values(c))
+	require.NoError(t, c.Set(ctx, "key3", "val3", 0))
+	require.NoError(t, c.Close())
+
+	c, err = OpenBuildInMapCache(time.Minute, BuildInMapCacheWithAOF(aofPath))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"key1": "val1", "key3": "val3"}, values(c))
+	require.NoError(t, c.Close())
+
+	// 不是 AOF 文件
+	require.NoError(t, os.WriteFile(aofPath, []byte("abcdef"), 0o644))
+	_, err = OpenBuildInMapCache(time.Minute, BuildInMapCacheWithAOF(aofPath))
+	assert.ErrorIs(t, err, errInvalidPersistenceFile)
+}
+
+func TestOpenBuildInMapCache_SaveSnapshotConcurrentWrite(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	codec := &blockingCodec{encoding: make(chan struct{}), release: make(chan struct{})}
+	open := func() *BuildInMapCache {
+		c, err := OpenBuildInMapCache(time.Minute,
+			BuildInMapCacheWithSnapshot(filepath.Join(dir, "cache.snapshot"), 0),
+			BuildInMapCacheWithAOF(filepath.Join(dir, "cache.aof")),
+			BuildInMapCacheWithValueCodec(codec))
+		require.NoError(t, err)
+		return c
+	}
+	c := open()
+	require.NoError(t, c.Set(ctx, "key1", "val1", 0))
+
+	codec.block.Store(true)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.SaveSnapshot()
+	}()
+	<-codec.encoding
+	codec.block.Store(false)
+	// 編碼快照的時候不會阻塞讀寫，期間的修改保留在 AOF 裡面
+	val, err := c.Get(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, "val1", val)
+	require.NoError(t, c.Set(ctx, "key2", "val2", 0))
+	require.NoError(t, c.Delete(ctx, "key1"))
+	close(codec.release)
+	require.NoError(t, <-done)
+
+	// 模擬進程崩潰，從快照和 AOF 恢復
+	require.NoError(t, c.aof.Close())
+	c = open()
+	defer c.Close()
+	assert.Equal(t, map[string]any{"key2": "val2"}, values(c))
+}
+
+// blockingCodec block 為 true 的時候，Encode 通知 encoding 並且等待 release
+type blockingCodec struct {
+	GobCodec[any]
+	block    atomic.Bool
+	encoding chan struct{}
+	release  chan struct{}
+}
+
+func (c *blockingCodec) Encode(val any) ([]byte, error) {
+	if c.block.Load() {
+		c.encoding <- struct{}{}
+		<-c.release
+	}
+	return c.GobCodec.Encode(val)
+}
+
+func TestOpenBuildInMapCache_CorruptLength(t *testing.T) {
+	// 長度字段損壞，後面沒有對應的數據
+	record := func(l uint64) []byte {
+		buf := []byte{opSet}
+		buf = binary.AppendUvarint(buf, 4)
+		buf = append(buf, "key1"...)
+		buf = binary.AppendVarint(buf, 0)
+		return binary.AppendUvarint(buf, l)
+	}
+	testCases := []struct {
+		name string
+		l    uint64
+		// 沒有超過上限的當作寫了一半的記錄截斷
+		wantErr error
+	}{
+		{name: "truncated", l: maxRecordBytes},
+		{name: "too large", l: math.MaxUint64, wantErr: errInvalidPersistenceFile},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			snapshot := append([]byte(snapshotMagic), record(tc.l)...)
+			err := newBuildInMapCache().Restore(bytes.NewReader(snapshot))
+			assert.ErrorIs(t, err, errInvalidPersistenceFile)
+
+			aofPath := filepath.Join(t.TempDir(), "cache.aof")
+			require.NoError(t, os.WriteFile(aofPath, append([]byte(aofMagic), record(tc.l)...), 0o644))
+			c, err := OpenBuildInMapCache(time.Minute, BuildInMapCacheWithAOF(aofPath))
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Empty(t, values(c))
+			require.NoError(t, c.Close())
+			info, err := os.Stat(aofPath)
+			require.NoError(t, err)
+			assert.Equal(t, int64(len(aofMagic)), info.Size())
+		})
+	}
+}
+
+func TestOpenBuildInMapCache_PeriodicSnapshot(t *testing.T) {
+	ctx := context.Background()
+	snapshotPath := filepath.Join(t.TempDir(), "cache.snapshot")
+	c, err := OpenBuildInMapCache(time.Minute, BuildInMapCacheWithSnapshot(snapshotPath, time.Millisecond*50))
+	require.NoError(t, err)
+	defer c.Close()
+	require.NoError(t, c.Set(ctx, "key1", "val1", 0))
+	time.Sleep(time.Millisecond * 150)
+
+	restored, err := OpenBuildInMapCache(time.Minute, BuildInMapCacheWithSnapshot(snapshotPath, 0))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"key1": "val1"}, values(restored))
+}
+
+func TestNewBuildInMapCache_Persistence(t *testing.T) {
+	assert.Panics(t, func() {
+		NewBuildInMapCache(time.Minute, BuildInMapCacheWithAOF("cache.aof"))
+	})
+}
+
+func values(c *BuildInMapCache) map[string]any {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	res := make(map[string]any, len(c.data))
+	for key, itm := range c.data {
+		res[key] = itm.val
+	}
+	return res
+}
+
+func TestOpenBuildInMapCache_WriteAfterClose(t *testing.T) {
+	ctx := context.Background()
+	aofPath := filepath.Join(t.TempDir(), "cache.aof")
+	c, err := OpenBuildInMapCache(time.Minute, BuildInMapCacheWithAOF(aofPath))
+	require.NoError(t, err)
+	require.NoError(t, c.Set(ctx, "key1", "val1", 0))
+	require.NoError(t, c.Close())
+
+	// 關閉之後的修改沒辦法持久化，直接返回錯誤
+	assert.Equal(t, errCacheClosed, c.Set(ctx, "key2", "val2", 0))
+	assert.Equal(t, errCacheClosed, c.Delete(ctx, "key1"))
+	_, err = c.LoadAndDelete(ctx, "key1")
+	assert.Equal(t, errCacheClosed, err)
+	val, err := c.Get(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, "val1", val)
+
+	c, err = OpenBuildInMapCache(time.Minute, BuildInMapCacheWithAOF(aofPath))
+	require.NoError(t, err)
+	defer c.Close()
+	assert.Equal(t, map[string]any{"key1": "val1"}, values(c))
+}
@@ -0,0 +1,68 @@
+package cache
+
+import (
+	"geektime-go/cache/stats"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	_ stats.Provider  = (*BuildInMapCache)(nil)
+	_ stats.KeyLister = (*BuildInMapCache)(nil)
+)
+
+// Stats BuildInMapCache 沒有容量限制，所以 Evictions 一直為 0
+// UsedBytes 為 key 和值的估算大小，見 entrySize
+// 和 Keys 一樣包括已經過期但是還沒被刪除的 key
+func (b *BuildInMapCache) Stats() stats.Stats {
+	res := b.counters.Snapshot()
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	res.Keys = len(b.data)
+	res.UsedBytes = b.used
+	return res
+}
+
+// KeyStats 所有沒有過期的 key，會遍歷整個緩存，只用於調試
+func (b *BuildInMapCache) KeyStats() []stats.KeyInfo {
+	now := time.Now()
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	res := make([]stats.KeyInfo, 0, len(b.data))
+	for key, itm := range b.data {
+		if itm.deadlineBefore(now) {
+			continue
+		}
+		res = append(res, stats.KeyInfo{
+			Key:      key,
+			Size:     entrySize(key, itm.val),
+			Accesses: atomic.LoadUint64(&itm.accesses),
+		})
+	}
+	return res
+}
+
+// entrySize 一個 key 佔用的大小
+func entrySize(key string, val any) int64 {
+	return int64(len(key)) + sizeOf(val)
+}
+
+// sizeOf 值的大小，只計算 []byte、string 和數字，其他類型按照一個接口的大小估算
+func sizeOf(val any) int64 {
+	switch v := val.(type) {
+	case []byte:
+		return int64(len(v))
+	case string:
+		return int64(len(v))
+	case bool, int8, uint8:
+		return 1
+	case int16, uint16:
+		return 2
+	case int32, uint32, float32:
+		return 4
+	case int, int64, uint, uint64, float64, time.Duration:
+		return 8
+	default:
+		return 16
+	}
+}
@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"context"
+	"geektime-go/cache/stats"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBuildInMapCache_Stats(t *testing.T) {
+	ctx := context.Background()
+	c := NewBuildInMapCache(time.Minute)
+	defer c.Close()
+	require.NoError(t, c.Set(ctx, "key1", "value1", 0))
+	require.NoError(t, c.Set(ctx, "key2", []byte("value22"), 0))
+	require.NoError(t, c.Set(ctx, "key3", 123, time.Millisecond))
+	require.NoError(t, c.Set(ctx, "key4", "value4", 0))
+	time.Sleep(time.Millisecond * 5)
+
+	for i := 0; i < 3; i++ {
+		_, err := c.Get(ctx, "key1")
+		require.NoError(t, err)
+	}
+	_, err := c.Get(ctx, "key2")
+	require.NoError(t, err)
+	_, err = c.Get(ctx, "key3")
+	assert.ErrorIs(t, err, errKeyNotFound)
+	_, err = c.Get(ctx, "not exist")
+	assert.ErrorIs(t, err, errKeyNotFound)
+	require.NoError(t, c.Delete(ctx, "key4"))
+	// 不存在的 key 不算刪除
+	require.NoError(t, c.Delete(ctx, "key4"))
+
+	assert.Equal(t, stats.Stats{
+		Hits:        4,
+		Misses:      2,
+		Sets:        4,
+		Deletes:     1,
+		Expirations: 1,
+		Keys:        2,
+		UsedBytes:   4 + 6 + 4 + 7,
+	}, c.Stats())
+
+	keys := stats.TopKeys(c.KeyStats(), stats.OrderByAccesses, 10)
+	assert.Equal(t, []stats.KeyInfo{
+		{Key: "key1", Size: 10, Accesses: 3},
+		{Key: "key2", Size: 11, Accesses: 1},
+	}, keys)
+}
+
+func TestBuildInMapCache_UsedBytes(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	open := func() *BuildInMapCache {
+		c, err := OpenBuildInMapCache(time.Millisecond,
+			BuildInMapCacheWithAOF(filepath.Join(dir, "cache.aof")))
+		require.NoError(t, err)
+		return c
+	}
+
+	c := open()
+	require.NoError(t, c.Set(ctx, "key1", "value1", 0))
+	// 覆蓋的時候減去原本的大小
+	require.NoError(t, c.Set(ctx, "key1", "v", 0))
+	require.NoError(t, c.Set(ctx, "key2", []byte("value2"), 0))
+	require.NoError(t, c.Set(ctx, "key3", 123, time.Millisecond*10))
+	_, err := c.LoadAndDelete(ctx, "key2")
+	require.NoError(t, err)
+	assert.Equal(t, int64(4+1+4+8), c.Stats().UsedBytes)
+	// 後台 goroutine 刪除過期的 key
+	assert.Eventually(t, func() bool {
+		return c.Stats().UsedBytes == 4+1
+	}, time.Second, time.Millisecond*10)
+	require.NoError(t, c.Close())
+
+	// 重放 AOF 之後一樣
+	c = open()
+	defer c.Close()
+	assert.Equal(t, int64(4+1), c.Stats().UsedBytes)
+}
@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+var _ TagCache = (*BuildInMapCache)(nil)
+
+// SetWithTags 標籤和值一起寫入快照和 AOF，重啟之後 InvalidateTag 仍然能找到恢復的 key
+func (b *BuildInMapCache) SetWithTags(ctx context.Context, key string, value any,
+	expiration time.Duration, tags ...string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.set(ctx, key, value, expiration, tags...)
+}
+
+// tag 給 key 加上標籤並且更新索引，需要持有鎖
+func (b *BuildInMapCache) tag(key string, itm *item, tags []string) {
+	if b.tags == nil && len(tags) > 0 {
+		b.tags = make(map[string]map[string]struct{}, len(tags))
+	}
+	for _, tag := range tags {
+		keys, ok := b.tags[tag]
+		if !ok {
+			keys = make(map[string]struct{})
+			b.tags[tag] = keys
+		}
+		if _, ok = keys[key]; !ok {
+			keys[key] = struct{}{}
+			itm.tags = append(itm.tags, tag)
+		}
+	}
+}
+
+// InvalidateTag 只會訪問帶有這些標籤的 key，不會遍歷整個緩存
+func (b *BuildInMapCache) InvalidateTag(ctx context.Context, tags ...string) (int, error) {
+	now := time.Now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	cnt := 0
+	for _, tag := range tags {
+		// remove 會修改 b.tags[tag]，在 range 裡面刪除 map 的元素是安全的
+		for key := range b.tags[tag] {
+			itm := b.data[key]
+			if itm.deadlineBefore(now) {
+				if err := b.appendDelete(key); err != nil {
+					return cnt, err
+				}
+				b.expire(key, itm)
+				continue
+			}
+			if err := b.remove(key, itm); err != nil {
+				return cnt, err
+			}
+			cnt++
+		}
+	}
+	return cnt, nil
+}
+
+// mergeTags 合併兩組標籤並去重，返回新的切片
+func mergeTags(old []string, tags []string) []string {
+	if len(old) == 0 && len(tags) == 0 {
+		return nil
+	}
+	res := make([]string, 0, len(old)+len(tags))
+	seen := make(map[string]struct{}, len(old)+len(tags))
+	for _, list := range [][]string{old, tags} {
+		for _, tag := range list {
+			if _, ok := seen[tag]; !ok {
+				seen[tag] = struct{}{}
+				res = append(res, tag)
+			}
+		}
+	}
+	return res
+}
+
+// untag 從標籤的索引裡面移除 key，需要持有鎖
+func (b *BuildInMapCache) untag(key string, itm *item) {
+	for _, tag := range itm.tags {
+		keys := b.tags[tag]
+		delete(keys, key)
+		if len(keys) == 0 {
+			delete(b.tags, tag)
+		}
+	}
+	itm.tags = nil
+}
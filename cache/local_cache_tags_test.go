@@ -0,0 +1,133 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBuildInMapCache_InvalidateTag(t *testing.T) {
+	ctx := context.Background()
+	var evicted []string
+	c := NewBuildInMapCache(time.Minute, BuildInMapCacheWithOnEvictedCallback(func(key string, val any) {
+		evicted = append(evicted, key)
+	}))
+	defer c.Close()
+	require.NoError(t, c.SetWithTags(ctx, "profile:42", "Tom", 0, "user:42"))
+	require.NoError(t, c.SetWithTags(ctx, "perm:42", "admin", 0, "user:42", "perm"))
+	require.NoError(t, c.SetWithTags(ctx, "perm:43", "guest", 0, "user:43", "perm"))
+	require.NoError(t, c.SetWithTags(ctx, "feed:42", "page1", time.Millisecond, "user:42"))
+	require.NoError(t, c.Set(ctx, "other", "val", 0))
+	// 覆蓋的時候保留原本的標籤
+	require.NoError(t, c.Set(ctx, "profile:42", "Jerry", 0))
+	time.Sleep(time.Millisecond * 5)
+
+	n, err := c.InvalidateTag(ctx, "user:42")
+	require.NoError(t, err)
+	// 過期的 feed:42 不計算在內
+	assert.Equal(t, 2, n)
+	assert.ElementsMatch(t, []string{"profile:42", "perm:42", "feed:42"}, evicted)
+	assert.Equal(t, map[string]any{"perm:43": "guest", "other": "val"}, values(c))
+	// perm:42 被刪除之後，索引裡面也沒有了
+	assert.Equal(t, map[string]map[string]struct{}{
+		"user:43": {"perm:43": {}},
+		"perm":    {"perm:43": {}},
+	}, c.tags)
+
+	// 刪除之後重新寫入的 key 不再帶有標籤
+	require.NoError(t, c.Set(ctx, "perm:42", "guest", 0))
+	n, err = c.InvalidateTag(ctx, "perm", "user:42", "unknown")
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, map[string]any{"perm:42": "guest", "other": "val"}, values(c))
+	assert.Empty(t, c.tags)
+}
+
+func TestBuildInMapCache_TagsRestore(t *testing.T) {
+	ctx := context.Background()
+	c := NewBuildInMapCache(time.Minute)
+	defer c.Close()
+	require.NoError(t, c.SetWithTags(ctx, "key1", "val1", 0, "tag1"))
+	require.NoError(t, c.SetWithTags(ctx, "key2", "val2", 0, "tag1", "tag2"))
+	require.NoError(t, c.Set(ctx, "key3", "val3", 0))
+	var buf bytes.Buffer
+	require.NoError(t, c.Snapshot(&buf))
+
+	// 標籤和值一起恢復
+	restored := NewBuildInMapCache(time.Minute)
+	defer restored.Close()
+	require.NoError(t, restored.Restore(&buf))
+	n, err := restored.InvalidateTag(ctx, "tag2")
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, map[string]any{"key1": "val1", "key3": "val3"}, values(restored))
+	assert.Equal(t, map[string]map[string]struct{}{
+		"tag1": {"key1": {}},
+	}, restored.tags)
+}
+
+func TestOpenBuildInMapCache_Tags(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	open := func() *BuildInMapCache {
+		c, err := OpenBuildInMapCache(time.Minute,
+			BuildInMapCacheWithSnapshot(filepath.Join(dir, "cache.snapshot"), 0),
+			BuildInMapCacheWithAOF(filepath.Join(dir, "cache.aof")))
+		require.NoError(t, err)
+		return c
+	}
+
+	c := open()
+	require.NoError(t, c.SetWithTags(ctx, "key1", "val1", 0, "tag1"))
+	// 覆蓋的時候保留原本的標籤，重放之後也一樣
+	require.NoError(t, c.Set(ctx, "key1", "val2", 0))
+	require.NoError(t, c.SetWithTags(ctx, "key2", "val2", 0, "tag1"))
+	require.NoError(t, c.Delete(ctx, "key2"))
+	require.NoError(t, c.SetWithTags(ctx, "key3", "val3", 0, "tag2"))
+	// 模擬進程崩潰，只能從 AOF 恢復
+	require.NoError(t, c.aof.Close())
+
+	c = open()
+	assert.Equal(t, map[string]map[string]struct{}{
+		"tag1": {"key1": {}},
+		"tag2": {"key3": {}},
+	}, c.tags)
+	n, err := c.InvalidateTag(ctx, "tag1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	// Close 保存快照，從快照恢復
+	require.NoError(t, c.Close())
+
+	c = open()
+	defer c.Close()
+	n, err = c.InvalidateTag(ctx, "tag2")
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Empty(t, values(c))
+}
+
+func TestOpenBuildInMapCache_TagsExpiredRecord(t *testing.T) {
+	ctx := context.Background()
+	aof := filepath.Join(t.TempDir(), "cache.aof")
+	c, err := OpenBuildInMapCache(time.Minute, BuildInMapCacheWithAOF(aof))
+	require.NoError(t, err)
+	require.NoError(t, c.SetWithTags(ctx, "key1", "val1", time.Millisecond*50, "tag1"))
+	// 還沒過期的時候覆蓋，保留標籤
+	require.NoError(t, c.Set(ctx, "key1", "val2", 0))
+	require.NoError(t, c.aof.Close())
+
+	// 重啟的時候第一條記錄已經過期，標籤來自第二條記錄
+	time.Sleep(time.Millisecond * 100)
+	c, err = OpenBuildInMapCache(time.Minute, BuildInMapCacheWithAOF(aof))
+	require.NoError(t, err)
+	defer c.Close()
+	assert.Equal(t, map[string]map[string]struct{}{"tag1": {"key1": {}}}, c.tags)
+	n, err := c.InvalidateTag(ctx, "tag1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Empty(t, values(c))
+}
@@ -3,6 +3,7 @@ package cache
 import (
 	"context"
 	"fmt"
+	"geektime-go/cache/event"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"testing"
@@ -79,3 +80,41 @@ func TestBuildInMapCache_Loop(t *testing.T) {
 	assert.False(t, ok)
 	assert.Equal(t, 1, count)
 }
+
+func TestBuildInMapCache_Subscribe(t *testing.T) {
+	ctx := context.Background()
+	cache := NewBuildInMapCache(time.Millisecond * 10)
+	all := cache.Subscribe()
+	users := cache.Subscribe(event.SubscribeWithPrefix("user:"))
+
+	require.NoError(t, cache.Set(ctx, "user:1", "Tom", 0))
+	require.NoError(t, cache.Set(ctx, "order:1", 100, time.Millisecond*10))
+	require.NoError(t, cache.Delete(ctx, "user:1"))
+	// 不存在的 key 沒有事件
+	require.NoError(t, cache.Delete(ctx, "user:1"))
+	require.NoError(t, cache.Set(ctx, "user:2", "Jerry", 0))
+	_, err := cache.LoadAndDelete(ctx, "user:2")
+	require.NoError(t, err)
+	// 等待後台 goroutine 刪除過期的 key
+	time.Sleep(time.Millisecond * 50)
+	require.NoError(t, cache.Close())
+
+	var events []event.Event
+	for e := range all.Events() {
+		events = append(events, e)
+	}
+	assert.Equal(t, []event.Event{
+		{Key: "user:1", Val: "Tom", Type: event.TypeSet},
+		{Key: "order:1", Val: 100, Type: event.TypeSet},
+		{Key: "user:1", Val: "Tom", Type: event.TypeDelete},
+		{Key: "user:2", Val: "Jerry", Type: event.TypeSet},
+		{Key: "user:2", Val: "Jerry", Type: event.TypeDelete},
+		{Key: "order:1", Val: 100, Type: event.TypeExpire},
+	}, events)
+
+	events = events[:0]
+	for e := range users.Events() {
+		events = append(events, e)
+	}
+	assert.Len(t, events, 4)
+}
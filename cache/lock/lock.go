@@ -0,0 +1,291 @@
+// Package lock 分佈式鎖
+//
+//	client := lock.NewClient(lock.NewRedisBackend(redisClient))
+//	l, err := client.Lock(ctx, "cron:report", time.Minute, lock.NewFixedIntervalRetry(time.Second, 10))
+//	if err != nil {
+//		return err
+//	}
+//	defer l.Unlock(context.Background())
+//	go l.AutoRefresh(time.Second*20, time.Second)
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrLockNotObtained 鎖被其他人持有
+	ErrLockNotObtained = errors.New("lock: 搶鎖失敗")
+	// ErrLockNotHeld 鎖已經過期或者被其他人持有
+	ErrLockNotHeld = errors.New("lock: 未持有鎖")
+)
+
+// Backend 存儲鎖的後端，所有操作都必須是原子的
+type Backend interface {
+	// Acquire key 不存在的時候設置為 token；
+	// key 的值已經是 token 的時候 (e.g. 上一次請求超時但其實成功了) 重置過期時間
+	// 返回是否拿到鎖
+	Acquire(ctx context.Context, key string, token string, ttl time.Duration) (bool, error)
+	// Release key 的值為 token 的時候刪除，返回是否刪除了
+	Release(ctx context.Context, key string, token string) (bool, error)
+	// Refresh key 的值為 token 的時候重置過期時間，返回是否成功
+	Refresh(ctx context.Context, key string, token string, ttl time.Duration) (bool, error)
+}
+
+type Client struct {
+	backend Backend
+}
+
+func NewClient(backend Backend) *Client {
+	return &Client{backend: backend}
+}
+
+// TryLock 只嘗試一次，鎖被其他人持有的時候返回 ErrLockNotObtained
+func (c *Client) TryLock(ctx context.Context, key string, ttl time.Duration) (*Lock, error) {
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	ok, err := c.backend.Acquire(ctx, key, token, ttl)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrLockNotObtained
+	}
+	return newLock(c.backend, key, token, ttl, start), nil
+}
+
+// Lock 按照 retry 重試，直到拿到鎖、重試次數用完或者 ctx 結束
+// 每一次嘗試都使用同一個 token，上一次超時但是其實成功了的話，這一次也會成功
+func (c *Client) Lock(ctx context.Context, key string, ttl time.Duration, retry RetryStrategy) (*Lock, error) {
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	var timer *time.Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+	for attempt := 1; ; attempt++ {
+		start := time.Now()
+		ok, err := c.backend.Acquire(ctx, key, token, ttl)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return newLock(c.backend, key, token, ttl, start), nil
+		}
+		interval, ok := retry.Next(attempt)
+		if !ok {
+			return nil, ErrLockNotObtained
+		}
+		if timer == nil {
+			timer = time.NewTimer(interval)
+		} else {
+			timer.Reset(interval)
+		}
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Lock 拿到的鎖，只有持有 token 的一方可以釋放和續約
+type Lock struct {
+	backend Backend
+	key     string
+	token   string
+	ttl     time.Duration
+
+	unlockOnce sync.Once
+	unlocked   chan struct{}
+	lostOnce   sync.Once
+	lost       chan struct{}
+
+	mu sync.Mutex
+	// 最後一次成功拿到鎖或者續約的請求發出的時間 + ttl
+	// 後端實際設置過期時間比發出請求晚，所以在這之前鎖一定還有效
+	leaseEnd time.Time
+}
+
+// newLock start 為拿到鎖的請求發出的時間
+func newLock(backend Backend, key string, token string, ttl time.Duration, start time.Time) *Lock {
+	return &Lock{
+		backend:  backend,
+		key:      key,
+		token:    token,
+		ttl:      ttl,
+		unlocked: make(chan struct{}),
+		lost:     make(chan struct{}),
+		leaseEnd: start.Add(ttl),
+	}
+}
+
+func (l *Lock) Key() string {
+	return l.key
+}
+
+func (l *Lock) Token() string {
+	return l.token
+}
+
+// Unlock 釋放鎖，並且停止 AutoRefresh
+// 鎖已經過期或者被其他人持有的時候返回 ErrLockNotHeld
+func (l *Lock) Unlock(ctx context.Context) error {
+	l.unlockOnce.Do(func() {
+		close(l.unlocked)
+	})
+	ok, err := l.backend.Release(ctx, l.key, l.token)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// Refresh 把過期時間重置為 ttl
+func (l *Lock) Refresh(ctx context.Context) error {
+	start := time.Now()
+	ok, err := l.backend.Refresh(ctx, l.key, l.token, l.ttl)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		if !l.isUnlocked() {
+			l.markLost()
+		}
+		return ErrLockNotHeld
+	}
+	l.mu.Lock()
+	if end := start.Add(l.ttl); end.After(l.leaseEnd) {
+		l.leaseEnd = end
+	}
+	l.mu.Unlock()
+	return nil
+}
+
+// LeaseEnd 在這個時間之前鎖一定還被自己持有 (除非 Unlock 或者 Lost)
+func (l *Lock) LeaseEnd() time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.leaseEnd
+}
+
+// AutoRefresh 每隔 interval 續約一次，每一次續約的超時時間為 timeout
+// 一直阻塞到 Unlock (返回 nil) 或者續約失敗 (返回錯誤)，一般在單獨的 goroutine 裡面調用
+// 續約超時會按照指數退避重試，直到 LeaseEnd，之後返回 ErrLockNotHeld；
+// 其他錯誤直接返回，這兩種情況都會關閉 Lost，此時應該認為鎖已經丟失
+func (l *Lock) AutoRefresh(interval time.Duration, timeout time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	backoff := NewExponentialBackoffRetry(refreshRetryInitial, interval, 0)
+	var retry *time.Timer
+	var retryC <-chan time.Time
+	defer func() {
+		if retry != nil {
+			retry.Stop()
+		}
+	}()
+	attempt := 0
+	for {
+		select {
+		case <-ticker.C:
+		case <-retryC:
+		case <-l.unlocked:
+			return nil
+		}
+		retryC = nil
+		remaining := time.Until(l.LeaseEnd())
+		if remaining <= 0 {
+			return l.expired()
+		}
+		// 續約的請求不會等到租約過期之後
+		if remaining > timeout {
+			remaining = timeout
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), remaining)
+		err := l.Refresh(ctx)
+		cancel()
+		if errors.Is(err, context.DeadlineExceeded) {
+			remaining = time.Until(l.LeaseEnd())
+			if remaining <= 0 {
+				return l.expired()
+			}
+			attempt++
+			delay, _ := backoff.Next(attempt)
+			if delay > remaining {
+				delay = remaining
+			}
+			// 不復用 timer，避免 ticker 先觸發的時候 retry.C 裡面留著上一次的值
+			if retry != nil {
+				retry.Stop()
+			}
+			retry = time.NewTimer(delay)
+			retryC = retry.C
+			continue
+		}
+		attempt = 0
+		if err != nil {
+			// Unlock 和續約同時發生，鎖是自己釋放的
+			if l.isUnlocked() {
+				return nil
+			}
+			l.markLost()
+			return err
+		}
+	}
+}
+
+// refreshRetryInitial AutoRefresh 續約超時之後第一次重試的最大等待時間
+const refreshRetryInitial = time.Millisecond * 10
+
+// expired 續約一直超時，租約已經過期
+func (l *Lock) expired() error {
+	if l.isUnlocked() {
+		return nil
+	}
+	l.markLost()
+	return ErrLockNotHeld
+}
+
+// Lost AutoRefresh 或者 Refresh 發現鎖已經丟失的時候關閉
+// 持有鎖執行任務的一方可以監聽它，及時停止
+func (l *Lock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+func (l *Lock) isUnlocked() bool {
+	select {
+	case <-l.unlocked:
+		return true
+	default:
+		return false
+	}
+}
+
+func (l *Lock) markLost() {
+	l.lostOnce.Do(func() {
+		close(l.lost)
+	})
+}
+
+func newToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
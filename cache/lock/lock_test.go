@@ -0,0 +1,254 @@
+package lock
+
+import (
+	"context"
+	"geektime-go/cache"
+	"geektime-go/cache/resp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func backends(t *testing.T) map[string]func() Backend {
+	return map[string]func() Backend{
+		"memory": func() Backend {
+			return NewMemoryBackend(cache.NewBuildInMapCache(time.Millisecond * 10))
+		},
+		"redis": func() Backend {
+			s := resp.NewServer(resp.ServerWithExpireInterval(time.Millisecond * 10))
+			RegisterScripts(s)
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			go func() {
+				_ = s.Serve(l)
+			}()
+			client := resp.NewClient(l.Addr().String())
+			t.Cleanup(func() {
+				_ = client.Close()
+				_ = s.Close()
+			})
+			return NewRedisBackend(client)
+		},
+	}
+}
+
+func TestClient_TryLock(t *testing.T) {
+	for name, newBackend := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			client := NewClient(newBackend())
+
+			l1, err := client.TryLock(ctx, "key1", time.Second)
+			require.NoError(t, err)
+			assert.Equal(t, "key1", l1.Key())
+			assert.NotEmpty(t, l1.Token())
+
+			_, err = client.TryLock(ctx, "key1", time.Second)
+			assert.Equal(t, ErrLockNotObtained, err)
+
+			// 不同的 key 互不影響
+			_, err = client.TryLock(ctx, "key2", time.Second)
+			require.NoError(t, err)
+
+			require.NoError(t, l1.Unlock(ctx))
+			assert.Equal(t, ErrLockNotHeld, l1.Unlock(ctx))
+
+			l3, err := client.TryLock(ctx, "key1", time.Second)
+			require.NoError(t, err)
+			assert.NotEqual(t, l1.Token(), l3.Token())
+		})
+	}
+}
+
+func TestClient_Expired(t *testing.T) {
+	for name, newBackend := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			client := NewClient(newBackend())
+
+			l1, err := client.TryLock(ctx, "key1", time.Millisecond*50)
+			require.NoError(t, err)
+			time.Sleep(time.Millisecond * 100)
+
+			// 過期之後其他人可以拿到鎖，原來的持有者不能釋放和續約
+			l2, err := client.TryLock(ctx, "key1", time.Second)
+			require.NoError(t, err)
+			assert.Equal(t, ErrLockNotHeld, l1.Refresh(ctx))
+			select {
+			case <-l1.Lost():
+			default:
+				t.Fatal("Refresh 失敗之後 Lost 應該關閉")
+			}
+			assert.Equal(t, ErrLockNotHeld, l1.Unlock(ctx))
+			require.NoError(t, l2.Unlock(ctx))
+		})
+	}
+}
+
+func TestLock_Refresh(t *testing.T) {
+	for name, newBackend := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			client := NewClient(newBackend())
+
+			l, err := client.TryLock(ctx, "key1", time.Millisecond*100)
+			require.NoError(t, err)
+			for i := 0; i < 4; i++ {
+				time.Sleep(time.Millisecond * 50)
+				require.NoError(t, l.Refresh(ctx))
+			}
+			_, err = client.TryLock(ctx, "key1", time.Second)
+			assert.Equal(t, ErrLockNotObtained, err)
+			require.NoError(t, l.Unlock(ctx))
+		})
+	}
+}
+
+func TestLock_AutoRefresh(t *testing.T) {
+	for name, newBackend := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			backend := newBackend()
+			client := NewClient(backend)
+
+			l, err := client.TryLock(ctx, "key1", time.Millisecond*100)
+			require.NoError(t, err)
+			done := make(chan error, 1)
+			go func() {
+				done <- l.AutoRefresh(time.Millisecond*30, time.Second)
+			}()
+			time.Sleep(time.Millisecond * 300)
+			_, err = client.TryLock(ctx, "key1", time.Second)
+			assert.Equal(t, ErrLockNotObtained, err)
+
+			require.NoError(t, l.Unlock(ctx))
+			assert.NoError(t, <-done)
+
+			// 鎖被其他人搶走之後 AutoRefresh 返回錯誤
+			l, err = client.TryLock(ctx, "key1", time.Millisecond*100)
+			require.NoError(t, err)
+			go func() {
+				done <- l.AutoRefresh(time.Millisecond*30, time.Second)
+			}()
+			_, err = backend.Release(ctx, "key1", l.Token())
+			require.NoError(t, err)
+			_, err = client.TryLock(ctx, "key1", time.Second)
+			require.NoError(t, err)
+			assert.Equal(t, ErrLockNotHeld, <-done)
+			<-l.Lost()
+		})
+	}
+}
+
+func TestLock_AutoRefreshTimeout(t *testing.T) {
+	ctx := context.Background()
+	backend := &timeoutBackend{Backend: NewMemoryBackend(cache.NewBuildInMapCache(time.Millisecond * 10))}
+	client := NewClient(backend)
+	l, err := client.TryLock(ctx, "key1", time.Millisecond*200)
+	require.NoError(t, err)
+	leaseEnd := l.LeaseEnd()
+
+	// 續約一直超時，租約過期之後認為鎖已經丟失，不會一直重試
+	start := time.Now()
+	err = l.AutoRefresh(time.Millisecond*50, time.Millisecond*20)
+	assert.Equal(t, ErrLockNotHeld, err)
+	assert.False(t, time.Now().Before(leaseEnd))
+	assert.Less(t, time.Since(start), time.Millisecond*400)
+	<-l.Lost()
+	assert.Less(t, atomic.LoadInt32(&backend.refreshes), int32(30))
+}
+
+// timeoutBackend Refresh 一直阻塞到 ctx 超時
+type timeoutBackend struct {
+	Backend
+	refreshes int32
+}
+
+func (b *timeoutBackend) Refresh(ctx context.Context, key string, token string, ttl time.Duration) (bool, error) {
+	atomic.AddInt32(&b.refreshes, 1)
+	<-ctx.Done()
+	return false, ctx.Err()
+}
+
+func TestClient_Lock(t *testing.T) {
+	for name, newBackend := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			client := NewClient(newBackend())
+
+			l1, err := client.TryLock(ctx, "key1", time.Second)
+			require.NoError(t, err)
+
+			// 重試次數用完
+			_, err = client.Lock(ctx, "key1", time.Second, NewFixedIntervalRetry(time.Millisecond*10, 3))
+			assert.Equal(t, ErrLockNotObtained, err)
+
+			// ctx 超時
+			timeoutCtx, cancel := context.WithTimeout(ctx, time.Millisecond*50)
+			_, err = client.Lock(timeoutCtx, "key1", time.Second, NewFixedIntervalRetry(time.Millisecond*10, 0))
+			cancel()
+			assert.Equal(t, context.DeadlineExceeded, err)
+
+			// 持有者釋放之後，重試可以拿到鎖
+			go func() {
+				time.Sleep(time.Millisecond * 50)
+				_ = l1.Unlock(ctx)
+			}()
+			l2, err := client.Lock(ctx, "key1", time.Second,
+				NewExponentialBackoffRetry(time.Millisecond*5, time.Millisecond*20, 0))
+			require.NoError(t, err)
+			require.NoError(t, l2.Unlock(ctx))
+		})
+	}
+}
+
+func TestClient_Mutex(t *testing.T) {
+	for name, newBackend := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			client := NewClient(newBackend())
+			retry := NewExponentialBackoffRetry(time.Millisecond, time.Millisecond*10, 0)
+
+			var holders int32
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					l, err := client.Lock(ctx, "key1", time.Second, retry)
+					if !assert.NoError(t, err) {
+						return
+					}
+					assert.Equal(t, int32(1), atomic.AddInt32(&holders, 1))
+					time.Sleep(time.Millisecond * 5)
+					atomic.AddInt32(&holders, -1)
+					assert.NoError(t, l.Unlock(ctx))
+				}()
+			}
+			wg.Wait()
+		})
+	}
+}
+
+func TestRedisBackend_EvalFallback(t *testing.T) {
+	// 新的 Redis 沒有緩存腳本，第一次 EVALSHA 會返回 NOSCRIPT，然後使用 EVAL
+	backend := backends(t)["redis"]().(*RedisBackend)
+	ctx := context.Background()
+	_, err := backend.client.Do(ctx, "SCRIPT", "FLUSH")
+	require.NoError(t, err)
+	ok, err := backend.Acquire(ctx, "key1", "token", time.Second)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// 同一個 token 再次搶鎖算成功，並且續約
+	ok, err = backend.Acquire(ctx, "key1", "token", time.Second)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = backend.Acquire(ctx, "key1", "other", time.Second)
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
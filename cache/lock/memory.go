@@ -0,0 +1,53 @@
+package lock
+
+import (
+	"context"
+	"geektime-go/cache"
+	"sync"
+	"time"
+)
+
+var _ Backend = (*MemoryBackend)(nil)
+
+// MemoryBackend 使用本地緩存 (e.g. BuildInMapCache) 存儲鎖，只能在同一個進程內互斥
+// 靠 MemoryBackend 自己的鎖保證原子性，所以不能有其他人直接修改緩存裡面的這些 key
+type MemoryBackend struct {
+	mu    sync.Mutex
+	cache cache.Cache
+}
+
+// NewMemoryBackend 過期的鎖由緩存負責刪除
+func NewMemoryBackend(c cache.Cache) *MemoryBackend {
+	return &MemoryBackend{cache: c}
+}
+
+func (m *MemoryBackend) Acquire(ctx context.Context, key string, token string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// 本地緩存只有 key 不存在的時候才會返回錯誤
+	val, err := m.cache.Get(ctx, key)
+	if err == nil && val != token {
+		return false, nil
+	}
+	return true, m.cache.Set(ctx, key, token, ttl)
+}
+
+func (m *MemoryBackend) Release(ctx context.Context, key string, token string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	val, err := m.cache.Get(ctx, key)
+	if err != nil || val != token {
+		return false, nil
+	}
+	return true, m.cache.Delete(ctx, key)
+}
+
+func (m *MemoryBackend) Refresh(ctx context.Context, key string, token string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	val, err := m.cache.Get(ctx, key)
+	if err != nil || val != token {
+		return false, nil
+	}
+	return true, m.cache.Set(ctx, key, token, ttl)
+}
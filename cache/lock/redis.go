@@ -0,0 +1,102 @@
+package lock
+
+import (
+	"bytes"
+	"context"
+	"geektime-go/cache/resp"
+	"time"
+)
+
+var _ Backend = (*RedisBackend)(nil)
+
+var (
+	// acquireScript key 不存在的時候設置，已經是自己的時候續約
+	acquireScript = resp.NewLuaScript(`
+local val = redis.call('GET', KEYS[1])
+if val == false then
+	return redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+elseif val == ARGV[1] then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+	return 'OK'
+else
+	return ''
+end`)
+	releaseScript = resp.NewLuaScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+else
+	return 0
+end`)
+	refreshScript = resp.NewLuaScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+else
+	return 0
+end`)
+)
+
+// RedisBackend 使用 Lua 腳本保證判斷 token 和修改是原子的
+// 測試的時候可以用 RegisterScripts 讓 resp.Server 支持這些腳本
+type RedisBackend struct {
+	client *resp.Client
+}
+
+func NewRedisBackend(client *resp.Client) *RedisBackend {
+	return &RedisBackend{client: client}
+}
+
+func (r *RedisBackend) Acquire(ctx context.Context, key string, token string, ttl time.Duration) (bool, error) {
+	val, err := resp.String(acquireScript.Run(ctx, r.client, []string{key}, token, ttlMillis(ttl)))
+	if err != nil {
+		return false, err
+	}
+	return val == "OK", nil
+}
+
+func (r *RedisBackend) Release(ctx context.Context, key string, token string) (bool, error) {
+	n, err := resp.Int64(releaseScript.Run(ctx, r.client, []string{key}, token))
+	return n == 1, err
+}
+
+func (r *RedisBackend) Refresh(ctx context.Context, key string, token string, ttl time.Duration) (bool, error) {
+	n, err := resp.Int64(refreshScript.Run(ctx, r.client, []string{key}, token, ttlMillis(ttl)))
+	return n == 1, err
+}
+
+// ttlMillis PX 不能為 0，不足 1 毫秒的按照 1 毫秒
+func ttlMillis(ttl time.Duration) int64 {
+	ms := ttl.Milliseconds()
+	if ms <= 0 {
+		ms = 1
+	}
+	return ms
+}
+
+// RegisterScripts 在 resp.Server 上註冊這些 Lua 腳本的 Go 實現，用於測試
+func RegisterScripts(s *resp.Server) {
+	s.RegisterScript(acquireScript.Src(), func(call *resp.ScriptCall, keys []string, args [][]byte) any {
+		val := call.Call("GET", keys[0])
+		switch {
+		case val == nil:
+			return call.Call("SET", keys[0], args[0], "PX", args[1])
+		case bytes.Equal(val.([]byte), args[0]):
+			call.Call("PEXPIRE", keys[0], args[1])
+			return resp.SimpleString("OK")
+		default:
+			// Lua 的 return '' 返回的是空的 bulk string
+			return []byte{}
+		}
+	})
+	s.RegisterScript(releaseScript.Src(), func(call *resp.ScriptCall, keys []string, args [][]byte) any {
+		if val, ok := call.Call("GET", keys[0]).([]byte); ok && bytes.Equal(val, args[0]) {
+			return call.Call("DEL", keys[0])
+		}
+		return int64(0)
+	})
+	s.RegisterScript(refreshScript.Src(), func(call *resp.ScriptCall, keys []string, args [][]byte) any {
+		if val, ok := call.Call("GET", keys[0]).([]byte); ok && bytes.Equal(val, args[0]) {
+			return call.Call("PEXPIRE", keys[0], args[1])
+		}
+		return int64(0)
+	})
+}
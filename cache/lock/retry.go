@@ -0,0 +1,76 @@
+package lock
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// RetryStrategy 重試策略，沒有狀態，可以在多個 goroutine 之間共用
+type RetryStrategy interface {
+	// Next attempt 為已經失敗的次數，從 1 開始
+	// 返回下一次重試之前等待的時間，false 表示不再重試
+	Next(attempt int) (time.Duration, bool)
+}
+
+var _ RetryStrategy = FixedIntervalRetry{}
+
+// FixedIntervalRetry 固定間隔重試
+type FixedIntervalRetry struct {
+	interval time.Duration
+	// 最多重試的次數，不大於 0 表示不限制，由 ctx 控制
+	max int
+}
+
+func NewFixedIntervalRetry(interval time.Duration, max int) FixedIntervalRetry {
+	return FixedIntervalRetry{interval: interval, max: max}
+}
+
+func (f FixedIntervalRetry) Next(attempt int) (time.Duration, bool) {
+	if f.max > 0 && attempt > f.max {
+		return 0, false
+	}
+	return f.interval, true
+}
+
+var _ RetryStrategy = (*ExponentialBackoffRetry)(nil)
+
+// ExponentialBackoffRetry 指數退避，加上隨機抖動 (full jitter)
+// 第 n 次重試等待 [0, min(max, initial * 2^(n-1))) 之間的隨機時間，避免多個客戶端同時重試
+type ExponentialBackoffRetry struct {
+	initial    time.Duration
+	maxDelay   time.Duration
+	maxRetries int
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// NewExponentialBackoffRetry maxRetries 不大於 0 表示不限制
+func NewExponentialBackoffRetry(initial time.Duration, maxDelay time.Duration, maxRetries int) *ExponentialBackoffRetry {
+	return &ExponentialBackoffRetry{
+		initial:    initial,
+		maxDelay:   maxDelay,
+		maxRetries: maxRetries,
+		rand:       rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (e *ExponentialBackoffRetry) Next(attempt int) (time.Duration, bool) {
+	if e.maxRetries > 0 && attempt > e.maxRetries {
+		return 0, false
+	}
+	delay := e.initial
+	for i := 1; i < attempt && delay < e.maxDelay; i++ {
+		delay <<= 1
+	}
+	if delay > e.maxDelay {
+		delay = e.maxDelay
+	}
+	if delay <= 0 {
+		return 0, true
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return time.Duration(e.rand.Int63n(int64(delay))), true
+}
@@ -0,0 +1,46 @@
+package lock
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestFixedIntervalRetry_Next(t *testing.T) {
+	r := NewFixedIntervalRetry(time.Second, 2)
+	for attempt := 1; attempt <= 2; attempt++ {
+		interval, ok := r.Next(attempt)
+		assert.True(t, ok)
+		assert.Equal(t, time.Second, interval)
+	}
+	_, ok := r.Next(3)
+	assert.False(t, ok)
+
+	// 不限制次數
+	_, ok = NewFixedIntervalRetry(time.Second, 0).Next(1000)
+	assert.True(t, ok)
+}
+
+func TestExponentialBackoffRetry_Next(t *testing.T) {
+	r := NewExponentialBackoffRetry(time.Millisecond*10, time.Millisecond*100, 6)
+	testCases := []struct {
+		attempt int
+		ceil    time.Duration
+	}{
+		{attempt: 1, ceil: time.Millisecond * 10},
+		{attempt: 2, ceil: time.Millisecond * 20},
+		{attempt: 3, ceil: time.Millisecond * 40},
+		{attempt: 4, ceil: time.Millisecond * 80},
+		{attempt: 5, ceil: time.Millisecond * 100},
+		{attempt: 6, ceil: time.Millisecond * 100},
+	}
+	for _, tc := range testCases {
+		for i := 0; i < 100; i++ {
+			interval, ok := r.Next(tc.attempt)
+			assert.True(t, ok)
+			assert.True(t, interval >= 0 && interval < tc.ceil, "attempt %d: %v", tc.attempt, interval)
+		}
+	}
+	_, ok := r.Next(7)
+	assert.False(t, ok)
+}
@@ -0,0 +1,193 @@
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+var _ Cache = (*MultiLevelCache)(nil)
+
+// MultiLevelCache 二級緩存，L1 一般為本地緩存 (e.g. BuildInMapCache)，L2 為 Redis 之類的遠程緩存
+// 讀的時候先讀 L1，未命中再讀 L2 並且回填 L1
+// 寫和刪除的時候先改 L2 再改 L1，然後透過 Transport 通知其他節點刪除各自 L1 裡面的 key
+//
+// 失效通知可能會丟失 (e.g. 網絡故障)，所以 L1 的過期時間應該設置得比較短，限制讀到舊數據的時間
+type MultiLevelCache struct {
+	l1 Cache
+	l2 Cache
+	// 從 L2 回填 L1 的時候使用的過期時間，寫的時候也不會超過它
+	l1TTL     time.Duration
+	transport Transport
+	node      string
+	// L1 和廣播失敗的時候不會影響結果，錯誤交給 onError
+	onError func(err error)
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+type MultiLevelCacheOption func(cache *MultiLevelCache)
+
+// NewMultiLevelCache 有 Transport 的時候，會在後台接收其他節點的失效通知
+func NewMultiLevelCache(l1 Cache, l2 Cache, opts ...MultiLevelCacheOption) *MultiLevelCache {
+	res := &MultiLevelCache{
+		l1:      l1,
+		l2:      l2,
+		l1TTL:   time.Minute,
+		node:    randomNodeID(),
+		onError: func(err error) {},
+		done:    make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(res)
+	}
+	if res.transport != nil {
+		ch, err := res.transport.Subscribe()
+		if err != nil {
+			res.onError(err)
+		} else {
+			go res.listen(ch)
+		}
+	}
+	return res
+}
+
+// MultiLevelCacheWithTransport Close 的時候也會關閉 transport
+func MultiLevelCacheWithTransport(t Transport) MultiLevelCacheOption {
+	return func(cache *MultiLevelCache) {
+		cache.transport = t
+	}
+}
+
+// MultiLevelCacheWithL1TTL 預設一分鐘
+func MultiLevelCacheWithL1TTL(ttl time.Duration) MultiLevelCacheOption {
+	return func(cache *MultiLevelCache) {
+		cache.l1TTL = ttl
+	}
+}
+
+// MultiLevelCacheWithNodeID 預設為隨機生成的 ID，同一個集群裡面不能重複
+func MultiLevelCacheWithNodeID(id string) MultiLevelCacheOption {
+	return func(cache *MultiLevelCache) {
+		cache.node = id
+	}
+}
+
+func MultiLevelCacheWithErrorHandler(f func(err error)) MultiLevelCacheOption {
+	return func(cache *MultiLevelCache) {
+		cache.onError = f
+	}
+}
+
+func (m *MultiLevelCache) Get(ctx context.Context, key string) (any, error) {
+	val, err := m.l1.Get(ctx, key)
+	if err == nil {
+		return val, nil
+	}
+	if !errors.Is(err, errKeyNotFound) {
+		// L1 出錯照樣可以讀 L2
+		m.onError(err)
+	}
+	val, err = m.l2.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if err = m.l1.Set(ctx, key, val, m.l1TTL); err != nil {
+		m.onError(err)
+	}
+	return val, nil
+}
+
+func (m *MultiLevelCache) Set(ctx context.Context, key string, value any, expiration time.Duration) error {
+	if err := m.l2.Set(ctx, key, value, expiration); err != nil {
+		return err
+	}
+	ttl := m.l1TTL
+	if expiration > 0 && expiration < ttl {
+		ttl = expiration
+	}
+	if err := m.l1.Set(ctx, key, value, ttl); err != nil {
+		m.onError(err)
+	}
+	m.broadcast(ctx, key)
+	return nil
+}
+
+func (m *MultiLevelCache) Delete(ctx context.Context, key string) error {
+	if err := m.l2.Delete(ctx, key); err != nil {
+		return err
+	}
+	if err := m.l1.Delete(ctx, key); err != nil {
+		m.onError(err)
+	}
+	m.broadcast(ctx, key)
+	return nil
+}
+
+// Invalidate 只刪除 L1，並且通知其他節點，用於數據源被其他途徑修改的情況
+func (m *MultiLevelCache) Invalidate(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		if err := m.l1.Delete(ctx, key); err != nil {
+			m.onError(err)
+		}
+	}
+	if m.transport == nil {
+		return nil
+	}
+	return m.transport.Publish(ctx, Invalidation{Node: m.node, Keys: keys})
+}
+
+// Close 停止接收失效通知並關閉 transport，不會關閉 L1 和 L2
+func (m *MultiLevelCache) Close() error {
+	err := errors.New("重複關閉")
+	m.closeOnce.Do(func() {
+		close(m.done)
+		err = nil
+		if m.transport != nil {
+			err = m.transport.Close()
+		}
+	})
+	return err
+}
+
+func (m *MultiLevelCache) broadcast(ctx context.Context, key string) {
+	if m.transport == nil {
+		return
+	}
+	if err := m.transport.Publish(ctx, Invalidation{Node: m.node, Keys: []string{key}}); err != nil {
+		m.onError(err)
+	}
+}
+
+func (m *MultiLevelCache) listen(ch <-chan Invalidation) {
+	for {
+		select {
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			if msg.Node == m.node {
+				continue
+			}
+			for _, key := range msg.Keys {
+				if err := m.l1.Delete(context.Background(), key); err != nil {
+					m.onError(err)
+				}
+			}
+		case <-m.done:
+			return
+		}
+	}
+}
+
+func randomNodeID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return time.Now().Format("20060102150405.000000000")
+	}
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,132 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestMultiLevelCache(t *testing.T) {
+	testCases := []struct {
+		name       string
+		transports func(t *testing.T) (Transport, Transport)
+	}{
+		{
+			name: "memory",
+			transports: func(t *testing.T) (Transport, Transport) {
+				broker := NewMemoryBroker()
+				return broker.NewTransport(), broker.NewTransport()
+			},
+		},
+		{
+			name: "tcp",
+			transports: func(t *testing.T) (Transport, Transport) {
+				a, err := NewTCPTransport("127.0.0.1:0")
+				require.NoError(t, err)
+				b, err := NewTCPTransport("127.0.0.1:0", a.Addr().String())
+				require.NoError(t, err)
+				a.peers = []string{b.Addr().String()}
+				return a, b
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			// 兩個節點共用 L2
+			l2 := NewBuildInMapCache(time.Minute)
+			ta, tb := tc.transports(t)
+			l1a, l1b := NewBuildInMapCache(time.Minute), NewBuildInMapCache(time.Minute)
+			a := NewMultiLevelCache(l1a, l2, MultiLevelCacheWithTransport(ta), MultiLevelCacheWithNodeID("a"))
+			b := NewMultiLevelCache(l1b, l2, MultiLevelCacheWithTransport(tb), MultiLevelCacheWithNodeID("b"))
+			defer func() {
+				assert.NoError(t, a.Close())
+				assert.NoError(t, b.Close())
+			}()
+
+			require.NoError(t, a.Set(ctx, "key1", "v1", time.Minute))
+			// b 從 L2 讀，並且回填 L1
+			val, err := b.Get(ctx, "key1")
+			require.NoError(t, err)
+			assert.Equal(t, "v1", val)
+			val, err = l1b.Get(ctx, "key1")
+			require.NoError(t, err)
+			assert.Equal(t, "v1", val)
+
+			// a 更新之後，b 的 L1 被刪除，讀到新的值
+			require.NoError(t, a.Set(ctx, "key1", "v2", time.Minute))
+			assert.Eventually(t, func() bool {
+				_, err := l1b.Get(ctx, "key1")
+				return errors.Is(err, errKeyNotFound)
+			}, time.Second, time.Millisecond)
+			val, err = b.Get(ctx, "key1")
+			require.NoError(t, err)
+			assert.Equal(t, "v2", val)
+			// 自己發出的通知不會刪除自己的 L1
+			val, err = l1a.Get(ctx, "key1")
+			require.NoError(t, err)
+			assert.Equal(t, "v2", val)
+
+			require.NoError(t, b.Delete(ctx, "key1"))
+			assert.Eventually(t, func() bool {
+				_, err := l1a.Get(ctx, "key1")
+				return errors.Is(err, errKeyNotFound)
+			}, time.Second, time.Millisecond)
+			_, err = a.Get(ctx, "key1")
+			assert.ErrorIs(t, err, errKeyNotFound)
+
+			// 只刪除 L1
+			require.NoError(t, l2.Set(ctx, "key2", "v1", time.Minute))
+			_, err = a.Get(ctx, "key2")
+			require.NoError(t, err)
+			require.NoError(t, l2.Set(ctx, "key2", "v2", time.Minute))
+			require.NoError(t, b.Invalidate(ctx, "key2"))
+			assert.Eventually(t, func() bool {
+				val, err := a.Get(ctx, "key2")
+				return err == nil && val == "v2"
+			}, time.Second, time.Millisecond)
+		})
+	}
+}
+
+func TestMultiLevelCache_L1TTL(t *testing.T) {
+	ctx := context.Background()
+	l1, l2 := NewBuildInMapCache(time.Minute), NewBuildInMapCache(time.Minute)
+	c := NewMultiLevelCache(l1, l2, MultiLevelCacheWithL1TTL(time.Second))
+
+	require.NoError(t, c.Set(ctx, "key1", "v1", time.Minute))
+	require.NoError(t, c.Set(ctx, "key2", "v2", time.Millisecond*100))
+	assert.WithinDuration(t, time.Now().Add(time.Second), l1.data["key1"].deadline, time.Millisecond*50)
+	assert.WithinDuration(t, time.Now().Add(time.Millisecond*100), l1.data["key2"].deadline, time.Millisecond*50)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), l2.data["key1"].deadline, time.Millisecond*50)
+	require.NoError(t, c.Close())
+	assert.Error(t, c.Close())
+}
+
+func TestMultiLevelCache_Error(t *testing.T) {
+	ctx := context.Background()
+	errL1, errL2 := errors.New("l1 error"), errors.New("l2 error")
+	var errs []error
+	l2 := NewBuildInMapCache(time.Minute)
+	require.NoError(t, l2.Set(ctx, "key1", "v1", time.Minute))
+	c := NewMultiLevelCache(&errCache{Cache: NewBuildInMapCache(time.Minute), getErr: errL1, setErr: errL1}, l2,
+		MultiLevelCacheWithErrorHandler(func(err error) {
+			errs = append(errs, err)
+		}))
+
+	// L1 出錯照樣從 L2 讀
+	val, err := c.Get(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, "v1", val)
+	assert.Equal(t, []error{errL1, errL1}, errs)
+
+	// L2 寫失敗不會寫 L1
+	c = NewMultiLevelCache(NewBuildInMapCache(time.Minute), &errCache{Cache: l2, setErr: errL2})
+	assert.Equal(t, errL2, c.Set(ctx, "key2", "v2", time.Minute))
+	_, err = c.l1.Get(ctx, "key2")
+	assert.ErrorIs(t, err, errKeyNotFound)
+}
@@ -0,0 +1,310 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	errTagsNotSupported = errors.New("cache: 底層 Cache 不支持標籤")
+	errQuotaExceeded    = errors.New("cache: 超過命名空間的配額")
+)
+
+var (
+	_ Cache    = (*Namespace)(nil)
+	_ TagCache = (*Namespace)(nil)
+)
+
+// namespaceSeparator 上下層命名空間和 key 之間的分隔符
+const namespaceSeparator = ":"
+
+// Namespace 在 Cache 上面加上前綴的視圖，不同命名空間的 key 互不影響
+// 命名空間可以嵌套，e.g. users 下面的 42 的前綴為 "users:42:"
+//
+// 底層 Cache 是 TagCache 的時候，每個 key 都會帶上自己和所有上層命名空間的標籤，
+// 所以 Invalidate 可以刪除命名空間裡面的所有 key，包括下層命名空間的
+//
+//	users := NewNamespace(c, "users", NamespaceWithDefaultTTL(time.Hour))
+//	u42 := users.Namespace("42")
+//	_ = u42.Set(ctx, "profile", profile, 0)
+//	_, _ = u42.Invalidate(ctx)
+type Namespace struct {
+	c      Cache
+	prefix string
+	// 自己和所有上層命名空間的標籤
+	scopes []string
+	ttl    time.Duration
+	quota  *namespaceQuota
+
+	mu       sync.Mutex
+	children []*Namespace
+}
+
+type NamespaceOption func(ns *Namespace)
+
+func NewNamespace(c Cache, name string, opts ...NamespaceOption) *Namespace {
+	return newNamespace(c, name+namespaceSeparator, nil, opts...)
+}
+
+func newNamespace(c Cache, prefix string, parentScopes []string, opts ...NamespaceOption) *Namespace {
+	res := &Namespace{
+		c:      c,
+		prefix: prefix,
+	}
+	res.scopes = append(append(make([]string, 0, len(parentScopes)+1), parentScopes...), res.scopeTag())
+	for _, opt := range opts {
+		opt(res)
+	}
+	return res
+}
+
+// NamespaceWithDefaultTTL Set 的過期時間為 0 的時候使用 ttl，不需要過期的時候使用 NoExpiration
+func NamespaceWithDefaultTTL(ttl time.Duration) NamespaceOption {
+	return func(ns *Namespace) {
+		ns.ttl = ttl
+	}
+}
+
+// NamespaceWithQuota 命名空間的容量上限，超過的時候 Set 返回錯誤，而不是淘汰其他 key
+// weigher 計算每個 key 的權重，為 nil 的時候按照 key 的數量限制
+// 配額只計算透過這個 Namespace 寫入的 key (不包括下層命名空間)，是本地的估算：
+// 底層 Cache 過期或者淘汰的 key 在過期時間到了或者 Get 不到的時候才會釋放
+func NamespaceWithQuota(max int64, weigher func(key string, val any) int64) NamespaceOption {
+	return func(ns *Namespace) {
+		if weigher == nil {
+			weigher = func(key string, val any) int64 {
+				return 1
+			}
+		}
+		ns.quota = &namespaceQuota{
+			max:     max,
+			weigher: weigher,
+			entries: make(map[string]quotaEntry),
+		}
+	}
+}
+
+// Namespace 創建下層命名空間，默認的過期時間和上層一樣，配額需要單獨設置
+func (n *Namespace) Namespace(name string, opts ...NamespaceOption) *Namespace {
+	res := newNamespace(n.c, n.prefix+name+namespaceSeparator, n.scopes,
+		append([]NamespaceOption{NamespaceWithDefaultTTL(n.ttl)}, opts...)...)
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.children = append(n.children, res)
+	return res
+}
+
+// Key 返回 key 在底層 Cache 裡面的完整的 key
+func (n *Namespace) Key(key string) string {
+	return n.prefix + key
+}
+
+func (n *Namespace) Set(ctx context.Context, key string, value any, expiration time.Duration) error {
+	return n.set(ctx, key, value, expiration, nil)
+}
+
+// SetWithTags 標籤只在這個命名空間裡面有效，不同命名空間的同名標籤互不影響
+func (n *Namespace) SetWithTags(ctx context.Context, key string, value any,
+	expiration time.Duration, tags ...string) error {
+	if _, ok := n.c.(TagCache); !ok {
+		return errTagsNotSupported
+	}
+	return n.set(ctx, key, value, expiration, tags)
+}
+
+func (n *Namespace) set(ctx context.Context, key string, value any,
+	expiration time.Duration, tags []string) error {
+	switch {
+	case expiration == 0:
+		expiration = n.ttl
+	case expiration < 0:
+		expiration = 0
+	}
+	var rollback func()
+	if n.quota != nil {
+		var err error
+		if rollback, err = n.quota.reserve(key, value, expiration, tags); err != nil {
+			return fmt.Errorf("%w, namespace: %s", err, n.prefix)
+		}
+	}
+	var err error
+	if tc, ok := n.c.(TagCache); ok {
+		err = tc.SetWithTags(ctx, n.prefix+key, value, expiration, append(n.userTags(tags), n.scopes...)...)
+	} else {
+		err = n.c.Set(ctx, n.prefix+key, value, expiration)
+	}
+	if err != nil && rollback != nil {
+		rollback()
+	}
+	return err
+}
+
+func (n *Namespace) Get(ctx context.Context, key string) (any, error) {
+	val, err := n.c.Get(ctx, n.prefix+key)
+	if n.quota != nil && errors.Is(err, errKeyNotFound) {
+		n.quota.release(key)
+	}
+	return val, err
+}
+
+func (n *Namespace) Delete(ctx context.Context, key string) error {
+	if err := n.c.Delete(ctx, n.prefix+key); err != nil {
+		return err
+	}
+	if n.quota != nil {
+		n.quota.release(key)
+	}
+	return nil
+}
+
+// InvalidateTag 刪除這個命名空間裡面帶有任意一個標籤的 key
+// 標籤 "*" 表示整個命名空間，效果和 Invalidate 一樣
+func (n *Namespace) InvalidateTag(ctx context.Context, tags ...string) (int, error) {
+	tc, ok := n.c.(TagCache)
+	if !ok {
+		return 0, errTagsNotSupported
+	}
+	cnt, err := tc.InvalidateTag(ctx, n.userTags(tags)...)
+	if hasAnyTag(nil, tags) {
+		n.resetQuota()
+	} else if n.quota != nil {
+		n.quota.releaseTags(tags)
+	}
+	return cnt, err
+}
+
+// Invalidate 刪除命名空間裡面的所有 key，包括下層命名空間的，需要底層 Cache 是 TagCache
+func (n *Namespace) Invalidate(ctx context.Context) (int, error) {
+	return n.InvalidateTag(ctx, "*")
+}
+
+// scopeTag 命名空間自己的標籤，也就是用戶標籤 "*"
+func (n *Namespace) scopeTag() string {
+	return n.prefix + "*"
+}
+
+// userTags 用戶標籤加上命名空間的前綴
+func (n *Namespace) userTags(tags []string) []string {
+	res := make([]string, 0, len(tags)+len(n.scopes))
+	for _, tag := range tags {
+		res = append(res, n.prefix+tag)
+	}
+	return res
+}
+
+func (n *Namespace) resetQuota() {
+	if n.quota != nil {
+		n.quota.reset()
+	}
+	n.mu.Lock()
+	children := n.children
+	n.mu.Unlock()
+	for _, child := range children {
+		child.resetQuota()
+	}
+}
+
+type namespaceQuota struct {
+	mu      sync.Mutex
+	max     int64
+	used    int64
+	weigher func(key string, val any) int64
+	entries map[string]quotaEntry
+}
+
+type quotaEntry struct {
+	weight   int64
+	deadline time.Time
+	tags     []string
+}
+
+// reserve 先佔用配額，寫入失敗的時候調用 rollback 恢復
+func (q *namespaceQuota) reserve(key string, val any, expiration time.Duration,
+	tags []string) (func(), error) {
+	w := q.weigher(key, val)
+	now := time.Now()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.used-q.entries[key].weight+w > q.max {
+		q.sweep(now)
+	}
+	old, hasOld := q.entries[key]
+	used := q.used - old.weight + w
+	if used > q.max {
+		return nil, fmt.Errorf("%w, key: %s, weight: %d, max: %d", errQuotaExceeded, key, w, q.max)
+	}
+	entry := quotaEntry{weight: w, tags: append([]string(nil), old.tags...)}
+	for _, tag := range tags {
+		if !hasAnyTag(entry.tags, []string{tag}) {
+			entry.tags = append(entry.tags, tag)
+		}
+	}
+	if expiration > 0 {
+		entry.deadline = now.Add(expiration)
+	}
+	q.entries[key] = entry
+	q.used = used
+	return func() {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		q.used -= q.entries[key].weight
+		delete(q.entries, key)
+		if hasOld {
+			q.entries[key] = old
+			q.used += old.weight
+		}
+	}, nil
+}
+
+// sweep 釋放已經過期的 key，需要持有鎖
+func (q *namespaceQuota) sweep(now time.Time) {
+	for key, entry := range q.entries {
+		if !entry.deadline.IsZero() && entry.deadline.Before(now) {
+			q.used -= entry.weight
+			delete(q.entries, key)
+		}
+	}
+}
+
+func (q *namespaceQuota) release(key string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.used -= q.entries[key].weight
+	delete(q.entries, key)
+}
+
+func (q *namespaceQuota) releaseTags(tags []string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for key, entry := range q.entries {
+		if hasAnyTag(entry.tags, tags) {
+			q.used -= entry.weight
+			delete(q.entries, key)
+		}
+	}
+}
+
+func (q *namespaceQuota) reset() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.used = 0
+	q.entries = make(map[string]quotaEntry)
+}
+
+// hasAnyTag targets 裡面有 "*" 的時候一定返回 true
+func hasAnyTag(tags []string, targets []string) bool {
+	for _, target := range targets {
+		if target == "*" {
+			return true
+		}
+		for _, tag := range tags {
+			if tag == target {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,149 @@
+package cache
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestNamespace(t *testing.T) {
+	testCases := []struct {
+		name  string
+		cache func(t *testing.T) TagCache
+	}{
+		{
+			name: "local",
+			cache: func(t *testing.T) TagCache {
+				c := NewBuildInMapCache(time.Minute)
+				t.Cleanup(func() {
+					_ = c.Close()
+				})
+				return c
+			},
+		},
+		{
+			name: "redis",
+			cache: func(t *testing.T) TagCache {
+				return NewRedisCache(startRedis(t, RegisterRedisScripts))
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			c := tc.cache(t)
+			users := NewNamespace(c, "users")
+			u42 := users.Namespace("42")
+			u43 := users.Namespace("43")
+			feeds := NewNamespace(c, "feeds")
+
+			require.NoError(t, u42.SetWithTags(ctx, "profile", "Tom", 0, "profile"))
+			require.NoError(t, u42.Set(ctx, "perm", "admin", 0))
+			require.NoError(t, u43.SetWithTags(ctx, "profile", "Jerry", 0, "profile"))
+			require.NoError(t, feeds.SetWithTags(ctx, "42", "page1", 0, "profile"))
+
+			// 前綴隔離
+			assert.Equal(t, "users:42:profile", u42.Key("profile"))
+			val, err := c.Get(ctx, "users:42:profile")
+			require.NoError(t, err)
+			assert.Equal(t, "Tom", val)
+			_, err = users.Get(ctx, "profile")
+			assert.ErrorIs(t, err, errKeyNotFound)
+
+			// 標籤只在命名空間裡面有效
+			n, err := u42.InvalidateTag(ctx, "profile")
+			require.NoError(t, err)
+			assert.Equal(t, 1, n)
+			_, err = u42.Get(ctx, "profile")
+			assert.ErrorIs(t, err, errKeyNotFound)
+			val, err = u43.Get(ctx, "profile")
+			require.NoError(t, err)
+			assert.Equal(t, "Jerry", val)
+
+			// 刪除 users 下面的所有 key，包括下層命名空間的
+			n, err = users.Invalidate(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, 2, n)
+			_, err = u42.Get(ctx, "perm")
+			assert.ErrorIs(t, err, errKeyNotFound)
+			_, err = u43.Get(ctx, "profile")
+			assert.ErrorIs(t, err, errKeyNotFound)
+			val, err = feeds.Get(ctx, "42")
+			require.NoError(t, err)
+			assert.Equal(t, "page1", val)
+		})
+	}
+}
+
+func TestNamespace_DefaultTTL(t *testing.T) {
+	ctx := context.Background()
+	c := NewBuildInMapCache(time.Minute)
+	defer c.Close()
+	users := NewNamespace(c, "users", NamespaceWithDefaultTTL(time.Minute))
+	u42 := users.Namespace("42")
+	require.NoError(t, u42.Set(ctx, "default", "val", 0))
+	require.NoError(t, u42.Set(ctx, "custom", "val", time.Second))
+	require.NoError(t, u42.Set(ctx, "forever", "val", NoExpiration))
+
+	ttl, err := c.TTL(ctx, "users:42:default")
+	require.NoError(t, err)
+	assert.True(t, ttl > time.Second && ttl <= time.Minute)
+	ttl, err = c.TTL(ctx, "users:42:custom")
+	require.NoError(t, err)
+	assert.True(t, ttl <= time.Second)
+	ttl, err = c.TTL(ctx, "users:42:forever")
+	require.NoError(t, err)
+	assert.Equal(t, NoExpiration, ttl)
+}
+
+func TestNamespace_Quota(t *testing.T) {
+	ctx := context.Background()
+	c := NewBuildInMapCache(time.Minute)
+	defer c.Close()
+	users := NewNamespace(c, "users", NamespaceWithQuota(10, func(key string, val any) int64 {
+		return int64(len(val.(string)))
+	}))
+	u42 := users.Namespace("42", NamespaceWithQuota(2, nil))
+
+	require.NoError(t, users.Set(ctx, "key1", "value1", 0))
+	err := users.Set(ctx, "key2", "value2", 0)
+	assert.ErrorIs(t, err, errQuotaExceeded)
+	_, err = users.Get(ctx, "key2")
+	assert.ErrorIs(t, err, errKeyNotFound)
+	// 覆蓋只計算新的大小
+	require.NoError(t, users.Set(ctx, "key1", "value1-new", 0))
+	require.NoError(t, users.Delete(ctx, "key1"))
+	require.NoError(t, users.Set(ctx, "key2", "value2", 0))
+
+	// 過期的 key 釋放配額
+	require.NoError(t, users.Set(ctx, "key3", "v3", time.Millisecond))
+	time.Sleep(time.Millisecond * 5)
+	require.NoError(t, users.Set(ctx, "key4", "v4", 0))
+	require.NoError(t, users.Set(ctx, "key5", "v5", 0))
+
+	// 下層命名空間的配額是獨立的，按照 key 的數量計算
+	require.NoError(t, u42.Set(ctx, "key1", "value1", 0))
+	require.NoError(t, u42.Set(ctx, "key2", "value2", 0))
+	assert.ErrorIs(t, u42.Set(ctx, "key3", "value3", 0), errQuotaExceeded)
+	// Invalidate 之後配額全部釋放
+	_, err = users.Invalidate(ctx)
+	require.NoError(t, err)
+	require.NoError(t, u42.Set(ctx, "key3", "value3", 0))
+	require.NoError(t, users.Set(ctx, "key1", "value1-new", 0))
+}
+
+func TestNamespace_TagsNotSupported(t *testing.T) {
+	ctx := context.Background()
+	c := NewShardedCache(time.Minute)
+	defer c.Close()
+	users := NewNamespace(c, "users")
+	require.NoError(t, users.Set(ctx, "key1", "val1", 0))
+	val, err := c.Get(ctx, "users:key1")
+	require.NoError(t, err)
+	assert.Equal(t, "val1", val)
+	assert.ErrorIs(t, users.SetWithTags(ctx, "key1", "val1", 0, "tag"), errTagsNotSupported)
+	_, err = users.Invalidate(ctx)
+	assert.ErrorIs(t, err, errTagsNotSupported)
+}
@@ -0,0 +1,17 @@
+package cache
+
+// EvictionPolicy 淘汰策略，決定容量不足的時候淘汰哪一個 key
+// 實現不需要考慮併發安全，由使用方 (e.g. BoundedCache) 加鎖
+type EvictionPolicy interface {
+	// Add 寫入一個新的 key
+	Add(key string)
+	// Access 命中一個已經存在的 key，包括 Get 命中和覆蓋寫入
+	Access(key string)
+	// Remove 主動刪除或是過期的 key
+	Remove(key string)
+	// Evict 挑選一個 key 淘汰，並且從策略中移除
+	// 沒有可以淘汰的 key 時返回 false
+	Evict() (string, bool)
+	// Len 策略中正在追蹤的 key 數量，不包括 ARC 的 ghost key
+	Len() int
+}
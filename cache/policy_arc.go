@@ -0,0 +1,99 @@
+package cache
+
+// ARCPolicy Adaptive Replacement Cache
+// t1 保存只訪問過一次的 key，t2 保存訪問過多次的 key
+// b1、b2 是從 t1、t2 淘汰的 ghost key，只記錄 key 不保存值
+// 命中 ghost key 的時候調整 t1 的目標大小 p，在 recency 與 frequency 之間自適應
+// 參考 Megiddo & Modha, "ARC: A Self-Tuning, Low Overhead Replacement Cache"
+type ARCPolicy struct {
+	// capacity 用於限制 ghost key 的數量以及調整 p，單位為 key 的數量
+	capacity int
+	p        int
+
+	t1, t2 *LRUPolicy
+	b1, b2 *LRUPolicy
+}
+
+func NewARCPolicy(capacity int) *ARCPolicy {
+	return &ARCPolicy{
+		capacity: capacity,
+		t1:       NewLRUPolicy(),
+		t2:       NewLRUPolicy(),
+		b1:       NewLRUPolicy(),
+		b2:       NewLRUPolicy(),
+	}
+}
+
+func (a *ARCPolicy) Add(key string) {
+	switch {
+	case a.t1.has(key) || a.t2.has(key):
+		a.Access(key)
+	case a.b1.has(key):
+		// 最近淘汰的 key 又被訪問，代表 t1 太小了
+		a.p = minInt(a.capacity, a.p+maxInt(a.b2.Len()/maxInt(a.b1.Len(), 1), 1))
+		a.b1.Remove(key)
+		a.t2.Add(key)
+	case a.b2.has(key):
+		// 代表 t2 太小了
+		a.p = maxInt(0, a.p-maxInt(a.b1.Len()/maxInt(a.b2.Len(), 1), 1))
+		a.b2.Remove(key)
+		a.t2.Add(key)
+	default:
+		a.t1.Add(key)
+	}
+	// 控制 ghost key 的數量，|t1| + |b1| <= c，總數 <= 2c
+	for a.t1.Len()+a.b1.Len() > a.capacity && a.b1.Len() > 0 {
+		a.b1.Evict()
+	}
+	for a.t1.Len()+a.t2.Len()+a.b1.Len()+a.b2.Len() > 2*a.capacity && a.b2.Len() > 0 {
+		a.b2.Evict()
+	}
+}
+
+func (a *ARCPolicy) Access(key string) {
+	if a.t1.has(key) {
+		a.t1.Remove(key)
+		a.t2.Add(key)
+		return
+	}
+	a.t2.Access(key)
+}
+
+func (a *ARCPolicy) Remove(key string) {
+	a.t1.Remove(key)
+	a.t2.Remove(key)
+	a.b1.Remove(key)
+	a.b2.Remove(key)
+}
+
+func (a *ARCPolicy) Evict() (string, bool) {
+	if a.t1.Len() > 0 && (a.t1.Len() > a.p || a.t2.Len() == 0) {
+		key, _ := a.t1.Evict()
+		a.b1.Add(key)
+		return key, true
+	}
+	key, ok := a.t2.Evict()
+	if !ok {
+		return "", false
+	}
+	a.b2.Add(key)
+	return key, true
+}
+
+func (a *ARCPolicy) Len() int {
+	return a.t1.Len() + a.t2.Len()
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,93 @@
+package cache
+
+import "container/list"
+
+// LFUPolicy 淘汰訪問次數最少的 key，次數相同時淘汰最久沒有被訪問的
+// 按照訪問次數把 key 放進有序的桶裡面，所有操作都是 O(1)
+type LFUPolicy struct {
+	// 元素為 *lfuBucket，按照 freq 從小到大排列
+	buckets *list.List
+	entries map[string]*lfuEntry
+}
+
+type lfuBucket struct {
+	freq int
+	// 元素為 key，越靠前越新
+	keys *list.List
+}
+
+type lfuEntry struct {
+	bucket *list.Element
+	elem   *list.Element
+}
+
+func NewLFUPolicy() *LFUPolicy {
+	return &LFUPolicy{
+		buckets: list.New(),
+		entries: make(map[string]*lfuEntry),
+	}
+}
+
+func (l *LFUPolicy) Add(key string) {
+	if _, ok := l.entries[key]; ok {
+		l.Access(key)
+		return
+	}
+	front := l.buckets.Front()
+	if front == nil || front.Value.(*lfuBucket).freq != 1 {
+		front = l.buckets.PushFront(&lfuBucket{freq: 1, keys: list.New()})
+	}
+	l.entries[key] = &lfuEntry{
+		bucket: front,
+		elem:   front.Value.(*lfuBucket).keys.PushFront(key),
+	}
+}
+
+func (l *LFUPolicy) Access(key string) {
+	entry, ok := l.entries[key]
+	if !ok {
+		return
+	}
+	cur := entry.bucket.Value.(*lfuBucket)
+	next := entry.bucket.Next()
+	if next == nil || next.Value.(*lfuBucket).freq != cur.freq+1 {
+		next = l.buckets.InsertAfter(&lfuBucket{freq: cur.freq + 1, keys: list.New()}, entry.bucket)
+	}
+	cur.keys.Remove(entry.elem)
+	if cur.keys.Len() == 0 {
+		l.buckets.Remove(entry.bucket)
+	}
+	entry.bucket = next
+	entry.elem = next.Value.(*lfuBucket).keys.PushFront(key)
+}
+
+func (l *LFUPolicy) Remove(key string) {
+	entry, ok := l.entries[key]
+	if !ok {
+		return
+	}
+	l.remove(key, entry)
+}
+
+func (l *LFUPolicy) Evict() (string, bool) {
+	front := l.buckets.Front()
+	if front == nil {
+		return "", false
+	}
+	key := front.Value.(*lfuBucket).keys.Back().Value.(string)
+	l.remove(key, l.entries[key])
+	return key, true
+}
+
+func (l *LFUPolicy) Len() int {
+	return len(l.entries)
+}
+
+func (l *LFUPolicy) remove(key string, entry *lfuEntry) {
+	b := entry.bucket.Value.(*lfuBucket)
+	b.keys.Remove(entry.elem)
+	if b.keys.Len() == 0 {
+		l.buckets.Remove(entry.bucket)
+	}
+	delete(l.entries, key)
+}
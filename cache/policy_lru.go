@@ -0,0 +1,67 @@
+package cache
+
+import "container/list"
+
+// LRUPolicy 淘汰最久沒有被訪問的 key
+// 使用 map + 雙向鏈表，所有操作都是 O(1)
+type LRUPolicy struct {
+	ll    *list.List
+	elems map[string]*list.Element
+}
+
+func NewLRUPolicy() *LRUPolicy {
+	return &LRUPolicy{
+		ll:    list.New(),
+		elems: make(map[string]*list.Element),
+	}
+}
+
+func (l *LRUPolicy) Add(key string) {
+	if elem, ok := l.elems[key]; ok {
+		l.ll.MoveToFront(elem)
+		return
+	}
+	l.elems[key] = l.ll.PushFront(key)
+}
+
+func (l *LRUPolicy) Access(key string) {
+	if elem, ok := l.elems[key]; ok {
+		l.ll.MoveToFront(elem)
+	}
+}
+
+func (l *LRUPolicy) Remove(key string) {
+	if elem, ok := l.elems[key]; ok {
+		l.ll.Remove(elem)
+		delete(l.elems, key)
+	}
+}
+
+func (l *LRUPolicy) Evict() (string, bool) {
+	elem := l.ll.Back()
+	if elem == nil {
+		return "", false
+	}
+	key := elem.Value.(string)
+	l.ll.Remove(elem)
+	delete(l.elems, key)
+	return key, true
+}
+
+func (l *LRUPolicy) Len() int {
+	return l.ll.Len()
+}
+
+func (l *LRUPolicy) has(key string) bool {
+	_, ok := l.elems[key]
+	return ok
+}
+
+// back 最久沒有被訪問的 key，不會移除
+func (l *LRUPolicy) back() (string, bool) {
+	elem := l.ll.Back()
+	if elem == nil {
+		return "", false
+	}
+	return elem.Value.(string), true
+}
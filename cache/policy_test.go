@@ -0,0 +1,87 @@
+package cache
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestEvictionPolicy(t *testing.T) {
+	testCases := []struct {
+		name   string
+		policy func() EvictionPolicy
+		// 每一步操作，a: Add，g: Access，d: Remove，e: Evict
+		ops []string
+
+		wantEvicted []string
+		wantLen     int
+	}{
+		{
+			name:        "lru",
+			policy:      func() EvictionPolicy { return NewLRUPolicy() },
+			ops:         []string{"a:a", "a:b", "a:c", "g:a", "e", "e"},
+			wantEvicted: []string{"b", "c"},
+			wantLen:     1,
+		},
+		{
+			name:        "lru remove",
+			policy:      func() EvictionPolicy { return NewLRUPolicy() },
+			ops:         []string{"a:a", "a:b", "d:a", "e", "e"},
+			wantEvicted: []string{"b"},
+		},
+		{
+			name:   "lfu",
+			policy: func() EvictionPolicy { return NewLFUPolicy() },
+			ops: []string{"a:a", "a:b", "a:c", "g:a", "g:a", "g:c",
+				"e", "e", "e"},
+			wantEvicted: []string{"b", "c", "a"},
+		},
+		{
+			name:        "lfu same freq",
+			policy:      func() EvictionPolicy { return NewLFUPolicy() },
+			ops:         []string{"a:a", "a:b", "g:b", "g:a", "a:c", "d:c", "e", "e"},
+			wantEvicted: []string{"b", "a"},
+		},
+		{
+			name:   "arc",
+			policy: func() EvictionPolicy { return NewARCPolicy(2) },
+			// a 訪問過兩次，進入 t2。b 被淘汰後進入 ghost b1，再次寫入時直接進入 t2
+			// 命中 b1 讓 t1 的目標大小 p 變成 1，所以後面優先淘汰 t2 的 a、b，保留 t1 的 c
+			ops:         []string{"a:a", "a:b", "g:a", "e", "a:b", "a:c", "e", "e"},
+			wantEvicted: []string{"b", "a", "b"},
+			wantLen:     1,
+		},
+		{
+			name:   "tinylfu",
+			policy: func() EvictionPolicy { return NewTinyLFUPolicy(3) },
+			// window 1 個，main 2 個
+			// a、b 訪問頻率高，c、d 進不了 main；e 訪問次數超過 a 之後，a 被淘汰
+			ops: []string{"a:a", "a:b", "a:c", "g:a", "g:a", "g:b", "g:b", "a:d", "e",
+				"a:e", "e", "g:e", "g:e", "g:e", "g:e", "g:e", "a:f", "e"},
+			wantEvicted: []string{"c", "d", "a"},
+			wantLen:     3,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p := tc.policy()
+			var evicted []string
+			for _, op := range tc.ops {
+				switch op[0] {
+				case 'a':
+					p.Add(op[2:])
+				case 'g':
+					p.Access(op[2:])
+				case 'd':
+					p.Remove(op[2:])
+				case 'e':
+					if key, ok := p.Evict(); ok {
+						evicted = append(evicted, key)
+					}
+				}
+			}
+			assert.Equal(t, tc.wantEvicted, evicted)
+			assert.Equal(t, tc.wantLen, p.Len())
+		})
+	}
+}
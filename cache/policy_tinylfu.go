@@ -0,0 +1,176 @@
+package cache
+
+import (
+	"hash/fnv"
+)
+
+// TinyLFUPolicy W-TinyLFU
+// 新的 key 先進入一個很小的 window LRU，從 window 淘汰出來的 key 作為候選
+// 與 main 區域 (SLRU) 的淘汰對象比較訪問頻率，頻率高的留下，也就是准入策略
+// 訪問頻率使用 Count-Min Sketch 估算，定期減半，讓舊的熱點逐漸冷卻
+// 參考 Einziger et al., "TinyLFU: A Highly Efficient Cache Admission Policy"
+type TinyLFUPolicy struct {
+	sketch *cmSketch
+
+	window    *LRUPolicy
+	maxWindow int
+	// main 區域分為 probation 和 protected
+	// 第一次進入 main 的 key 放在 probation，再次命中才會晉升到 protected
+	probation    *LRUPolicy
+	protected    *LRUPolicy
+	maxMain      int
+	maxProtected int
+}
+
+// NewTinyLFUPolicy capacity 用於劃分各個區域的大小，單位為 key 的數量
+// window 佔 1%，protected 佔 main 區域的 80%
+func NewTinyLFUPolicy(capacity int) *TinyLFUPolicy {
+	maxWindow := maxInt(1, capacity/100)
+	maxMain := maxInt(1, capacity-maxWindow)
+	return &TinyLFUPolicy{
+		sketch:       newCMSketch(capacity),
+		window:       NewLRUPolicy(),
+		maxWindow:    maxWindow,
+		probation:    NewLRUPolicy(),
+		protected:    NewLRUPolicy(),
+		maxMain:      maxMain,
+		maxProtected: maxInt(1, maxMain*8/10),
+	}
+}
+
+func (t *TinyLFUPolicy) Add(key string) {
+	if t.window.has(key) || t.probation.has(key) || t.protected.has(key) {
+		t.Access(key)
+		return
+	}
+	t.sketch.increment(key)
+	t.window.Add(key)
+}
+
+func (t *TinyLFUPolicy) Access(key string) {
+	t.sketch.increment(key)
+	switch {
+	case t.window.has(key):
+		t.window.Access(key)
+	case t.probation.has(key):
+		t.probation.Remove(key)
+		t.protected.Add(key)
+		// protected 滿了，降級回 probation
+		if t.protected.Len() > t.maxProtected {
+			demoted, _ := t.protected.Evict()
+			t.probation.Add(demoted)
+		}
+	case t.protected.has(key):
+		t.protected.Access(key)
+	}
+}
+
+func (t *TinyLFUPolicy) Remove(key string) {
+	t.window.Remove(key)
+	t.probation.Remove(key)
+	t.protected.Remove(key)
+}
+
+func (t *TinyLFUPolicy) Evict() (string, bool) {
+	for t.window.Len() > t.maxWindow {
+		candidate, _ := t.window.Evict()
+		if t.probation.Len()+t.protected.Len() < t.maxMain {
+			t.probation.Add(candidate)
+			continue
+		}
+		victim, ok := t.probation.back()
+		victimList := t.probation
+		if !ok {
+			victim, _ = t.protected.back()
+			victimList = t.protected
+		}
+		// 候選者頻率更高，才淘汰 main 區域的 key
+		if t.sketch.estimate(candidate) > t.sketch.estimate(victim) {
+			victimList.Remove(victim)
+			t.probation.Add(candidate)
+			return victim, true
+		}
+		return candidate, true
+	}
+	// window 沒有超過大小，但是使用方仍然需要淘汰 (e.g. 按照字節數限制)
+	for _, l := range []*LRUPolicy{t.probation, t.protected, t.window} {
+		if key, ok := l.Evict(); ok {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+func (t *TinyLFUPolicy) Len() int {
+	return t.window.Len() + t.probation.Len() + t.protected.Len()
+}
+
+const cmDepth = 4
+
+// cmSketch Count-Min Sketch，每個計數器最大為 15
+// 記錄的總次數達到 10 倍容量的時候，所有計數器減半
+type cmSketch struct {
+	rows       [cmDepth][]uint8
+	mask       uint64
+	additions  int
+	resetAfter int
+}
+
+func newCMSketch(capacity int) *cmSketch {
+	width := 16
+	for width < capacity {
+		width <<= 1
+	}
+	s := &cmSketch{
+		mask:       uint64(width - 1),
+		resetAfter: maxInt(10*capacity, 16),
+	}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+func (s *cmSketch) indexes(key string) [cmDepth]uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	sum := h.Sum64()
+	// double hashing，用兩個 32 位的哈希值組合出每一行的位置
+	h1, h2 := sum&0xffffffff, sum>>32
+	var res [cmDepth]uint64
+	for i := range res {
+		res[i] = (h1 + uint64(i)*h2) & s.mask
+	}
+	return res
+}
+
+func (s *cmSketch) increment(key string) {
+	for i, idx := range s.indexes(key) {
+		if s.rows[i][idx] < 15 {
+			s.rows[i][idx]++
+		}
+	}
+	s.additions++
+	if s.additions >= s.resetAfter {
+		s.reset()
+	}
+}
+
+func (s *cmSketch) estimate(key string) uint8 {
+	res := uint8(15)
+	for i, idx := range s.indexes(key) {
+		if s.rows[i][idx] < res {
+			res = s.rows[i][idx]
+		}
+	}
+	return res
+}
+
+func (s *cmSketch) reset() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+	s.additions /= 2
+}
@@ -0,0 +1,110 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"geektime-go/cache/stats"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var (
+	errFailedToRefreshCache = errors.New("cache: 刷新緩存失敗")
+)
+
+// LoadFunc 緩存未命中的時候從數據源 (e.g. DB) 加載數據
+type LoadFunc func(ctx context.Context, key string) (any, error)
+
+// ReadThroughCache 未命中的時候調用 LoadFunc 加載數據並寫回緩存
+// 業務代碼只需要調用 Get，不需要再自己處理 "查緩存，查 DB，寫緩存"
+//
+// 注意底層 Cache 未命中的時候需要返回 errKeyNotFound，
+// 其他錯誤 (e.g. 網絡錯誤) 不會觸發加載，避免緩存故障時把壓力全部打到 DB
+type ReadThroughCache struct {
+	Cache
+	load       LoadFunc
+	expiration time.Duration
+	// 在 expiration 的基礎上隨機增加 [0, jitter) 的過期時間，避免大量 key 同時過期
+	jitter time.Duration
+	// 一定不存在的 key 不會調用 load，可以為 nil
+	filter Filter
+	// 加載耗時的分佈，可以為 nil
+	latency *stats.Histogram
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+type ReadThroughCacheOption func(cache *ReadThroughCache)
+
+func NewReadThroughCache(cache Cache, load LoadFunc, expiration time.Duration,
+	opts ...ReadThroughCacheOption) *ReadThroughCache {
+	res := &ReadThroughCache{
+		Cache:      cache,
+		load:       load,
+		expiration: expiration,
+		rand:       rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	for _, opt := range opts {
+		opt(res)
+	}
+	return res
+}
+
+// ReadThroughCacheWithJitter 每個 key 的過期時間隨機增加 [0, jitter)
+func ReadThroughCacheWithJitter(jitter time.Duration) ReadThroughCacheOption {
+	return func(cache *ReadThroughCache) {
+		cache.jitter = jitter
+	}
+}
+
+// ReadThroughCacheWithFilter 未命中的時候先檢查 filter，一定不存在的 key 直接返回 errKeyNotFound
+// 數據源新增數據的時候需要同時加到 filter 裡面
+func ReadThroughCacheWithFilter(filter Filter) ReadThroughCacheOption {
+	return func(cache *ReadThroughCache) {
+		cache.filter = filter
+	}
+}
+
+// ReadThroughCacheWithLoadHistogram 記錄 LoadFunc 的耗時，包括失敗的加載
+func ReadThroughCacheWithLoadHistogram(h *stats.Histogram) ReadThroughCacheOption {
+	return func(cache *ReadThroughCache) {
+		cache.latency = h
+	}
+}
+
+func (r *ReadThroughCache) Get(ctx context.Context, key string) (any, error) {
+	val, err := r.Cache.Get(ctx, key)
+	if !errors.Is(err, errKeyNotFound) {
+		return val, err
+	}
+	if r.filter != nil && !r.filter.Contains(key) {
+		return nil, err
+	}
+	start := time.Now()
+	val, err = r.load(ctx, key)
+	if r.latency != nil {
+		r.latency.Observe(time.Since(start))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = r.Cache.Set(ctx, key, val, r.ttl()); err != nil {
+		// 數據已經加載到了，所以照樣返回
+		return val, fmt.Errorf("%w, key: %s, err: %v", errFailedToRefreshCache, key, err)
+	}
+	return val, nil
+}
+
+// ttl 過期時間加上隨機的抖動，expiration 不大於 0 的時候表示不過期
+func (r *ReadThroughCache) ttl() time.Duration {
+	if r.expiration <= 0 || r.jitter <= 0 {
+		return r.expiration
+	}
+	// rand.Rand 不是併發安全的
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.expiration + time.Duration(r.rand.Int63n(int64(r.jitter)))
+}
@@ -0,0 +1,181 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"geektime-go/cache/stats"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestReadThroughCache_Get(t *testing.T) {
+	errDB := errors.New("db error")
+	testCases := []struct {
+		name  string
+		cache func() Cache
+		load  LoadFunc
+		key   string
+
+		wantVal   any
+		wantErr   error
+		wantCache any
+	}{
+		{
+			name: "hit",
+			cache: func() Cache {
+				c := NewBuildInMapCache(time.Minute)
+				_ = c.Set(context.Background(), "key1", "cached", 0)
+				return c
+			},
+			load: func(ctx context.Context, key string) (any, error) {
+				t.Fatal("命中的時候不應該加載")
+				return nil, nil
+			},
+			key:       "key1",
+			wantVal:   "cached",
+			wantCache: "cached",
+		},
+		{
+			name: "load",
+			cache: func() Cache {
+				return NewBuildInMapCache(time.Minute)
+			},
+			load: func(ctx context.Context, key string) (any, error) {
+				return "db " + key, nil
+			},
+			key:       "key1",
+			wantVal:   "db key1",
+			wantCache: "db key1",
+		},
+		{
+			name: "load error",
+			cache: func() Cache {
+				return NewBuildInMapCache(time.Minute)
+			},
+			load: func(ctx context.Context, key string) (any, error) {
+				return nil, errDB
+			},
+			key:     "key1",
+			wantErr: errDB,
+		},
+		{
+			name: "cache error",
+			cache: func() Cache {
+				return &errCache{Cache: NewBuildInMapCache(time.Minute), getErr: errDB}
+			},
+			load: func(ctx context.Context, key string) (any, error) {
+				t.Fatal("緩存出錯的時候不應該加載")
+				return nil, nil
+			},
+			key:     "key1",
+			wantErr: errDB,
+		},
+		{
+			// 加載成功但是寫緩存失敗，照樣返回數據
+			name: "refresh error",
+			cache: func() Cache {
+				return &errCache{Cache: NewBuildInMapCache(time.Minute), setErr: errDB}
+			},
+			load: func(ctx context.Context, key string) (any, error) {
+				return "db " + key, nil
+			},
+			key:     "key1",
+			wantVal: "db key1",
+			wantErr: fmt.Errorf("%w, key: %s, err: %v", errFailedToRefreshCache, "key1", errDB),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			underlying := tc.cache()
+			c := NewReadThroughCache(underlying, tc.load, time.Minute)
+			val, err := c.Get(context.Background(), tc.key)
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantVal, val)
+			if tc.wantCache == nil {
+				return
+			}
+			val, err = underlying.Get(context.Background(), tc.key)
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantCache, val)
+		})
+	}
+}
+
+func TestReadThroughCache_Jitter(t *testing.T) {
+	underlying := NewBuildInMapCache(time.Minute)
+	c := NewReadThroughCache(underlying, func(ctx context.Context, key string) (any, error) {
+		return key, nil
+	}, time.Minute, ReadThroughCacheWithJitter(time.Second*10))
+
+	deadlines := map[time.Time]struct{}{}
+	for i := 0; i < 20; i++ {
+		start := time.Now()
+		key := fmt.Sprintf("key%d", i)
+		_, err := c.Get(context.Background(), key)
+		require.NoError(t, err)
+		dl := underlying.data[key].deadline
+		assert.False(t, dl.Before(start.Add(time.Minute)))
+		assert.True(t, dl.Before(time.Now().Add(time.Minute+time.Second*10)))
+		deadlines[dl] = struct{}{}
+	}
+	// 過期時間應該是分散的
+	assert.Greater(t, len(deadlines), 1)
+}
+
+// errCache 讓 Get 或者 Set 返回固定的錯誤
+type errCache struct {
+	Cache
+	getErr error
+	setErr error
+}
+
+func (e *errCache) Get(ctx context.Context, key string) (any, error) {
+	if e.getErr != nil {
+		return nil, e.getErr
+	}
+	return e.Cache.Get(ctx, key)
+}
+
+func (e *errCache) Set(ctx context.Context, key string, value any, expiration time.Duration) error {
+	if e.setErr != nil {
+		return e.setErr
+	}
+	return e.Cache.Set(ctx, key, value, expiration)
+}
+
+func TestReadThroughCache_Filter(t *testing.T) {
+	f := NewBloomFilterWithEstimates(100, 0.01)
+	f.Add("key1")
+	loads := 0
+	c := NewReadThroughCache(NewBuildInMapCache(time.Minute), func(ctx context.Context, key string) (any, error) {
+		loads++
+		return "db " + key, nil
+	}, time.Minute, ReadThroughCacheWithFilter(f))
+
+	// 一定不存在的 key 不會加載
+	_, err := c.Get(context.Background(), "key2")
+	assert.Equal(t, fmt.Errorf("%w, key: %s", errKeyNotFound, "key2"), err)
+	assert.Equal(t, 0, loads)
+
+	val, err := c.Get(context.Background(), "key1")
+	require.NoError(t, err)
+	assert.Equal(t, "db key1", val)
+	assert.Equal(t, 1, loads)
+}
+
+func TestReadThroughCache_LoadHistogram(t *testing.T) {
+	h := stats.NewHistogram()
+	c := NewReadThroughCache(NewBuildInMapCache(time.Minute), func(ctx context.Context, key string) (any, error) {
+		return "value", nil
+	}, time.Minute, ReadThroughCacheWithLoadHistogram(h))
+	for i := 0; i < 3; i++ {
+		_, err := c.Get(context.Background(), "key1")
+		require.NoError(t, err)
+	}
+	// 只有第一次未命中的時候加載
+	assert.Equal(t, uint64(1), h.Snapshot().Count)
+}
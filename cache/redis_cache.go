@@ -0,0 +1,257 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	memlimit "geektime-go/cache/HW_memory_limit"
+	"geektime-go/cache/resp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	errFailedToSetCache = errors.New("cache: 寫入緩存失敗")
+)
+
+var (
+	_ Cache          = (*RedisCache)(nil)
+	_ memlimit.Cache = (*RedisBytesCache)(nil)
+)
+
+// RedisCache 使用 Redis 作為緩存，Get 返回 string
+// 值的類型參考 resp 的參數，其他類型需要實現 encoding.BinaryMarshaler
+//
+// OnEvicted 依賴 keyspace 通知，Redis 需要開啟 notify-keyspace-events Exe
+// 透過 Delete 和 LoadAndDelete 刪除的時候回調能拿到值，
+// Redis 自己過期或者淘汰的時候只能拿到 key，值為 nil
+// 通知是整個 db 的，同一個 db 裡面其他 key 過期也會觸發回調
+type RedisCache struct {
+	core *redisCore
+}
+
+func NewRedisCache(client *resp.Client) *RedisCache {
+	return &RedisCache{core: &redisCore{client: client}}
+}
+
+func (r *RedisCache) Set(ctx context.Context, key string, value any, expiration time.Duration) error {
+	return r.core.set(ctx, key, value, expiration)
+}
+
+func (r *RedisCache) Get(ctx context.Context, key string) (any, error) {
+	val, err := r.core.get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return string(val), nil
+}
+
+func (r *RedisCache) Delete(ctx context.Context, key string) error {
+	return r.core.delete(ctx, key)
+}
+
+// LoadAndDelete 使用 GETDEL，需要 Redis 6.2 以上
+func (r *RedisCache) LoadAndDelete(ctx context.Context, key string) (any, error) {
+	val, err := r.core.loadAndDelete(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return string(val), nil
+}
+
+func (r *RedisCache) OnEvicted(f func(key string, val any)) {
+	r.core.onEvicted(func(key string, val []byte) {
+		if val == nil {
+			f(key, nil)
+			return
+		}
+		f(key, string(val))
+	})
+}
+
+// Close 停止接收 keyspace 通知，不會關閉 client
+func (r *RedisCache) Close() error {
+	return r.core.close()
+}
+
+// RedisBytesCache 實現 HW_memory_limit 的 Cache，可以和 MaxMemoryCache 一起使用
+// 注意 Redis 自己過期或者淘汰的時候回調拿不到值，MaxMemoryCache 的統計會不準確
+type RedisBytesCache struct {
+	core *redisCore
+}
+
+func NewRedisBytesCache(client *resp.Client) *RedisBytesCache {
+	return &RedisBytesCache{core: &redisCore{client: client}}
+}
+
+func (r *RedisBytesCache) Get(ctx context.Context, key string) ([]byte, error) {
+	return r.core.get(ctx, key)
+}
+
+func (r *RedisBytesCache) Set(ctx context.Context, key string, val []byte, expiration time.Duration) error {
+	return r.core.set(ctx, key, val, expiration)
+}
+
+func (r *RedisBytesCache) Delete(ctx context.Context, key string) error {
+	return r.core.delete(ctx, key)
+}
+
+func (r *RedisBytesCache) LoadAndDelete(ctx context.Context, key string) ([]byte, error) {
+	return r.core.loadAndDelete(ctx, key)
+}
+
+func (r *RedisBytesCache) OnEvicted(f func(key string, val []byte)) {
+	r.core.onEvicted(f)
+}
+
+func (r *RedisBytesCache) Close() error {
+	return r.core.close()
+}
+
+// redisCore RedisCache 和 RedisBytesCache 共用的實現
+type redisCore struct {
+	client *resp.Client
+
+	mu      sync.Mutex
+	evicted func(key string, val []byte)
+	// 第一次調用 OnEvicted 的時候開始訂閱
+	watching bool
+	closed   bool
+	done     chan struct{}
+	ps       *resp.PubSub
+}
+
+func (r *redisCore) set(ctx context.Context, key string, val any, expiration time.Duration) error {
+	args := []any{"SET", key, val}
+	if expiration > 0 {
+		args = append(args, "PX", pxMillis(expiration))
+	}
+	res, err := resp.String(r.client.Do(ctx, args...))
+	if err != nil {
+		return err
+	}
+	if res != "OK" {
+		return fmt.Errorf("%w, key: %s, reply: %s", errFailedToSetCache, key, res)
+	}
+	return nil
+}
+
+func (r *redisCore) get(ctx context.Context, key string) ([]byte, error) {
+	val, err := resp.Bytes(r.client.Do(ctx, "GET", key))
+	if errors.Is(err, resp.ErrNil) {
+		return nil, fmt.Errorf("%w, key: %s", errKeyNotFound, key)
+	}
+	return val, err
+}
+
+// delete 有回調的時候使用 GETDEL，回調才能拿到值
+func (r *redisCore) delete(ctx context.Context, key string) error {
+	if r.callback() == nil {
+		_, err := r.client.Do(ctx, "DEL", key)
+		return err
+	}
+	_, err := r.loadAndDelete(ctx, key)
+	if errors.Is(err, errKeyNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (r *redisCore) loadAndDelete(ctx context.Context, key string) ([]byte, error) {
+	val, err := resp.Bytes(r.client.Do(ctx, "GETDEL", key))
+	if errors.Is(err, resp.ErrNil) {
+		return nil, fmt.Errorf("%w, key: %s", errKeyNotFound, key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if f := r.callback(); f != nil {
+		f(key, val)
+	}
+	return val, nil
+}
+
+func (r *redisCore) callback() func(key string, val []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.evicted
+}
+
+// onEvicted 替換回調，第一次調用的時候訂閱過期和淘汰的通知
+// 第一次訂閱是同步的，返回之後過期的 key 都能收到通知；斷開之後會在後台重新訂閱
+func (r *redisCore) onEvicted(f func(key string, val []byte)) {
+	r.mu.Lock()
+	r.evicted = f
+	if r.watching || r.closed {
+		r.mu.Unlock()
+		return
+	}
+	r.watching = true
+	r.done = make(chan struct{})
+	r.mu.Unlock()
+
+	ps, _ := r.subscribe()
+	go r.watch(ps)
+}
+
+func (r *redisCore) subscribe() (*resp.PubSub, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	db := strconv.Itoa(r.client.DB())
+	ps, err := r.client.Subscribe(ctx, "__keyevent@"+db+"__:expired", "__keyevent@"+db+"__:evicted")
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		_ = ps.Close()
+		return nil, errors.New("cache: 已經關閉")
+	}
+	r.ps = ps
+	return ps, nil
+}
+
+func (r *redisCore) watch(ps *resp.PubSub) {
+	for {
+		if ps != nil {
+			for msg := range ps.Channel() {
+				if f := r.callback(); f != nil {
+					f(msg.Payload, nil)
+				}
+			}
+		}
+		select {
+		case <-r.done:
+			return
+		case <-time.After(time.Second):
+		}
+		ps, _ = r.subscribe()
+	}
+}
+
+func (r *redisCore) close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return errors.New("重複關閉")
+	}
+	r.closed = true
+	if r.done != nil {
+		close(r.done)
+	}
+	if r.ps != nil {
+		_ = r.ps.Close()
+	}
+	return nil
+}
+
+// pxMillis PX 不能為 0，不足 1 毫秒的按照 1 毫秒
+func pxMillis(expiration time.Duration) int64 {
+	ms := expiration.Milliseconds()
+	if ms == 0 {
+		ms = 1
+	}
+	return ms
+}
@@ -0,0 +1,386 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	memlimit "geektime-go/cache/HW_memory_limit"
+	"geektime-go/cache/resp"
+	"strconv"
+	"time"
+)
+
+var (
+	_ BatchCache  = (*RedisCache)(nil)
+	_ AtomicCache = (*RedisCache)(nil)
+	_ TTLCache    = (*RedisCache)(nil)
+
+	_ memlimit.BatchCache  = (*RedisBytesCache)(nil)
+	_ memlimit.AtomicCache = (*RedisBytesCache)(nil)
+	_ memlimit.TTLCache    = (*RedisBytesCache)(nil)
+)
+
+var (
+	// msetScript MSET 不支持過期時間，ARGV[1] 為過期時間，後面是和 KEYS 一一對應的值
+	msetScript = resp.NewLuaScript(`
+for i = 1, #KEYS do
+	redis.call('SET', KEYS[i], ARGV[i + 1], 'PX', ARGV[1])
+end
+return 'OK'`)
+	// mdelScript 有 OnEvicted 回調的時候使用，返回被刪除的值
+	mdelScript = resp.NewLuaScript(`
+local vals = {}
+for i = 1, #KEYS do
+	vals[i] = redis.call('GETDEL', KEYS[i])
+end
+return vals`)
+	// casScript Redis 沒有版本號，版本為值的 SHA1 的前 52 位加 1，和 redisVersion 一致
+	// ARGV[1] 為版本，ARGV[2] 為新的值，ARGV[3] 為過期時間，0 表示不過期
+	casScript = resp.NewLuaScript(`
+local val = redis.call('GET', KEYS[1])
+local ver = 0
+if val then
+	ver = tonumber(string.sub(redis.sha1hex(val), 1, 13), 16) + 1
+end
+if ver ~= tonumber(ARGV[1]) then
+	return 0
+end
+if tonumber(ARGV[3]) > 0 then
+	redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+else
+	redis.call('SET', KEYS[1], ARGV[2])
+end
+return 1`)
+)
+
+// redisVersion 值的版本，值相同的時候版本也相同
+// 所以 A -> B -> A 的修改對 CompareAndSwap 來說是沒有修改
+func redisVersion(val []byte) uint64 {
+	sum := sha1.Sum(val)
+	return binary.BigEndian.Uint64(sum[:8])>>12 + 1
+}
+
+// RegisterRedisScripts 在 resp.Server 上註冊 RedisCache 使用的 Lua 腳本的 Go 實現，用於測試
+func RegisterRedisScripts(s *resp.Server) {
+	s.RegisterScript(msetScript.Src(), func(call *resp.ScriptCall, keys []string, args [][]byte) any {
+		for i, key := range keys {
+			if res, ok := call.Call("SET", key, args[i+1], "PX", args[0]).(resp.Error); ok {
+				return res
+			}
+		}
+		return resp.SimpleString("OK")
+	})
+	s.RegisterScript(mdelScript.Src(), func(call *resp.ScriptCall, keys []string, args [][]byte) any {
+		vals := make([]any, len(keys))
+		for i, key := range keys {
+			vals[i] = call.Call("GETDEL", key)
+		}
+		return vals
+	})
+	s.RegisterScript(casScript.Src(), func(call *resp.ScriptCall, keys []string, args [][]byte) any {
+		var ver uint64
+		if val, ok := call.Call("GET", keys[0]).([]byte); ok {
+			ver = redisVersion(val)
+		}
+		if strconv.FormatUint(ver, 10) != string(args[0]) {
+			return int64(0)
+		}
+		if !bytes.Equal(args[2], []byte("0")) {
+			call.Call("SET", keys[0], args[1], "PX", args[2])
+		} else {
+			call.Call("SET", keys[0], args[1])
+		}
+		return int64(1)
+	})
+	registerRedisTagScripts(s)
+}
+
+func (r *redisCore) mget(ctx context.Context, keys []string) (map[string][]byte, error) {
+	args := make([]any, 0, len(keys)+1)
+	args = append(args, "MGET")
+	for _, key := range keys {
+		args = append(args, key)
+	}
+	vals, err := r.client.Do(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	arr, _ := vals.([]any)
+	res := make(map[string][]byte, len(keys))
+	for i, val := range arr {
+		if v, ok := val.([]byte); ok && i < len(keys) {
+			res[keys[i]] = v
+		}
+	}
+	return res, nil
+}
+
+func (r *redisCore) mset(ctx context.Context, entries map[string]any, expiration time.Duration) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	var res string
+	var err error
+	if expiration <= 0 {
+		args := make([]any, 0, len(entries)*2+1)
+		args = append(args, "MSET")
+		for key, val := range entries {
+			args = append(args, key, val)
+		}
+		res, err = resp.String(r.client.Do(ctx, args...))
+	} else {
+		keys := make([]string, 0, len(entries))
+		args := make([]any, 0, len(entries)+1)
+		args = append(args, pxMillis(expiration))
+		for key, val := range entries {
+			keys = append(keys, key)
+			args = append(args, val)
+		}
+		res, err = resp.String(msetScript.Run(ctx, r.client, keys, args...))
+	}
+	if err != nil {
+		return err
+	}
+	if res != "OK" {
+		return fmt.Errorf("%w, reply: %s", errFailedToSetCache, res)
+	}
+	return nil
+}
+
+// mdelete 有回調的時候使用腳本取出被刪除的值
+func (r *redisCore) mdelete(ctx context.Context, keys []string) (int, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	f := r.callback()
+	if f == nil {
+		args := make([]any, 0, len(keys)+1)
+		args = append(args, "DEL")
+		for _, key := range keys {
+			args = append(args, key)
+		}
+		n, err := resp.Int64(r.client.Do(ctx, args...))
+		return int(n), err
+	}
+	vals, err := mdelScript.Run(ctx, r.client, keys)
+	if err != nil {
+		return 0, err
+	}
+	arr, _ := vals.([]any)
+	cnt := 0
+	for i, val := range arr {
+		if v, ok := val.([]byte); ok && i < len(keys) {
+			f(keys[i], v)
+			cnt++
+		}
+	}
+	return cnt, nil
+}
+
+func (r *redisCore) setNX(ctx context.Context, key string, val any, expiration time.Duration) (bool, error) {
+	args := []any{"SET", key, val, "NX"}
+	if expiration > 0 {
+		args = append(args, "PX", pxMillis(expiration))
+	}
+	_, err := resp.String(r.client.Do(ctx, args...))
+	if errors.Is(err, resp.ErrNil) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// getAndSet 使用 SET GET，需要 Redis 6.2 以上
+func (r *redisCore) getAndSet(ctx context.Context, key string, val any, expiration time.Duration) ([]byte, bool, error) {
+	args := []any{"SET", key, val, "GET"}
+	if expiration > 0 {
+		args = append(args, "PX", pxMillis(expiration))
+	}
+	old, err := resp.Bytes(r.client.Do(ctx, args...))
+	if errors.Is(err, resp.ErrNil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return old, true, nil
+}
+
+func (r *redisCore) getWithVersion(ctx context.Context, key string) ([]byte, uint64, error) {
+	val, err := r.get(ctx, key)
+	if err != nil {
+		return nil, 0, err
+	}
+	return val, redisVersion(val), nil
+}
+
+func (r *redisCore) compareAndSwap(ctx context.Context, key string, version uint64,
+	val any, expiration time.Duration) (bool, error) {
+	var px int64
+	if expiration > 0 {
+		px = pxMillis(expiration)
+	}
+	n, err := resp.Int64(casScript.Run(ctx, r.client, []string{key}, version, val, px))
+	return n == 1, err
+}
+
+func (r *redisCore) incr(ctx context.Context, key string, delta int64) (int64, error) {
+	return resp.Int64(r.client.Do(ctx, "INCRBY", key, delta))
+}
+
+func (r *redisCore) ttl(ctx context.Context, key string) (time.Duration, error) {
+	ms, err := resp.Int64(r.client.Do(ctx, "PTTL", key))
+	if err != nil {
+		return 0, err
+	}
+	switch ms {
+	case -2:
+		return 0, fmt.Errorf("%w, key: %s", errKeyNotFound, key)
+	case -1:
+		return NoExpiration, nil
+	default:
+		return time.Duration(ms) * time.Millisecond, nil
+	}
+}
+
+// expire 和 Redis 一樣，不大於 0 的過期時間直接刪除
+func (r *redisCore) expire(ctx context.Context, key string, expiration time.Duration) (bool, error) {
+	var ms int64
+	if expiration > 0 {
+		ms = pxMillis(expiration)
+	}
+	n, err := resp.Int64(r.client.Do(ctx, "PEXPIRE", key, ms))
+	return n == 1, err
+}
+
+func (r *redisCore) persist(ctx context.Context, key string) (bool, error) {
+	n, err := resp.Int64(r.client.Do(ctx, "PERSIST", key))
+	return n == 1, err
+}
+
+// MGet 值為 string
+func (r *RedisCache) MGet(ctx context.Context, keys ...string) (map[string]any, error) {
+	vals, err := r.core.mget(ctx, keys)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]any, len(vals))
+	for key, val := range vals {
+		res[key] = string(val)
+	}
+	return res, nil
+}
+
+// MSet 有過期時間的時候使用 Lua 腳本
+func (r *RedisCache) MSet(ctx context.Context, entries map[string]any, expiration time.Duration) error {
+	return r.core.mset(ctx, entries, expiration)
+}
+
+func (r *RedisCache) MDelete(ctx context.Context, keys ...string) (int, error) {
+	return r.core.mdelete(ctx, keys)
+}
+
+func (r *RedisCache) SetNX(ctx context.Context, key string, value any, expiration time.Duration) (bool, error) {
+	return r.core.setNX(ctx, key, value, expiration)
+}
+
+func (r *RedisCache) GetAndSet(ctx context.Context, key string, value any, expiration time.Duration) (any, bool, error) {
+	old, loaded, err := r.core.getAndSet(ctx, key, value, expiration)
+	if !loaded {
+		return nil, false, err
+	}
+	return string(old), true, nil
+}
+
+// GetWithVersion 版本根據值計算，見 redisVersion
+func (r *RedisCache) GetWithVersion(ctx context.Context, key string) (any, uint64, error) {
+	val, version, err := r.core.getWithVersion(ctx, key)
+	if err != nil {
+		return nil, 0, err
+	}
+	return string(val), version, nil
+}
+
+func (r *RedisCache) CompareAndSwap(ctx context.Context, key string, version uint64,
+	value any, expiration time.Duration) (bool, error) {
+	return r.core.compareAndSwap(ctx, key, version, value, expiration)
+}
+
+func (r *RedisCache) Incr(ctx context.Context, key string, delta int64) (int64, error) {
+	return r.core.incr(ctx, key, delta)
+}
+
+func (r *RedisCache) Decr(ctx context.Context, key string, delta int64) (int64, error) {
+	return resp.Int64(r.core.client.Do(ctx, "DECRBY", key, delta))
+}
+
+func (r *RedisCache) TTL(ctx context.Context, key string) (time.Duration, error) {
+	return r.core.ttl(ctx, key)
+}
+
+func (r *RedisCache) Expire(ctx context.Context, key string, expiration time.Duration) (bool, error) {
+	return r.core.expire(ctx, key, expiration)
+}
+
+func (r *RedisCache) Persist(ctx context.Context, key string) (bool, error) {
+	return r.core.persist(ctx, key)
+}
+
+func (r *RedisBytesCache) MGet(ctx context.Context, keys ...string) (map[string][]byte, error) {
+	return r.core.mget(ctx, keys)
+}
+
+func (r *RedisBytesCache) MSet(ctx context.Context, entries map[string][]byte, expiration time.Duration) error {
+	vals := make(map[string]any, len(entries))
+	for key, val := range entries {
+		vals[key] = val
+	}
+	return r.core.mset(ctx, vals, expiration)
+}
+
+func (r *RedisBytesCache) MDelete(ctx context.Context, keys ...string) (int, error) {
+	return r.core.mdelete(ctx, keys)
+}
+
+func (r *RedisBytesCache) SetNX(ctx context.Context, key string, val []byte, expiration time.Duration) (bool, error) {
+	return r.core.setNX(ctx, key, val, expiration)
+}
+
+func (r *RedisBytesCache) GetAndSet(ctx context.Context, key string, val []byte, expiration time.Duration) ([]byte, bool, error) {
+	return r.core.getAndSet(ctx, key, val, expiration)
+}
+
+func (r *RedisBytesCache) GetWithVersion(ctx context.Context, key string) ([]byte, uint64, error) {
+	return r.core.getWithVersion(ctx, key)
+}
+
+func (r *RedisBytesCache) CompareAndSwap(ctx context.Context, key string, version uint64,
+	val []byte, expiration time.Duration) (bool, error) {
+	return r.core.compareAndSwap(ctx, key, version, val, expiration)
+}
+
+func (r *RedisBytesCache) Incr(ctx context.Context, key string, delta int64) (int64, error) {
+	return r.core.incr(ctx, key, delta)
+}
+
+func (r *RedisBytesCache) Decr(ctx context.Context, key string, delta int64) (int64, error) {
+	return resp.Int64(r.core.client.Do(ctx, "DECRBY", key, delta))
+}
+
+func (r *RedisBytesCache) TTL(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := r.core.ttl(ctx, key)
+	if ttl == NoExpiration {
+		return memlimit.NoExpiration, err
+	}
+	return ttl, err
+}
+
+func (r *RedisBytesCache) Expire(ctx context.Context, key string, expiration time.Duration) (bool, error) {
+	return r.core.expire(ctx, key, expiration)
+}
+
+func (r *RedisBytesCache) Persist(ctx context.Context, key string) (bool, error) {
+	return r.core.persist(ctx, key)
+}
@@ -0,0 +1,119 @@
+package cache
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestRedisCache_Batch(t *testing.T) {
+	ctx := context.Background()
+	c := NewRedisCache(startRedis(t, RegisterRedisScripts))
+	defer c.Close()
+	require.NoError(t, c.MSet(ctx, map[string]any{"key1": "val1", "key2": 2}, 0))
+	require.NoError(t, c.MSet(ctx, map[string]any{"key3": "val3"}, time.Millisecond))
+	time.Sleep(time.Millisecond * 5)
+
+	vals, err := c.MGet(ctx, "key1", "key2", "key3", "key4")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"key1": "val1", "key2": "2"}, vals)
+
+	n, err := c.MDelete(ctx, "key1", "key3", "key4")
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	// 有回調的時候回調能拿到被刪除的值
+	evicted := make(map[string]string)
+	c.OnEvicted(func(key string, val any) {
+		evicted[key] = val.(string)
+	})
+	n, err = c.MDelete(ctx, "key2", "key4")
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, map[string]string{"key2": "2"}, evicted)
+}
+
+func TestRedisCache_Atomic(t *testing.T) {
+	ctx := context.Background()
+	c := NewRedisCache(startRedis(t, RegisterRedisScripts))
+	defer c.Close()
+
+	ok, err := c.SetNX(ctx, "key1", "val1", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = c.SetNX(ctx, "key1", "val2", 0)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	old, loaded, err := c.GetAndSet(ctx, "key1", "val2", 0)
+	require.NoError(t, err)
+	assert.True(t, loaded)
+	assert.Equal(t, "val1", old)
+	_, loaded, err = c.GetAndSet(ctx, "key2", "val2", 0)
+	require.NoError(t, err)
+	assert.False(t, loaded)
+
+	val, version, err := c.GetWithVersion(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, "val2", val)
+	assert.Equal(t, redisVersion([]byte("val2")), version)
+	_, _, err = c.GetWithVersion(ctx, "key3")
+	assert.ErrorIs(t, err, errKeyNotFound)
+
+	ok, err = c.CompareAndSwap(ctx, "key1", version+1, "val3", 0)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	ok, err = c.CompareAndSwap(ctx, "key1", version, "val3", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = c.CompareAndSwap(ctx, "key1", version, "val4", 0)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	ok, err = c.CompareAndSwap(ctx, "key3", 0, "val3", 0)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	n, err := c.Incr(ctx, "cnt", 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), n)
+	n, err = c.Decr(ctx, "cnt", 3)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), n)
+	_, err = c.Incr(ctx, "key1", 1)
+	assert.Error(t, err)
+}
+
+func TestRedisBytesCache_TTL(t *testing.T) {
+	ctx := context.Background()
+	c := NewRedisBytesCache(startRedis(t))
+	defer c.Close()
+	require.NoError(t, c.Set(ctx, "key1", []byte("val1"), 0))
+
+	ttl, err := c.TTL(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, time.Duration(-1), ttl)
+	_, err = c.TTL(ctx, "key2")
+	assert.ErrorIs(t, err, errKeyNotFound)
+
+	ok, err := c.Expire(ctx, "key1", time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ttl, err = c.TTL(ctx, "key1")
+	require.NoError(t, err)
+	assert.True(t, ttl > 0 && ttl <= time.Minute)
+
+	ok, err = c.Persist(ctx, "key1")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = c.Persist(ctx, "key1")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	ok, err = c.Expire(ctx, "key1", 0)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	_, err = c.Get(ctx, "key1")
+	assert.ErrorIs(t, err, errKeyNotFound)
+}
@@ -0,0 +1,155 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"geektime-go/cache/resp"
+	"strconv"
+	"time"
+)
+
+var _ TagCache = (*RedisCache)(nil)
+
+// redisTagPrefix 標籤在 Redis 裡面是一個集合，成員為帶有這個標籤的 key
+const redisTagPrefix = "cache:tag:"
+
+var (
+	// setWithTagsScript KEYS[1] 為 key，後面是標籤的集合；ARGV[1] 為值，ARGV[2] 為過期時間，0 表示不過期
+	// 集合的過期時間不短於所有成員的過期時間，有不過期的成員的時候集合也不過期
+	// PTTL 為 -2 表示集合不存在，-1 表示集合不過期
+	setWithTagsScript = resp.NewLuaScript(`
+local px = tonumber(ARGV[2])
+if px > 0 then
+	redis.call('SET', KEYS[1], ARGV[1], 'PX', px)
+else
+	redis.call('SET', KEYS[1], ARGV[1])
+end
+for i = 2, #KEYS do
+	local ttl = redis.call('PTTL', KEYS[i])
+	redis.call('SADD', KEYS[i], KEYS[1])
+	if px == 0 then
+		redis.call('PERSIST', KEYS[i])
+	elseif ttl == -2 or (ttl >= 0 and ttl < px) then
+		redis.call('PEXPIRE', KEYS[i], px)
+	end
+end
+return 'OK'`)
+	// invalidateTagScript KEYS 為標籤的集合，返回被刪除的 key 和值，依次排列
+	invalidateTagScript = resp.NewLuaScript(`
+local res = {}
+for i = 1, #KEYS do
+	local members = redis.call('SMEMBERS', KEYS[i])
+	for _, key in ipairs(members) do
+		local val = redis.call('GETDEL', key)
+		if val then
+			res[#res + 1] = key
+			res[#res + 1] = val
+		end
+	end
+	redis.call('DEL', KEYS[i])
+end
+return res`)
+)
+
+func registerRedisTagScripts(s *resp.Server) {
+	s.RegisterScript(setWithTagsScript.Src(), func(call *resp.ScriptCall, keys []string, args [][]byte) any {
+		var res any
+		if string(args[1]) != "0" {
+			res = call.Call("SET", keys[0], args[0], "PX", args[1])
+		} else {
+			res = call.Call("SET", keys[0], args[0])
+		}
+		if isRespError(res) {
+			return res
+		}
+		px, err := strconv.ParseInt(string(args[1]), 10, 64)
+		if err != nil {
+			return resp.Error("ERR value is not an integer or out of range")
+		}
+		for _, tag := range keys[1:] {
+			ttl, _ := call.Call("PTTL", tag).(int64)
+			if res = call.Call("SADD", tag, keys[0]); isRespError(res) {
+				return res
+			}
+			if px == 0 {
+				res = call.Call("PERSIST", tag)
+			} else if ttl == -2 || ttl >= 0 && ttl < px {
+				res = call.Call("PEXPIRE", tag, px)
+			}
+			if isRespError(res) {
+				return res
+			}
+		}
+		return resp.SimpleString("OK")
+	})
+	s.RegisterScript(invalidateTagScript.Src(), func(call *resp.ScriptCall, keys []string, args [][]byte) any {
+		res := make([]any, 0)
+		for _, tag := range keys {
+			members := call.Call("SMEMBERS", tag)
+			if isRespError(members) {
+				return members
+			}
+			for _, key := range members.([]any) {
+				if val, ok := call.Call("GETDEL", key).([]byte); ok {
+					res = append(res, key, val)
+				}
+			}
+			call.Call("DEL", tag)
+		}
+		return res
+	})
+}
+
+func isRespError(val any) bool {
+	_, ok := val.(resp.Error)
+	return ok
+}
+
+// SetWithTags key 和標籤的集合在同一個腳本裡面寫入
+// 標籤的集合在最晚過期的成員過期之後過期，不會一直保留；
+// 但是 key 過期或者被刪除之後不會馬上從集合裡面移除，帶有不過期的 key 的集合也不會過期，需要 InvalidateTag 清理，
+// 所以 InvalidateTag 可能刪除重新寫入但是沒有這個標籤的 key，對緩存來說只是多一次 miss
+func (r *RedisCache) SetWithTags(ctx context.Context, key string, value any,
+	expiration time.Duration, tags ...string) error {
+	keys := make([]string, 0, len(tags)+1)
+	keys = append(keys, key)
+	for _, tag := range tags {
+		keys = append(keys, redisTagPrefix+tag)
+	}
+	var px int64
+	if expiration > 0 {
+		px = pxMillis(expiration)
+	}
+	res, err := resp.String(setWithTagsScript.Run(ctx, r.core.client, keys, value, px))
+	if err != nil {
+		return err
+	}
+	if res != "OK" {
+		return fmt.Errorf("%w, reply: %s", errFailedToSetCache, res)
+	}
+	return nil
+}
+
+// InvalidateTag 有 OnEvicted 回調的時候，回調能拿到被刪除的值
+// 腳本使用 GETDEL，需要 Redis 6.2 以上
+func (r *RedisCache) InvalidateTag(ctx context.Context, tags ...string) (int, error) {
+	if len(tags) == 0 {
+		return 0, nil
+	}
+	keys := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		keys = append(keys, redisTagPrefix+tag)
+	}
+	vals, err := invalidateTagScript.Run(ctx, r.core.client, keys)
+	if err != nil {
+		return 0, err
+	}
+	arr, _ := vals.([]any)
+	f := r.core.callback()
+	for i := 0; f != nil && i+1 < len(arr); i += 2 {
+		key, _ := arr[i].([]byte)
+		val, _ := arr[i+1].([]byte)
+		f(string(key), val)
+	}
+	return len(arr) / 2, nil
+}
@@ -0,0 +1,74 @@
+package cache
+
+import (
+	"context"
+	"geektime-go/cache/resp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestRedisCache_InvalidateTag(t *testing.T) {
+	ctx := context.Background()
+	c := NewRedisCache(startRedis(t, RegisterRedisScripts))
+	defer c.Close()
+	require.NoError(t, c.SetWithTags(ctx, "profile:42", "Tom", time.Minute, "user:42"))
+	require.NoError(t, c.SetWithTags(ctx, "perm:42", "admin", 0, "user:42", "perm"))
+	require.NoError(t, c.SetWithTags(ctx, "perm:43", "guest", 0, "user:43", "perm"))
+	require.NoError(t, c.Set(ctx, "other", "val", 0))
+
+	evicted := make(map[string]any)
+	c.OnEvicted(func(key string, val any) {
+		evicted[key] = val
+	})
+	n, err := c.InvalidateTag(ctx, "user:42")
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, map[string]any{"profile:42": "Tom", "perm:42": "admin"}, evicted)
+	_, err = c.Get(ctx, "profile:42")
+	assert.ErrorIs(t, err, errKeyNotFound)
+
+	// 同一個 key 有多個標籤只計算一次
+	n, err = c.InvalidateTag(ctx, "perm", "user:43", "unknown")
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	val, err := c.Get(ctx, "other")
+	require.NoError(t, err)
+	assert.Equal(t, "val", val)
+
+	n, err = c.InvalidateTag(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestRedisCache_SetWithTagsTTL(t *testing.T) {
+	ctx := context.Background()
+	client := startRedis(t, RegisterRedisScripts)
+	c := NewRedisCache(client)
+	defer c.Close()
+	pttl := func(tag string) int64 {
+		res, err := resp.Int64(client.Do(ctx, "PTTL", redisTagPrefix+tag))
+		require.NoError(t, err)
+		return res
+	}
+
+	// 集合的過期時間跟著最晚過期的成員
+	require.NoError(t, c.SetWithTags(ctx, "key1", "val1", time.Second, "tag"))
+	assert.InDelta(t, time.Second.Milliseconds(), pttl("tag"), 100)
+	require.NoError(t, c.SetWithTags(ctx, "key2", "val2", time.Minute, "tag"))
+	assert.InDelta(t, time.Minute.Milliseconds(), pttl("tag"), 100)
+	require.NoError(t, c.SetWithTags(ctx, "key3", "val3", time.Second, "tag"))
+	assert.InDelta(t, time.Minute.Milliseconds(), pttl("tag"), 100)
+	// 有不過期的成員的時候集合也不過期
+	require.NoError(t, c.SetWithTags(ctx, "key4", "val4", 0, "tag"))
+	assert.Equal(t, int64(-1), pttl("tag"))
+	require.NoError(t, c.SetWithTags(ctx, "key5", "val5", time.Minute, "tag"))
+	assert.Equal(t, int64(-1), pttl("tag"))
+
+	// 所有成員都過期之後集合也會被刪除
+	require.NoError(t, c.SetWithTags(ctx, "key6", "val6", time.Millisecond*20, "short"))
+	assert.Eventually(t, func() bool {
+		return pttl("short") == -2
+	}, time.Second, time.Millisecond*10)
+}
@@ -0,0 +1,189 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	memlimit "geektime-go/cache/HW_memory_limit"
+	"geektime-go/cache/resp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// startRedis 在進程內啟動 Redis 替身，開啟過期和淘汰的通知
+func startRedis(t *testing.T, opts ...resp.ServerOption) *resp.Client {
+	opts = append([]resp.ServerOption{
+		resp.ServerWithNotifyKeyspaceEvents("Exe"),
+		resp.ServerWithExpireInterval(time.Millisecond * 10),
+	}, opts...)
+	s := resp.NewServer(opts...)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		_ = s.Serve(l)
+	}()
+	client := resp.NewClient(l.Addr().String())
+	t.Cleanup(func() {
+		_ = client.Close()
+		_ = s.Close()
+	})
+	return client
+}
+
+func TestRedisCache(t *testing.T) {
+	c := NewRedisCache(startRedis(t))
+	ctx := context.Background()
+
+	_, err := c.Get(ctx, "key1")
+	assert.Equal(t, fmt.Errorf("%w, key: %s", errKeyNotFound, "key1"), err)
+
+	require.NoError(t, c.Set(ctx, "key1", "val1", time.Minute))
+	require.NoError(t, c.Set(ctx, "key2", 123, 0))
+	val, err := c.Get(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, "val1", val)
+	val, err = c.Get(ctx, "key2")
+	require.NoError(t, err)
+	assert.Equal(t, "123", val)
+
+	val, err = c.LoadAndDelete(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, "val1", val)
+	_, err = c.LoadAndDelete(ctx, "key1")
+	assert.Equal(t, fmt.Errorf("%w, key: %s", errKeyNotFound, "key1"), err)
+
+	require.NoError(t, c.Delete(ctx, "key2"))
+	require.NoError(t, c.Delete(ctx, "key2"))
+	_, err = c.Get(ctx, "key2")
+	assert.ErrorIs(t, err, errKeyNotFound)
+
+	// 不足 1 毫秒的過期時間
+	require.NoError(t, c.Set(ctx, "key3", "val3", time.Microsecond))
+	time.Sleep(time.Millisecond * 5)
+	_, err = c.Get(ctx, "key3")
+	assert.ErrorIs(t, err, errKeyNotFound)
+	assert.NoError(t, c.Close())
+}
+
+func TestRedisCache_OnEvicted(t *testing.T) {
+	c := NewRedisCache(startRedis(t, resp.ServerWithMaxKeys(2)))
+	defer func() {
+		_ = c.Close()
+	}()
+	ctx := context.Background()
+	var (
+		mu      sync.Mutex
+		evicted = map[string]any{}
+	)
+	c.OnEvicted(func(key string, val any) {
+		mu.Lock()
+		defer mu.Unlock()
+		evicted[key] = val
+	})
+	snapshot := func() map[string]any {
+		mu.Lock()
+		defer mu.Unlock()
+		res := make(map[string]any, len(evicted))
+		for k, v := range evicted {
+			res[k] = v
+		}
+		return res
+	}
+
+	// 刪除的時候可以拿到值
+	require.NoError(t, c.Set(ctx, "key1", "val1", 0))
+	require.NoError(t, c.Delete(ctx, "key1"))
+	assert.Equal(t, map[string]any{"key1": "val1"}, snapshot())
+
+	// 過期只能拿到 key
+	require.NoError(t, c.Set(ctx, "key2", "val2", time.Millisecond*10))
+	assert.Eventually(t, func() bool {
+		_, ok := snapshot()["key2"]
+		return ok
+	}, time.Second, time.Millisecond*10)
+	assert.Nil(t, snapshot()["key2"])
+
+	// 超過 maxKeys 被淘汰
+	for _, key := range []string{"key3", "key4", "key5"} {
+		require.NoError(t, c.Set(ctx, key, "val", 0))
+	}
+	assert.Eventually(t, func() bool {
+		return len(snapshot()) == 3
+	}, time.Second, time.Millisecond*10)
+}
+
+func TestRedisBytesCache_MaxMemory(t *testing.T) {
+	client := startRedis(t)
+	rc := NewRedisBytesCache(client)
+	defer func() {
+		_ = rc.Close()
+	}()
+	c := memlimit.NewMaxMemoryCache(10, rc)
+	ctx := context.Background()
+
+	require.NoError(t, c.Set(ctx, "key1", []byte("12345"), time.Minute))
+	require.NoError(t, c.Set(ctx, "key2", []byte("12345"), time.Minute))
+	// 超出 10 個字節，淘汰 key1
+	require.NoError(t, c.Set(ctx, "key3", []byte("123"), time.Minute))
+	_, err := rc.Get(ctx, "key1")
+	assert.ErrorIs(t, err, errKeyNotFound)
+	val, err := c.Get(ctx, "key3")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("123"), val)
+
+	val, err = c.LoadAndDelete(ctx, "key2")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("12345"), val)
+}
+
+// TestRedisBytesCache_MaxMemoryExpire 過期通知在 watch 的 goroutine 裡面回調，需要配合 -race 運行
+func TestRedisBytesCache_MaxMemoryExpire(t *testing.T) {
+	client := startRedis(t)
+	rc := NewRedisBytesCache(client)
+	defer func() {
+		_ = rc.Close()
+	}()
+	c := memlimit.NewMaxMemoryCache(1<<20, rc)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				key := fmt.Sprintf("key%d-%d", i, j)
+				assert.NoError(t, c.Set(ctx, key, []byte("value"), time.Millisecond*5))
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.Eventually(t, func() bool {
+		return c.Used() == 0
+	}, time.Second*3, time.Millisecond*10)
+	assert.Equal(t, 0, c.Stats().Keys)
+}
+
+func TestRedisCache_Typed(t *testing.T) {
+	client := startRedis(t)
+	c := NewTypedCache[string](NewRedisCache(client))
+	ctx := context.Background()
+	require.NoError(t, c.Set(ctx, "key1", "val1", time.Minute))
+	val, err := c.LoadAndDelete(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, "val1", val)
+
+	// 未命中的時候從數據源加載
+	rc := NewReadThroughCache(NewRedisCache(client), func(ctx context.Context, key string) (any, error) {
+		return "db " + key, nil
+	}, time.Minute)
+	v, err := rc.Get(ctx, "key2")
+	require.NoError(t, err)
+	assert.Equal(t, "db key2", v)
+	v, err = rc.Cache.Get(ctx, "key2")
+	require.NoError(t, err)
+	assert.Equal(t, "db key2", v)
+}
@@ -0,0 +1,215 @@
+package resp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNil key 不存在，對應 Redis 返回的 nil
+	ErrNil = errors.New("resp: nil")
+
+	errClientClosed = errors.New("resp: client 已經關閉")
+)
+
+// Client 併發安全的 Redis 客戶端，內部維護一個連接池
+//
+//	client := resp.NewClient("127.0.0.1:6379")
+//	val, err := resp.String(client.Do(ctx, "GET", "key"))
+type Client struct {
+	addr        string
+	db          int
+	password    string
+	dialTimeout time.Duration
+
+	mu     sync.Mutex
+	idle   []*conn
+	max    int
+	closed bool
+}
+
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+type ClientOption func(c *Client)
+
+func NewClient(addr string, opts ...ClientOption) *Client {
+	res := &Client{
+		addr:        addr,
+		max:         10,
+		dialTimeout: time.Second * 3,
+	}
+	for _, opt := range opts {
+		opt(res)
+	}
+	return res
+}
+
+// ClientWithPoolSize 空閒連接的最大數量
+func ClientWithPoolSize(n int) ClientOption {
+	return func(c *Client) {
+		c.max = n
+	}
+}
+
+// ClientWithDB 建立連接之後 SELECT db
+func ClientWithDB(db int) ClientOption {
+	return func(c *Client) {
+		c.db = db
+	}
+}
+
+// ClientWithPassword 建立連接之後 AUTH password
+func ClientWithPassword(password string) ClientOption {
+	return func(c *Client) {
+		c.password = password
+	}
+}
+
+func ClientWithDialTimeout(timeout time.Duration) ClientOption {
+	return func(c *Client) {
+		c.dialTimeout = timeout
+	}
+}
+
+// DB 連接使用的 db，用於拼接 keyspace 通知的 channel
+func (c *Client) DB() int {
+	return c.db
+}
+
+// Do 執行一個命令，Redis 返回錯誤的時候 error 為 Error 類型
+// 返回值參考 readValue
+func (c *Client) Do(ctx context.Context, args ...any) (any, error) {
+	cn, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	val, err := c.do(ctx, cn, args)
+	var redisErr Error
+	if err != nil && !errors.As(err, &redisErr) {
+		// 網絡錯誤，連接的狀態不確定，直接關閉
+		_ = cn.Close()
+		return nil, err
+	}
+	c.put(cn)
+	return val, err
+}
+
+// Close 關閉空閒的連接，正在使用的連接用完之後也會被關閉
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return errClientClosed
+	}
+	c.closed = true
+	for _, cn := range c.idle {
+		_ = cn.Close()
+	}
+	c.idle = nil
+	return nil
+}
+
+func (c *Client) do(ctx context.Context, cn *conn, args []any) (any, error) {
+	dl, _ := ctx.Deadline()
+	if err := cn.SetDeadline(dl); err != nil {
+		return nil, err
+	}
+	// ctx 沒有超時時間，但是可能被取消
+	if ctx.Done() != nil {
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			select {
+			case <-ctx.Done():
+				_ = cn.SetDeadline(time.Now())
+			case <-done:
+			}
+		}()
+	}
+	if err := writeCommand(cn.w, args); err != nil {
+		// 參數不合法，還沒有寫到連接上，需要丟棄緩衝區
+		cn.w.Reset(cn.Conn)
+		return nil, err
+	}
+	if err := cn.w.Flush(); err != nil {
+		return nil, c.ctxErr(ctx, err)
+	}
+	val, err := readValue(cn.r)
+	if err != nil {
+		return nil, c.ctxErr(ctx, err)
+	}
+	if e, ok := val.(Error); ok {
+		return nil, e
+	}
+	return val, nil
+}
+
+// ctxErr 因為 ctx 結束導致的超時，返回 ctx 的錯誤
+func (c *Client) ctxErr(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	// 連接的超時可能比 ctx 的計時器先觸發
+	var ne net.Error
+	if dl, ok := ctx.Deadline(); ok && errors.As(err, &ne) && ne.Timeout() && !time.Now().Before(dl) {
+		return context.DeadlineExceeded
+	}
+	return err
+}
+
+func (c *Client) get(ctx context.Context) (*conn, error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, errClientClosed
+	}
+	if n := len(c.idle); n > 0 {
+		cn := c.idle[n-1]
+		c.idle = c.idle[:n-1]
+		c.mu.Unlock()
+		return cn, nil
+	}
+	c.mu.Unlock()
+	return c.dial(ctx)
+}
+
+func (c *Client) put(cn *conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed || len(c.idle) >= c.max {
+		_ = cn.Close()
+		return
+	}
+	c.idle = append(c.idle, cn)
+}
+
+// dial 建立連接，並且完成 AUTH 和 SELECT
+func (c *Client) dial(ctx context.Context) (*conn, error) {
+	d := net.Dialer{Timeout: c.dialTimeout}
+	nc, err := d.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return nil, err
+	}
+	cn := &conn{Conn: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}
+	if c.password != "" {
+		if _, err = c.do(ctx, cn, []any{"AUTH", c.password}); err != nil {
+			_ = cn.Close()
+			return nil, err
+		}
+	}
+	if c.db != 0 {
+		if _, err = c.do(ctx, cn, []any{"SELECT", c.db}); err != nil {
+			_ = cn.Close()
+			return nil, err
+		}
+	}
+	return cn, nil
+}
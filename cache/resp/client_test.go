@@ -0,0 +1,125 @@
+package resp
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestClient_Do(t *testing.T) {
+	_, client := startServer(t)
+	ctx := context.Background()
+
+	// 不支持的參數類型不會寫到連接上，連接還能繼續使用
+	_, err := client.Do(ctx, "SET", "key1", struct{}{})
+	assert.EqualError(t, err, "resp: 不支持的參數類型 struct {}，需要實現 encoding.BinaryMarshaler")
+	val, err := String(client.Do(ctx, "SET", "key1", 12.5))
+	require.NoError(t, err)
+	assert.Equal(t, "OK", val)
+	val, err = String(client.Do(ctx, "GET", "key1"))
+	require.NoError(t, err)
+	assert.Equal(t, "12.5", val)
+
+	_, err = String(client.Do(ctx, "GET", "key2"))
+	assert.Equal(t, ErrNil, err)
+	n, err := Int64(client.Do(ctx, "INCRBY", "cnt", int64(3)))
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), n)
+	data, err := Bytes(client.Do(ctx, "GET", "cnt"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("3"), data)
+}
+
+func TestClient_Pool(t *testing.T) {
+	s, client := startServer(t)
+	client.max = 2
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := client.Do(context.Background(), "INCR", "cnt")
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	n, err := Int64(client.Do(context.Background(), "GET", "cnt"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(20), n)
+	client.mu.Lock()
+	assert.LessOrEqual(t, len(client.idle), 2)
+	client.mu.Unlock()
+
+	// server 關閉之後，連接池裡面的連接都不能用了
+	require.NoError(t, s.Close())
+	_, err = client.Do(context.Background(), "GET", "cnt")
+	assert.Error(t, err)
+
+	require.NoError(t, client.Close())
+	_, err = client.Do(context.Background(), "GET", "cnt")
+	assert.Equal(t, errClientClosed, err)
+}
+
+func TestClient_Context(t *testing.T) {
+	// 只接受連接，不返回響應
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() {
+		_ = l.Close()
+	}()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer func() {
+				_ = conn.Close()
+			}()
+		}
+	}()
+	client := NewClient(l.Addr().String())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	_, err = client.Do(ctx, "GET", "key1")
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(time.Millisecond*10, cancel)
+	_, err = client.Do(ctx, "GET", "key1")
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestClient_Subscribe(t *testing.T) {
+	_, client := startServer(t)
+	ctx := context.Background()
+	ps, err := client.Subscribe(ctx, "ch1", "ch2")
+	require.NoError(t, err)
+
+	n, err := client.Publish(ctx, "ch1", "hello")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	_, err = client.Publish(ctx, "ch3", "ignored")
+	require.NoError(t, err)
+	_, err = client.Publish(ctx, "ch2", []byte("world"))
+	require.NoError(t, err)
+
+	assert.Equal(t, Message{Channel: "ch1", Payload: "hello"}, <-ps.Channel())
+	assert.Equal(t, Message{Channel: "ch2", Payload: "world"}, <-ps.Channel())
+
+	require.NoError(t, ps.Close())
+	_, ok := <-ps.Channel()
+	assert.False(t, ok)
+	assert.Error(t, ps.Close())
+
+	// 取消訂閱之後不會再收到
+	assert.Eventually(t, func() bool {
+		n, err = client.Publish(ctx, "ch1", "hello")
+		return err == nil && n == 0
+	}, time.Second, time.Millisecond*10)
+}
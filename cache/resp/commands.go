@@ -0,0 +1,435 @@
+package resp
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+type command struct {
+	// 參數數量的範圍，不包括命令本身；max 為 -1 表示不限制
+	min, max int
+	// 訂閱狀態下也可以執行
+	pubsub bool
+	handle func(s *Server, c *serverConn, args [][]byte) any
+}
+
+var (
+	replyOK        = SimpleString("OK")
+	errSyntax      = Error("ERR syntax error")
+	errNotInteger  = Error("ERR value is not an integer or out of range")
+	errInvalidTTL  = Error("ERR invalid expire time in 'set' command")
+	errInvalidDB   = Error("ERR DB index is out of range")
+	errInvalidAuth = Error("WRONGPASS invalid username-password pair or user is disabled.")
+	errWrongType   = Error("WRONGTYPE Operation against a key holding the wrong kind of value")
+)
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"PING":     {min: 0, max: 1, pubsub: true, handle: cmdPing},
+		"ECHO":     {min: 1, max: 1, handle: cmdEcho},
+		"QUIT":     {min: 0, max: 0, pubsub: true, handle: cmdQuit},
+		"AUTH":     {min: 1, max: 1, handle: cmdAuth},
+		"SELECT":   {min: 1, max: 1, handle: cmdSelect},
+		"GET":      {min: 1, max: 1, handle: cmdGet},
+		"SET":      {min: 2, max: -1, handle: cmdSet},
+		"GETDEL":   {min: 1, max: 1, handle: cmdGetDel},
+		"MGET":     {min: 1, max: -1, handle: cmdMGet},
+		"MSET":     {min: 2, max: -1, handle: cmdMSet},
+		"DEL":      {min: 1, max: -1, handle: cmdDel},
+		"EXISTS":   {min: 1, max: -1, handle: cmdExists},
+		"EXPIRE":   {min: 2, max: 2, handle: cmdExpire(time.Second)},
+		"PEXPIRE":  {min: 2, max: 2, handle: cmdExpire(time.Millisecond)},
+		"TTL":      {min: 1, max: 1, handle: cmdTTL(time.Second)},
+		"PTTL":     {min: 1, max: 1, handle: cmdTTL(time.Millisecond)},
+		"PERSIST":  {min: 1, max: 1, handle: cmdPersist},
+		"INCR":     {min: 1, max: 1, handle: cmdIncr(1, false)},
+		"DECR":     {min: 1, max: 1, handle: cmdIncr(-1, false)},
+		"INCRBY":   {min: 2, max: 2, handle: cmdIncr(1, true)},
+		"DECRBY":   {min: 2, max: 2, handle: cmdIncr(-1, true)},
+		"DBSIZE":   {min: 0, max: 0, handle: cmdDBSize},
+		"FLUSHDB":  {min: 0, max: 1, handle: cmdFlushDB},
+		"FLUSHALL": {min: 0, max: 1, handle: cmdFlushAll},
+		"CONFIG":   {min: 2, max: -1, handle: cmdConfig},
+
+		"SADD":     {min: 2, max: -1, handle: cmdSAdd},
+		"SREM":     {min: 2, max: -1, handle: cmdSRem},
+		"SMEMBERS": {min: 1, max: 1, handle: cmdSMembers},
+		"SCARD":    {min: 1, max: 1, handle: cmdSCard},
+
+		"EVAL":    {min: 2, max: -1, handle: cmdEval},
+		"EVALSHA": {min: 2, max: -1, handle: cmdEvalSHA},
+		"SCRIPT":  {min: 1, max: -1, handle: cmdScript},
+
+		"PUBLISH":      {min: 2, max: 2, handle: cmdPublish},
+		"SUBSCRIBE":    {min: 1, max: -1, pubsub: true, handle: cmdSubscribe(false)},
+		"PSUBSCRIBE":   {min: 1, max: -1, pubsub: true, handle: cmdSubscribe(true)},
+		"UNSUBSCRIBE":  {min: 0, max: -1, pubsub: true, handle: cmdUnsubscribe(false)},
+		"PUNSUBSCRIBE": {min: 0, max: -1, pubsub: true, handle: cmdUnsubscribe(true)},
+	}
+}
+
+func cmdPing(s *Server, c *serverConn, args [][]byte) any {
+	if len(args) > 0 {
+		return args[0]
+	}
+	return SimpleString("PONG")
+}
+
+func cmdEcho(s *Server, c *serverConn, args [][]byte) any {
+	return args[0]
+}
+
+func cmdQuit(s *Server, c *serverConn, args [][]byte) any {
+	return replyOK
+}
+
+func cmdAuth(s *Server, c *serverConn, args [][]byte) any {
+	if s.password == "" {
+		return Error("ERR AUTH <password> called without any password configured for the default user.")
+	}
+	if string(args[0]) != s.password {
+		return errInvalidAuth
+	}
+	c.authed = true
+	return replyOK
+}
+
+func cmdSelect(s *Server, c *serverConn, args [][]byte) any {
+	idx, err := strconv.Atoi(string(args[0]))
+	if err != nil {
+		return errNotInteger
+	}
+	if idx < 0 || idx > 15 {
+		return errInvalidDB
+	}
+	c.db = idx
+	return replyOK
+}
+
+func cmdGet(s *Server, c *serverConn, args [][]byte) any {
+	e, exist := s.lookup(c, string(args[0]))
+	if !exist {
+		return nil
+	}
+	if e.set != nil {
+		return errWrongType
+	}
+	return e.val
+}
+
+// cmdSet SET key value [NX | XX] [GET] [EX seconds | PX milliseconds | KEEPTTL]
+func cmdSet(s *Server, c *serverConn, args [][]byte) any {
+	key := string(args[0])
+	var (
+		nx, xx, get, keepTTL bool
+		deadline             time.Time
+	)
+	for i := 2; i < len(args); i++ {
+		switch opt := strings.ToUpper(string(args[i])); opt {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "GET":
+			get = true
+		case "KEEPTTL":
+			keepTTL = true
+		case "EX", "PX":
+			if i+1 >= len(args) || !deadline.IsZero() {
+				return errSyntax
+			}
+			i++
+			n, err := strconv.ParseInt(string(args[i]), 10, 64)
+			if err != nil {
+				return errNotInteger
+			}
+			if n <= 0 {
+				return errInvalidTTL
+			}
+			unit := time.Second
+			if opt == "PX" {
+				unit = time.Millisecond
+			}
+			deadline = time.Now().Add(time.Duration(n) * unit)
+		default:
+			return errSyntax
+		}
+	}
+	if nx && xx || keepTTL && !deadline.IsZero() {
+		return errSyntax
+	}
+
+	old, exist := s.lookup(c, key)
+	if get && exist && old.set != nil {
+		return errWrongType
+	}
+	var reply any = replyOK
+	if get {
+		reply = nil
+		if exist {
+			reply = old.val
+		}
+	}
+	if nx && exist || xx && !exist {
+		if get {
+			return reply
+		}
+		return nil
+	}
+	if keepTTL && exist {
+		deadline = old.deadline
+	}
+	s.store(c, key, &entry{val: args[1], deadline: deadline})
+	s.notifyEvent('$', c.db, key, "set")
+	return reply
+}
+
+// cmdMGet 不存在的 key 和不是字符串的 key 返回 nil
+func cmdMGet(s *Server, c *serverConn, args [][]byte) any {
+	res := make([]any, len(args))
+	for i, arg := range args {
+		if e, exist := s.lookup(c, string(arg)); exist && e.set == nil {
+			res[i] = e.val
+		}
+	}
+	return res
+}
+
+// cmdMSet MSET key value [key value ...]，會清除原本的過期時間
+func cmdMSet(s *Server, c *serverConn, args [][]byte) any {
+	if len(args)%2 != 0 {
+		return Error("ERR wrong number of arguments for 'mset' command")
+	}
+	for i := 0; i < len(args); i += 2 {
+		key := string(args[i])
+		s.store(c, key, &entry{val: args[i+1]})
+		s.notifyEvent('$', c.db, key, "set")
+	}
+	return replyOK
+}
+
+func cmdGetDel(s *Server, c *serverConn, args [][]byte) any {
+	key := string(args[0])
+	e, exist := s.lookup(c, key)
+	if !exist {
+		return nil
+	}
+	if e.set != nil {
+		return errWrongType
+	}
+	delete(s.db(c), key)
+	s.notifyEvent('g', c.db, key, "del")
+	return e.val
+}
+
+func cmdDel(s *Server, c *serverConn, args [][]byte) any {
+	cnt := 0
+	for _, arg := range args {
+		key := string(arg)
+		if _, exist := s.lookup(c, key); exist {
+			delete(s.db(c), key)
+			s.notifyEvent('g', c.db, key, "del")
+			cnt++
+		}
+	}
+	return cnt
+}
+
+func cmdExists(s *Server, c *serverConn, args [][]byte) any {
+	cnt := 0
+	for _, arg := range args {
+		if _, exist := s.lookup(c, string(arg)); exist {
+			cnt++
+		}
+	}
+	return cnt
+}
+
+func cmdExpire(unit time.Duration) func(s *Server, c *serverConn, args [][]byte) any {
+	return func(s *Server, c *serverConn, args [][]byte) any {
+		key := string(args[0])
+		n, err := strconv.ParseInt(string(args[1]), 10, 64)
+		if err != nil {
+			return errNotInteger
+		}
+		e, exist := s.lookup(c, key)
+		if !exist {
+			return 0
+		}
+		// 和 Redis 一樣，非正數的過期時間直接刪除
+		if n <= 0 {
+			delete(s.db(c), key)
+			s.notifyEvent('g', c.db, key, "del")
+			return 1
+		}
+		e.deadline = time.Now().Add(time.Duration(n) * unit)
+		s.notifyEvent('g', c.db, key, "expire")
+		return 1
+	}
+}
+
+// cmdTTL key 不存在返回 -2，沒有過期時間返回 -1
+func cmdTTL(unit time.Duration) func(s *Server, c *serverConn, args [][]byte) any {
+	return func(s *Server, c *serverConn, args [][]byte) any {
+		e, exist := s.lookup(c, string(args[0]))
+		if !exist {
+			return -2
+		}
+		if e.deadline.IsZero() {
+			return -1
+		}
+		// 和 Redis 一樣向上取整
+		ttl := time.Until(e.deadline)
+		return int64((ttl + unit - 1) / unit)
+	}
+}
+
+func cmdPersist(s *Server, c *serverConn, args [][]byte) any {
+	key := string(args[0])
+	e, exist := s.lookup(c, key)
+	if !exist || e.deadline.IsZero() {
+		return 0
+	}
+	e.deadline = time.Time{}
+	s.notifyEvent('g', c.db, key, "persist")
+	return 1
+}
+
+// cmdIncr sign 為 1 或者 -1，withDelta 表示是否帶增量參數
+func cmdIncr(sign int64, withDelta bool) func(s *Server, c *serverConn, args [][]byte) any {
+	return func(s *Server, c *serverConn, args [][]byte) any {
+		key := string(args[0])
+		delta := int64(1)
+		if withDelta {
+			var err error
+			if delta, err = strconv.ParseInt(string(args[1]), 10, 64); err != nil {
+				return errNotInteger
+			}
+		}
+		var (
+			val      int64
+			deadline time.Time
+		)
+		if e, exist := s.lookup(c, key); exist {
+			if e.set != nil {
+				return errWrongType
+			}
+			var err error
+			if val, err = strconv.ParseInt(string(e.val), 10, 64); err != nil {
+				return errNotInteger
+			}
+			deadline = e.deadline
+		}
+		val += sign * delta
+		s.store(c, key, &entry{val: strconv.AppendInt(nil, val, 10), deadline: deadline})
+		s.notifyEvent('$', c.db, key, "incrby")
+		return val
+	}
+}
+
+func cmdDBSize(s *Server, c *serverConn, args [][]byte) any {
+	now := time.Now()
+	cnt := 0
+	for _, e := range s.db(c) {
+		if !e.expired(now) {
+			cnt++
+		}
+	}
+	return cnt
+}
+
+func cmdFlushDB(s *Server, c *serverConn, args [][]byte) any {
+	delete(s.dbs, c.db)
+	return replyOK
+}
+
+func cmdFlushAll(s *Server, c *serverConn, args [][]byte) any {
+	s.dbs = map[int]map[string]*entry{}
+	return replyOK
+}
+
+// cmdConfig 只支持 notify-keyspace-events，其他配置 SET 會被忽略
+func cmdConfig(s *Server, c *serverConn, args [][]byte) any {
+	switch strings.ToUpper(string(args[0])) {
+	case "GET":
+		param := strings.ToLower(string(args[1]))
+		if globMatch(param, "notify-keyspace-events") {
+			return []any{[]byte("notify-keyspace-events"), []byte(s.notify)}
+		}
+		return []any{}
+	case "SET":
+		if len(args) != 3 {
+			return Error("ERR wrong number of arguments for 'config|set' command")
+		}
+		if strings.ToLower(string(args[1])) == "notify-keyspace-events" {
+			s.notify = string(args[2])
+		}
+		return replyOK
+	default:
+		return Error("ERR unknown subcommand '" + string(args[0]) + "'")
+	}
+}
+
+func cmdPublish(s *Server, c *serverConn, args [][]byte) any {
+	return s.publish(string(args[0]), args[1])
+}
+
+func cmdSubscribe(pattern bool) func(s *Server, c *serverConn, args [][]byte) any {
+	kind, subs := "subscribe", func(s *Server) map[string]map[*serverConn]struct{} { return s.channels }
+	if pattern {
+		kind, subs = "psubscribe", func(s *Server) map[string]map[*serverConn]struct{} { return s.patterns }
+	}
+	return func(s *Server, c *serverConn, args [][]byte) any {
+		if c.channels == nil {
+			c.channels, c.patterns = map[string]struct{}{}, map[string]struct{}{}
+		}
+		mine := c.channels
+		if pattern {
+			mine = c.patterns
+		}
+		for _, arg := range args {
+			ch := string(arg)
+			conns, exist := subs(s)[ch]
+			if !exist {
+				conns = map[*serverConn]struct{}{}
+				subs(s)[ch] = conns
+			}
+			conns[c] = struct{}{}
+			mine[ch] = struct{}{}
+			_ = c.write([]any{[]byte(kind), arg, len(c.channels) + len(c.patterns)})
+		}
+		return noReply{}
+	}
+}
+
+func cmdUnsubscribe(pattern bool) func(s *Server, c *serverConn, args [][]byte) any {
+	kind, subs := "unsubscribe", func(s *Server) map[string]map[*serverConn]struct{} { return s.channels }
+	if pattern {
+		kind, subs = "punsubscribe", func(s *Server) map[string]map[*serverConn]struct{} { return s.patterns }
+	}
+	return func(s *Server, c *serverConn, args [][]byte) any {
+		mine := c.channels
+		if pattern {
+			mine = c.patterns
+		}
+		// 沒有參數表示取消所有的訂閱
+		if len(args) == 0 {
+			for ch := range mine {
+				args = append(args, []byte(ch))
+			}
+		}
+		if len(args) == 0 {
+			return []any{[]byte(kind), nil, 0}
+		}
+		for _, arg := range args {
+			ch := string(arg)
+			delete(subs(s)[ch], c)
+			delete(mine, ch)
+			_ = c.write([]any{[]byte(kind), arg, len(c.channels) + len(c.patterns)})
+		}
+		return noReply{}
+	}
+}
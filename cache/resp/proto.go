@@ -0,0 +1,251 @@
+// Package resp 實現了 Redis 的 RESP2 協議
+// 包括一個簡單的客戶端，和一個在進程內運行的服務端，服務端用於測試，不需要真的啟動 Redis
+package resp
+
+import (
+	"bufio"
+	"encoding"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+var (
+	errInvalidReply = errors.New("resp: 不合法的響應")
+)
+
+// Error Redis 返回的錯誤，e.g. ERR unknown command
+type Error string
+
+func (e Error) Error() string {
+	return string(e)
+}
+
+// SimpleString 簡單字符串，e.g. OK、PONG
+// 服務端返回 string 的時候也會寫成簡單字符串
+type SimpleString string
+
+// writeCommand 把命令寫成 bulk string 組成的數組
+func writeCommand(w *bufio.Writer, args []any) error {
+	_, _ = w.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		data, err := argBytes(arg)
+		if err != nil {
+			return err
+		}
+		writeBulk(w, data)
+	}
+	return nil
+}
+
+// argBytes 參考 go-redis 的 appendArg，其他類型需要實現 encoding.BinaryMarshaler
+func argBytes(arg any) ([]byte, error) {
+	switch v := arg.(type) {
+	case nil:
+		return []byte{}, nil
+	case string:
+		return []byte(v), nil
+	case []byte:
+		return v, nil
+	case int:
+		return strconv.AppendInt(nil, int64(v), 10), nil
+	case int32:
+		return strconv.AppendInt(nil, int64(v), 10), nil
+	case int64:
+		return strconv.AppendInt(nil, v, 10), nil
+	case uint:
+		return strconv.AppendUint(nil, uint64(v), 10), nil
+	case uint32:
+		return strconv.AppendUint(nil, uint64(v), 10), nil
+	case uint64:
+		return strconv.AppendUint(nil, v, 10), nil
+	case float32:
+		return strconv.AppendFloat(nil, float64(v), 'f', -1, 32), nil
+	case float64:
+		return strconv.AppendFloat(nil, v, 'f', -1, 64), nil
+	case bool:
+		if v {
+			return []byte("1"), nil
+		}
+		return []byte("0"), nil
+	case time.Duration:
+		return strconv.AppendInt(nil, v.Milliseconds(), 10), nil
+	case encoding.BinaryMarshaler:
+		return v.MarshalBinary()
+	default:
+		return nil, fmt.Errorf("resp: 不支持的參數類型 %T，需要實現 encoding.BinaryMarshaler", arg)
+	}
+}
+
+func writeBulk(w *bufio.Writer, data []byte) {
+	_, _ = w.WriteString("$" + strconv.Itoa(len(data)) + "\r\n")
+	_, _ = w.Write(data)
+	_, _ = w.WriteString("\r\n")
+}
+
+// writeValue 服務端寫響應
+//
+//	SimpleString, string -> +OK
+//	Error, error         -> -ERR xxx
+//	int, int64, bool     -> :1
+//	[]byte               -> $3\r\nabc
+//	nil                  -> $-1
+//	[]any                -> *2 ...
+func writeValue(w *bufio.Writer, val any) {
+	switch v := val.(type) {
+	case nil:
+		_, _ = w.WriteString("$-1\r\n")
+	case SimpleString:
+		_, _ = w.WriteString("+" + string(v) + "\r\n")
+	case string:
+		_, _ = w.WriteString("+" + v + "\r\n")
+	case error:
+		_, _ = w.WriteString("-" + v.Error() + "\r\n")
+	case int:
+		_, _ = w.WriteString(":" + strconv.Itoa(v) + "\r\n")
+	case int64:
+		_, _ = w.WriteString(":" + strconv.FormatInt(v, 10) + "\r\n")
+	case bool:
+		if v {
+			_, _ = w.WriteString(":1\r\n")
+		} else {
+			_, _ = w.WriteString(":0\r\n")
+		}
+	case []byte:
+		writeBulk(w, v)
+	case []any:
+		if v == nil {
+			_, _ = w.WriteString("*-1\r\n")
+			return
+		}
+		_, _ = w.WriteString("*" + strconv.Itoa(len(v)) + "\r\n")
+		for _, elem := range v {
+			writeValue(w, elem)
+		}
+	default:
+		_, _ = w.WriteString("-ERR unsupported reply type " + fmt.Sprintf("%T", val) + "\r\n")
+	}
+}
+
+// readValue 讀取一個響應
+//
+//	+OK     -> SimpleString
+//	-ERR    -> Error，作為值返回，而不是 error
+//	:1      -> int64
+//	$3 abc  -> []byte，$-1 為 nil
+//	*2 ...  -> []any，*-1 為 nil
+func readValue(r *bufio.Reader) (any, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, errInvalidReply
+	}
+	switch line[0] {
+	case '+':
+		return SimpleString(line[1:]), nil
+	case '-':
+		return Error(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(string(line[1:]), 10, 64)
+	case '$':
+		n, err := strconv.Atoi(string(line[1:]))
+		if err != nil {
+			return nil, errInvalidReply
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		data := make([]byte, n+2)
+		if _, err = io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return data[:n], nil
+	case '*':
+		n, err := strconv.Atoi(string(line[1:]))
+		if err != nil {
+			return nil, errInvalidReply
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		res := make([]any, n)
+		for i := range res {
+			if res[i], err = readValue(r); err != nil {
+				return nil, err
+			}
+		}
+		return res, nil
+	default:
+		return nil, errInvalidReply
+	}
+}
+
+func readLine(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadSlice('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, errInvalidReply
+	}
+	return line[:len(line)-2], nil
+}
+
+// String 把 Do 的結果轉成字符串，nil 返回 ErrNil
+//
+//	val, err := resp.String(client.Do(ctx, "GET", "key"))
+func String(val any, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+	switch v := val.(type) {
+	case nil:
+		return "", ErrNil
+	case []byte:
+		return string(v), nil
+	case SimpleString:
+		return string(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	default:
+		return "", fmt.Errorf("resp: 無法把 %T 轉成字符串", val)
+	}
+}
+
+// Bytes 把 Do 的結果轉成 []byte，nil 返回 ErrNil
+func Bytes(val any, err error) ([]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+	switch v := val.(type) {
+	case nil:
+		return nil, ErrNil
+	case []byte:
+		return v, nil
+	case SimpleString:
+		return []byte(v), nil
+	default:
+		return nil, fmt.Errorf("resp: 無法把 %T 轉成 []byte", val)
+	}
+}
+
+// Int64 把 Do 的結果轉成整數，nil 返回 ErrNil
+func Int64(val any, err error) (int64, error) {
+	if err != nil {
+		return 0, err
+	}
+	switch v := val.(type) {
+	case nil:
+		return 0, ErrNil
+	case int64:
+		return v, nil
+	case []byte:
+		return strconv.ParseInt(string(v), 10, 64)
+	default:
+		return 0, fmt.Errorf("resp: 無法把 %T 轉成整數", val)
+	}
+}
@@ -0,0 +1,146 @@
+package resp
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Message 訂閱收到的消息，Pattern 只有 PSUBSCRIBE 的時候才有
+type Message struct {
+	Pattern string
+	Channel string
+	Payload string
+}
+
+// PubSub 訂閱使用獨立的連接，不會放回連接池
+type PubSub struct {
+	cn        *conn
+	ch        chan Message
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// Subscribe 訂閱 channel，返回的時候已經訂閱成功
+func (c *Client) Subscribe(ctx context.Context, channels ...string) (*PubSub, error) {
+	return c.subscribe(ctx, "SUBSCRIBE", channels)
+}
+
+// PSubscribe 按照模式訂閱，e.g. __keyevent@0__:*
+func (c *Client) PSubscribe(ctx context.Context, patterns ...string) (*PubSub, error) {
+	return c.subscribe(ctx, "PSUBSCRIBE", patterns)
+}
+
+// Publish 返回收到消息的訂閱者數量
+func (c *Client) Publish(ctx context.Context, channel string, msg any) (int64, error) {
+	return Int64(c.Do(ctx, "PUBLISH", channel, msg))
+}
+
+func (c *Client) subscribe(ctx context.Context, cmd string, channels []string) (*PubSub, error) {
+	c.mu.Lock()
+	closed := c.closed
+	c.mu.Unlock()
+	if closed {
+		return nil, errClientClosed
+	}
+	cn, err := c.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	args := make([]any, 0, len(channels)+1)
+	args = append(args, cmd)
+	for _, ch := range channels {
+		args = append(args, ch)
+	}
+	if dl, ok := ctx.Deadline(); ok {
+		_ = cn.SetDeadline(dl)
+	}
+	if err = c.confirm(cn, args); err != nil {
+		_ = cn.Close()
+		return nil, err
+	}
+	// 之後一直阻塞在讀上面，不能有超時
+	_ = cn.SetDeadline(time.Time{})
+
+	res := &PubSub{
+		cn:   cn,
+		ch:   make(chan Message, 100),
+		done: make(chan struct{}),
+	}
+	go res.loop()
+	return res, nil
+}
+
+// confirm 發送訂閱命令，並且等待每一個 channel 的確認
+func (c *Client) confirm(cn *conn, args []any) error {
+	if err := writeCommand(cn.w, args); err != nil {
+		return err
+	}
+	if err := cn.w.Flush(); err != nil {
+		return err
+	}
+	for i := 1; i < len(args); i++ {
+		val, err := readValue(cn.r)
+		if err != nil {
+			return err
+		}
+		if e, ok := val.(Error); ok {
+			return e
+		}
+		arr, ok := val.([]any)
+		if !ok || len(arr) != 3 {
+			return fmt.Errorf("resp: 訂閱的響應不合法 %v", val)
+		}
+	}
+	return nil
+}
+
+// Channel 收到的消息，連接斷開或者 Close 之後會被關閉
+// 消費太慢的時候會阻塞讀取，Redis 那邊可能因此斷開連接
+func (p *PubSub) Channel() <-chan Message {
+	return p.ch
+}
+
+func (p *PubSub) Close() error {
+	err := errClientClosed
+	p.closeOnce.Do(func() {
+		close(p.done)
+		err = p.cn.Close()
+	})
+	return err
+}
+
+func (p *PubSub) loop() {
+	defer close(p.ch)
+	for {
+		val, err := readValue(p.cn.r)
+		if err != nil {
+			_ = p.Close()
+			return
+		}
+		arr, ok := val.([]any)
+		if !ok || len(arr) == 0 {
+			continue
+		}
+		var msg Message
+		kind, _ := String(arr[0], nil)
+		switch {
+		case kind == "message" && len(arr) == 3:
+			msg.Channel, _ = String(arr[1], nil)
+			msg.Payload, _ = String(arr[2], nil)
+		case kind == "pmessage" && len(arr) == 4:
+			msg.Pattern, _ = String(arr[1], nil)
+			msg.Channel, _ = String(arr[2], nil)
+			msg.Payload, _ = String(arr[3], nil)
+		default:
+			// subscribe、pong 之類的響應
+			continue
+		}
+		select {
+		case p.ch <- msg:
+		case <-p.done:
+			return
+		}
+	}
+}
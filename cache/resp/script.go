@@ -0,0 +1,172 @@
+package resp
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Script 用 Go 實現的腳本，代替 Lua 腳本在 Server 上原子地執行
+// 返回值的類型參考 writeValue
+type Script func(call *ScriptCall, keys []string, args [][]byte) any
+
+// ScriptCall 相當於 Lua 裡面的 redis.call，在腳本裡面執行命令
+type ScriptCall struct {
+	s *Server
+	c *serverConn
+}
+
+// Call 執行命令，返回值和 Client.Do 一致：
+// SimpleString、[]byte、int64、[]any、nil，錯誤返回 Error
+func (sc *ScriptCall) Call(args ...any) any {
+	if len(args) == 0 {
+		return Error("ERR Please specify at least one argument for this redis lib call")
+	}
+	bs := make([][]byte, len(args))
+	for i, arg := range args {
+		data, err := argBytes(arg)
+		if err != nil {
+			return Error("ERR " + err.Error())
+		}
+		bs[i] = data
+	}
+	name := strings.ToUpper(string(bs[0]))
+	cmd, ok := commands[name]
+	if !ok || cmd.pubsub || name == "EVAL" || name == "EVALSHA" {
+		return Error("ERR This Redis command is not allowed from script")
+	}
+	if len(bs)-1 < cmd.min || cmd.max >= 0 && len(bs)-1 > cmd.max {
+		return Error("ERR wrong number of arguments for '" + strings.ToLower(name) + "' command")
+	}
+	return normalize(cmd.handle(sc.s, sc.c, bs[1:]))
+}
+
+// normalize 把 handler 的返回值轉成客戶端看到的類型
+func normalize(val any) any {
+	switch v := val.(type) {
+	case int:
+		return int64(v)
+	case bool:
+		if v {
+			return int64(1)
+		}
+		return int64(0)
+	case string:
+		return SimpleString(v)
+	case []any:
+		for i := range v {
+			v[i] = normalize(v[i])
+		}
+		return v
+	default:
+		return val
+	}
+}
+
+// RegisterScript 註冊 Lua 腳本對應的 Go 實現
+// 客戶端 EVAL 或者 EVALSHA 這個 Lua 腳本的時候，執行的是 fn
+func (s *Server) RegisterScript(src string, fn Script) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scripts[scriptSHA(src)] = fn
+}
+
+func scriptSHA(src string) string {
+	sum := sha1.Sum([]byte(src))
+	return hex.EncodeToString(sum[:])
+}
+
+func cmdEval(s *Server, c *serverConn, args [][]byte) any {
+	sha := scriptSHA(string(args[0]))
+	if _, ok := s.scripts[sha]; !ok {
+		return Error("ERR resp: 不支持的腳本，需要先透過 RegisterScript 註冊")
+	}
+	s.loaded[sha] = struct{}{}
+	return runScript(s, c, sha, args[1:])
+}
+
+func cmdEvalSHA(s *Server, c *serverConn, args [][]byte) any {
+	sha := strings.ToLower(string(args[0]))
+	if _, ok := s.loaded[sha]; !ok {
+		return Error("NOSCRIPT No matching script. Please use EVAL.")
+	}
+	return runScript(s, c, sha, args[1:])
+}
+
+// runScript args 為 numkeys key [key ...] arg [arg ...]
+func runScript(s *Server, c *serverConn, sha string, args [][]byte) any {
+	n, err := strconv.Atoi(string(args[0]))
+	if err != nil {
+		return errNotInteger
+	}
+	if n < 0 || n > len(args)-1 {
+		return Error("ERR Number of keys can't be greater than number of args")
+	}
+	keys := make([]string, n)
+	for i := range keys {
+		keys[i] = string(args[i+1])
+	}
+	return normalize(s.scripts[sha](&ScriptCall{s: s, c: c}, keys, args[n+1:]))
+}
+
+// cmdScript SCRIPT LOAD | EXISTS | FLUSH
+func cmdScript(s *Server, c *serverConn, args [][]byte) any {
+	switch strings.ToUpper(string(args[0])) {
+	case "LOAD":
+		if len(args) != 2 {
+			return Error("ERR wrong number of arguments for 'script|load' command")
+		}
+		sha := scriptSHA(string(args[1]))
+		if _, ok := s.scripts[sha]; !ok {
+			return Error("ERR resp: 不支持的腳本，需要先透過 RegisterScript 註冊")
+		}
+		s.loaded[sha] = struct{}{}
+		return []byte(sha)
+	case "EXISTS":
+		res := make([]any, 0, len(args)-1)
+		for _, arg := range args[1:] {
+			_, ok := s.loaded[strings.ToLower(string(arg))]
+			res = append(res, ok)
+		}
+		return res
+	case "FLUSH":
+		s.loaded = map[string]struct{}{}
+		return replyOK
+	default:
+		return Error("ERR unknown subcommand '" + string(args[0]) + "'")
+	}
+}
+
+// LuaScript 客戶端使用的 Lua 腳本，先 EVALSHA，Redis 還沒有緩存腳本的時候再 EVAL
+type LuaScript struct {
+	src string
+	sha string
+}
+
+func NewLuaScript(src string) *LuaScript {
+	return &LuaScript{src: src, sha: scriptSHA(src)}
+}
+
+// Src 腳本的源碼，用於 Server.RegisterScript
+func (l *LuaScript) Src() string {
+	return l.src
+}
+
+func (l *LuaScript) Run(ctx context.Context, client *Client, keys []string, args ...any) (any, error) {
+	cmd := make([]any, 0, 3+len(keys)+len(args))
+	cmd = append(cmd, "EVALSHA", l.sha, len(keys))
+	for _, key := range keys {
+		cmd = append(cmd, key)
+	}
+	cmd = append(cmd, args...)
+	val, err := client.Do(ctx, cmd...)
+	var redisErr Error
+	if errors.As(err, &redisErr) && strings.HasPrefix(string(redisErr), "NOSCRIPT") {
+		cmd[0], cmd[1] = "EVAL", l.src
+		return client.Do(ctx, cmd...)
+	}
+	return val, err
+}
@@ -0,0 +1,420 @@
+package resp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	errServerClosed = errors.New("resp: server 已經關閉")
+)
+
+// Server 在進程內運行的 Redis 替身，實現了緩存需要的一部分命令，只用於測試
+// 數據都在內存裡面，沒有持久化
+//
+//	s := resp.NewServer()
+//	l, _ := net.Listen("tcp", "127.0.0.1:0")
+//	go s.Serve(l)
+//	client := resp.NewClient(l.Addr().String())
+type Server struct {
+	mu       sync.Mutex
+	dbs      map[int]map[string]*entry
+	password string
+	// 每個 db 最多的 key 數量，超過的時候隨機淘汰，0 表示不限制
+	maxKeys int
+	// notify-keyspace-events
+	notify string
+
+	channels map[string]map[*serverConn]struct{}
+	patterns map[string]map[*serverConn]struct{}
+
+	// 透過 RegisterScript 註冊的腳本，key 為 Lua 腳本的 SHA1
+	scripts map[string]Script
+	// 已經 EVAL 或者 SCRIPT LOAD 過的腳本，可以 EVALSHA
+	loaded map[string]struct{}
+
+	expireInterval time.Duration
+	listeners      map[net.Listener]struct{}
+	conns          map[*serverConn]struct{}
+	closed         bool
+	close          chan struct{}
+}
+
+type entry struct {
+	val []byte
+	// 不為 nil 表示 key 是集合，見 SADD
+	set      map[string]struct{}
+	deadline time.Time
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return !e.deadline.IsZero() && !now.Before(e.deadline)
+}
+
+type serverConn struct {
+	net.Conn
+	r   *bufio.Reader
+	w   *bufio.Writer
+	wmu sync.Mutex
+
+	db       int
+	authed   bool
+	channels map[string]struct{}
+	patterns map[string]struct{}
+}
+
+type ServerOption func(s *Server)
+
+func NewServer(opts ...ServerOption) *Server {
+	res := &Server{
+		dbs:            map[int]map[string]*entry{},
+		channels:       map[string]map[*serverConn]struct{}{},
+		patterns:       map[string]map[*serverConn]struct{}{},
+		scripts:        map[string]Script{},
+		loaded:         map[string]struct{}{},
+		expireInterval: time.Millisecond * 100,
+		listeners:      map[net.Listener]struct{}{},
+		conns:          map[*serverConn]struct{}{},
+		close:          make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(res)
+	}
+	go res.expireLoop()
+	return res
+}
+
+// ServerWithPassword 客戶端需要先 AUTH
+func ServerWithPassword(password string) ServerOption {
+	return func(s *Server) {
+		s.password = password
+	}
+}
+
+// ServerWithMaxKeys 每個 db 最多的 key 數量，超過的時候隨機淘汰 (allkeys-random)
+func ServerWithMaxKeys(n int) ServerOption {
+	return func(s *Server) {
+		s.maxKeys = n
+	}
+}
+
+// ServerWithNotifyKeyspaceEvents 和 Redis 的 notify-keyspace-events 配置一樣，e.g. "Exe"
+// 也可以透過 CONFIG SET 修改
+func ServerWithNotifyKeyspaceEvents(flags string) ServerOption {
+	return func(s *Server) {
+		s.notify = flags
+	}
+}
+
+// ServerWithExpireInterval 主動刪除過期 key 的間隔，預設 100ms
+func ServerWithExpireInterval(interval time.Duration) ServerOption {
+	return func(s *Server) {
+		s.expireInterval = interval
+	}
+}
+
+// ListenAndServe 阻塞直到 Close
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve 阻塞直到 Close，Close 之後返回 nil
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		_ = l.Close()
+		return errServerClosed
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+
+	for {
+		nc, err := l.Accept()
+		if err != nil {
+			select {
+			case <-s.close:
+				return nil
+			default:
+				return err
+			}
+		}
+		c := &serverConn{Conn: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			_ = nc.Close()
+			return nil
+		}
+		s.conns[c] = struct{}{}
+		s.mu.Unlock()
+		go s.serveConn(c)
+	}
+}
+
+// Close 關閉所有的監聽和連接
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errServerClosed
+	}
+	s.closed = true
+	close(s.close)
+	for l := range s.listeners {
+		_ = l.Close()
+	}
+	for c := range s.conns {
+		_ = c.Close()
+	}
+	return nil
+}
+
+func (s *Server) serveConn(c *serverConn) {
+	defer func() {
+		s.mu.Lock()
+		s.unsubscribeAll(c)
+		delete(s.conns, c)
+		s.mu.Unlock()
+		_ = c.Close()
+	}()
+	for {
+		args, err := readCommand(c.r)
+		if err != nil {
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		name := strings.ToUpper(string(args[0]))
+		reply := s.exec(c, name, args[1:])
+		if _, ok := reply.(noReply); ok {
+			continue
+		}
+		if err = c.write(reply); err != nil {
+			return
+		}
+		if name == "QUIT" {
+			return
+		}
+	}
+}
+
+// noReply 訂閱相關的命令自己寫響應
+type noReply struct{}
+
+func (s *Server) exec(c *serverConn, name string, args [][]byte) any {
+	cmd, ok := commands[name]
+	if !ok {
+		return Error("ERR unknown command '" + strings.ToLower(name) + "'")
+	}
+	if len(args) < cmd.min || cmd.max >= 0 && len(args) > cmd.max {
+		return Error("ERR wrong number of arguments for '" + strings.ToLower(name) + "' command")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.password != "" && !c.authed && name != "AUTH" && name != "QUIT" {
+		return Error("NOAUTH Authentication required.")
+	}
+	if len(c.channels)+len(c.patterns) > 0 && !cmd.pubsub {
+		return Error("ERR Can't execute '" + strings.ToLower(name) +
+			"': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT are allowed in this context")
+	}
+	return cmd.handle(s, c, args)
+}
+
+func (c *serverConn) write(reply any) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	// 避免訂閱者不讀數據，導致 PUBLISH 一直阻塞
+	_ = c.SetWriteDeadline(time.Now().Add(time.Second))
+	writeValue(c.w, reply)
+	return c.w.Flush()
+}
+
+// db 當前連接選中的 db
+func (s *Server) db(c *serverConn) map[string]*entry {
+	res, ok := s.dbs[c.db]
+	if !ok {
+		res = map[string]*entry{}
+		s.dbs[c.db] = res
+	}
+	return res
+}
+
+// lookup 懶惰刪除過期的 key
+func (s *Server) lookup(c *serverConn, key string) (*entry, bool) {
+	db := s.db(c)
+	e, ok := db[key]
+	if !ok {
+		return nil, false
+	}
+	if e.expired(time.Now()) {
+		delete(db, key)
+		s.notifyEvent('x', c.db, key, "expired")
+		return nil, false
+	}
+	return e, true
+}
+
+// store 寫入新的 key 的時候，超過 maxKeys 就隨機淘汰一個
+func (s *Server) store(c *serverConn, key string, e *entry) {
+	db := s.db(c)
+	if _, ok := db[key]; !ok && s.maxKeys > 0 && len(db) >= s.maxKeys {
+		for k := range db {
+			delete(db, k)
+			s.notifyEvent('e', c.db, k, "evicted")
+			break
+		}
+	}
+	db[key] = e
+}
+
+func (s *Server) expireLoop() {
+	ticker := time.NewTicker(s.expireInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			s.mu.Lock()
+			for idx, db := range s.dbs {
+				for key, e := range db {
+					if e.expired(now) {
+						delete(db, key)
+						s.notifyEvent('x', idx, key, "expired")
+					}
+				}
+			}
+			s.mu.Unlock()
+		case <-s.close:
+			return
+		}
+	}
+}
+
+// notifyEvent 按照 notify-keyspace-events 發布 keyspace 和 keyevent 通知
+// class: g 通用命令，$ 字符串命令，s 集合命令，x 過期，e 淘汰
+func (s *Server) notifyEvent(class byte, db int, key string, event string) {
+	flags := s.notify
+	if !strings.ContainsRune(flags, rune(class)) &&
+		!(strings.ContainsRune(flags, 'A') && strings.IndexByte("g$sxe", class) >= 0) {
+		return
+	}
+	dbStr := strconv.Itoa(db)
+	if strings.ContainsRune(flags, 'K') {
+		s.publish("__keyspace@"+dbStr+"__:"+key, []byte(event))
+	}
+	if strings.ContainsRune(flags, 'E') {
+		s.publish("__keyevent@"+dbStr+"__:"+event, []byte(key))
+	}
+}
+
+// publish 返回收到消息的訂閱者數量
+func (s *Server) publish(channel string, msg []byte) int {
+	cnt := 0
+	for c := range s.channels[channel] {
+		if c.write([]any{[]byte("message"), []byte(channel), msg}) == nil {
+			cnt++
+		}
+	}
+	for pattern, conns := range s.patterns {
+		if !globMatch(pattern, channel) {
+			continue
+		}
+		for c := range conns {
+			if c.write([]any{[]byte("pmessage"), []byte(pattern), []byte(channel), msg}) == nil {
+				cnt++
+			}
+		}
+	}
+	return cnt
+}
+
+func (s *Server) unsubscribeAll(c *serverConn) {
+	for ch := range c.channels {
+		delete(s.channels[ch], c)
+	}
+	for p := range c.patterns {
+		delete(s.patterns[p], c)
+	}
+	c.channels, c.patterns = nil, nil
+}
+
+// readCommand 支持數組形式的命令，也支持 telnet 的 inline 命令
+func readCommand(r *bufio.Reader) ([][]byte, error) {
+	b, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	if b[0] != '*' {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.Fields(line), nil
+	}
+	val, err := readValue(r)
+	if err != nil {
+		return nil, err
+	}
+	arr, ok := val.([]any)
+	if !ok {
+		return nil, errInvalidReply
+	}
+	res := make([][]byte, len(arr))
+	for i, v := range arr {
+		if res[i], ok = v.([]byte); !ok {
+			return nil, errInvalidReply
+		}
+	}
+	return res, nil
+}
+
+// globMatch 支持 * 和 ?，\ 轉義
+func globMatch(pattern, str string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(str); i++ {
+				if globMatch(pattern, str[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(str) == 0 {
+				return false
+			}
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(str) == 0 || str[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern, str = pattern[1:], str[1:]
+	}
+	return len(str) == 0
+}
+
+var _ io.Closer = (*Server)(nil)
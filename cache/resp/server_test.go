@@ -0,0 +1,268 @@
+package resp
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"testing"
+	"time"
+)
+
+// startServer 在隨機端口啟動 Server，測試結束的時候關閉
+func startServer(t *testing.T, opts ...ServerOption) (*Server, *Client) {
+	s := NewServer(opts...)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		_ = s.Serve(l)
+	}()
+	client := NewClient(l.Addr().String())
+	t.Cleanup(func() {
+		_ = client.Close()
+		_ = s.Close()
+	})
+	return s, client
+}
+
+func TestServer_Commands(t *testing.T) {
+	_, client := startServer(t)
+	testCases := []struct {
+		name    string
+		args    []any
+		want    any
+		wantErr error
+	}{
+		{name: "ping", args: []any{"PING"}, want: SimpleString("PONG")},
+		{name: "ping msg", args: []any{"PING", "hi"}, want: []byte("hi")},
+		{name: "unknown", args: []any{"FOO"}, wantErr: Error("ERR unknown command 'foo'")},
+		{name: "arity", args: []any{"GET"}, wantErr: Error("ERR wrong number of arguments for 'get' command")},
+		{name: "get nil", args: []any{"GET", "key1"}, want: nil},
+		{name: "set", args: []any{"SET", "key1", "val1"}, want: SimpleString("OK")},
+		{name: "get", args: []any{"GET", "key1"}, want: []byte("val1")},
+		{name: "set nx exist", args: []any{"SET", "key1", "val2", "NX"}, want: nil},
+		{name: "set xx get", args: []any{"SET", "key1", "val2", "XX", "GET"}, want: []byte("val1")},
+		{name: "set xx not exist", args: []any{"SET", "key2", "val2", "XX"}, want: nil},
+		{name: "set syntax", args: []any{"SET", "key2", "val2", "NX", "XX"}, wantErr: errSyntax},
+		{name: "set invalid ttl", args: []any{"SET", "key2", "val2", "EX", 0}, wantErr: errInvalidTTL},
+		{name: "set px", args: []any{"SET", "key2", "val2", "PX", 100000}, want: SimpleString("OK")},
+		{name: "ttl", args: []any{"TTL", "key2"}, want: int64(100)},
+		{name: "ttl no expire", args: []any{"TTL", "key1"}, want: int64(-1)},
+		{name: "ttl not exist", args: []any{"PTTL", "key3"}, want: int64(-2)},
+		{name: "set keepttl", args: []any{"SET", "key2", "val3", "KEEPTTL"}, want: SimpleString("OK")},
+		{name: "ttl kept", args: []any{"TTL", "key2"}, want: int64(100)},
+		{name: "persist", args: []any{"PERSIST", "key2"}, want: int64(1)},
+		{name: "persist again", args: []any{"PERSIST", "key2"}, want: int64(0)},
+		{name: "expire", args: []any{"EXPIRE", "key2", 10}, want: int64(1)},
+		{name: "expire not exist", args: []any{"EXPIRE", "key3", 10}, want: int64(0)},
+		{name: "exists", args: []any{"EXISTS", "key1", "key2", "key3"}, want: int64(2)},
+		{name: "dbsize", args: []any{"DBSIZE"}, want: int64(2)},
+		{name: "getdel", args: []any{"GETDEL", "key2"}, want: []byte("val3")},
+		{name: "getdel not exist", args: []any{"GETDEL", "key2"}, want: nil},
+		{name: "incr", args: []any{"INCR", "cnt"}, want: int64(1)},
+		{name: "incrby", args: []any{"INCRBY", "cnt", 10}, want: int64(11)},
+		{name: "decrby", args: []any{"DECRBY", "cnt", 5}, want: int64(6)},
+		{name: "incr not integer", args: []any{"INCR", "key1"}, wantErr: errNotInteger},
+		{name: "mset", args: []any{"MSET", "key3", "val3", "key4", "val4"}, want: SimpleString("OK")},
+		{name: "mset arity", args: []any{"MSET", "key3", "val3", "key4"},
+			wantErr: Error("ERR wrong number of arguments for 'mset' command")},
+		{name: "mget", args: []any{"MGET", "key3", "key5", "key4"}, want: []any{[]byte("val3"), nil, []byte("val4")}},
+		{name: "del", args: []any{"DEL", "key1", "cnt", "key3", "key4"}, want: int64(4)},
+		{name: "sadd", args: []any{"SADD", "set", "b", "a", "b"}, want: int64(2)},
+		{name: "sadd exist", args: []any{"SADD", "set", "a", "c"}, want: int64(1)},
+		{name: "scard", args: []any{"SCARD", "set"}, want: int64(3)},
+		{name: "smembers", args: []any{"SMEMBERS", "set"}, want: []any{[]byte("a"), []byte("b"), []byte("c")}},
+		{name: "get wrong type", args: []any{"GET", "set"}, wantErr: errWrongType},
+		{name: "set string", args: []any{"SET", "str", "val"}, want: SimpleString("OK")},
+		{name: "sadd wrong type", args: []any{"SADD", "str", "a"}, wantErr: errWrongType},
+		{name: "srem", args: []any{"SREM", "set", "a", "d"}, want: int64(1)},
+		{name: "srem all", args: []any{"SREM", "set", "b", "c"}, want: int64(2)},
+		{name: "smembers not exist", args: []any{"SMEMBERS", "set"}, want: []any{}},
+		{name: "srem wrong type", args: []any{"SREM", "str", "a"}, wantErr: errWrongType},
+		{name: "select", args: []any{"SELECT", 16}, wantErr: errInvalidDB},
+		{name: "config", args: []any{"CONFIG", "GET", "notify-*"},
+			want: []any{[]byte("notify-keyspace-events"), []byte("")}},
+		{name: "publish", args: []any{"PUBLISH", "ch", "msg"}, want: int64(0)},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			val, err := client.Do(context.Background(), tc.args...)
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.want, val)
+		})
+	}
+}
+
+func TestServer_Expire(t *testing.T) {
+	_, client := startServer(t, ServerWithExpireInterval(time.Millisecond*10))
+	_, err := client.Do(context.Background(), "SET", "key1", "val1", "PX", 20)
+	require.NoError(t, err)
+	val, err := client.Do(context.Background(), "GET", "key1")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("val1"), val)
+
+	time.Sleep(time.Millisecond * 50)
+	val, err = client.Do(context.Background(), "GET", "key1")
+	require.NoError(t, err)
+	assert.Nil(t, val)
+}
+
+func TestServer_DB(t *testing.T) {
+	s, client := startServer(t)
+	_, err := client.Do(context.Background(), "SET", "key1", "db0")
+	require.NoError(t, err)
+
+	db1 := NewClient(client.addr, ClientWithDB(1))
+	defer func() {
+		_ = db1.Close()
+	}()
+	val, err := db1.Do(context.Background(), "GET", "key1")
+	require.NoError(t, err)
+	assert.Nil(t, val)
+	_, err = db1.Do(context.Background(), "SET", "key1", "db1")
+	require.NoError(t, err)
+
+	s.mu.Lock()
+	assert.Equal(t, []byte("db0"), s.dbs[0]["key1"].val)
+	assert.Equal(t, []byte("db1"), s.dbs[1]["key1"].val)
+	s.mu.Unlock()
+}
+
+func TestServer_Auth(t *testing.T) {
+	_, client := startServer(t, ServerWithPassword("123"))
+	_, err := client.Do(context.Background(), "GET", "key1")
+	assert.Equal(t, Error("NOAUTH Authentication required."), err)
+
+	authed := NewClient(client.addr, ClientWithPassword("123"))
+	defer func() {
+		_ = authed.Close()
+	}()
+	_, err = authed.Do(context.Background(), "GET", "key1")
+	assert.NoError(t, err)
+
+	wrong := NewClient(client.addr, ClientWithPassword("456"))
+	defer func() {
+		_ = wrong.Close()
+	}()
+	_, err = wrong.Do(context.Background(), "GET", "key1")
+	assert.Equal(t, errInvalidAuth, err)
+}
+
+func TestServer_Notify(t *testing.T) {
+	_, client := startServer(t,
+		ServerWithExpireInterval(time.Millisecond*10),
+		ServerWithMaxKeys(2))
+	ctx := context.Background()
+	_, err := client.Do(ctx, "CONFIG", "SET", "notify-keyspace-events", "KEgx")
+	require.NoError(t, err)
+
+	ps, err := client.PSubscribe(ctx, "__key*@0__:*")
+	require.NoError(t, err)
+	defer func() {
+		_ = ps.Close()
+	}()
+
+	_, err = client.Do(ctx, "SET", "key1", "val1", "PX", 10)
+	require.NoError(t, err)
+	assert.Equal(t, Message{Pattern: "__key*@0__:*", Channel: "__keyspace@0__:key1", Payload: "expired"}, <-ps.Channel())
+	assert.Equal(t, Message{Pattern: "__key*@0__:*", Channel: "__keyevent@0__:expired", Payload: "key1"}, <-ps.Channel())
+
+	// 沒有訂閱 e，淘汰不會通知
+	for _, key := range []string{"key2", "key3", "key4"} {
+		_, err = client.Do(ctx, "SET", key, "val")
+		require.NoError(t, err)
+	}
+	_, err = client.Do(ctx, "DEL", "key4")
+	require.NoError(t, err)
+	assert.Equal(t, Message{Pattern: "__key*@0__:*", Channel: "__keyspace@0__:key4", Payload: "del"}, <-ps.Channel())
+	assert.Equal(t, Message{Pattern: "__key*@0__:*", Channel: "__keyevent@0__:del", Payload: "key4"}, <-ps.Channel())
+	n, err := Int64(client.Do(ctx, "DBSIZE"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+}
+
+func TestServer_Inline(t *testing.T) {
+	_, client := startServer(t)
+	conn, err := net.Dial("tcp", client.addr)
+	require.NoError(t, err)
+	defer func() {
+		_ = conn.Close()
+	}()
+	_, err = conn.Write([]byte("SET key1 val1\r\nGET key1\r\n"))
+	require.NoError(t, err)
+	buf := make([]byte, 64)
+	n := 0
+	for n < len("+OK\r\n$4\r\nval1\r\n") {
+		cnt, err := conn.Read(buf[n:])
+		require.NoError(t, err)
+		n += cnt
+	}
+	assert.Equal(t, "+OK\r\n$4\r\nval1\r\n", string(buf[:n]))
+}
+
+func TestGlobMatch(t *testing.T) {
+	testCases := []struct {
+		pattern string
+		str     string
+		want    bool
+	}{
+		{pattern: "*", str: "", want: true},
+		{pattern: "*", str: "abc", want: true},
+		{pattern: "a*c", str: "abbbc", want: true},
+		{pattern: "a*c", str: "abbb", want: false},
+		{pattern: "a?c", str: "abc", want: true},
+		{pattern: "a?c", str: "ac", want: false},
+		{pattern: "__keyevent@0__:*", str: "__keyevent@0__:expired", want: true},
+		{pattern: `a\*`, str: "a*", want: true},
+		{pattern: `a\*`, str: "ab", want: false},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.want, globMatch(tc.pattern, tc.str), "%s %s", tc.pattern, tc.str)
+	}
+}
+
+func TestServer_Script(t *testing.T) {
+	s, client := startServer(t)
+	ctx := context.Background()
+	// 和 Lua 腳本 return redis.call('INCRBY', KEYS[1], ARGV[1]) + 1 一樣
+	src := "return redis.call('INCRBY', KEYS[1], ARGV[1]) + 1"
+	s.RegisterScript(src, func(call *ScriptCall, keys []string, args [][]byte) any {
+		res := call.Call("INCRBY", keys[0], args[0])
+		if n, ok := res.(int64); ok {
+			return n + 1
+		}
+		return res
+	})
+	sha := scriptSHA(src)
+
+	_, err := client.Do(ctx, "EVALSHA", sha, 1, "cnt", 2)
+	assert.Equal(t, Error("NOSCRIPT No matching script. Please use EVAL."), err)
+	val, err := client.Do(ctx, "EVAL", src, 1, "cnt", 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), val)
+	val, err = client.Do(ctx, "EVALSHA", sha, 1, "cnt", 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), val)
+
+	// 腳本裡面的錯誤
+	_, err = client.Do(ctx, "SET", "str", "abc")
+	require.NoError(t, err)
+	_, err = client.Do(ctx, "EVALSHA", sha, 1, "str", 2)
+	assert.Equal(t, errNotInteger, err)
+	_, err = client.Do(ctx, "EVALSHA", sha, 3, "cnt", 2)
+	assert.Equal(t, Error("ERR Number of keys can't be greater than number of args"), err)
+
+	val, err = client.Do(ctx, "SCRIPT", "EXISTS", sha, "123")
+	require.NoError(t, err)
+	assert.Equal(t, []any{int64(1), int64(0)}, val)
+	val, err = client.Do(ctx, "SCRIPT", "FLUSH")
+	require.NoError(t, err)
+	_, err = client.Do(ctx, "EVALSHA", sha, 1, "cnt", 2)
+	assert.Error(t, err)
+	val, err = client.Do(ctx, "SCRIPT", "LOAD", src)
+	require.NoError(t, err)
+	assert.Equal(t, []byte(sha), val)
+
+	_, err = client.Do(ctx, "EVAL", "return 1", 0)
+	assert.Equal(t, Error("ERR resp: 不支持的腳本，需要先透過 RegisterScript 註冊"), err)
+}
@@ -0,0 +1,93 @@
+package resp
+
+import "sort"
+
+// lookupSet key 不是集合的時候返回 errWrongType
+func (s *Server) lookupSet(c *serverConn, key string) (*entry, bool, any) {
+	e, exist := s.lookup(c, key)
+	if exist && e.set == nil {
+		return nil, false, errWrongType
+	}
+	return e, exist, nil
+}
+
+// cmdSAdd SADD key member [member ...]，返回新加入的成員數量
+func cmdSAdd(s *Server, c *serverConn, args [][]byte) any {
+	key := string(args[0])
+	e, exist, errReply := s.lookupSet(c, key)
+	if errReply != nil {
+		return errReply
+	}
+	if !exist {
+		e = &entry{set: make(map[string]struct{}, len(args)-1)}
+		s.store(c, key, e)
+	}
+	cnt := 0
+	for _, member := range args[1:] {
+		if _, ok := e.set[string(member)]; !ok {
+			e.set[string(member)] = struct{}{}
+			cnt++
+		}
+	}
+	s.notifyEvent('s', c.db, key, "sadd")
+	return cnt
+}
+
+// cmdSRem 和 Redis 一樣，集合為空的時候刪除 key
+func cmdSRem(s *Server, c *serverConn, args [][]byte) any {
+	key := string(args[0])
+	e, exist, errReply := s.lookupSet(c, key)
+	if errReply != nil {
+		return errReply
+	}
+	if !exist {
+		return 0
+	}
+	cnt := 0
+	for _, member := range args[1:] {
+		if _, ok := e.set[string(member)]; ok {
+			delete(e.set, string(member))
+			cnt++
+		}
+	}
+	if cnt > 0 {
+		s.notifyEvent('s', c.db, key, "srem")
+	}
+	if len(e.set) == 0 {
+		delete(s.db(c), key)
+		s.notifyEvent('g', c.db, key, "del")
+	}
+	return cnt
+}
+
+// cmdSMembers 成員按照字典序排列，方便測試；Redis 不保證順序
+func cmdSMembers(s *Server, c *serverConn, args [][]byte) any {
+	e, exist, errReply := s.lookupSet(c, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	res := make([]any, 0)
+	if !exist {
+		return res
+	}
+	members := make([]string, 0, len(e.set))
+	for member := range e.set {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	for _, member := range members {
+		res = append(res, []byte(member))
+	}
+	return res
+}
+
+func cmdSCard(s *Server, c *serverConn, args [][]byte) any {
+	e, exist, errReply := s.lookupSet(c, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if !exist {
+		return 0
+	}
+	return len(e.set)
+}
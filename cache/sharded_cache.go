@@ -0,0 +1,235 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var _ Cache = (*ShardedCache)(nil)
+
+// ShardedCache 把 key 按照哈希分散到多個 shard，每個 shard 有自己的鎖
+// 不同 shard 上的讀寫互不影響，適合高併發的場景
+//
+// 過期檢查是增量的：每次輪詢在每個 shard 上最多抽查 scanLimit 個 key，
+// 過期的比例超過 1/4 就在這個 shard 上再抽查一輪 (類似 Redis 的主動過期)，
+// 任何時候最多只鎖住一個 shard
+type ShardedCache struct {
+	shards []*shard
+	// len(shards) - 1，shard 數量是 2 的冪，可以用位運算取模
+	mask      uint32
+	scanLimit int
+	onEvicted func(key string, val any)
+	close     chan struct{}
+	closeOnce sync.Once
+}
+
+type shard struct {
+	mu   sync.RWMutex
+	data map[string]*item
+}
+
+type ShardedCacheOption func(cache *ShardedCache)
+
+// NewShardedCache interval 為過期檢查的間隔，預設 32 個 shard
+func NewShardedCache(interval time.Duration, opts ...ShardedCacheOption) *ShardedCache {
+	res := &ShardedCache{
+		scanLimit: 20,
+		onEvicted: func(key string, val any) {},
+		close:     make(chan struct{}),
+	}
+	ShardedCacheWithShardCount(32)(res)
+	for _, opt := range opts {
+		opt(res)
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case t := <-ticker.C:
+				for _, s := range res.shards {
+					res.expire(s, t)
+				}
+			case <-res.close:
+				return
+			}
+		}
+	}()
+	return res
+}
+
+// ShardedCacheWithShardCount shard 數量，會向上取整到 2 的冪
+func ShardedCacheWithShardCount(n int) ShardedCacheOption {
+	return func(cache *ShardedCache) {
+		cnt := 1
+		for cnt < n {
+			cnt <<= 1
+		}
+		cache.shards = make([]*shard, cnt)
+		for i := range cache.shards {
+			cache.shards[i] = &shard{data: make(map[string]*item, 16)}
+		}
+		cache.mask = uint32(cnt - 1)
+	}
+}
+
+// ShardedCacheWithScanLimit 每一輪過期檢查在一個 shard 上最多檢查的 key 數量
+func ShardedCacheWithScanLimit(n int) ShardedCacheOption {
+	return func(cache *ShardedCache) {
+		cache.scanLimit = n
+	}
+}
+
+func ShardedCacheWithOnEvictedCallback(f func(key string, val any)) ShardedCacheOption {
+	return func(cache *ShardedCache) {
+		cache.onEvicted = f
+	}
+}
+
+func (s *ShardedCache) Set(ctx context.Context, key string, value any, expiration time.Duration) error {
+	var dl time.Time
+	if expiration > 0 {
+		dl = time.Now().Add(expiration)
+	}
+	sd := s.shard(key)
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	sd.data[key] = &item{val: value, deadline: dl}
+	return nil
+}
+
+func (s *ShardedCache) Get(ctx context.Context, key string) (any, error) {
+	sd := s.shard(key)
+	sd.mu.RLock()
+	itm, ok := sd.data[key]
+	sd.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w, key: %s", errKeyNotFound, key)
+	}
+	now := time.Now()
+	if itm.deadlineBefore(now) {
+		sd.mu.Lock()
+		defer sd.mu.Unlock()
+		// double check，可能已經被其他人刪除或者更新
+		itm, ok = sd.data[key]
+		if !ok {
+			return nil, fmt.Errorf("%w, key: %s", errKeyNotFound, key)
+		}
+		if itm.deadlineBefore(now) {
+			s.delete(sd, key)
+			return nil, fmt.Errorf("%w, key: %s", errKeyNotFound, key)
+		}
+	}
+	return itm.val, nil
+}
+
+func (s *ShardedCache) Delete(ctx context.Context, key string) error {
+	sd := s.shard(key)
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	s.delete(sd, key)
+	return nil
+}
+
+// LoadAndDelete 取出並刪除 key，已經過期的 key 視為不存在
+func (s *ShardedCache) LoadAndDelete(ctx context.Context, key string) (any, error) {
+	sd := s.shard(key)
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	itm, ok := sd.data[key]
+	if !ok {
+		return nil, fmt.Errorf("%w, key: %s", errKeyNotFound, key)
+	}
+	s.delete(sd, key)
+	if itm.deadlineBefore(time.Now()) {
+		return nil, fmt.Errorf("%w, key: %s", errKeyNotFound, key)
+	}
+	return itm.val, nil
+}
+
+// OnEvicted 應該在使用之前設置，之後設置不保證對併發中的刪除生效
+func (s *ShardedCache) OnEvicted(f func(key string, val any)) {
+	// 鎖住所有 shard，保證設置之後的刪除都能看到新的回調
+	for _, sd := range s.shards {
+		sd.mu.Lock()
+	}
+	s.onEvicted = f
+	for _, sd := range s.shards {
+		sd.mu.Unlock()
+	}
+}
+
+// Len key 的數量，包括已經過期但還沒被刪除的
+func (s *ShardedCache) Len() int {
+	res := 0
+	for _, sd := range s.shards {
+		sd.mu.RLock()
+		res += len(sd.data)
+		sd.mu.RUnlock()
+	}
+	return res
+}
+
+func (s *ShardedCache) Close() error {
+	err := errors.New("重複關閉")
+	s.closeOnce.Do(func() {
+		close(s.close)
+		err = nil
+	})
+	return err
+}
+
+// expire 在一個 shard 上增量地刪除過期的 key
+func (s *ShardedCache) expire(sd *shard, now time.Time) {
+	// 最多連續抽查 16 輪，避免一個 shard 佔用太久
+	for round := 0; round < 16; round++ {
+		sd.mu.Lock()
+		checked, expired := 0, 0
+		// map 的遍歷順序是隨機的，相當於隨機抽查
+		for key, itm := range sd.data {
+			if checked >= s.scanLimit {
+				break
+			}
+			checked++
+			if itm.deadlineBefore(now) {
+				s.delete(sd, key)
+				expired++
+			}
+		}
+		sd.mu.Unlock()
+		if checked < s.scanLimit || expired*4 <= checked {
+			return
+		}
+	}
+}
+
+func (s *ShardedCache) shard(key string) *shard {
+	return s.shards[fnv32(key)&s.mask]
+}
+
+func (s *ShardedCache) delete(sd *shard, key string) {
+	itm, ok := sd.data[key]
+	if !ok {
+		return
+	}
+	delete(sd.data, key)
+	s.onEvicted(key, itm.val)
+}
+
+// fnv32 FNV-1a，避免 hash/fnv 轉換 []byte 的內存分配
+func fnv32(key string) uint32 {
+	const (
+		offset = 2166136261
+		prime  = 16777619
+	)
+	h := uint32(offset)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= prime
+	}
+	return h
+}
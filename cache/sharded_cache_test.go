@@ -0,0 +1,220 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math/rand"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestShardedCache_Get(t *testing.T) {
+	testCases := []struct {
+		name    string
+		cache   func() *ShardedCache
+		key     string
+		wantErr error
+		wantVal any
+	}{
+		{
+			name: "key not found",
+			key:  "not existed key",
+			cache: func() *ShardedCache {
+				return NewShardedCache(time.Second * 10)
+			},
+			wantErr: fmt.Errorf("%w, key: %s", errKeyNotFound, "not existed key"),
+		},
+		{
+			name: "key expired",
+			key:  "expired key",
+			cache: func() *ShardedCache {
+				c := NewShardedCache(time.Second * 10)
+				err := c.Set(context.Background(), "expired key", "123", time.Millisecond)
+				require.NoError(t, err)
+				time.Sleep(time.Millisecond * 10)
+				return c
+			},
+			wantErr: fmt.Errorf("%w, key: %s", errKeyNotFound, "expired key"),
+		},
+		{
+			name: "get key",
+			key:  "key1",
+			cache: func() *ShardedCache {
+				res := NewShardedCache(time.Second, ShardedCacheWithShardCount(3))
+				err := res.Set(context.Background(), "key1", 123, time.Second)
+				require.NoError(t, err)
+				return res
+			},
+			wantVal: 123,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := tc.cache()
+			defer func() {
+				_ = c.Close()
+			}()
+			itm, err := c.Get(context.Background(), tc.key)
+			assert.Equal(t, tc.wantErr, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tc.wantVal, itm)
+		})
+	}
+}
+
+func TestShardedCache_ShardCount(t *testing.T) {
+	testCases := []struct {
+		n    int
+		want int
+	}{
+		{n: 0, want: 1},
+		{n: 1, want: 1},
+		{n: 3, want: 4},
+		{n: 16, want: 16},
+		{n: 17, want: 32},
+	}
+	for _, tc := range testCases {
+		c := NewShardedCache(time.Minute, ShardedCacheWithShardCount(tc.n))
+		assert.Equal(t, tc.want, len(c.shards))
+		assert.Equal(t, uint32(tc.want-1), c.mask)
+		require.NoError(t, c.Close())
+		assert.Error(t, c.Close())
+	}
+}
+
+func TestShardedCache_Loop(t *testing.T) {
+	var count int32
+	c := NewShardedCache(time.Millisecond*10,
+		ShardedCacheWithShardCount(4),
+		ShardedCacheWithScanLimit(10),
+		ShardedCacheWithOnEvictedCallback(func(key string, val any) {
+			atomic.AddInt32(&count, 1)
+		}))
+	defer func() {
+		_ = c.Close()
+	}()
+	// 過期的 key 遠多於 scanLimit，需要多輪抽查
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, c.Set(context.Background(), "expired"+strconv.Itoa(i), i, time.Millisecond))
+	}
+	require.NoError(t, c.Set(context.Background(), "key", "123", 0))
+
+	assert.Eventually(t, func() bool {
+		// 不能 Get，會把 key 刪除
+		return c.Len() == 1
+	}, time.Second*3, time.Millisecond*10)
+	assert.Equal(t, int32(1000), atomic.LoadInt32(&count))
+	val, err := c.Get(context.Background(), "key")
+	require.NoError(t, err)
+	assert.Equal(t, "123", val)
+}
+
+func TestShardedCache_LoadAndDelete(t *testing.T) {
+	c := NewShardedCache(time.Minute)
+	defer func() {
+		_ = c.Close()
+	}()
+	var evicted []string
+	c.OnEvicted(func(key string, val any) {
+		evicted = append(evicted, key)
+	})
+	require.NoError(t, c.Set(context.Background(), "key1", 1, 0))
+	require.NoError(t, c.Set(context.Background(), "key2", 2, time.Millisecond))
+	time.Sleep(time.Millisecond * 10)
+
+	val, err := c.LoadAndDelete(context.Background(), "key1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, val)
+	_, err = c.LoadAndDelete(context.Background(), "key2")
+	assert.Equal(t, fmt.Errorf("%w, key: %s", errKeyNotFound, "key2"), err)
+	require.NoError(t, c.Delete(context.Background(), "key3"))
+	assert.Equal(t, []string{"key1", "key2"}, evicted)
+	assert.Equal(t, 0, c.Len())
+}
+
+func TestShardedCache_Concurrent(t *testing.T) {
+	c := NewShardedCache(time.Millisecond, ShardedCacheWithShardCount(8))
+	defer func() {
+		_ = c.Close()
+	}()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				key := strconv.Itoa(i*1000 + j)
+				assert.NoError(t, c.Set(context.Background(), key, j, time.Millisecond*time.Duration(j%3)))
+				_, _ = c.Get(context.Background(), key)
+				if j%5 == 0 {
+					assert.NoError(t, c.Delete(context.Background(), key))
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+// 並行壓測，和 BuildInMapCache 比較吞吐量
+// go test -run none -bench 'BenchmarkParallel' -cpu 1,4,16 ./cache/
+func BenchmarkParallel(b *testing.B) {
+	const keys = 1 << 16
+	caches := []struct {
+		name  string
+		cache func() (Cache, func() error)
+	}{
+		{name: "BuildInMapCache", cache: func() (Cache, func() error) {
+			c := NewBuildInMapCache(time.Minute)
+			return c, c.Close
+		}},
+		{name: "ShardedCache", cache: func() (Cache, func() error) {
+			c := NewShardedCache(time.Minute)
+			return c, c.Close
+		}},
+	}
+	workloads := []struct {
+		name string
+		// 寫操作的比例，百分比
+		writes int
+	}{
+		{name: "read90", writes: 10},
+		{name: "read50", writes: 50},
+		{name: "write100", writes: 100},
+	}
+	for _, w := range workloads {
+		for _, cc := range caches {
+			b.Run(w.name+"/"+cc.name, func(b *testing.B) {
+				c, closeFn := cc.cache()
+				b.Cleanup(func() { _ = closeFn() })
+				// 提前生成 key，避免 strconv 的內存分配影響結果
+				ks := make([]string, keys)
+				for i := range ks {
+					ks[i] = strconv.Itoa(i)
+					_ = c.Set(context.Background(), ks[i], i, time.Minute)
+				}
+				var seed int64
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					r := rand.New(rand.NewSource(atomic.AddInt64(&seed, 1)))
+					for pb.Next() {
+						n := r.Intn(keys)
+						key := ks[n]
+						if r.Intn(100) < w.writes {
+							_ = c.Set(context.Background(), key, n, time.Minute)
+						} else {
+							_, _ = c.Get(context.Background(), key)
+						}
+					}
+				})
+			})
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// singleflight 合併同一個 key 併發的加載，同一時間只有一個 goroutine 真的去加載
+// 和 golang.org/x/sync/singleflight 類似，但是等待的一方可以透過 ctx 放棄等待
+type singleflight struct {
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+type call struct {
+	done chan struct{}
+	val  any
+	err  error
+}
+
+// do shared 表示是否和其他 goroutine 合併了
+// 發起加載的 goroutine 會同步執行 fn，其他 goroutine 等待結果或者 ctx 結束
+func (g *singleflight) do(ctx context.Context, key string, fn func() (any, error)) (val any, err error, shared bool) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*call)
+	}
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		select {
+		case <-c.done:
+			return c.val, c.err, true
+		case <-ctx.Done():
+			return nil, ctx.Err(), true
+		}
+	}
+	c := &call{done: make(chan struct{})}
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	g.call(key, c, fn)
+	return c.val, c.err, false
+}
+
+// doAsync 沒有正在進行的加載的時候，在新的 goroutine 裡面執行 fn
+// 返回 false 表示已經有其他 goroutine 在加載
+func (g *singleflight) doAsync(key string, fn func() (any, error)) bool {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*call)
+	}
+	if _, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		return false
+	}
+	c := &call{done: make(chan struct{})}
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	go g.call(key, c, fn)
+	return true
+}
+
+func (g *singleflight) call(key string, c *call, fn func() (any, error)) {
+	defer func() {
+		// fn panic 的時候也要通知等待的 goroutine，然後繼續 panic
+		if r := recover(); r != nil {
+			c.err = fmt.Errorf("cache: 加載 key %s 的時候 panic: %v", key, r)
+			g.finish(key, c)
+			panic(r)
+		}
+		g.finish(key, c)
+	}()
+	c.val, c.err = fn()
+}
+
+func (g *singleflight) finish(key string, c *call) {
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+	close(c.done)
+}
@@ -0,0 +1,69 @@
+package stats
+
+import (
+	"bytes"
+	"geektime-go/web"
+	"net/http"
+	"strconv"
+)
+
+// Mount 在 server 上註冊調試接口
+//   - GET {prefix}/metrics: Prometheus 指標
+//   - GET {prefix}/stats: 所有緩存的統計數據，JSON
+//   - GET {prefix}/keys/:name?by=size|accesses&n=20: 緩存 name 按照大小或者訪問次數排序的 key，JSON
+//
+// 調試接口會暴露 key，不要掛在對外的端口上
+func Mount(server *web.HttpServer, prefix string, reg *Registry) {
+	server.Get(prefix+"/metrics", func(ctx *web.Context) {
+		var buf bytes.Buffer
+		if err := reg.WritePrometheus(&buf); err != nil {
+			_ = ctx.RespServerError(err.Error())
+			return
+		}
+		ctx.Resp.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		ctx.RespStatusCode = http.StatusOK
+		ctx.RespData = buf.Bytes()
+	})
+	server.Get(prefix+"/stats", func(ctx *web.Context) {
+		res := make(map[string]statsResp)
+		for name, s := range reg.Stats() {
+			res[name] = statsResp{Stats: s, HitRatio: s.HitRatio()}
+		}
+		_ = ctx.RespJSONOK(res)
+	})
+	server.Get(prefix+"/keys/:name", func(ctx *web.Context) {
+		name, _ := ctx.PathValue("name")
+		p, ok := reg.cache(name)
+		if !ok {
+			_ = ctx.RespString(http.StatusNotFound, "緩存不存在")
+			return
+		}
+		lister, ok := p.(KeyLister)
+		if !ok {
+			_ = ctx.RespString(http.StatusBadRequest, "緩存不支持列出 key")
+			return
+		}
+		by, _ := ctx.QueryValue("by")
+		if by == "" {
+			by = OrderByAccesses
+		}
+		if by != OrderBySize && by != OrderByAccesses {
+			_ = ctx.RespString(http.StatusBadRequest, "by 只能是 size 或者 accesses")
+			return
+		}
+		n := 20
+		if val, err := ctx.QueryValue("n"); err == nil && val != "" {
+			n, err = strconv.Atoi(val)
+			if err != nil || n <= 0 {
+				_ = ctx.RespString(http.StatusBadRequest, "n 必須是正整數")
+				return
+			}
+		}
+		_ = ctx.RespJSONOK(TopKeys(lister.KeyStats(), by, n))
+	})
+}
+
+type statsResp struct {
+	Stats
+	HitRatio float64
+}
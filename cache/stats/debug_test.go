@@ -0,0 +1,86 @@
+package stats
+
+import (
+	"encoding/json"
+	"geektime-go/web"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type mockLister struct {
+	mockProvider
+	keys []KeyInfo
+}
+
+func (m mockLister) KeyStats() []KeyInfo {
+	res := make([]KeyInfo, len(m.keys))
+	copy(res, m.keys)
+	return res
+}
+
+func TestMount(t *testing.T) {
+	reg := NewRegistry()
+	reg.Register("users", mockLister{
+		mockProvider: mockProvider{Hits: 3, Misses: 1},
+		keys: []KeyInfo{
+			{Key: "key1", Size: 10, Accesses: 5},
+			{Key: "key2", Size: 30, Accesses: 1},
+			{Key: "key3", Size: 20, Accesses: 3},
+		},
+	})
+	reg.Register("orders", mockProvider{})
+	server := web.NewHttpServer()
+	Mount(server, "/debug/cache", reg)
+
+	testCases := []struct {
+		name     string
+		url      string
+		wantCode int
+		wantKeys []string
+	}{
+		{name: "by accesses", url: "/debug/cache/keys/users", wantCode: http.StatusOK,
+			wantKeys: []string{"key1", "key3", "key2"}},
+		{name: "by size", url: "/debug/cache/keys/users?by=size&n=2", wantCode: http.StatusOK,
+			wantKeys: []string{"key2", "key3"}},
+		{name: "invalid by", url: "/debug/cache/keys/users?by=abc", wantCode: http.StatusBadRequest},
+		{name: "invalid n", url: "/debug/cache/keys/users?n=-1", wantCode: http.StatusBadRequest},
+		{name: "not lister", url: "/debug/cache/keys/orders", wantCode: http.StatusBadRequest},
+		{name: "not found", url: "/debug/cache/keys/abc", wantCode: http.StatusNotFound},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tc.url, nil))
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			if tc.wantCode != http.StatusOK {
+				return
+			}
+			var keys []KeyInfo
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &keys))
+			names := make([]string, 0, len(keys))
+			for _, k := range keys {
+				names = append(names, k.Key)
+			}
+			assert.Equal(t, tc.wantKeys, names)
+		})
+	}
+
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/debug/cache/stats", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	var res map[string]struct {
+		Hits     uint64
+		HitRatio float64
+	}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &res))
+	assert.Equal(t, uint64(3), res["users"].Hits)
+	assert.Equal(t, 0.75, res["users"].HitRatio)
+
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/debug/cache/metrics", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), `cache_hits_total{cache="users"} 3`)
+}
@@ -0,0 +1,73 @@
+package stats
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultBuckets 加載耗時的默認分桶，從 1ms 到 10s
+var DefaultBuckets = []time.Duration{
+	time.Millisecond, time.Millisecond * 5, time.Millisecond * 10, time.Millisecond * 25,
+	time.Millisecond * 50, time.Millisecond * 100, time.Millisecond * 250, time.Millisecond * 500,
+	time.Second, time.Second * 2, time.Second * 5, time.Second * 10,
+}
+
+// Histogram 耗時分佈，和 Prometheus 的 histogram 一樣，每個桶記錄不大於上界的次數
+type Histogram struct {
+	buckets []time.Duration
+	// 最後一個為 +Inf
+	counts []atomic.Uint64
+	count  atomic.Uint64
+	sum    atomic.Int64
+}
+
+// NewHistogram buckets 為每個桶的上界，沒有傳的時候使用 DefaultBuckets
+func NewHistogram(buckets ...time.Duration) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	bs := make([]time.Duration, len(buckets))
+	copy(bs, buckets)
+	sort.Slice(bs, func(i, j int) bool {
+		return bs[i] < bs[j]
+	})
+	return &Histogram{
+		buckets: bs,
+		counts:  make([]atomic.Uint64, len(bs)+1),
+	}
+}
+
+func (h *Histogram) Observe(d time.Duration) {
+	i := sort.Search(len(h.buckets), func(i int) bool {
+		return h.buckets[i] >= d
+	})
+	h.counts[i].Add(1)
+	h.count.Add(1)
+	h.sum.Add(int64(d))
+}
+
+// HistogramSnapshot Counts 為累計值，Counts[i] 為不大於 Buckets[i] 的次數
+// Counts 比 Buckets 多一個，最後一個為 +Inf，等於 Count
+type HistogramSnapshot struct {
+	Buckets []time.Duration
+	Counts  []uint64
+	Count   uint64
+	Sum     time.Duration
+}
+
+// Snapshot 併發 Observe 的時候，各個字段之間可能有微小的不一致
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	res := HistogramSnapshot{
+		Buckets: h.buckets,
+		Counts:  make([]uint64, len(h.counts)),
+		Count:   h.count.Load(),
+		Sum:     time.Duration(h.sum.Load()),
+	}
+	var cum uint64
+	for i := range h.counts {
+		cum += h.counts[i].Load()
+		res.Counts[i] = cum
+	}
+	return res
+}
@@ -0,0 +1,24 @@
+package stats
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram(time.Millisecond*100, time.Millisecond*10)
+	h.Observe(time.Millisecond * 5)
+	h.Observe(time.Millisecond * 10)
+	h.Observe(time.Millisecond * 50)
+	h.Observe(time.Second)
+	assert.Equal(t, HistogramSnapshot{
+		// 分桶會被排序
+		Buckets: []time.Duration{time.Millisecond * 10, time.Millisecond * 100},
+		Counts:  []uint64{2, 3, 4},
+		Count:   4,
+		Sum:     time.Millisecond*65 + time.Second,
+	}, h.Snapshot())
+
+	assert.Equal(t, DefaultBuckets, NewHistogram().Snapshot().Buckets)
+}
@@ -0,0 +1,155 @@
+package stats
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Registry 按照名字管理需要導出的緩存和耗時分佈
+// 沒有依賴 Prometheus 的客戶端，直接輸出 text format，可以直接被 Prometheus 抓取
+type Registry struct {
+	mu         sync.RWMutex
+	caches     map[string]Provider
+	histograms map[string]*Histogram
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		caches:     make(map[string]Provider),
+		histograms: make(map[string]*Histogram),
+	}
+}
+
+// Register 同名的緩存會被覆蓋
+func (r *Registry) Register(name string, p Provider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.caches[name] = p
+}
+
+// RegisterHistogram 一般為加載數據的耗時，name 和對應的緩存一樣
+func (r *Registry) RegisterHistogram(name string, h *Histogram) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.histograms[name] = h
+}
+
+func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.caches, name)
+	delete(r.histograms, name)
+}
+
+// Stats 所有緩存的統計數據
+func (r *Registry) Stats() map[string]Stats {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	res := make(map[string]Stats, len(r.caches))
+	for name, p := range r.caches {
+		res[name] = p.Stats()
+	}
+	return res
+}
+
+func (r *Registry) cache(name string) (Provider, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	p, ok := r.caches[name]
+	return p, ok
+}
+
+type metric struct {
+	name  string
+	help  string
+	typ   string
+	value func(s Stats) string
+}
+
+var metrics = []metric{
+	{name: "cache_hits_total", help: "命中次數", typ: "counter",
+		value: func(s Stats) string { return strconv.FormatUint(s.Hits, 10) }},
+	{name: "cache_misses_total", help: "未命中次數", typ: "counter",
+		value: func(s Stats) string { return strconv.FormatUint(s.Misses, 10) }},
+	{name: "cache_sets_total", help: "寫入次數", typ: "counter",
+		value: func(s Stats) string { return strconv.FormatUint(s.Sets, 10) }},
+	{name: "cache_deletes_total", help: "主動刪除次數", typ: "counter",
+		value: func(s Stats) string { return strconv.FormatUint(s.Deletes, 10) }},
+	{name: "cache_evictions_total", help: "容量不足淘汰次數", typ: "counter",
+		value: func(s Stats) string { return strconv.FormatUint(s.Evictions, 10) }},
+	{name: "cache_expirations_total", help: "過期刪除次數", typ: "counter",
+		value: func(s Stats) string { return strconv.FormatUint(s.Expirations, 10) }},
+	{name: "cache_keys", help: "key 的數量", typ: "gauge",
+		value: func(s Stats) string { return strconv.Itoa(s.Keys) }},
+	{name: "cache_used_bytes", help: "佔用的內存", typ: "gauge",
+		value: func(s Stats) string { return strconv.FormatInt(s.UsedBytes, 10) }},
+	{name: "cache_max_bytes", help: "內存上限，0 表示沒有限制", typ: "gauge",
+		value: func(s Stats) string { return strconv.FormatInt(s.MaxBytes, 10) }},
+}
+
+// WritePrometheus 按照 Prometheus text format 輸出所有指標，緩存的名字為 cache 標籤
+func (r *Registry) WritePrometheus(w io.Writer) error {
+	stats := r.Stats()
+	names := make([]string, 0, len(stats))
+	for name := range stats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	bw := bufio.NewWriter(w)
+	if len(names) > 0 {
+		for _, m := range metrics {
+			fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.typ)
+			for _, name := range names {
+				fmt.Fprintf(bw, "%s{cache=\"%s\"} %s\n", m.name, escapeLabel(name), m.value(stats[name]))
+			}
+		}
+	}
+
+	r.mu.RLock()
+	histograms := make(map[string]HistogramSnapshot, len(r.histograms))
+	for name, h := range r.histograms {
+		histograms[name] = h.Snapshot()
+	}
+	r.mu.RUnlock()
+	names = names[:0]
+	for name := range histograms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) > 0 {
+		const name = "cache_load_duration_seconds"
+		fmt.Fprintf(bw, "# HELP %s 加載數據的耗時\n# TYPE %s histogram\n", name, name)
+		for _, cache := range names {
+			h := histograms[cache]
+			label := escapeLabel(cache)
+			for i, b := range h.Buckets {
+				fmt.Fprintf(bw, "%s_bucket{cache=\"%s\",le=\"%s\"} %d\n", name, label,
+					strconv.FormatFloat(b.Seconds(), 'g', -1, 64), h.Counts[i])
+			}
+			fmt.Fprintf(bw, "%s_bucket{cache=\"%s\",le=\"+Inf\"} %d\n", name, label, h.Count)
+			fmt.Fprintf(bw, "%s_sum{cache=\"%s\"} %s\n", name, label,
+				strconv.FormatFloat(h.Sum.Seconds(), 'g', -1, 64))
+			fmt.Fprintf(bw, "%s_count{cache=\"%s\"} %d\n", name, label, h.Count)
+		}
+	}
+	return bw.Flush()
+}
+
+// ServeHTTP 輸出 WritePrometheus 的內容，可以直接註冊到 http.ServeMux
+func (r *Registry) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = r.WritePrometheus(writer)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(val string) string {
+	return labelEscaper.Replace(val)
+}
@@ -0,0 +1,67 @@
+package stats
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type mockProvider Stats
+
+func (m mockProvider) Stats() Stats {
+	return Stats(m)
+}
+
+func TestRegistry_WritePrometheus(t *testing.T) {
+	reg := NewRegistry()
+	reg.Register("users", mockProvider{Hits: 3, Misses: 1, Keys: 2, UsedBytes: 100, MaxBytes: 1024})
+	reg.Register(`a"b`, mockProvider{Evictions: 5})
+	h := NewHistogram(time.Millisecond*10, time.Millisecond*500)
+	h.Observe(time.Millisecond * 5)
+	h.Observe(time.Millisecond * 20)
+	reg.RegisterHistogram("users", h)
+
+	var sb strings.Builder
+	require.NoError(t, reg.WritePrometheus(&sb))
+	out := sb.String()
+	for _, line := range []string{
+		"# TYPE cache_hits_total counter",
+		`cache_hits_total{cache="users"} 3`,
+		`cache_misses_total{cache="users"} 1`,
+		`cache_evictions_total{cache="a\"b"} 5`,
+		"# TYPE cache_keys gauge",
+		`cache_keys{cache="users"} 2`,
+		`cache_used_bytes{cache="users"} 100`,
+		`cache_max_bytes{cache="users"} 1024`,
+		"# TYPE cache_load_duration_seconds histogram",
+		`cache_load_duration_seconds_bucket{cache="users",le="0.01"} 1`,
+		`cache_load_duration_seconds_bucket{cache="users",le="0.5"} 2`,
+		`cache_load_duration_seconds_bucket{cache="users",le="+Inf"} 2`,
+		`cache_load_duration_seconds_sum{cache="users"} 0.025`,
+		`cache_load_duration_seconds_count{cache="users"} 2`,
+	} {
+		assert.Contains(t, out, line+"\n")
+	}
+	// 按照名字排序
+	assert.Less(t, strings.Index(out, `cache_hits_total{cache="a\"b"}`), strings.Index(out, `cache_hits_total{cache="users"}`))
+
+	reg.Unregister("users")
+	sb.Reset()
+	require.NoError(t, reg.WritePrometheus(&sb))
+	assert.NotContains(t, sb.String(), "users")
+	assert.NotContains(t, sb.String(), "cache_load_duration_seconds")
+}
+
+func TestRegistry_ServeHTTP(t *testing.T) {
+	reg := NewRegistry()
+	reg.Register("users", mockProvider{Hits: 1})
+	recorder := httptest.NewRecorder()
+	reg.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Header().Get("Content-Type"), "text/plain")
+	assert.Contains(t, recorder.Body.String(), `cache_hits_total{cache="users"} 1`)
+}
@@ -0,0 +1,128 @@
+// Package stats 緩存的統計數據、Prometheus 指標導出和調試接口
+//
+// cache 和 HW_memory_limit 都依賴這個包，所以這裡不能依賴它們
+//
+//	reg := stats.NewRegistry()
+//	reg.Register("users", localCache)
+//	reg.RegisterHistogram("users", loadingCache.LoadLatency())
+//	stats.Mount(server, "/debug/cache", reg)
+package stats
+
+import (
+	"sort"
+	"sync/atomic"
+)
+
+// Stats 某一時刻的統計數據
+type Stats struct {
+	Hits   uint64
+	Misses uint64
+	Sets   uint64
+	// Deletes 用戶主動刪除的次數
+	Deletes uint64
+	// Evictions 因為容量不足被淘汰的次數
+	Evictions uint64
+	// Expirations 因為過期被刪除的次數
+	Expirations uint64
+
+	Keys int
+	// UsedBytes 數據佔用的內存，無法計算具體大小的值為估算
+	UsedBytes int64
+	// MaxBytes 內存上限，0 表示沒有限制
+	MaxBytes int64
+}
+
+// HitRatio 命中率，沒有任何訪問的時候為 0
+func (s Stats) HitRatio() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+// Provider 可以提供統計數據的緩存
+type Provider interface {
+	Stats() Stats
+}
+
+// KeyInfo 單個 key 的統計數據
+type KeyInfo struct {
+	Key      string `json:"key"`
+	Size     int64  `json:"size"`
+	Accesses uint64 `json:"accesses"`
+}
+
+// KeyLister 可以列出所有 key 統計數據的緩存，用於調試接口
+type KeyLister interface {
+	KeyStats() []KeyInfo
+}
+
+const (
+	OrderBySize     = "size"
+	OrderByAccesses = "accesses"
+)
+
+// TopKeys 按照 orderBy 從大到小排序，返回前 n 個，會修改 keys
+func TopKeys(keys []KeyInfo, orderBy string, n int) []KeyInfo {
+	sort.Slice(keys, func(i, j int) bool {
+		if orderBy == OrderBySize {
+			if keys[i].Size != keys[j].Size {
+				return keys[i].Size > keys[j].Size
+			}
+		} else if keys[i].Accesses != keys[j].Accesses {
+			return keys[i].Accesses > keys[j].Accesses
+		}
+		return keys[i].Key < keys[j].Key
+	})
+	if n >= 0 && n < len(keys) {
+		keys = keys[:n]
+	}
+	return keys
+}
+
+// Counters 併發安全的計數器，嵌入到緩存裡面使用
+// Keys、UsedBytes、MaxBytes 由緩存自己填充
+type Counters struct {
+	hits        atomic.Uint64
+	misses      atomic.Uint64
+	sets        atomic.Uint64
+	deletes     atomic.Uint64
+	evictions   atomic.Uint64
+	expirations atomic.Uint64
+}
+
+func (c *Counters) Hit() {
+	c.hits.Add(1)
+}
+
+func (c *Counters) Miss() {
+	c.misses.Add(1)
+}
+
+func (c *Counters) Set() {
+	c.sets.Add(1)
+}
+
+func (c *Counters) Delete() {
+	c.deletes.Add(1)
+}
+
+func (c *Counters) Evict() {
+	c.evictions.Add(1)
+}
+
+func (c *Counters) Expire() {
+	c.expirations.Add(1)
+}
+
+func (c *Counters) Snapshot() Stats {
+	return Stats{
+		Hits:        c.hits.Load(),
+		Misses:      c.misses.Load(),
+		Sets:        c.sets.Load(),
+		Deletes:     c.deletes.Load(),
+		Evictions:   c.evictions.Load(),
+		Expirations: c.expirations.Load(),
+	}
+}
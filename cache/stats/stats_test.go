@@ -0,0 +1,66 @@
+package stats
+
+import (
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+)
+
+func TestCounters(t *testing.T) {
+	var c Counters
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Hit()
+			c.Hit()
+			c.Miss()
+			c.Set()
+			c.Delete()
+			c.Evict()
+			c.Expire()
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, Stats{
+		Hits: 20, Misses: 10, Sets: 10, Deletes: 10, Evictions: 10, Expirations: 10,
+	}, c.Snapshot())
+}
+
+func TestStats_HitRatio(t *testing.T) {
+	assert.Equal(t, float64(0), Stats{}.HitRatio())
+	assert.Equal(t, 0.75, Stats{Hits: 3, Misses: 1}.HitRatio())
+}
+
+func TestTopKeys(t *testing.T) {
+	keys := func() []KeyInfo {
+		return []KeyInfo{
+			{Key: "key1", Size: 10, Accesses: 1},
+			{Key: "key2", Size: 30, Accesses: 3},
+			{Key: "key3", Size: 20, Accesses: 3},
+			{Key: "key4", Size: 30, Accesses: 2},
+		}
+	}
+	testCases := []struct {
+		name    string
+		orderBy string
+		n       int
+		want    []string
+	}{
+		{name: "by size", orderBy: OrderBySize, n: 3, want: []string{"key2", "key4", "key3"}},
+		{name: "by accesses", orderBy: OrderByAccesses, n: 2, want: []string{"key2", "key3"}},
+		{name: "n larger than len", orderBy: OrderByAccesses, n: 10,
+			want: []string{"key2", "key3", "key4", "key1"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res := TopKeys(keys(), tc.orderBy, tc.n)
+			names := make([]string, 0, len(res))
+			for _, k := range res {
+				names = append(names, k.Key)
+			}
+			assert.Equal(t, tc.want, names)
+		})
+	}
+}
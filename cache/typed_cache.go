@@ -0,0 +1,97 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	errTypeMismatch = errors.New("cache: value type mismatch")
+)
+
+var _ CacheV2[any] = (*TypedCache[any])(nil)
+
+// TypedCache 在 Cache 的基礎上提供類型安全的 CacheV2 實現
+// 過期和淘汰都交給底層的 Cache，e.g. BuildInMapCache 或 BoundedCache
+//
+//	c := NewTypedCache[*User](NewBuildInMapCache(time.Second))
+//	u, err := c.Get(ctx, "user:1") // u 的類型為 *User
+type TypedCache[T any] struct {
+	cache Cache
+}
+
+func NewTypedCache[T any](cache Cache) *TypedCache[T] {
+	return &TypedCache[T]{cache: cache}
+}
+
+// NewLocalCache 使用 BuildInMapCache 作為底層實現
+func NewLocalCache[T any](interval time.Duration, opts ...BuildInMapCacheOption) *TypedCache[T] {
+	return NewTypedCache[T](NewBuildInMapCache(interval, opts...))
+}
+
+func (t *TypedCache[T]) Set(ctx context.Context, key string, value T, expiration time.Duration) error {
+	return t.cache.Set(ctx, key, value, expiration)
+}
+
+func (t *TypedCache[T]) Get(ctx context.Context, key string) (T, error) {
+	val, err := t.cache.Get(ctx, key)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return t.cast(key, val)
+}
+
+func (t *TypedCache[T]) Delete(ctx context.Context, key string) error {
+	return t.cache.Delete(ctx, key)
+}
+
+// LoadAndDelete 底層沒有實現 LoadAndDelete 的時候退化為 Get + Delete，不是原子操作
+func (t *TypedCache[T]) LoadAndDelete(ctx context.Context, key string) (T, error) {
+	var zero T
+	if c, ok := t.cache.(interface {
+		LoadAndDelete(ctx context.Context, key string) (any, error)
+	}); ok {
+		val, err := c.LoadAndDelete(ctx, key)
+		if err != nil {
+			return zero, err
+		}
+		return t.cast(key, val)
+	}
+	val, err := t.Get(ctx, key)
+	if err != nil {
+		return zero, err
+	}
+	return val, t.cache.Delete(ctx, key)
+}
+
+// OnEvicted 底層沒有實現 OnEvicted 的時候不會有任何效果
+// 類型不是 T 的值 (e.g. 別人直接寫進底層 Cache 的) 會被忽略
+func (t *TypedCache[T]) OnEvicted(f func(key string, val T)) {
+	c, ok := t.cache.(interface {
+		OnEvicted(func(key string, val any))
+	})
+	if !ok {
+		return
+	}
+	c.OnEvicted(func(key string, val any) {
+		if v, ok := val.(T); ok {
+			f(key, v)
+		}
+	})
+}
+
+// Unwrap 返回底層的 Cache
+func (t *TypedCache[T]) Unwrap() Cache {
+	return t.cache
+}
+
+func (t *TypedCache[T]) cast(key string, val any) (T, error) {
+	res, ok := val.(T)
+	if !ok {
+		return res, fmt.Errorf("%w, key: %s, want %T, got %T", errTypeMismatch, key, res, val)
+	}
+	return res, nil
+}
@@ -0,0 +1,67 @@
+package cache
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+type testUser struct {
+	Name string
+	Age  int
+}
+
+func TestTypedCache(t *testing.T) {
+	var evicted []testUser
+	c := NewLocalCache[*testUser](time.Second)
+	c.OnEvicted(func(key string, val *testUser) {
+		evicted = append(evicted, *val)
+	})
+	defer func() {
+		_ = c.Unwrap().(*BuildInMapCache).Close()
+	}()
+	ctx := context.Background()
+
+	require.NoError(t, c.Set(ctx, "tom", &testUser{Name: "Tom", Age: 18}, time.Minute))
+	u, err := c.Get(ctx, "tom")
+	require.NoError(t, err)
+	assert.Equal(t, &testUser{Name: "Tom", Age: 18}, u)
+
+	_, err = c.Get(ctx, "jerry")
+	assert.ErrorIs(t, err, errKeyNotFound)
+
+	// 繞過 TypedCache 直接寫入其他類型
+	require.NoError(t, c.Unwrap().Set(ctx, "bad", "not a user", time.Minute))
+	u, err = c.Get(ctx, "bad")
+	assert.ErrorIs(t, err, errTypeMismatch)
+	assert.Nil(t, u)
+
+	u, err = c.LoadAndDelete(ctx, "tom")
+	require.NoError(t, err)
+	assert.Equal(t, "Tom", u.Name)
+	_, err = c.Get(ctx, "tom")
+	assert.ErrorIs(t, err, errKeyNotFound)
+
+	// 類型不對的值不會觸發回調
+	require.NoError(t, c.Delete(ctx, "bad"))
+	assert.Equal(t, []testUser{{Name: "Tom", Age: 18}}, evicted)
+}
+
+func TestTypedCache_Bounded(t *testing.T) {
+	c := NewTypedCache[int](NewBoundedCache(2, NewLRUPolicy()))
+	ctx := context.Background()
+	for i, key := range []string{"a", "b", "c"} {
+		require.NoError(t, c.Set(ctx, key, i, 0))
+	}
+	_, err := c.Get(ctx, "a")
+	assert.ErrorIs(t, err, errKeyNotFound)
+
+	// BoundedCache 沒有 LoadAndDelete，退化為 Get + Delete
+	val, err := c.LoadAndDelete(ctx, "c")
+	require.NoError(t, err)
+	assert.Equal(t, 2, val)
+	_, err = c.Get(ctx, "c")
+	assert.ErrorIs(t, err, errKeyNotFound)
+}
@@ -16,3 +16,51 @@ type CacheV2[T any] interface {
 	Get(ctx context.Context, key string) (T, error)
 	Delete(ctx context.Context, key string) error
 }
+
+// NoExpiration TTL 返回的值，表示 key 沒有過期時間
+const NoExpiration time.Duration = -1
+
+// BatchCache 批量操作，在同一個鎖 (或者同一條命令) 裡面完成
+type BatchCache interface {
+	// MGet 只返回存在的 key
+	MGet(ctx context.Context, keys ...string) (map[string]any, error)
+	MSet(ctx context.Context, entries map[string]any, expiration time.Duration) error
+	// MDelete 返回真正刪除了的 key 的數量
+	MDelete(ctx context.Context, keys ...string) (int, error)
+}
+
+// AtomicCache 原子的讀改寫操作，不需要在外面加鎖
+type AtomicCache interface {
+	// SetNX key 不存在的時候才寫入，返回是否寫入了
+	SetNX(ctx context.Context, key string, value any, expiration time.Duration) (bool, error)
+	// GetAndSet 寫入新的值，返回舊的值，loaded 表示 key 原本是否存在
+	GetAndSet(ctx context.Context, key string, value any, expiration time.Duration) (old any, loaded bool, err error)
+	// GetWithVersion 返回值和它的版本，版本只能用於 CompareAndSwap
+	GetWithVersion(ctx context.Context, key string) (any, uint64, error)
+	// CompareAndSwap 版本和 GetWithVersion 返回的一樣的時候才寫入，返回是否寫入了
+	// version 為 0 表示 key 不存在的時候才寫入
+	CompareAndSwap(ctx context.Context, key string, version uint64, value any, expiration time.Duration) (bool, error)
+	// Incr key 不存在的時候從 0 開始，保留原本的過期時間
+	Incr(ctx context.Context, key string, delta int64) (int64, error)
+	Decr(ctx context.Context, key string, delta int64) (int64, error)
+}
+
+// TTLCache 過期時間相關的操作
+type TTLCache interface {
+	// TTL 剩餘的過期時間，沒有過期時間返回 NoExpiration
+	TTL(ctx context.Context, key string) (time.Duration, error)
+	// Expire 重新設置過期時間，不大於 0 的時候直接刪除，返回 key 是否存在
+	Expire(ctx context.Context, key string, expiration time.Duration) (bool, error)
+	// Persist 去掉過期時間，返回 key 是否存在並且原本有過期時間
+	Persist(ctx context.Context, key string) (bool, error)
+}
+
+// TagCache 可以給 key 加上標籤，按照標籤批量刪除
+// e.g. 用戶 42 的資料、權限都加上標籤 "user:42"，用戶更新之後 InvalidateTag(ctx, "user:42")
+type TagCache interface {
+	Cache
+	// SetWithTags 覆蓋已經存在的 key 的時候，原本的標籤會保留
+	SetWithTags(ctx context.Context, key string, value any, expiration time.Duration, tags ...string) error
+	// InvalidateTag 刪除帶有任意一個標籤的 key，返回刪除的數量
+	InvalidateTag(ctx context.Context, tags ...string) (int, error)
+}
@@ -0,0 +1,215 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var errWriteBackClosed = errors.New("cache: WriteBackCache 已經關閉")
+
+// BatchStoreFunc 把一批數據寫到數據源
+type BatchStoreFunc func(ctx context.Context, entries map[string]any) error
+
+// WriteBackCache 只寫緩存，把修改過的 key 記下來，定期批量寫回數據源
+// 累積的 key 達到 batchSize 的時候也會提前寫回，Close 的時候會把剩下的都寫回
+//
+// 寫回失敗的數據不會重試，透過 WriteBackCacheWithErrorHandler 交給用戶處理
+// Delete 只會刪除緩存和還沒寫回的修改，不會刪除數據源裡面的數據
+// Close 之後 Set 返回錯誤，因為修改已經沒有機會寫回
+type WriteBackCache struct {
+	Cache
+	store     BatchStoreFunc
+	batchSize int
+	timeout   time.Duration
+	onError   func(entries map[string]any, err error)
+
+	mu    sync.Mutex
+	dirty map[string]any
+	// 正在寫回的數據，每一批寫完之後才刪除，寫回的過程中 Get 依舊可以讀到
+	flushing map[string]any
+	// 保證同一時間只有一個 flush，寫回的順序和修改的順序一致
+	flushMu sync.Mutex
+
+	// Set 持有讀鎖，Close 持有寫鎖設置 closed
+	// 所以 Close 之前開始的 Set 都會進入 dirty，之後的都會失敗
+	closeMu  sync.RWMutex
+	isClosed bool
+
+	full      chan struct{}
+	close     chan struct{}
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+type WriteBackCacheOption func(cache *WriteBackCache)
+
+// NewWriteBackCache interval 為寫回的間隔
+func NewWriteBackCache(cache Cache, store BatchStoreFunc, interval time.Duration,
+	opts ...WriteBackCacheOption) *WriteBackCache {
+	res := &WriteBackCache{
+		Cache:     cache,
+		store:     store,
+		batchSize: 100,
+		timeout:   time.Second * 10,
+		onError:   func(entries map[string]any, err error) {},
+		dirty:     make(map[string]any, 16),
+		full:      make(chan struct{}, 1),
+		close:     make(chan struct{}),
+		closed:    make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(res)
+	}
+
+	go func() {
+		defer close(res.closed)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-res.full:
+			case <-res.close:
+				return
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), res.timeout)
+			_ = res.Flush(ctx)
+			cancel()
+		}
+	}()
+	return res
+}
+
+// WriteBackCacheWithBatchSize 每一批寫回的最大數量，也是觸發提前寫回的閾值
+func WriteBackCacheWithBatchSize(n int) WriteBackCacheOption {
+	return func(cache *WriteBackCache) {
+		cache.batchSize = n
+	}
+}
+
+// WriteBackCacheWithTimeout 定期寫回的時候每一次 Flush 的超時時間
+func WriteBackCacheWithTimeout(timeout time.Duration) WriteBackCacheOption {
+	return func(cache *WriteBackCache) {
+		cache.timeout = timeout
+	}
+}
+
+// WriteBackCacheWithErrorHandler 寫回失敗的回調，entries 為寫失敗的那一批數據
+func WriteBackCacheWithErrorHandler(f func(entries map[string]any, err error)) WriteBackCacheOption {
+	return func(cache *WriteBackCache) {
+		cache.onError = f
+	}
+}
+
+func (w *WriteBackCache) Set(ctx context.Context, key string, value any, expiration time.Duration) error {
+	w.closeMu.RLock()
+	defer w.closeMu.RUnlock()
+	if w.isClosed {
+		return errWriteBackClosed
+	}
+	if err := w.Cache.Set(ctx, key, value, expiration); err != nil {
+		return err
+	}
+	w.mu.Lock()
+	w.dirty[key] = value
+	full := len(w.dirty) >= w.batchSize
+	w.mu.Unlock()
+	if full {
+		select {
+		case w.full <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Get 緩存裡面沒有，但是還沒寫回或者正在寫回的 (e.g. 已經過期或者被淘汰) 也能讀到
+func (w *WriteBackCache) Get(ctx context.Context, key string) (any, error) {
+	val, err := w.Cache.Get(ctx, key)
+	if !errors.Is(err, errKeyNotFound) {
+		return val, err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if v, ok := w.dirty[key]; ok {
+		return v, nil
+	}
+	if v, ok := w.flushing[key]; ok {
+		return v, nil
+	}
+	return val, err
+}
+
+// Delete 正在寫回的修改沒辦法撤回，但是之後不會再被讀到
+func (w *WriteBackCache) Delete(ctx context.Context, key string) error {
+	w.mu.Lock()
+	delete(w.dirty, key)
+	delete(w.flushing, key)
+	w.mu.Unlock()
+	return w.Cache.Delete(ctx, key)
+}
+
+// Flush 馬上把所有修改寫回數據源，返回第一個錯誤
+// 每一批失敗的數據都會交給錯誤回調
+func (w *WriteBackCache) Flush(ctx context.Context) error {
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+
+	// 先分好批，寫回的過程中 flushing 可能被 Delete 修改
+	w.mu.Lock()
+	batches := make([]map[string]any, 0, len(w.dirty)/w.batchSize+1)
+	batch := make(map[string]any, w.batchSize)
+	for key, val := range w.dirty {
+		batch[key] = val
+		if len(batch) == w.batchSize {
+			batches = append(batches, batch)
+			batch = make(map[string]any, w.batchSize)
+		}
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+	w.flushing = w.dirty
+	w.dirty = make(map[string]any, len(w.flushing))
+	w.mu.Unlock()
+
+	var res error
+	for _, batch := range batches {
+		if err := w.flush(ctx, batch); err != nil && res == nil {
+			res = err
+		}
+		// 不管成功與否都不會重試，所以寫完就不再從 flushing 讀
+		w.mu.Lock()
+		for key := range batch {
+			delete(w.flushing, key)
+		}
+		w.mu.Unlock()
+	}
+	return res
+}
+
+func (w *WriteBackCache) flush(ctx context.Context, batch map[string]any) error {
+	err := w.store(ctx, batch)
+	if err != nil {
+		w.onError(batch, err)
+	}
+	return err
+}
+
+// Close 停止定期寫回，並且把剩下的修改寫回數據源
+// 不會關閉底層的 Cache
+func (w *WriteBackCache) Close(ctx context.Context) error {
+	err := errWriteBackClosed
+	w.closeOnce.Do(func() {
+		w.closeMu.Lock()
+		w.isClosed = true
+		w.closeMu.Unlock()
+		close(w.close)
+		// 等待正在進行的定期寫回結束
+		<-w.closed
+		err = w.Flush(ctx)
+	})
+	return err
+}
@@ -0,0 +1,165 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWriteBackCache_Flush(t *testing.T) {
+	db := &mockDB{data: map[string]any{}}
+	c := NewWriteBackCache(NewBuildInMapCache(time.Minute), db.store, time.Hour)
+	ctx := context.Background()
+
+	for i := 0; i < 7; i++ {
+		require.NoError(t, c.Set(ctx, "key"+strconv.Itoa(i%5), i, time.Minute))
+	}
+	require.NoError(t, c.Delete(ctx, "key4"))
+	// 還沒寫回
+	assert.Equal(t, 0, db.len())
+
+	// 寫完再調小，避免觸發提前寫回
+	c.batchSize = 3
+	require.NoError(t, c.Flush(ctx))
+	assert.Equal(t, map[string]any{"key0": 5, "key1": 6, "key2": 2, "key3": 3}, db.snapshot())
+	// 4 個 key，每批 3 個
+	assert.Equal(t, 2, db.batches)
+
+	// 沒有修改的時候不會寫
+	require.NoError(t, c.Flush(ctx))
+	assert.Equal(t, 2, db.batches)
+	require.NoError(t, c.Close(ctx))
+	assert.Error(t, c.Close(ctx))
+}
+
+func TestWriteBackCache_Periodic(t *testing.T) {
+	db := &mockDB{data: map[string]any{}}
+	c := NewWriteBackCache(NewBuildInMapCache(time.Minute), db.store, time.Millisecond*10)
+	require.NoError(t, c.Set(context.Background(), "key1", "val1", time.Minute))
+	assert.Eventually(t, func() bool {
+		return db.len() == 1
+	}, time.Second, time.Millisecond*10)
+	require.NoError(t, c.Close(context.Background()))
+}
+
+func TestWriteBackCache_BatchFull(t *testing.T) {
+	db := &mockDB{data: map[string]any{}}
+	c := NewWriteBackCache(NewBuildInMapCache(time.Minute), db.store, time.Hour,
+		WriteBackCacheWithBatchSize(2))
+	require.NoError(t, c.Set(context.Background(), "key1", "val1", time.Minute))
+	require.NoError(t, c.Set(context.Background(), "key2", "val2", time.Minute))
+	// 達到 batchSize 提前寫回
+	assert.Eventually(t, func() bool {
+		return db.len() == 2
+	}, time.Second, time.Millisecond*10)
+	require.NoError(t, c.Close(context.Background()))
+}
+
+func TestWriteBackCache_Close(t *testing.T) {
+	errDB := errors.New("db error")
+	var (
+		failed map[string]any
+		gotErr error
+	)
+	db := &mockDB{data: map[string]any{}, err: errDB}
+	c := NewWriteBackCache(NewBuildInMapCache(time.Minute), db.store, time.Hour,
+		WriteBackCacheWithErrorHandler(func(entries map[string]any, err error) {
+			failed, gotErr = entries, err
+		}))
+	require.NoError(t, c.Set(context.Background(), "key1", "val1", time.Millisecond))
+	time.Sleep(time.Millisecond * 10)
+
+	// 緩存已經過期，但是還沒寫回，照樣可以讀到
+	val, err := c.Get(context.Background(), "key1")
+	require.NoError(t, err)
+	assert.Equal(t, "val1", val)
+
+	// Close 的時候寫回，錯誤交給回調
+	assert.Equal(t, errDB, c.Close(context.Background()))
+	assert.Equal(t, errDB, gotErr)
+	assert.Equal(t, map[string]any{"key1": "val1"}, failed)
+	_, err = c.Get(context.Background(), "key1")
+	assert.ErrorIs(t, err, errKeyNotFound)
+
+	// 關閉之後的修改沒有機會寫回
+	assert.Equal(t, errWriteBackClosed, c.Set(context.Background(), "key2", "val2", time.Minute))
+	_, err = c.Get(context.Background(), "key2")
+	assert.ErrorIs(t, err, errKeyNotFound)
+}
+
+func TestWriteBackCache_Flushing(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	db := &mockDB{data: map[string]any{}}
+	c := NewWriteBackCache(NewBuildInMapCache(time.Minute), func(ctx context.Context, entries map[string]any) error {
+		close(started)
+		<-release
+		return db.store(ctx, entries)
+	}, time.Hour)
+	ctx := context.Background()
+	require.NoError(t, c.Set(ctx, "key1", "val1", time.Millisecond))
+	require.NoError(t, c.Set(ctx, "key2", "val2", time.Millisecond))
+	time.Sleep(time.Millisecond * 10)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.Flush(ctx)
+	}()
+	<-started
+	// 正在寫回的數據依舊可以讀到
+	val, err := c.Get(ctx, "key1")
+	require.NoError(t, err)
+	assert.Equal(t, "val1", val)
+	// 刪除之後讀不到，但是已經在寫的那一批沒辦法撤回
+	require.NoError(t, c.Delete(ctx, "key2"))
+	_, err = c.Get(ctx, "key2")
+	assert.ErrorIs(t, err, errKeyNotFound)
+
+	close(release)
+	require.NoError(t, <-done)
+	assert.Equal(t, map[string]any{"key1": "val1", "key2": "val2"}, db.snapshot())
+	// 寫回之後只能從數據源讀
+	_, err = c.Get(ctx, "key1")
+	assert.ErrorIs(t, err, errKeyNotFound)
+	require.NoError(t, c.Close(ctx))
+}
+
+type mockDB struct {
+	mu      sync.Mutex
+	data    map[string]any
+	batches int
+	err     error
+}
+
+func (m *mockDB) store(ctx context.Context, entries map[string]any) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	m.batches++
+	for k, v := range entries {
+		m.data[k] = v
+	}
+	return nil
+}
+
+func (m *mockDB) len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.data)
+}
+
+func (m *mockDB) snapshot() map[string]any {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	res := make(map[string]any, len(m.data))
+	for k, v := range m.data {
+		res[k] = v
+	}
+	return res
+}
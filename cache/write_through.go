@@ -0,0 +1,56 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// StoreFunc 把數據寫到數據源 (e.g. DB)
+type StoreFunc func(ctx context.Context, key string, val any) error
+
+// WriteThroughCache 寫緩存的同時寫數據源
+// 預設先寫數據源，成功之後再寫緩存；數據源寫失敗的時候緩存不會被修改
+type WriteThroughCache struct {
+	Cache
+	store      StoreFunc
+	cacheFirst bool
+}
+
+type WriteThroughCacheOption func(cache *WriteThroughCache)
+
+func NewWriteThroughCache(cache Cache, store StoreFunc, opts ...WriteThroughCacheOption) *WriteThroughCache {
+	res := &WriteThroughCache{
+		Cache: cache,
+		store: store,
+	}
+	for _, opt := range opts {
+		opt(res)
+	}
+	return res
+}
+
+// WriteThroughCacheWithCacheFirst 先寫緩存再寫數據源
+// 數據源寫失敗的時候會刪除緩存，避免讀到沒有持久化的數據
+func WriteThroughCacheWithCacheFirst() WriteThroughCacheOption {
+	return func(cache *WriteThroughCache) {
+		cache.cacheFirst = true
+	}
+}
+
+func (w *WriteThroughCache) Set(ctx context.Context, key string, value any, expiration time.Duration) error {
+	if !w.cacheFirst {
+		if err := w.store(ctx, key, value); err != nil {
+			return err
+		}
+		return w.Cache.Set(ctx, key, value, expiration)
+	}
+
+	if err := w.Cache.Set(ctx, key, value, expiration); err != nil {
+		return err
+	}
+	if err := w.store(ctx, key, value); err != nil {
+		_ = w.Cache.Delete(ctx, key)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestWriteThroughCache_Set(t *testing.T) {
+	errDB := errors.New("db error")
+	testCases := []struct {
+		name  string
+		cache func() Cache
+		store func(db map[string]any) StoreFunc
+		opts  []WriteThroughCacheOption
+
+		wantErr   error
+		wantDB    map[string]any
+		wantCache bool
+	}{
+		{
+			name: "store first",
+			cache: func() Cache {
+				return NewBuildInMapCache(time.Minute)
+			},
+			store: func(db map[string]any) StoreFunc {
+				return func(ctx context.Context, key string, val any) error {
+					db[key] = val
+					return nil
+				}
+			},
+			wantDB:    map[string]any{"key1": "val1"},
+			wantCache: true,
+		},
+		{
+			name: "store error",
+			cache: func() Cache {
+				return NewBuildInMapCache(time.Minute)
+			},
+			store: func(db map[string]any) StoreFunc {
+				return func(ctx context.Context, key string, val any) error {
+					return errDB
+				}
+			},
+			wantErr: errDB,
+			wantDB:  map[string]any{},
+		},
+		{
+			name: "cache error",
+			cache: func() Cache {
+				return &errCache{Cache: NewBuildInMapCache(time.Minute), setErr: errDB}
+			},
+			store: func(db map[string]any) StoreFunc {
+				return func(ctx context.Context, key string, val any) error {
+					db[key] = val
+					return nil
+				}
+			},
+			// 數據源已經寫成功了
+			wantErr: errDB,
+			wantDB:  map[string]any{"key1": "val1"},
+		},
+		{
+			name: "cache first",
+			cache: func() Cache {
+				return NewBuildInMapCache(time.Minute)
+			},
+			store: func(db map[string]any) StoreFunc {
+				return func(ctx context.Context, key string, val any) error {
+					db[key] = val
+					return nil
+				}
+			},
+			opts:      []WriteThroughCacheOption{WriteThroughCacheWithCacheFirst()},
+			wantDB:    map[string]any{"key1": "val1"},
+			wantCache: true,
+		},
+		{
+			// 數據源寫失敗，緩存會被刪除
+			name: "cache first store error",
+			cache: func() Cache {
+				return NewBuildInMapCache(time.Minute)
+			},
+			store: func(db map[string]any) StoreFunc {
+				return func(ctx context.Context, key string, val any) error {
+					return errDB
+				}
+			},
+			opts:    []WriteThroughCacheOption{WriteThroughCacheWithCacheFirst()},
+			wantErr: errDB,
+			wantDB:  map[string]any{},
+		},
+		{
+			name: "cache first cache error",
+			cache: func() Cache {
+				return &errCache{Cache: NewBuildInMapCache(time.Minute), setErr: errDB}
+			},
+			store: func(db map[string]any) StoreFunc {
+				return func(ctx context.Context, key string, val any) error {
+					db[key] = val
+					return nil
+				}
+			},
+			opts:    []WriteThroughCacheOption{WriteThroughCacheWithCacheFirst()},
+			wantErr: errDB,
+			wantDB:  map[string]any{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			db := map[string]any{}
+			underlying := tc.cache()
+			c := NewWriteThroughCache(underlying, tc.store(db), tc.opts...)
+			err := c.Set(context.Background(), "key1", "val1", time.Minute)
+			assert.Equal(t, tc.wantErr, err)
+			assert.Equal(t, tc.wantDB, db)
+			val, err := underlying.Get(context.Background(), "key1")
+			if !tc.wantCache {
+				assert.ErrorIs(t, err, errKeyNotFound)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, "val1", val)
+		})
+	}
+}
@@ -19,6 +19,7 @@ var authSessions = cache.New(time.Minute*15, time.Second)
 
 // 模擬單機登入，把 SSO 驗證服務器 與 業務服務器 放一起
 func TestAuthServer(t *testing.T) {
+	skipUnlessManual(t)
 	whiteList := map[string]string{
 		"server_geek": "http://geek.com:8081/callback?code=",
 		"server_a":    "http://aaa.com:8081/token",
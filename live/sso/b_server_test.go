@@ -18,6 +18,14 @@ var bSessions = cache.New(15*time.Minute, time.Second)
 
 // 在業務服務器上，模擬單機登入過程
 func testBizServer_B(t *testing.T) {
+	server := newBizServerB(t, &http.Client{})
+	err := server.Start(":8082")
+	t.Log(err)
+}
+
+// newBizServerB 註冊業務服務器的路由，不啟動監聽
+// client 用來調用 SSO 服務器
+func newBizServerB(t *testing.T, client *http.Client) *web.HttpServer {
 	server := web.NewHttpServer(web.ServerWithMiddlewares(LoginMiddlewareServerB))
 	// 需要登入才看得到，如何處理？
 	// 要判斷是否有登入， 這邊透過 middleware 進行登入檢驗
@@ -44,7 +52,7 @@ func testBizServer_B(t *testing.T) {
 			return
 		}
 		t.Log(req)
-		resp, err := (&http.Client{}).Do(req)
+		resp, err := client.Do(req)
 		if err != nil {
 			_ = ctx.RespServerError("Biz server - B: 解析 token 失敗")
 			return
@@ -66,8 +74,7 @@ func testBizServer_B(t *testing.T) {
 		// 登入成功，跳回最一開始的 /profile 頁面
 		http.Redirect(ctx.Resp, ctx.Req, "http://bbb.com:8082/profile", http.StatusFound)
 	})
-	err := server.Start(":8082")
-	t.Log(err)
+	return server
 }
 
 // 登入驗證的 Middleware
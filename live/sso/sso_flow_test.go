@@ -0,0 +1,55 @@
+package sso
+
+import (
+	"geektime-go/web"
+	"geektime-go/web/webtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"html/template"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+// TestSSOFlow 不監聽端口，在進程內模擬 aaa.com、bbb.com 透過 sso.com 單點登入
+func TestSSOFlow(t *testing.T) {
+	tpl, err := template.ParseGlob("template/*.gohtml")
+	require.NoError(t, err)
+	engine := webtest.NewTemplateRecorder(&web.GoTemplateEngine{T: tpl})
+
+	c := webtest.NewClient(t, nil)
+	// 業務服務器調用 SSO 服務器，也走進程內的 client
+	c.Host("sso.com", newSSOServer(engine)).
+		Host("aaa.com", newBizServerA(t, c.HTTPClient())).
+		Host("bbb.com", newBizServerB(t, c.HTTPClient()))
+
+	// 沒有登入，跳轉到 SSO 的登入頁面
+	resp := c.Get("http://aaa.com:8081/profile").Do().
+		AssertStatus(http.StatusOK).
+		AssertURL("http://sso.com:8080/login?client_id=server_a")
+	assert.Equal(t, map[string]string{"ClientId": "server_a"}, resp.AssertTemplate("login.gohtml"))
+
+	// 帳號密碼錯誤
+	c.Post("http://sso.com:8080/login").Form(url.Values{
+		"email":     []string{"abc@biz.com"},
+		"password":  []string{"wrong"},
+		"client_id": []string{"server_a"},
+	}).Do().AssertStatus(http.StatusInternalServerError)
+
+	// 登入成功，經過 aaa.com/token 換取 token 之後，回到 profile
+	c.Post("http://sso.com:8080/login").Form(url.Values{
+		"email":     []string{"abc@biz.com"},
+		"password":  []string{"123"},
+		"client_id": []string{"server_a"},
+	}).Do().
+		AssertStatus(http.StatusOK).
+		AssertURL("http://aaa.com:8081/profile").
+		AssertJSON("Name", "Tom")
+
+	// bbb.com 不需要再輸入帳號密碼
+	resp = c.Get("http://bbb.com:8082/profile").Do().
+		AssertStatus(http.StatusOK).
+		AssertURL("http://bbb.com:8082/profile").
+		AssertJSON("Name", "Tom B")
+	assert.Empty(t, resp.Templates())
+}
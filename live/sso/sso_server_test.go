@@ -8,6 +8,7 @@ import (
 	"html/template"
 	"io"
 	"net/http"
+	"os"
 	"testing"
 	"time"
 )
@@ -16,15 +17,41 @@ import (
 var ssoSession = cache.New(time.Minute*15, time.Second)
 
 // 模擬單機登入，把 SSO 驗證服務器 與 業務服務器 放一起
+// 監聽真實的端口並且一直阻塞，用於在瀏覽器手動驗證，自動化的測試見 TestSSOFlow
 func TestSSOServer(t *testing.T) {
+	skipUnlessManual(t)
+	tpl, err := template.ParseGlob("template/*.gohtml")
+	require.NoError(t, err)
+	server := newSSOServer(&web.GoTemplateEngine{T: tpl})
+
+	// server a
+	go func() {
+		testBizServer_A(t)
+	}()
+
+	// server b
+	go func() {
+		testBizServer_B(t)
+	}()
+
+	err = server.Start(":8080")
+	t.Log(err)
+}
+
+// skipUnlessManual 需要監聽端口的手動測試，設置了 SSO_MANUAL 才運行
+// e.g. SSO_MANUAL=1 go test -run TestSSOServer ./live/sso
+func skipUnlessManual(t *testing.T) {
+	if os.Getenv("SSO_MANUAL") == "" {
+		t.Skip("手動測試，設置 SSO_MANUAL 之後運行")
+	}
+}
+
+// newSSOServer 註冊 SSO 服務器的路由，不啟動監聽
+func newSSOServer(engine web.TemplateEngine) *web.HttpServer {
 	whiteList := map[string]string{
 		"server_a": "http://aaa.com:8081/token",
 		"server_b": "http://bbb.com:8082/token",
 	}
-	tpl, err := template.ParseGlob("template/*.gohtml")
-	require.NoError(t, err)
-	engine := &web.GoTemplateEngine{T: tpl}
-
 	server := web.NewHttpServer(web.ServerWithTemplateEngine(engine))
 	server.Get("/login", func(ctx *web.Context) {
 		// 要判斷是否有登入， 這邊透過 middleware 進行登入檢驗
@@ -55,10 +82,6 @@ func TestSSOServer(t *testing.T) {
 
 	// 模擬登入, login.gohtml
 	server.Post("/login", func(ctx *web.Context) {
-		if err != nil {
-			ctx.RespServerError("SSO server: 系統錯誤")
-			return
-		}
 		// Verify data
 		email, _ := ctx.FormValue("email")
 		password, _ := ctx.FormValue("password")
@@ -118,18 +141,7 @@ func TestSSOServer(t *testing.T) {
 		})
 	})
 
-	// server a
-	go func() {
-		testBizServer_A(t)
-	}()
-
-	// server b
-	go func() {
-		testBizServer_B(t)
-	}()
-
-	err = server.Start(":8080")
-	t.Log(err)
+	return server
 }
 
 type User struct {
@@ -11,13 +11,30 @@ import (
 	"net"
 	"reflect"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// ErrServerClosed Shutdown 之后 Serve 和 Start 返回的错误
+var ErrServerClosed = errors.New("micro: 服务端已关闭")
+
+// shutdownPollInterval Shutdown 检查连接是否空闲的间隔
+const shutdownPollInterval = time.Millisecond * 10
+
 type Server struct {
 	services    map[string]reflectionStub
 	serializers map[uint8]serialize.Serializer
 	compressors map[uint8]compressor.Compressor
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	// 连接是否正在处理请求，Shutdown 只关闭空闲的连接
+	conns  map[net.Conn]bool
+	closed bool
+
+	reject   atomic.Bool
+	inflight atomic.Int64
 }
 
 func NewServer() *Server {
@@ -25,6 +42,8 @@ func NewServer() *Server {
 		services:    make(map[string]reflectionStub, 16),
 		serializers: make(map[uint8]serialize.Serializer, 4),
 		compressors: make(map[uint8]compressor.Compressor, 4),
+		listeners:   make(map[net.Listener]struct{}, 1),
+		conns:       make(map[net.Conn]bool, 16),
 	}
 	res.RegisterSerializer(&json.Serializer{})
 	res.RegisterCompressor(compressor.DefaultCompressor{})
@@ -54,13 +73,37 @@ func (s *Server) Start(network, addr string) error {
 		// 比较常见的就是端口被占用
 		return err
 	}
+	return s.Serve(listener)
+}
+
+// Serve 阻塞直到 listener 出错，Shutdown 之后返回 ErrServerClosed
+func (s *Server) Serve(listener net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		_ = listener.Close()
+		return ErrServerClosed
+	}
+	s.listeners[listener] = struct{}{}
+	s.mu.Unlock()
 
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
 			return err
 		}
+		if !s.trackConn(conn) {
+			_ = conn.Close()
+			continue
+		}
 		go func() {
+			defer s.untrackConn(conn)
 			if er := s.handleConn(conn); er != nil {
 				_ = conn.Close()
 			}
@@ -68,13 +111,121 @@ func (s *Server) Start(network, addr string) error {
 	}
 }
 
+// RejectNew 之后收到的请求直接返回错误，正在处理的请求不受影响
+func (s *Server) RejectNew() {
+	s.reject.Store(true)
+}
+
+// Inflight 正在处理的请求数量，包括被拒绝的请求
+func (s *Server) Inflight() int64 {
+	return s.inflight.Load()
+}
+
+// Shutdown 关闭所有的 listener，等待正在处理的请求结束之后关闭连接
+// ctx 超时的时候直接关闭所有的连接，返回 ctx.Err()
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.reject.Store(true)
+	s.mu.Lock()
+	s.closed = true
+	for l := range s.listeners {
+		_ = l.Close()
+	}
+	s.listeners = nil
+	s.mu.Unlock()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		if s.closeIdleConns() {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			s.mu.Lock()
+			for conn := range s.conns {
+				_ = conn.Close()
+			}
+			s.mu.Unlock()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// closeIdleConns 关闭空闲的连接，返回是否所有的连接都关闭了
+func (s *Server) closeIdleConns() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn, active := range s.conns {
+		if !active {
+			_ = conn.Close()
+			delete(s.conns, conn)
+		}
+	}
+	return len(s.conns) == 0
+}
+
+func (s *Server) trackConn(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	s.conns[conn] = false
+	return true
+}
+
+func (s *Server) untrackConn(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, conn)
+}
+
+// activate 标记连接正在处理请求，连接已经被 Shutdown 关闭的时候返回 false
+// 和 closeIdleConns 使用同一把锁，标记之后 Shutdown 就只会等待，不会关闭这个连接
+func (s *Server) activate(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.conns[conn]; !ok {
+		return false
+	}
+	s.conns[conn] = true
+	return true
+}
+
+// beginRequest 计数并返回是否拒绝这个请求，连接在读请求之前已经由 activate 标记
+// 先计数再检查 reject，RejectNew 之后 Inflight 为 0 就不会再有请求被处理
+func (s *Server) beginRequest() bool {
+	s.inflight.Add(1)
+	return s.reject.Load()
+}
+
+func (s *Server) endRequest(conn net.Conn) {
+	s.mu.Lock()
+	if _, ok := s.conns[conn]; ok {
+		s.conns[conn] = false
+	}
+	s.mu.Unlock()
+	s.inflight.Add(-1)
+}
+
 // 我们可以认为，一个请求包含两部分
 // 1. 长度字段：用八个字节表示
 // 2. 请求数据：
 // 响应也是这个规范
 func (s *Server) handleConn(conn net.Conn) error {
 	for {
-		reqBs, err := ReadMsg(conn)
+		// 等待下一个请求的时候连接是空闲的
+		lenBs, err := readLength(conn)
+		if err != nil {
+			return err
+		}
+		// 读到长度字段就标记连接正在处理，再读剩下的数据
+		// 否则 Shutdown 可能在读完请求之后、处理之前关闭连接，请求被丢掉
+		if !s.activate(conn) {
+			return ErrServerClosed
+		}
+		reqBs, err := readBody(conn, lenBs)
 		if err != nil {
 			return err
 		}
@@ -84,35 +235,53 @@ func (s *Server) handleConn(conn net.Conn) error {
 		if err != nil {
 			return err
 		}
-		ctx := context.Background()
-		cancel := func() {}
-		log.Println(req.Meta)
-		if deadlineStr, ok := req.Meta["deadline"]; ok {
-			log.Println(deadlineStr)
-			if deadline, er := strconv.ParseInt(deadlineStr, 10, 64); er == nil {
-				log.Println(deadline)
-				ctx, cancel = context.WithDeadline(ctx, time.UnixMilli(deadline))
-			}
-		}
-		oneway, ok := req.Meta["one-way"]
-		if ok && oneway == "true" {
-			ctx = CtxWithOneway(ctx)
-		}
-		resp, err := s.Invoke(ctx, req)
-		cancel()
-		if err != nil {
-			// 处理业务 error
-			resp.Error = []byte(err.Error())
+		if err = s.serveReq(conn, req); err != nil {
+			return err
 		}
+	}
+}
 
+// serveReq 处理一个请求，处理结束之后连接重新变为空闲
+func (s *Server) serveReq(conn net.Conn, req *message.Request) error {
+	defer s.endRequest(conn)
+	if s.beginRequest() {
+		resp := &message.Response{
+			RequestID:  req.RequestID,
+			Version:    req.Version,
+			Compressor: req.Compressor,
+			Serializer: req.Serializer,
+			Error:      []byte(ErrServerClosed.Error()),
+		}
 		resp.CalculateHeaderLength()
 		resp.CalculateBodyLength()
-		_, err = conn.Write(message.EncodeResp(resp))
-
-		if err != nil {
-			return err
+		_, err := conn.Write(message.EncodeResp(resp))
+		return err
+	}
+	ctx := context.Background()
+	cancel := func() {}
+	log.Println(req.Meta)
+	if deadlineStr, ok := req.Meta["deadline"]; ok {
+		log.Println(deadlineStr)
+		if deadline, er := strconv.ParseInt(deadlineStr, 10, 64); er == nil {
+			log.Println(deadline)
+			ctx, cancel = context.WithDeadline(ctx, time.UnixMilli(deadline))
 		}
 	}
+	oneway, ok := req.Meta["one-way"]
+	if ok && oneway == "true" {
+		ctx = CtxWithOneway(ctx)
+	}
+	resp, err := s.Invoke(ctx, req)
+	cancel()
+	if err != nil {
+		// 处理业务 error
+		resp.Error = []byte(err.Error())
+	}
+
+	resp.CalculateHeaderLength()
+	resp.CalculateBodyLength()
+	_, err = conn.Write(message.EncodeResp(resp))
+	return err
 }
 
 func (s *Server) Invoke(ctx context.Context, req *message.Request) (*message.Response, error) {
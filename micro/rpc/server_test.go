@@ -0,0 +1,171 @@
+package rpc
+
+import (
+	"context"
+	"geektime-go/micro/rpc/Compressor"
+	"geektime-go/micro/rpc/message"
+	"geektime-go/micro/rpc/serialize/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type slowService struct {
+	delay time.Duration
+}
+
+type slowReq struct {
+	Msg string
+}
+
+type slowResp struct {
+	Msg string
+}
+
+func (s *slowService) Name() string {
+	return "slow-service"
+}
+
+func (s *slowService) Echo(ctx context.Context, req *slowReq) (*slowResp, error) {
+	time.Sleep(s.delay)
+	return &slowResp{Msg: req.Msg}, nil
+}
+
+// call 直接用 TCP 发送请求，返回响应的错误信息
+func call(t *testing.T, conn net.Conn, id uint32) string {
+	req := &message.Request{
+		RequestID:   id,
+		Serializer:  (&json.Serializer{}).Code(),
+		Compressor:  compressor.DefaultCompressor{}.Code(),
+		ServiceName: "slow-service",
+		MethodName:  "Echo",
+		Data:        []byte(`{"Msg":"hello"}`),
+	}
+	req.CalculateHeaderLength()
+	req.CalculateBodyLength()
+	_, err := conn.Write(message.EncodeReq(req))
+	require.NoError(t, err)
+	data, err := ReadMsg(conn)
+	require.NoError(t, err)
+	resp := message.DecodeResp(data)
+	assert.Equal(t, id, resp.RequestID)
+	return string(resp.Error)
+}
+
+func TestServer_Shutdown(t *testing.T) {
+	s := NewServer()
+	s.RegisterService(&slowService{delay: time.Millisecond * 100})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- s.Serve(l)
+	}()
+
+	busy, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer busy.Close()
+	idle, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer idle.Close()
+	assert.Equal(t, "", call(t, idle, 1))
+
+	// 正在处理的请求会正常返回
+	done := make(chan string, 1)
+	go func() {
+		done <- call(t, busy, 2)
+	}()
+	time.Sleep(time.Millisecond * 20)
+	assert.Equal(t, int64(1), s.Inflight())
+	s.RejectNew()
+	assert.Equal(t, ErrServerClosed.Error(), call(t, idle, 3))
+
+	require.NoError(t, s.Shutdown(context.Background()))
+	assert.Equal(t, "", <-done)
+	assert.Equal(t, int64(0), s.Inflight())
+	assert.Equal(t, ErrServerClosed, <-serveErr)
+	// 空闲的连接已经被关闭了
+	_, err = ReadMsg(idle)
+	assert.Error(t, err)
+	_, err = net.DialTimeout("tcp", l.Addr().String(), time.Millisecond*100)
+	assert.Error(t, err)
+}
+
+func TestServer_ShutdownTimeout(t *testing.T) {
+	s := NewServer()
+	s.RegisterService(&slowService{delay: time.Second})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		_ = s.Serve(l)
+	}()
+	conn, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	req := &message.Request{
+		RequestID:   1,
+		Serializer:  (&json.Serializer{}).Code(),
+		ServiceName: "slow-service",
+		MethodName:  "Echo",
+		Data:        []byte(`{}`),
+	}
+	req.CalculateHeaderLength()
+	req.CalculateBodyLength()
+	_, err = conn.Write(message.EncodeReq(req))
+	require.NoError(t, err)
+	time.Sleep(time.Millisecond * 20)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, s.Shutdown(ctx))
+}
+
+func TestServer_ShutdownPartialRequest(t *testing.T) {
+	s := NewServer()
+	s.RegisterService(&slowService{})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		_ = s.Serve(l)
+	}()
+	conn, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	req := &message.Request{
+		RequestID:   1,
+		Serializer:  (&json.Serializer{}).Code(),
+		Compressor:  compressor.DefaultCompressor{}.Code(),
+		ServiceName: "slow-service",
+		MethodName:  "Echo",
+		Data:        []byte(`{"Msg":"hello"}`),
+	}
+	req.CalculateHeaderLength()
+	req.CalculateBodyLength()
+	data := message.EncodeReq(req)
+	// 只發送了長度字段，連接已經不是空閒的，Shutdown 要等這個請求處理完
+	_, err = conn.Write(data[:numOfLengthBytes])
+	require.NoError(t, err)
+	time.Sleep(time.Millisecond * 20)
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- s.Shutdown(context.Background())
+	}()
+	time.Sleep(time.Millisecond * 20)
+	select {
+	case <-shutdown:
+		t.Fatal("Shutdown 不應該關閉正在讀請求的連接")
+	default:
+	}
+
+	// Shutdown 之後的請求被拒絕，但是客戶端可以收到響應
+	_, err = conn.Write(data[numOfLengthBytes:])
+	require.NoError(t, err)
+	resp, err := ReadMsg(conn)
+	require.NoError(t, err)
+	assert.Equal(t, ErrServerClosed.Error(), string(message.DecodeResp(resp).Error))
+	require.NoError(t, <-shutdown)
+}
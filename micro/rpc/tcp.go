@@ -6,17 +6,30 @@ import (
 )
 
 func ReadMsg(conn net.Conn) ([]byte, error) {
-	// 协议头和协议体
+	lenBs, err := readLength(conn)
+	if err != nil {
+		return nil, err
+	}
+	return readBody(conn, lenBs)
+}
+
+// readLength 读取协议头和协议体的长度，一共八个字节
+func readLength(conn net.Conn) ([]byte, error) {
 	lenBs := make([]byte, numOfLengthBytes)
 	_, err := conn.Read(lenBs)
 	if err != nil {
 		return nil, err
 	}
+	return lenBs, nil
+}
+
+// readBody 按照 readLength 读到的长度读取剩下的数据，返回完整的消息
+func readBody(conn net.Conn, lenBs []byte) ([]byte, error) {
 	headerLength := binary.BigEndian.Uint32(lenBs[:4])
 	bodyLength := binary.BigEndian.Uint32(lenBs[4:])
 	length := headerLength + bodyLength
 	data := make([]byte, length)
-	_, err = conn.Read(data[8:])
+	_, err := conn.Read(data[8:])
 	copy(data[:8], lenBs)
 	return data, err
 }
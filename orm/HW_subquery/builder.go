@@ -13,6 +13,8 @@ type builder struct {
 	dialect Dialect
 	quoter  byte
 	model   *model.Model
+	// 构造过程中用到的表名，不重复
+	tables []string
 }
 
 // buildColumn 构造列
@@ -84,6 +86,28 @@ func (b *builder) raw(r RawExpr) {
 	}
 }
 
+// reset 清空上一次 Build 的結果，同一個 builder 可以 Build 多次
+func (b *builder) reset() {
+	b.sb.Reset()
+	b.args = nil
+	b.tables = nil
+}
+
+func (b *builder) addTables(names ...string) {
+	for _, name := range names {
+		exist := false
+		for _, t := range b.tables {
+			if t == name {
+				exist = true
+				break
+			}
+		}
+		if !exist {
+			b.tables = append(b.tables, name)
+		}
+	}
+}
+
 func (b *builder) addArgs(args ...any) {
 	if b.args == nil {
 		// 很少有查询能够超过八个参数
@@ -205,6 +229,9 @@ func (b *builder) buildSubquery(sub Subquery, useAlias bool) error {
 	if err != nil {
 		return err
 	}
+	if t, ok := sub.q.(TableQueryBuilder); ok {
+		b.addTables(t.Tables()...)
+	}
 	b.sb.WriteByte('(')
 	// 拿掉最後 ';'
 	b.sb.WriteString(query.SQL[:len(query.SQL)-1])
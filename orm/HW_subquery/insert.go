@@ -73,6 +73,7 @@ func (i *Inserter[T]) Build() (*Query, error) {
 	if len(i.values) == 0 {
 		return nil, errs.ErrInsertZeroRow
 	}
+	i.reset()
 	m, err := i.r.Get(i.values[0])
 	i.model = m
 	if err != nil {
@@ -139,8 +140,13 @@ func (i *Inserter[T]) Build() (*Query, error) {
 }
 
 func (i *Inserter[T]) Exec(ctx context.Context) Result {
+	m, err := i.r.Get(new(T))
+	if err != nil {
+		return Result{err: err}
+	}
 	return exec(ctx, i.sess, i.core, &QueryContext{
 		Builder: i,
 		Type:    "INSERT",
+		Model:   m,
 	})
 }
@@ -12,7 +12,8 @@ type QueryContext struct {
 	// builder 使用的时候，大多数情况下你需要转换到具体的类型
 	// 才能篡改查询
 	Builder QueryBuilder
-	Model   *model.Model
+	// Model 查询的表对应的元数据，RAW 查询为 nil
+	Model *model.Model
 }
 
 type QueryResult struct {
@@ -0,0 +1,234 @@
+package querycache
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"geektime-go/cache"
+	orm "geektime-go/orm/HW_subquery"
+	"log"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// MiddlewareBuilder cache-aside 的查询缓存
+// SELECT 的结果按照 SQL 和参数缓存，同一个表的 UPDATE、INSERT (包括 upsert) 成功之后删除这个表的所有缓存
+// JOIN 和子查询的结果属于引用的每一个表，任何一个表的写操作都会删除它
+//
+// 缓存里面保存的是 *T 的浅拷贝，所以需要能保存任意类型的值的 Cache，e.g. cache.BuildInMapCache
+// T 里面的切片、map 和指针字段和缓存共享，调用者不能修改它们指向的数据
+// Cache 是 cache.TagCache 的时候用标签删除，多个实例共享同一个 Cache 也能删除；
+// 否则只能删除这个实例自己写入的缓存
+type MiddlewareBuilder struct {
+	c         cache.Cache
+	ttl       time.Duration
+	tableTTLs map[string]time.Duration
+	prefix    string
+	onError   func(err error)
+
+	mu sync.Mutex
+	// 每个表的版本，写操作之后加一，查询期间版本变化了的结果不写入缓存
+	versions map[string]uint64
+	// Cache 不是 TagCache 的时候，记录每个表缓存了哪些 key
+	keys map[string]map[string]struct{}
+}
+
+func NewBuilder(c cache.Cache) *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		c:         c,
+		ttl:       time.Minute,
+		tableTTLs: map[string]time.Duration{},
+		prefix:    "orm:",
+		onError: func(err error) {
+			log.Println(err)
+		},
+		versions: map[string]uint64{},
+		keys:     map[string]map[string]struct{}{},
+	}
+}
+
+// TTL 默认的过期时间
+func (m *MiddlewareBuilder) TTL(ttl time.Duration) *MiddlewareBuilder {
+	m.ttl = ttl
+	return m
+}
+
+// TableTTL 单独设置某个表 (model.TableName) 的过期时间
+func (m *MiddlewareBuilder) TableTTL(table string, ttl time.Duration) *MiddlewareBuilder {
+	m.tableTTLs[table] = ttl
+	return m
+}
+
+// Prefix 缓存的 key 和标签的前缀，默认为 "orm:"
+func (m *MiddlewareBuilder) Prefix(prefix string) *MiddlewareBuilder {
+	m.prefix = prefix
+	return m
+}
+
+// OnError 读写缓存失败的回调，缓存失败不会影响查询的结果
+func (m *MiddlewareBuilder) OnError(f func(err error)) *MiddlewareBuilder {
+	m.onError = f
+	return m
+}
+
+type skipKey struct{}
+
+// WithoutCache 这次查询不读也不写缓存，写操作不受影响，仍然会删除缓存
+func WithoutCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, skipKey{}, true)
+}
+
+func (m *MiddlewareBuilder) Build() orm.Middleware {
+	return func(next orm.HandleFunc) orm.HandleFunc {
+		return func(ctx context.Context, qc *orm.QueryContext) *orm.QueryResult {
+			// RAW 查询不知道是哪个表
+			if qc.Model == nil {
+				return next(ctx, qc)
+			}
+			switch qc.Type {
+			case "SELECT":
+				if ctx.Value(skipKey{}) != nil {
+					return next(ctx, qc)
+				}
+				return m.query(ctx, qc, next)
+			case "UPDATE", "INSERT", "DELETE":
+				res := next(ctx, qc)
+				if res.Err == nil {
+					m.invalidate(ctx, qc.Model.TableName)
+				}
+				return res
+			default:
+				return next(ctx, qc)
+			}
+		}
+	}
+}
+
+func (m *MiddlewareBuilder) query(ctx context.Context, qc *orm.QueryContext, next orm.HandleFunc) *orm.QueryResult {
+	q, err := qc.Builder.Build()
+	if err != nil {
+		return &orm.QueryResult{Err: err}
+	}
+	tables := []string{qc.Model.TableName}
+	if tb, ok := qc.Builder.(orm.TableQueryBuilder); ok && len(tb.Tables()) > 0 {
+		tables = tb.Tables()
+	}
+	key := m.key(qc.Model.TableName, q)
+	if val, err := m.c.Get(ctx, key); err == nil {
+		if res, ok := clone(val); ok {
+			return &orm.QueryResult{Result: res}
+		}
+	}
+
+	versions := m.versionsOf(tables)
+	res := next(ctx, qc)
+	if res.Err != nil || res.Result == nil {
+		return res
+	}
+	val, ok := clone(res.Result)
+	if !ok {
+		return res
+	}
+	m.store(ctx, tables, key, versions, val)
+	return res
+}
+
+// key 同样的 SQL 和参数使用同一个 key
+func (m *MiddlewareBuilder) key(table string, q *orm.Query) string {
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s%#v", q.SQL, q.Args)))
+	return m.prefix + table + ":" + hex.EncodeToString(sum[:])
+}
+
+func (m *MiddlewareBuilder) tag(table string) string {
+	return m.prefix + table
+}
+
+func (m *MiddlewareBuilder) versionsOf(tables []string) []uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	res := make([]uint64, len(tables))
+	for i, table := range tables {
+		res[i] = m.versions[table]
+	}
+	return res
+}
+
+// store 查询期间任何一个表有写操作的话，查询的结果可能已经过时了，不写入缓存
+// 过期时间取所有表里面最短的
+func (m *MiddlewareBuilder) store(ctx context.Context, tables []string, key string, versions []uint64, val any) {
+	var ttl time.Duration
+	for i, table := range tables {
+		t, ok := m.tableTTLs[table]
+		if !ok {
+			t = m.ttl
+		}
+		if i == 0 || t < ttl {
+			ttl = t
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, table := range tables {
+		if m.versions[table] != versions[i] {
+			return
+		}
+	}
+	var err error
+	if tc, ok := m.c.(cache.TagCache); ok {
+		tags := make([]string, 0, len(tables))
+		for _, table := range tables {
+			tags = append(tags, m.tag(table))
+		}
+		err = tc.SetWithTags(ctx, key, val, ttl, tags...)
+	} else {
+		err = m.c.Set(ctx, key, val, ttl)
+		if err == nil {
+			for _, table := range tables {
+				keys, ok := m.keys[table]
+				if !ok {
+					keys = map[string]struct{}{}
+					m.keys[table] = keys
+				}
+				keys[key] = struct{}{}
+			}
+		}
+	}
+	if err != nil {
+		m.onError(err)
+	}
+}
+
+func (m *MiddlewareBuilder) invalidate(ctx context.Context, table string) {
+	m.mu.Lock()
+	m.versions[table]++
+	keys := m.keys[table]
+	delete(m.keys, table)
+	m.mu.Unlock()
+
+	if tc, ok := m.c.(cache.TagCache); ok {
+		if _, err := tc.InvalidateTag(ctx, m.tag(table)); err != nil {
+			m.onError(err)
+		}
+		return
+	}
+	for key := range keys {
+		if err := m.c.Delete(ctx, key); err != nil {
+			m.onError(err)
+		}
+	}
+}
+
+// clone 浅拷贝 *T，调用者修改 T 的字段不影响缓存里面的对象，
+// 但是切片、map 和指针指向的数据仍然是共享的
+// 不是指针的值 (e.g. Redis 返回的字符串) 视为没有命中
+func clone(val any) (any, bool) {
+	v := reflect.ValueOf(val)
+	if v.Kind() != reflect.Pointer || v.IsNil() {
+		return nil, false
+	}
+	res := reflect.New(v.Elem().Type())
+	res.Elem().Set(v.Elem())
+	return res.Interface(), true
+}
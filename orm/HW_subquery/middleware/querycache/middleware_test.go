@@ -0,0 +1,198 @@
+package querycache
+
+import (
+	"context"
+	"geektime-go/cache"
+	orm "geektime-go/orm/HW_subquery"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+type User struct {
+	Id   int64
+	Name string
+}
+
+func TestMiddlewareBuilder(t *testing.T) {
+	testCases := []struct {
+		name  string
+		cache func(t *testing.T) cache.Cache
+	}{
+		{
+			// 使用标签删除
+			name: "tag cache",
+			cache: func(t *testing.T) cache.Cache {
+				c := cache.NewBuildInMapCache(time.Minute)
+				t.Cleanup(func() {
+					_ = c.Close()
+				})
+				return c
+			},
+		},
+		{
+			// 记录每个表的 key
+			name: "cache",
+			cache: func(t *testing.T) cache.Cache {
+				c := cache.NewShardedCache(time.Minute)
+				t.Cleanup(func() {
+					_ = c.Close()
+				})
+				return c
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			mockDB, mock, err := sqlmock.New()
+			require.NoError(t, err)
+			defer func() { _ = mockDB.Close() }()
+			db, err := orm.OpenDB(mockDB, orm.DBWithMiddleware(NewBuilder(tc.cache(t)).Build()))
+			require.NoError(t, err)
+
+			expectUser := func(id int64, name string) {
+				mock.ExpectQuery("SELECT .*").WithArgs(id).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(id, name))
+			}
+			get := func(ctx context.Context, id int64) *User {
+				u, err := orm.NewSelector[User](db).Where(orm.C("Id").EQ(id)).Get(ctx)
+				require.NoError(t, err)
+				return u
+			}
+
+			expectUser(1, "Tom")
+			u := get(ctx, 1)
+			assert.Equal(t, &User{Id: 1, Name: "Tom"}, u)
+			// 第二次从缓存读取，修改返回的对象不影响缓存
+			u.Name = "Jerry"
+			assert.Equal(t, &User{Id: 1, Name: "Tom"}, get(ctx, 1))
+
+			// 不同的参数
+			expectUser(2, "Jerry")
+			assert.Equal(t, &User{Id: 2, Name: "Jerry"}, get(ctx, 2))
+
+			// 不使用缓存
+			expectUser(1, "Tom2")
+			assert.Equal(t, &User{Id: 1, Name: "Tom2"}, get(WithoutCache(ctx), 1))
+			assert.Equal(t, &User{Id: 1, Name: "Tom"}, get(ctx, 1))
+
+			// UPDATE 之后重新查询
+			mock.ExpectExec("UPDATE .*").WillReturnResult(sqlmock.NewResult(0, 1))
+			res := orm.NewUpdater[User](db).Update(&User{Name: "Tom3"}).Set(orm.C("Name")).
+				Where(orm.C("Id").EQ(1)).Exec(ctx)
+			require.NoError(t, res.Err())
+			expectUser(1, "Tom3")
+			assert.Equal(t, &User{Id: 1, Name: "Tom3"}, get(ctx, 1))
+			expectUser(2, "Jerry")
+			assert.Equal(t, &User{Id: 2, Name: "Jerry"}, get(ctx, 2))
+
+			// upsert 之后重新查询
+			mock.ExpectExec("INSERT .*").WillReturnResult(sqlmock.NewResult(1, 1))
+			res = orm.NewInserter[User](db).Values(&User{Id: 1, Name: "Tom4"}).
+				OnDuplicateKey().Update(orm.C("Name")).Exec(ctx)
+			require.NoError(t, res.Err())
+			expectUser(1, "Tom4")
+			assert.Equal(t, &User{Id: 1, Name: "Tom4"}, get(ctx, 1))
+
+			// 写操作失败不删除缓存
+			mock.ExpectExec("INSERT .*").WillReturnError(assert.AnError)
+			res = orm.NewInserter[User](db).Values(&User{Id: 3, Name: "Tom"}).Exec(ctx)
+			assert.Equal(t, assert.AnError, res.Err())
+			assert.Equal(t, &User{Id: 1, Name: "Tom4"}, get(ctx, 1))
+
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+type Order struct {
+	Id     int64
+	UserId int64
+}
+
+// TestMiddlewareBuilder_MultiTable JOIN 和子查询的缓存在任何一个表写入之后都会删除
+func TestMiddlewareBuilder_MultiTable(t *testing.T) {
+	caches := map[string]func() cache.Cache{
+		"tag cache": func() cache.Cache {
+			return cache.NewBuildInMapCache(time.Minute)
+		},
+		"cache": func() cache.Cache {
+			return cache.NewShardedCache(time.Minute)
+		},
+	}
+	queries := map[string]func(db *orm.DB) *orm.Selector[User]{
+		"join": func(db *orm.DB) *orm.Selector[User] {
+			t1 := orm.TableOf(&User{})
+			t2 := orm.TableOf(&Order{})
+			return orm.NewSelector[User](db).From(t1.Join(t2).On(t1.C("Id").EQ(t2.C("UserId"))))
+		},
+		"subquery": func(db *orm.DB) *orm.Selector[User] {
+			sub := orm.NewSelector[Order](db).Select(orm.C("UserId")).AsSubquery("sub")
+			return orm.NewSelector[User](db).Where(orm.C("Id").InQuery(sub))
+		},
+	}
+	for cacheName, newCache := range caches {
+		for queryName, query := range queries {
+			t.Run(cacheName+"/"+queryName, func(t *testing.T) {
+				ctx := context.Background()
+				c := newCache()
+				defer func() {
+					_ = c.(interface{ Close() error }).Close()
+				}()
+				mockDB, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				defer func() { _ = mockDB.Close() }()
+				db, err := orm.OpenDB(mockDB, orm.DBWithMiddleware(NewBuilder(c).Build()))
+				require.NoError(t, err)
+
+				expectUser := func(name string) {
+					mock.ExpectQuery("SELECT .*").
+						WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, name))
+				}
+				get := func() *User {
+					u, err := query(db).Get(ctx)
+					require.NoError(t, err)
+					return u
+				}
+
+				expectUser("Tom")
+				assert.Equal(t, &User{Id: 1, Name: "Tom"}, get())
+				assert.Equal(t, &User{Id: 1, Name: "Tom"}, get())
+
+				// 写入 JOIN 或者子查询里面的表
+				mock.ExpectExec("UPDATE .*").WillReturnResult(sqlmock.NewResult(0, 1))
+				res := orm.NewUpdater[Order](db).Update(&Order{UserId: 2}).Set(orm.C("UserId")).Exec(ctx)
+				require.NoError(t, res.Err())
+				expectUser("Jerry")
+				assert.Equal(t, &User{Id: 1, Name: "Jerry"}, get())
+
+				assert.NoError(t, mock.ExpectationsWereMet())
+			})
+		}
+	}
+}
+
+func TestMiddlewareBuilder_TableTTL(t *testing.T) {
+	ctx := context.Background()
+	c := cache.NewBuildInMapCache(time.Minute)
+	defer c.Close()
+	mockDB, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() { _ = mockDB.Close() }()
+	db, err := orm.OpenDB(mockDB, orm.DBWithMiddleware(
+		NewBuilder(c).TTL(time.Hour).TableTTL("user", time.Millisecond).Build()))
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		mock.ExpectQuery("SELECT .*").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "Tom"))
+		_, err = orm.NewSelector[User](db).Get(ctx)
+		require.NoError(t, err)
+		// 过期之后重新查询
+		time.Sleep(time.Millisecond * 5)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -31,8 +31,9 @@ func (s *Selector[T]) From(tbl TableReference) *Selector[T] {
 }
 
 func (s *Selector[T]) Build() (*Query, error) {
-	// 重置 sb ，避免重複打印構造 SQL 結果
-	s.sb.Reset()
+	// 重置 sb 和 args，避免重複打印構造 SQL 結果
+	// middleware 可能會先調用一次 Build
+	s.reset()
 	var err error
 	s.model, err = s.r.Get(new(T))
 	if err != nil {
@@ -91,16 +92,25 @@ func (s *Selector[T]) Build() (*Query, error) {
 	}, nil
 }
 
+var _ TableQueryBuilder = &Selector[any]{}
+
+// Tables 上一次 Build 引用的所有表，包括 JOIN 和子查询里面的表
+func (s *Selector[T]) Tables() []string {
+	return s.tables
+}
+
 func (s *Selector[T]) buildTable(table TableReference) error {
 	switch tab := table.(type) {
 	case nil:
 		s.quote(s.model.TableName)
+		s.addTables(s.model.TableName)
 	case Table:
 		model, err := s.r.Get(tab.entity)
 		if err != nil {
 			return err
 		}
 		s.quote(model.TableName)
+		s.addTables(model.TableName)
 		if tab.alias != "" {
 			s.sb.WriteString(" AS ")
 			s.quote(tab.alias)
@@ -230,9 +240,14 @@ func (s *Selector[T]) AsSubquery(alias string) Subquery {
 }
 
 func (s *Selector[T]) Get(ctx context.Context) (*T, error) {
+	m, err := s.r.Get(new(T))
+	if err != nil {
+		return nil, err
+	}
 	res := get[T](ctx, s.core, s.sess, &QueryContext{
 		Builder: s,
 		Type:    "SELECT",
+		Model:   m,
 	})
 	if res.Result != nil {
 		return res.Result.(*T), res.Err
@@ -346,6 +346,66 @@ func TestSelector_SubqueryAndJoin(t *testing.T) {
 	}
 }
 
+func TestSelector_Tables(t *testing.T) {
+	db := memoryDB(t)
+
+	type Order struct {
+		Id int
+	}
+
+	type OrderDetail struct {
+		OrderId int
+		ItemId  int
+	}
+
+	type Item struct {
+		Id int
+	}
+
+	testCases := []struct {
+		name       string
+		q          TableQueryBuilder
+		wantTables []string
+	}{
+		{
+			name:       "default table",
+			q:          NewSelector[Order](db),
+			wantTables: []string{"order"},
+		},
+		{
+			name: "join",
+			q: func() TableQueryBuilder {
+				t1 := TableOf(&Order{})
+				t2 := TableOf(&OrderDetail{})
+				return NewSelector[Order](db).From(t1.Join(t2).On(t1.C("Id").EQ(t2.C("OrderId"))))
+			}(),
+			wantTables: []string{"order", "order_detail"},
+		},
+		{
+			// 子查询里面的表，重复的只算一次
+			name: "subquery",
+			q: func() TableQueryBuilder {
+				sub := NewSelector[OrderDetail](db).Select(C("OrderId")).
+					Where(C("ItemId").InQuery(NewSelector[Item](db).Select(C("Id")).AsSubquery("item"))).
+					AsSubquery("sub")
+				return NewSelector[Order](db).From(TableOf(&Order{})).Where(C("Id").InQuery(sub))
+			}(),
+			wantTables: []string{"order", "order_detail", "item"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := tc.q.Build()
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantTables, tc.q.Tables())
+			// 再次 Build 不会重复
+			_, err = tc.q.Build()
+			assert.NoError(t, err)
+			assert.Equal(t, tc.wantTables, tc.q.Tables())
+		})
+	}
+}
+
 func TestSelector_OffsetLimit(t *testing.T) {
 	db := memoryDB(t)
 	testCases := []struct {
@@ -21,3 +21,10 @@ type Query struct {
 type QueryBuilder interface {
 	Build() (*Query, error)
 }
+
+// TableQueryBuilder 可以拿到 Build 引用的所有表，e.g. Selector
+type TableQueryBuilder interface {
+	QueryBuilder
+	// Tables 上一次 Build 引用的表，包括 JOIN 和子查询里面的表
+	Tables() []string
+}
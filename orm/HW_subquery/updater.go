@@ -39,6 +39,7 @@ func (u *Updater[T]) Build() (*Query, error) {
 	if len(u.assigns) == 0 {
 		return nil, errs.ErrNoUpdatedColumns
 	}
+	u.reset()
 	if u.val == nil {
 		u.val = new(T)
 	}
@@ -101,10 +102,13 @@ func (u *Updater[T]) Where(ps ...Predicate) *Updater[T] {
 }
 
 func (u *Updater[T]) Exec(ctx context.Context) Result {
-	q, err := u.Build()
+	m, err := u.r.Get(new(T))
 	if err != nil {
 		return Result{err: err}
 	}
-	res, err := u.sess.execContext(ctx, q.SQL, q.Args...)
-	return Result{err: err, res: res}
+	return exec(ctx, u.sess, u.core, &QueryContext{
+		Builder: u,
+		Type:    "UPDATE",
+		Model:   m,
+	})
 }
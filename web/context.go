@@ -13,8 +13,10 @@ type Context struct {
 	// Resp 如果用戶直接使用這個
 	// 那麼代表用戶繞開了 RespData 和 RespStatusCode
 	// 部分 middleware 可能會無法運作
-	Resp         http.ResponseWriter
-	PathParams   map[string]string
+	Resp       http.ResponseWriter
+	PathParams map[string]string
+	// HostParams 虛擬主機的參數，e.g. :tenant.example.com
+	HostParams   map[string]string
 	MatchedRoute string
 
 	// 為了 middleware 讀寫用的
@@ -156,6 +158,14 @@ func (c *Context) PathValue(key string) (string, error) {
 	return val, nil
 }
 
+func (c *Context) HostValue(key string) (string, error) {
+	val, ok := c.HostParams[key]
+	if !ok {
+		return "", errors.New("web: key 不存在")
+	}
+	return val, nil
+}
+
 // StringValue 無法使用泛型，因為在創建時候我們不知道用戶需要說明作為 T
 //
 //	type StringValue[T any] struct {
@@ -0,0 +1,172 @@
+package web
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// VirtualHost 虛擬主機，有自己的路由樹和 middleware
+// 透過 HttpServer.Host 創建，請求按照 Host header 分發
+//
+//	server.Host("aaa.com").Get("/profile", handler)
+//	server.Host("*.example.com").Use(mdl)
+//	server.Host(":tenant.example.com").Get("/", handler) // ctx.HostParams["tenant"]
+type VirtualHost struct {
+	pattern     string
+	router      *Router
+	middlewares []Middleware
+
+	// 按 "." 切分的 label
+	labels []string
+	// 是否包含參數 label，或是最左邊為通配符
+	hasParam bool
+	wildcard bool
+}
+
+func (v *VirtualHost) Use(mdls ...Middleware) {
+	v.middlewares = append(v.middlewares, mdls...)
+}
+
+func (v *VirtualHost) UseV1(method string, path string, mdls ...Middleware) {
+	v.router.addRoute(method, path, nil, mdls...)
+}
+
+func (v *VirtualHost) Get(path string, handleFunc HandleFunc, mdls ...Middleware) {
+	v.router.addRoute(http.MethodGet, path, handleFunc, mdls...)
+}
+
+func (v *VirtualHost) Post(path string, handleFunc HandleFunc, mdls ...Middleware) {
+	v.router.addRoute(http.MethodPost, path, handleFunc, mdls...)
+}
+
+// handler 組裝虛擬主機的 middleware
+func (v *VirtualHost) handler() HandleFunc {
+	root := func(ctx *Context) {
+		serveRouter(v.router, ctx)
+	}
+	for i := len(v.middlewares) - 1; i >= 0; i-- {
+		root = v.middlewares[i](root)
+	}
+	return root
+}
+
+// match host 已經去掉端口，並轉為小寫
+func (v *VirtualHost) match(labels []string) (map[string]string, bool) {
+	if v.wildcard {
+		// *.example.com 中的 * 匹配一個或多個 label
+		if len(labels) < len(v.labels) {
+			return nil, false
+		}
+		labels = labels[len(labels)-len(v.labels)+1:]
+		return matchLabels(v.labels[1:], labels)
+	}
+	if len(labels) != len(v.labels) {
+		return nil, false
+	}
+	return matchLabels(v.labels, labels)
+}
+
+func matchLabels(patterns []string, labels []string) (map[string]string, bool) {
+	var params map[string]string
+	for i, p := range patterns {
+		if p[0] == ':' {
+			if params == nil {
+				params = make(map[string]string, 2)
+			}
+			params[p[1:]] = labels[i]
+			continue
+		}
+		if p != labels[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// hostRouter 先完全匹配，其次是參數匹配，最後才是通配符匹配
+// 同一類的按照 label 數量從多到少匹配，越具體越優先
+type hostRouter struct {
+	exact    map[string]*VirtualHost
+	patterns []*VirtualHost
+}
+
+func (h *hostRouter) hostOrCreate(pattern string) *VirtualHost {
+	pattern = strings.TrimSuffix(strings.ToLower(pattern), ".")
+	if pattern == "" {
+		panic("web: host is empty")
+	}
+	if h.exact == nil {
+		h.exact = make(map[string]*VirtualHost)
+	}
+	if vh, ok := h.exact[pattern]; ok {
+		return vh
+	}
+	for _, vh := range h.patterns {
+		if vh.pattern == pattern {
+			return vh
+		}
+	}
+
+	vh := &VirtualHost{
+		pattern: pattern,
+		router:  NewRouter(),
+		labels:  strings.Split(pattern, "."),
+	}
+	for i, l := range vh.labels {
+		switch {
+		case l == "":
+			panic(fmt.Sprintf("web: invalid host %s, empty label", pattern))
+		case l == "*":
+			if i != 0 {
+				panic(fmt.Sprintf("web: invalid host %s, '*' must be the leftmost label", pattern))
+			}
+			vh.wildcard = true
+		case l[0] == ':':
+			if len(l) == 1 {
+				panic(fmt.Sprintf("web: invalid host %s, empty param", pattern))
+			}
+			vh.hasParam = true
+		}
+	}
+	if !vh.wildcard && !vh.hasParam {
+		h.exact[pattern] = vh
+		return vh
+	}
+	h.patterns = append(h.patterns, vh)
+	sort.SliceStable(h.patterns, func(i, j int) bool {
+		x, y := h.patterns[i], h.patterns[j]
+		if x.wildcard != y.wildcard {
+			return !x.wildcard
+		}
+		return len(x.labels) > len(y.labels)
+	})
+	return vh
+}
+
+func (h *hostRouter) find(host string) (*VirtualHost, map[string]string, bool) {
+	if len(h.exact) == 0 && len(h.patterns) == 0 {
+		return nil, nil, false
+	}
+	host = normalizeHost(host)
+	if vh, ok := h.exact[host]; ok {
+		return vh, nil, true
+	}
+	labels := strings.Split(host, ".")
+	for _, vh := range h.patterns {
+		if params, ok := vh.match(labels); ok {
+			return vh, params, true
+		}
+	}
+	return nil, nil, false
+}
+
+// normalizeHost 去掉端口，轉為小寫
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
@@ -0,0 +1,126 @@
+package web
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHttpServer_Host(t *testing.T) {
+	var mdlBuilder = func(name string) Middleware {
+		return func(next HandleFunc) HandleFunc {
+			return func(ctx *Context) {
+				ctx.Resp.Header().Add("X-Mdl", name)
+				next(ctx)
+			}
+		}
+	}
+	var respBuilder = func(name string) HandleFunc {
+		return func(ctx *Context) {
+			_ = ctx.RespOk(name + " " + ctx.HostParams["tenant"] + " " + ctx.PathParams["id"])
+		}
+	}
+
+	server := NewHttpServer(ServerWithMiddlewares(mdlBuilder("server")))
+	server.Get("/user/:id", respBuilder("default"))
+	server.Host("aaa.com").Get("/user/:id", respBuilder("aaa"))
+	server.Host("AAA.com").Use(mdlBuilder("aaa"))
+	server.Host("*.example.com").Get("/user/:id", respBuilder("wildcard"))
+	server.Host("*.example.com").Use(mdlBuilder("wildcard"))
+	server.Host(":tenant.example.com").Get("/user/:id", respBuilder("tenant"))
+	server.Host("api.example.com").Get("/user/:id", respBuilder("api"))
+	server.Host("bbb.com").Post("/user/:id", respBuilder("bbb"))
+
+	testCases := []struct {
+		name   string
+		method string
+		host   string
+
+		wantCode int
+		wantResp string
+		wantMdls []string
+	}{
+		{
+			name:     "default",
+			method:   http.MethodGet,
+			host:     "ccc.com",
+			wantCode: http.StatusOK,
+			wantResp: "default  123",
+			wantMdls: []string{"server"},
+		},
+		{
+			name:     "exact with port",
+			method:   http.MethodGet,
+			host:     "aaa.com:8081",
+			wantCode: http.StatusOK,
+			wantResp: "aaa  123",
+			wantMdls: []string{"server", "aaa"},
+		},
+		{
+			name:     "exact over param",
+			method:   http.MethodGet,
+			host:     "api.example.com",
+			wantCode: http.StatusOK,
+			wantResp: "api  123",
+			wantMdls: []string{"server"},
+		},
+		{
+			name:     "param",
+			method:   http.MethodGet,
+			host:     "geek.example.com",
+			wantCode: http.StatusOK,
+			wantResp: "tenant geek 123",
+			wantMdls: []string{"server"},
+		},
+		{
+			name:     "wildcard multi labels",
+			method:   http.MethodGet,
+			host:     "a.b.example.com",
+			wantCode: http.StatusOK,
+			wantResp: "wildcard  123",
+			wantMdls: []string{"server", "wildcard"},
+		},
+		{
+			name:     "wildcard not match root domain",
+			method:   http.MethodGet,
+			host:     "example.com",
+			wantCode: http.StatusOK,
+			wantResp: "default  123",
+			wantMdls: []string{"server"},
+		},
+		{
+			name:     "host own route tree",
+			method:   http.MethodGet,
+			host:     "bbb.com",
+			wantCode: http.StatusNotFound,
+			wantResp: "Not found",
+			wantMdls: []string{"server"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "/user/123", nil)
+			req.Host = tc.host
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantResp, recorder.Body.String())
+			assert.Equal(t, tc.wantMdls, recorder.Header().Values("X-Mdl"))
+		})
+	}
+}
+
+func TestHttpServer_HostInvalid(t *testing.T) {
+	server := NewHttpServer()
+	assert.PanicsWithValue(t, "web: host is empty", func() {
+		server.Host("")
+	})
+	assert.PanicsWithValue(t, "web: invalid host a.*.com, '*' must be the leftmost label", func() {
+		server.Host("a.*.com")
+	})
+	assert.PanicsWithValue(t, "web: invalid host a..com, empty label", func() {
+		server.Host("a..com")
+	})
+}
@@ -0,0 +1,74 @@
+package bodyLimit
+
+import (
+	"errors"
+	"geektime-go/web"
+	"io"
+	"net/http"
+)
+
+type MiddlewareBuilder struct {
+	maxBytes int64
+	msg      string
+}
+
+// NewBuilder maxBytes 為請求 body 允許的最大字節數
+func NewBuilder(maxBytes int64) *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		maxBytes: maxBytes,
+		msg:      "web: 請求 body 過大",
+	}
+}
+
+// Msg 超過限制時返回的響應內容
+func (m *MiddlewareBuilder) Msg(msg string) *MiddlewareBuilder {
+	m.msg = msg
+	return m
+}
+
+func (m *MiddlewareBuilder) Build() web.Middleware {
+	return func(next web.HandleFunc) web.HandleFunc {
+		return func(ctx *web.Context) {
+			// 有 Content-Length 的情況，不用讀 body 就能直接拒絕
+			if ctx.Req.ContentLength > m.maxBytes {
+				m.reject(ctx)
+				return
+			}
+			if ctx.Req.Body == nil {
+				next(ctx)
+				return
+			}
+			// chunked 之類沒有 Content-Length 的請求，只能在讀的時候才發現超出限制
+			// 例如 BindJSON 讀到一半返回 *http.MaxBytesError
+			body := &limitedBody{
+				ReadCloser: http.MaxBytesReader(ctx.Resp, ctx.Req.Body, m.maxBytes),
+			}
+			ctx.Req.Body = body
+			next(ctx)
+			if body.exceeded {
+				m.reject(ctx)
+			}
+		}
+	}
+}
+
+func (m *MiddlewareBuilder) reject(ctx *web.Context) {
+	ctx.RespStatusCode = http.StatusRequestEntityTooLarge
+	ctx.RespData = []byte(m.msg)
+}
+
+// limitedBody 記錄 handler 讀取 body 時是否超出限制
+// 這樣不管 handler 怎麼處理錯誤，最後都可以統一返回 413
+type limitedBody struct {
+	io.ReadCloser
+	exceeded bool
+}
+
+func (l *limitedBody) Read(p []byte) (int, error) {
+	n, err := l.ReadCloser.Read(p)
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		l.exceeded = true
+	}
+	return n, err
+}
@@ -0,0 +1,73 @@
+package bodyLimit
+
+import (
+	"geektime-go/web"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	type User struct {
+		Name string `json:"name"`
+	}
+	testCases := []struct {
+		name string
+		req  func() *http.Request
+
+		wantCode int
+		wantData string
+	}{
+		{
+			name: "in limit",
+			req: func() *http.Request {
+				return httptest.NewRequest(http.MethodPost, "/user",
+					strings.NewReader(`{"name":"Tom"}`))
+			},
+			wantCode: http.StatusOK,
+			wantData: "Tom",
+		},
+		{
+			name: "content length too large",
+			req: func() *http.Request {
+				return httptest.NewRequest(http.MethodPost, "/user",
+					strings.NewReader(`{"name":"Tom Tom Tom Tom"}`))
+			},
+			wantCode: http.StatusRequestEntityTooLarge,
+			wantData: "web: 請求 body 過大",
+		},
+		{
+			name: "unknown content length",
+			req: func() *http.Request {
+				// 隱藏 Content-Length，只能在讀的時候才發現超出限制
+				req := httptest.NewRequest(http.MethodPost, "/user",
+					io.MultiReader(strings.NewReader(`{"name":"Tom Tom Tom Tom"}`)))
+				req.ContentLength = -1
+				return req
+			},
+			wantCode: http.StatusRequestEntityTooLarge,
+			wantData: "web: 請求 body 過大",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := web.NewHttpServer()
+			server.Post("/user", func(ctx *web.Context) {
+				var u User
+				if err := ctx.BindJSON(&u); err != nil {
+					_ = ctx.RespServerError(err.Error())
+					return
+				}
+				_ = ctx.RespOk(u.Name)
+			}, NewBuilder(16).Build())
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, tc.req())
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantData, recorder.Body.String())
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package timeout
+
+import (
+	"bytes"
+	"context"
+	"geektime-go/web"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type MiddlewareBuilder struct {
+	timeout    time.Duration
+	statusCode int
+	msg        string
+}
+
+// NewBuilder timeout 為 handler 可執行的最長時間
+// 超時預設返回 503，可以透過 StatusCode 改成 504
+func NewBuilder(timeout time.Duration) *MiddlewareBuilder {
+	return &MiddlewareBuilder{
+		timeout:    timeout,
+		statusCode: http.StatusServiceUnavailable,
+		msg:        "web: 請求超時",
+	}
+}
+
+// StatusCode 超時時返回的狀態碼，一般是 503 或 504
+func (m *MiddlewareBuilder) StatusCode(code int) *MiddlewareBuilder {
+	m.statusCode = code
+	return m
+}
+
+// Msg 超時時返回的響應內容
+func (m *MiddlewareBuilder) Msg(msg string) *MiddlewareBuilder {
+	m.msg = msg
+	return m
+}
+
+func (m *MiddlewareBuilder) Build() web.Middleware {
+	return func(next web.HandleFunc) web.HandleFunc {
+		return func(ctx *web.Context) {
+			tctx, cancel := context.WithTimeout(ctx.Req.Context(), m.timeout)
+			defer cancel()
+
+			// handler 跑在另一個 goroutine，超時之後它可能還在寫響應
+			// 所以讓 handler 操作 ctx 的副本，直接寫 Resp 的部分也先寫到 buffer
+			// 只有在 handler 按時結束的情況下，才把結果拷貝回 ctx，避免 data race
+			tw := &timeoutWriter{header: make(http.Header)}
+			shadow := *ctx
+			shadow.Req = ctx.Req.WithContext(tctx)
+			shadow.Resp = tw
+
+			done := make(chan struct{})
+			panicChan := make(chan any, 1)
+			go func() {
+				defer func() {
+					if p := recover(); p != nil {
+						panicChan <- p
+					}
+				}()
+				next(&shadow)
+				close(done)
+			}()
+
+			select {
+			case p := <-panicChan:
+				// 保持和不使用超時控制時一樣的行為，在原本的 goroutine 上 panic
+				panic(p)
+			case <-done:
+				ctx.PathParams = shadow.PathParams
+				ctx.MatchedRoute = shadow.MatchedRoute
+				ctx.RespStatusCode = shadow.RespStatusCode
+				ctx.RespData = shadow.RespData
+				tw.flush(ctx)
+			case <-tctx.Done():
+				tw.timeout()
+				ctx.RespStatusCode = m.statusCode
+				ctx.RespData = []byte(m.msg)
+			}
+		}
+	}
+}
+
+// timeoutWriter 先緩存 handler 直接寫入 Resp 的內容
+// 超時之後的寫入都會被丟棄，返回 http.ErrHandlerTimeout
+type timeoutWriter struct {
+	mu       sync.Mutex
+	header   http.Header
+	buf      bytes.Buffer
+	code     int
+	timedOut bool
+}
+
+func (t *timeoutWriter) Header() http.Header {
+	return t.header
+}
+
+func (t *timeoutWriter) Write(bs []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if t.code == 0 {
+		t.code = http.StatusOK
+	}
+	return t.buf.Write(bs)
+}
+
+func (t *timeoutWriter) WriteHeader(code int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.timedOut || t.code != 0 {
+		return
+	}
+	t.code = code
+}
+
+func (t *timeoutWriter) timeout() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.timedOut = true
+}
+
+// flush 把緩存的內容合併到 ctx，狀態碼和數據統一由 HttpServer 寫回，避免重複調用 WriteHeader
+// 直接寫入的狀態碼會先發出去，所以優先於 RespStatusCode；直接寫入的數據排在 RespData 前面
+func (t *timeoutWriter) flush(ctx *web.Context) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	dst := ctx.Resp.Header()
+	for k, vals := range t.header {
+		dst[k] = vals
+	}
+	if t.code != 0 {
+		ctx.RespStatusCode = t.code
+	}
+	if t.buf.Len() > 0 {
+		ctx.RespData = append(t.buf.Bytes(), ctx.RespData...)
+	}
+}
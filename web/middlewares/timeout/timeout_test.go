@@ -0,0 +1,116 @@
+package timeout
+
+import (
+	"geektime-go/web"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMiddlewareBuilder_Build(t *testing.T) {
+	testCases := []struct {
+		name    string
+		builder *MiddlewareBuilder
+		handler web.HandleFunc
+
+		wantCode   int
+		wantData   string
+		wantHeader string
+	}{
+		{
+			name:    "not timeout",
+			builder: NewBuilder(time.Second),
+			handler: func(ctx *web.Context) {
+				ctx.Resp.Header().Set("X-Test", "ok")
+				_ = ctx.RespOk("hello")
+			},
+			wantCode:   http.StatusOK,
+			wantData:   "hello",
+			wantHeader: "ok",
+		},
+		{
+			// 直接寫 Resp 和設置 RespData 混用
+			name:    "write directly",
+			builder: NewBuilder(time.Second),
+			handler: func(ctx *web.Context) {
+				ctx.Resp.WriteHeader(http.StatusCreated)
+				_, _ = ctx.Resp.Write([]byte("hello "))
+				ctx.RespData = []byte("world")
+			},
+			wantCode: http.StatusCreated,
+			wantData: "hello world",
+		},
+		{
+			name:    "timeout",
+			builder: NewBuilder(time.Millisecond * 10),
+			handler: func(ctx *web.Context) {
+				<-ctx.Req.Context().Done()
+				// 超時之後才寫，不會影響響應
+				ctx.Resp.Header().Set("X-Test", "ok")
+				_ = ctx.RespOk("hello")
+			},
+			wantCode: http.StatusServiceUnavailable,
+			wantData: "web: 請求超時",
+		},
+		{
+			name:    "timeout with status code",
+			builder: NewBuilder(time.Millisecond * 10).StatusCode(http.StatusGatewayTimeout).Msg("timeout"),
+			handler: func(ctx *web.Context) {
+				time.Sleep(time.Millisecond * 100)
+				_ = ctx.RespOk("hello")
+			},
+			wantCode: http.StatusGatewayTimeout,
+			wantData: "timeout",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := web.NewHttpServer()
+			server.Get("/timeout", tc.handler, tc.builder.Build())
+			req := httptest.NewRequest(http.MethodGet, "/timeout", nil)
+			recorder := httptest.NewRecorder()
+			w := &countingWriter{ResponseWriter: recorder}
+			server.ServeHTTP(w, req)
+			// 狀態碼只寫一次，不會有 superfluous response.WriteHeader
+			assert.LessOrEqual(t, w.cnt, 1)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantData, recorder.Body.String())
+			assert.Equal(t, tc.wantHeader, recorder.Header().Get("X-Test"))
+		})
+	}
+}
+
+// countingWriter 記錄寫狀態碼的次數，沒有調用 WriteHeader 直接 Write 相當於寫了 200
+type countingWriter struct {
+	http.ResponseWriter
+	cnt   int
+	wrote bool
+}
+
+func (c *countingWriter) WriteHeader(code int) {
+	c.cnt++
+	c.wrote = true
+	c.ResponseWriter.WriteHeader(code)
+}
+
+func (c *countingWriter) Write(bs []byte) (int, error) {
+	if !c.wrote {
+		c.cnt++
+		c.wrote = true
+	}
+	return c.ResponseWriter.Write(bs)
+}
+
+func TestMiddlewareBuilder_Panic(t *testing.T) {
+	server := web.NewHttpServer()
+	server.Get("/panic", func(ctx *web.Context) {
+		panic("handler panic")
+	}, NewBuilder(time.Second).Build())
+	req := httptest.NewRequest(http.MethodGet, "/panic", nil)
+	assert.PanicsWithValue(t, "handler panic", func() {
+		server.ServeHTTP(httptest.NewRecorder(), req)
+	})
+}
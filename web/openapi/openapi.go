@@ -0,0 +1,219 @@
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"geektime-go/web"
+	"html/template"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+//go:embed swagger.gohtml
+var swaggerTpl string
+
+// Swagger UI 的靜態文件，不依賴外部 CDN
+var (
+	//go:embed swagger-ui/swagger-ui.css
+	swaggerCSS []byte
+	//go:embed swagger-ui/swagger-ui-bundle.js
+	swaggerJS []byte
+)
+
+// Builder 從 HttpServer 已註冊的路由生成 OpenAPI 3 文檔
+// 路由的描述信息透過 HttpServer.Describe 添加，沒有描述信息的路由也會生成基本的文檔
+// 一份文檔只對應一個虛擬主機，默認為沒有虛擬主機的路由
+type Builder struct {
+	info    Info
+	servers []Server
+	host    string
+}
+
+func NewBuilder(title string, version string) *Builder {
+	return &Builder{
+		info: Info{Title: title, Version: version},
+	}
+}
+
+func (b *Builder) Description(desc string) *Builder {
+	b.info.Description = desc
+	return b
+}
+
+// Server 文檔中 API 的訪問地址
+func (b *Builder) Server(url string) *Builder {
+	b.servers = append(b.servers, Server{URL: url})
+	return b
+}
+
+// Host 生成虛擬主機 pattern 上的路由的文檔，e.g. aaa.com、*.example.com
+func (b *Builder) Host(pattern string) *Builder {
+	b.host = strings.TrimSuffix(strings.ToLower(pattern), ".")
+	return b
+}
+
+// Build 生成文檔，只處理 Builder 對應的虛擬主機上的路由
+func (b *Builder) Build(routes []web.RouteInfo) *Spec {
+	components := map[string]*Schema{}
+	spec := &Spec{
+		OpenAPI: "3.0.3",
+		Info:    b.info,
+		Servers: b.servers,
+		Paths:   map[string]PathItem{},
+	}
+	for _, r := range routes {
+		if r.Host != b.host {
+			continue
+		}
+		path, params := convertPath(r.Path)
+		item, ok := spec.Paths[path]
+		if !ok {
+			item = PathItem{}
+			spec.Paths[path] = item
+		}
+		item[strings.ToLower(r.Method)] = b.operation(r, params, components)
+	}
+	if len(components) > 0 {
+		spec.Components = &Components{Schemas: components}
+	}
+	return spec
+}
+
+func (b *Builder) operation(r web.RouteInfo, params []Parameter, components map[string]*Schema) *Operation {
+	op := &Operation{
+		Parameters: params,
+		Responses:  map[string]*Response{},
+	}
+	meta := r.Meta
+	if meta == nil {
+		meta = &web.RouteMeta{}
+	}
+	op.Summary = meta.Summary
+	op.Description = meta.Description
+	op.Tags = meta.Tags
+	if meta.Request != nil {
+		op.RequestBody = &RequestBody{
+			Required: true,
+			Content: map[string]MediaType{
+				"application/json": {Schema: b.schemaOf(reflect.TypeOf(meta.Request), components)},
+			},
+		}
+	}
+	for code, val := range meta.Responses {
+		resp := &Response{Description: http.StatusText(code)}
+		if val != nil {
+			resp.Content = map[string]MediaType{
+				"application/json": {Schema: b.schemaOf(reflect.TypeOf(val), components)},
+			}
+		}
+		op.Responses[strconv.Itoa(code)] = resp
+	}
+	// OpenAPI 要求至少有一個響應
+	if len(op.Responses) == 0 {
+		op.Responses["200"] = &Response{Description: http.StatusText(http.StatusOK)}
+	}
+	return op
+}
+
+// convertPath 把路由轉換為 OpenAPI 的路徑模板
+// /user/:id => /user/{id}
+// /order/:id(^[0-9]+$) => /order/{id}，並把正則放進參數的 pattern
+// /static/* => /static/{wildcard}
+func convertPath(path string) (string, []Parameter) {
+	if path == "/" {
+		return path, nil
+	}
+	segs := strings.Split(path[1:], "/")
+	var params []Parameter
+	for i, seg := range segs {
+		switch {
+		case seg == "*":
+			segs[i] = "{wildcard}"
+			params = append(params, Parameter{
+				Name: "wildcard", In: "path", Required: true,
+				Schema: &Schema{Type: "string"},
+			})
+		case seg[0] == ':':
+			name, pattern := seg[1:], ""
+			// 正則路由格式為 :<param>(<regExp>)
+			if idx := strings.Index(name, "("); idx > 0 && name[len(name)-1] == ')' {
+				name, pattern = name[:idx], name[idx+1:len(name)-1]
+			}
+			segs[i] = "{" + name + "}"
+			params = append(params, Parameter{
+				Name: name, In: "path", Required: true,
+				Schema: &Schema{Type: "string", Pattern: pattern},
+			})
+		}
+	}
+	return "/" + strings.Join(segs, "/"), params
+}
+
+// Register 在 server 上註冊文檔的路由
+// specPath 返回 JSON 格式的文檔，uiPath 返回 Swagger UI 頁面，頁面用到的靜態文件放在 uiPath 下面
+// 設置了 Host 的時候，路由註冊在對應的虛擬主機上
+// 文檔在請求的時候才生成，所以在 Register 之後註冊的路由也會出現在文檔裡
+func (b *Builder) Register(server *web.HttpServer, specPath string, uiPath string) {
+	var r interface {
+		Get(path string, handleFunc web.HandleFunc, mdls ...web.Middleware)
+	} = server
+	if b.host != "" {
+		r = server.Host(b.host)
+	}
+	tpl := template.Must(template.New("swagger").Parse(swaggerTpl))
+	assetPath := strings.TrimSuffix(uiPath, "/")
+	assets := map[string]asset{
+		assetPath + "/swagger-ui.css":       {contentType: "text/css; charset=utf-8", data: swaggerCSS},
+		assetPath + "/swagger-ui-bundle.js": {contentType: "text/javascript; charset=utf-8", data: swaggerJS},
+	}
+	r.Get(specPath, func(ctx *web.Context) {
+		routes := server.Routes()
+		// 文檔自身的路由不需要出現在文檔裡
+		filtered := make([]web.RouteInfo, 0, len(routes))
+		for _, rt := range routes {
+			if rt.Host == b.host {
+				if _, ok := assets[rt.Path]; ok || rt.Path == specPath || rt.Path == uiPath {
+					continue
+				}
+			}
+			filtered = append(filtered, rt)
+		}
+		data, err := json.Marshal(b.Build(filtered))
+		if err != nil {
+			_ = ctx.RespServerError("web: 生成 OpenAPI 文檔失敗")
+			return
+		}
+		ctx.Resp.Header().Set("Content-Type", "application/json")
+		ctx.RespStatusCode = http.StatusOK
+		ctx.RespData = data
+	})
+	r.Get(uiPath, func(ctx *web.Context) {
+		bs := &strings.Builder{}
+		if err := tpl.Execute(bs, map[string]string{
+			"Title":     b.info.Title,
+			"SpecPath":  specPath,
+			"AssetPath": assetPath,
+		}); err != nil {
+			_ = ctx.RespServerError("web: 渲染 Swagger UI 失敗")
+			return
+		}
+		ctx.Resp.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_ = ctx.RespOk(bs.String())
+	})
+	for path, a := range assets {
+		a := a
+		r.Get(path, func(ctx *web.Context) {
+			ctx.Resp.Header().Set("Content-Type", a.contentType)
+			ctx.Resp.Header().Set("Cache-Control", "public, max-age=86400")
+			ctx.RespStatusCode = http.StatusOK
+			ctx.RespData = a.data
+		})
+	}
+}
+
+type asset struct {
+	contentType string
+	data        []byte
+}
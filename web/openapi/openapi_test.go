@@ -0,0 +1,242 @@
+package openapi
+
+import (
+	"encoding/json"
+	"geektime-go/web"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type BaseEntity struct {
+	Id       int64     `json:"id"`
+	CreateAt time.Time `json:"create_at"`
+}
+
+type User struct {
+	BaseEntity
+	Name    string            `json:"name"`
+	Email   *string           `json:"email,omitempty"`
+	Tags    []string          `json:"tags,omitempty"`
+	Extra   map[string]int    `json:"extra,omitempty"`
+	Friends []*User           `json:"friends,omitempty"`
+	Avatar  []byte            `json:"avatar,omitempty"`
+	Secret  string            `json:"-"`
+	Labels  map[string]string `json:"labels,omitempty"`
+	age     int
+}
+
+type ErrResp struct {
+	Msg string `json:"msg"`
+}
+
+func TestBuilder_Build(t *testing.T) {
+	server := web.NewHttpServer()
+	handler := func(ctx *web.Context) {}
+	server.Get("/user/:id", handler)
+	server.Describe(http.MethodGet, "/user/:id", web.RouteMeta{
+		Summary: "查詢用戶",
+		Tags:    []string{"user"},
+		Responses: map[int]any{
+			http.StatusOK:       User{},
+			http.StatusNotFound: nil,
+		},
+	})
+	// 先描述，再註冊
+	server.Describe(http.MethodPost, "/user", web.RouteMeta{
+		Summary:   "創建用戶",
+		Request:   &User{},
+		Responses: map[int]any{http.StatusInternalServerError: ErrResp{}},
+	})
+	server.Post("/user", handler)
+	server.Get("/order/:id(^[0-9]+$)", handler)
+	server.Get("/static/*", handler)
+	// 只有描述，沒有 handler 的路由不會出現在文檔裡
+	server.Describe(http.MethodGet, "/not/registered", web.RouteMeta{Summary: "none"})
+	// 虛擬主機上的路由不會出現在默認的文檔裡
+	server.Host("aaa.com").Get("/aaa", handler)
+
+	spec := NewBuilder("user service", "v1").Server("http://localhost:8080").Build(server.Routes())
+	data, err := json.Marshal(spec)
+	require.NoError(t, err)
+
+	wantSpec := `{
+  "openapi": "3.0.3",
+  "info": {"title": "user service", "version": "v1"},
+  "servers": [{"url": "http://localhost:8080"}],
+  "paths": {
+    "/order/{id}": {
+      "get": {
+        "parameters": [{"name": "id", "in": "path", "required": true, "schema": {"type": "string", "pattern": "^[0-9]+$"}}],
+        "responses": {"200": {"description": "OK"}}
+      }
+    },
+    "/static/{wildcard}": {
+      "get": {
+        "parameters": [{"name": "wildcard", "in": "path", "required": true, "schema": {"type": "string"}}],
+        "responses": {"200": {"description": "OK"}}
+      }
+    },
+    "/user": {
+      "post": {
+        "summary": "創建用戶",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/geektime-go.web.openapi.User"}}}},
+        "responses": {"500": {"description": "Internal Server Error", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/geektime-go.web.openapi.ErrResp"}}}}}
+      }
+    },
+    "/user/{id}": {
+      "get": {
+        "summary": "查詢用戶",
+        "tags": ["user"],
+        "parameters": [{"name": "id", "in": "path", "required": true, "schema": {"type": "string"}}],
+        "responses": {
+          "200": {"description": "OK", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/geektime-go.web.openapi.User"}}}},
+          "404": {"description": "Not Found"}
+        }
+      }
+    }
+  },
+  "components": {
+    "schemas": {
+      "geektime-go.web.openapi.ErrResp": {"type": "object", "properties": {"msg": {"type": "string"}}, "required": ["msg"]},
+      "geektime-go.web.openapi.User": {
+        "type": "object",
+        "properties": {
+          "id": {"type": "integer", "format": "int64"},
+          "create_at": {"type": "string", "format": "date-time"},
+          "name": {"type": "string"},
+          "email": {"type": "string"},
+          "tags": {"type": "array", "items": {"type": "string"}},
+          "extra": {"type": "object", "additionalProperties": {"type": "integer", "format": "int64"}},
+          "friends": {"type": "array", "items": {"$ref": "#/components/schemas/geektime-go.web.openapi.User"}},
+          "avatar": {"type": "string", "format": "byte"},
+          "labels": {"type": "object", "additionalProperties": {"type": "string"}}
+        },
+        "required": ["id", "create_at", "name"]
+      }
+    }
+  }
+}`
+	assert.JSONEq(t, wantSpec, string(data))
+}
+
+func TestBuilder_Register(t *testing.T) {
+	server := web.NewHttpServer()
+	NewBuilder("user service", "v1").Register(server, "/openapi.json", "/docs")
+	// Register 之後註冊的路由也會出現在文檔裡
+	server.Get("/user", func(ctx *web.Context) {})
+
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+	var spec Spec
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &spec))
+	assert.Equal(t, []string{"/user"}, keys(spec.Paths))
+
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.True(t, strings.Contains(recorder.Body.String(), "SwaggerUIBundle"))
+	assert.True(t, strings.Contains(recorder.Body.String(), `\/openapi.json`))
+	assert.False(t, strings.Contains(recorder.Body.String(), "unpkg.com"))
+
+	// Swagger UI 的靜態文件由 server 自己提供
+	for path, contentType := range map[string]string{
+		"/docs/swagger-ui.css":       "text/css; charset=utf-8",
+		"/docs/swagger-ui-bundle.js": "text/javascript; charset=utf-8",
+	} {
+		assert.True(t, strings.Contains(recorder.Body.String(), path))
+		resp := httptest.NewRecorder()
+		server.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, contentType, resp.Header().Get("Content-Type"))
+		assert.NotZero(t, resp.Body.Len())
+	}
+}
+
+func TestBuilder_RegisterHost(t *testing.T) {
+	server := web.NewHttpServer()
+	server.Get("/user", func(ctx *web.Context) {})
+	server.Host("aaa.com").Get("/order", func(ctx *web.Context) {})
+	server.Host("aaa.com").Describe(http.MethodGet, "/order", web.RouteMeta{Summary: "訂單"})
+	NewBuilder("aaa", "v1").Host("AAA.com").Register(server, "/openapi.json", "/docs")
+
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://aaa.com/openapi.json", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	var spec Spec
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &spec))
+	assert.Equal(t, []string{"/order"}, keys(spec.Paths))
+	assert.Equal(t, "訂單", spec.Paths["/order"]["get"].Summary)
+
+	// 文檔只註冊在虛擬主機上
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestHttpServer_Routes(t *testing.T) {
+	server := web.NewHttpServer()
+	handler := func(ctx *web.Context) {}
+	server.Get("/user", handler)
+	server.Host("*.example.com").Post("/user", handler)
+	server.Host("aaa.com").Get("/order", handler)
+	server.Host("aaa.com").Describe(http.MethodGet, "/order", web.RouteMeta{Summary: "訂單"})
+
+	routes := server.Routes()
+	require.Len(t, routes, 3)
+	assert.Equal(t, web.RouteInfo{Method: http.MethodGet, Path: "/user"}, routes[0])
+	assert.Equal(t, web.RouteInfo{Host: "*.example.com", Method: http.MethodPost, Path: "/user"}, routes[1])
+	assert.Equal(t, web.RouteInfo{Host: "aaa.com", Method: http.MethodGet, Path: "/order",
+		Meta: &web.RouteMeta{Summary: "訂單"}}, routes[2])
+}
+
+func TestHttpServer_DescribeNotShadow(t *testing.T) {
+	server := web.NewHttpServer()
+	server.Get("/user/:id", func(ctx *web.Context) {
+		_ = ctx.RespOk(ctx.PathParams["id"])
+	})
+	// 只有描述的路由不會創建節點，不會擋住參數路由
+	server.Describe(http.MethodGet, "/user/profile", web.RouteMeta{Summary: "none"})
+	server.Describe(http.MethodGet, "/user/:name", web.RouteMeta{Summary: "none"})
+
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/user/profile", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "profile", recorder.Body.String())
+}
+
+// RouteInfo 和 web.RouteInfo 同名
+type RouteInfo struct {
+	Id int64 `json:"id"`
+}
+
+func TestBuilder_SameName(t *testing.T) {
+	server := web.NewHttpServer()
+	server.Get("/route", func(ctx *web.Context) {})
+	server.Describe(http.MethodGet, "/route", web.RouteMeta{
+		Request:   RouteInfo{},
+		Responses: map[int]any{http.StatusOK: web.RouteInfo{}},
+	})
+
+	spec := NewBuilder("route", "v1").Build(server.Routes())
+	op := spec.Paths["/route"]["get"]
+	assert.Equal(t, "#/components/schemas/geektime-go.web.openapi.RouteInfo",
+		op.RequestBody.Content["application/json"].Schema.Ref)
+	assert.Equal(t, "#/components/schemas/geektime-go.web.RouteInfo",
+		op.Responses["200"].Content["application/json"].Schema.Ref)
+	assert.Len(t, spec.Components.Schemas, 3)
+}
+
+func keys(paths map[string]PathItem) []string {
+	res := make([]string, 0, len(paths))
+	for k := range paths {
+		res = append(res, k)
+	}
+	return res
+}
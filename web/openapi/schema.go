@@ -0,0 +1,116 @@
+package openapi
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaOf 把 Go 類型轉換為 JSON schema
+// 具名的結構體會放進 components，返回 $ref，同時避免遞歸類型無限展開
+func (b *Builder) schemaOf(typ reflect.Type, components map[string]*Schema) *Schema {
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if typ == timeType {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+	switch typ.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		// []byte 在 encoding/json 裡面是 base64 字符串
+		if typ.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: b.schemaOf(typ.Elem(), components)}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: b.schemaOf(typ.Elem(), components)}
+	case reflect.Struct:
+		if typ.Name() == "" {
+			return b.structSchema(typ, components)
+		}
+		name := schemaName(typ)
+		ref := &Schema{Ref: "#/components/schemas/" + name}
+		if _, ok := components[name]; ok {
+			return ref
+		}
+		// 先佔位，處理遞歸引用自己的情況
+		components[name] = &Schema{}
+		components[name] = b.structSchema(typ, components)
+		return ref
+	default:
+		// interface 等無法確定類型的，允許任意值
+		return &Schema{}
+	}
+}
+
+func (b *Builder) structSchema(typ reflect.Type, components map[string]*Schema) *Schema {
+	res := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	b.fillFields(res, typ, components)
+	return res
+}
+
+// fillFields 按照 encoding/json 的規則處理字段
+// 沒有 omitempty 的字段視為必填
+func (b *Builder) fillFields(res *Schema, typ reflect.Type, components map[string]*Schema) {
+	for i := 0; i < typ.NumField(); i++ {
+		fd := typ.Field(i)
+		tag := fd.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		// 組合的結構體，字段會被展開
+		if fd.Anonymous && name == "" {
+			ft := fd.Type
+			for ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				b.fillFields(res, ft, components)
+				continue
+			}
+		}
+		if !fd.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = fd.Name
+		}
+		res.Properties[name] = b.schemaOf(fd.Type, components)
+		if !strings.Contains(opts, "omitempty") {
+			res.Required = append(res.Required, name)
+		}
+	}
+}
+
+// schemaName 用包路徑限定類型名，避免不同包的同名類型衝突
+// OpenAPI 的 component 名字只允許 [a-zA-Z0-9._-]，所以 "/" 轉換為 "."，其他字符轉換為 "_"
+// e.g. geektime-go/web/openapi.User => geektime-go.web.openapi.User
+func schemaName(typ reflect.Type) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9',
+			r == '.', r == '-', r == '_':
+			return r
+		case r == '/':
+			return '.'
+		default:
+			return '_'
+		}
+	}, typ.PkgPath()+"."+typ.Name())
+}
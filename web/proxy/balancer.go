@@ -0,0 +1,35 @@
+package proxy
+
+import (
+	"math/rand"
+	"sync/atomic"
+)
+
+// Balancer 負載均衡策略
+// targets 是當前可用的節點，已經過濾掉健康檢查失敗和熔斷中的節點
+type Balancer interface {
+	Pick(targets []*Target) *Target
+}
+
+// RoundRobinBalancer 輪詢
+type RoundRobinBalancer struct {
+	cnt uint64
+}
+
+func (r *RoundRobinBalancer) Pick(targets []*Target) *Target {
+	if len(targets) == 0 {
+		return nil
+	}
+	idx := atomic.AddUint64(&r.cnt, 1) - 1
+	return targets[idx%uint64(len(targets))]
+}
+
+// RandomBalancer 隨機
+type RandomBalancer struct{}
+
+func (r RandomBalancer) Pick(targets []*Target) *Target {
+	if len(targets) == 0 {
+		return nil
+	}
+	return targets[rand.Intn(len(targets))]
+}
@@ -0,0 +1,413 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"geektime-go/web"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	errNoTarget = errors.New("web: proxy 沒有上游節點")
+)
+
+// hopHeaders 只在單跳有效的 header，轉發時需要移除
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// Target 上游節點
+type Target struct {
+	URL *url.URL
+	// 1 代表健康，健康檢查會更新這個值
+	healthy int32
+	breaker *breaker
+}
+
+func (t *Target) Healthy() bool {
+	return atomic.LoadInt32(&t.healthy) == 1
+}
+
+func (t *Target) setHealthy(healthy bool) {
+	var val int32
+	if healthy {
+		val = 1
+	}
+	atomic.StoreInt32(&t.healthy, val)
+}
+
+// HandlerBuilder 構造反向代理的 HandleFunc
+// 搭配 Router 使用，匹配到的路由會被轉發到上游節點
+//
+//	builder, _ := proxy.NewBuilder("http://10.0.0.1:8080", "http://10.0.0.2:8080")
+//	server.Get("/user/:id", builder.Rewrite("/api/users/:id").Retry(2).Build())
+type HandlerBuilder struct {
+	targets  []*Target
+	balancer Balancer
+	client   *http.Client
+
+	rewrite        string
+	setReqHeaders  map[string]string
+	delReqHeaders  []string
+	setRespHeaders map[string]string
+	delRespHeaders []string
+
+	// 冪等請求的重試次數，不包含第一次請求
+	retries int
+
+	healthPath     string
+	healthInterval time.Duration
+	healthOnce     sync.Once
+	close          chan struct{}
+	closeOnce      sync.Once
+}
+
+func NewBuilder(targets ...string) (*HandlerBuilder, error) {
+	if len(targets) == 0 {
+		return nil, errNoTarget
+	}
+	res := &HandlerBuilder{
+		targets:  make([]*Target, 0, len(targets)),
+		balancer: &RoundRobinBalancer{},
+		client: &http.Client{
+			// 重定向交給下游的客戶端處理
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		setReqHeaders:  map[string]string{},
+		setRespHeaders: map[string]string{},
+		close:          make(chan struct{}),
+	}
+	for _, t := range targets {
+		u, err := url.Parse(t)
+		if err != nil {
+			return nil, fmt.Errorf("web: proxy 上游節點 %s 不合法: %w", t, err)
+		}
+		res.targets = append(res.targets, &Target{
+			URL:     u,
+			healthy: 1,
+			breaker: &breaker{},
+		})
+	}
+	return res, nil
+}
+
+func (b *HandlerBuilder) Balancer(balancer Balancer) *HandlerBuilder {
+	b.balancer = balancer
+	return b
+}
+
+// Transport 上游請求使用的 http.RoundTripper
+func (b *HandlerBuilder) Transport(rt http.RoundTripper) *HandlerBuilder {
+	b.client.Transport = rt
+	return b
+}
+
+// Rewrite 改寫轉發到上游的路徑
+// 路徑裡面 :param 形式的字段，會被替換為 ctx.PathParams 裡面對應的值
+// e.g. 路由 /user/:id，Rewrite("/api/users/:id")，/user/123 => /api/users/123
+func (b *HandlerBuilder) Rewrite(path string) *HandlerBuilder {
+	b.rewrite = path
+	return b
+}
+
+// SetRequestHeader 轉發前設置請求的 header
+func (b *HandlerBuilder) SetRequestHeader(key, val string) *HandlerBuilder {
+	b.setReqHeaders[key] = val
+	return b
+}
+
+// DelRequestHeader 轉發前刪除請求的 header
+func (b *HandlerBuilder) DelRequestHeader(keys ...string) *HandlerBuilder {
+	b.delReqHeaders = append(b.delReqHeaders, keys...)
+	return b
+}
+
+// SetResponseHeader 返回前設置響應的 header
+func (b *HandlerBuilder) SetResponseHeader(key, val string) *HandlerBuilder {
+	b.setRespHeaders[key] = val
+	return b
+}
+
+// DelResponseHeader 返回前刪除響應的 header
+func (b *HandlerBuilder) DelResponseHeader(keys ...string) *HandlerBuilder {
+	b.delRespHeaders = append(b.delRespHeaders, keys...)
+	return b
+}
+
+// Retry 冪等請求(GET、HEAD、PUT、DELETE 等)失敗或是上游返回 5xx 時的重試次數
+// 重試會優先挑選還沒試過的節點
+func (b *HandlerBuilder) Retry(retries int) *HandlerBuilder {
+	b.retries = retries
+	return b
+}
+
+// CircuitBreaker 每個節點連續失敗 threshold 次之後熔斷，cooldown 之後放行一個請求試探
+func (b *HandlerBuilder) CircuitBreaker(threshold int, cooldown time.Duration) *HandlerBuilder {
+	for _, t := range b.targets {
+		t.breaker = &breaker{threshold: threshold, cooldown: cooldown}
+	}
+	return b
+}
+
+// HealthCheck 每隔 interval 對每個節點發送 GET path，返回 2xx、3xx 視為健康
+// 在 Build 的時候啟動，調用 Close 停止
+func (b *HandlerBuilder) HealthCheck(path string, interval time.Duration) *HandlerBuilder {
+	b.healthPath = path
+	b.healthInterval = interval
+	return b
+}
+
+// Targets 返回所有上游節點
+func (b *HandlerBuilder) Targets() []*Target {
+	return b.targets
+}
+
+// Close 停止健康檢查
+func (b *HandlerBuilder) Close() error {
+	b.closeOnce.Do(func() {
+		close(b.close)
+	})
+	return nil
+}
+
+func (b *HandlerBuilder) Build() web.HandleFunc {
+	if b.healthPath != "" && b.healthInterval > 0 {
+		b.healthOnce.Do(func() {
+			go b.healthCheckLoop()
+		})
+	}
+	return func(ctx *web.Context) {
+		var body []byte
+		if ctx.Req.Body != nil {
+			// 重試需要重放 body，所以先讀出來
+			var err error
+			body, err = io.ReadAll(ctx.Req.Body)
+			if err != nil {
+				ctx.RespStatusCode = http.StatusBadRequest
+				ctx.RespData = []byte("web: proxy 讀取請求 body 失敗")
+				return
+			}
+		}
+
+		attempts := 1
+		if isIdempotent(ctx.Req.Method) {
+			attempts += b.retries
+		}
+		tried := make(map[*Target]bool, attempts)
+		var lastErr error
+		for i := 0; i < attempts; i++ {
+			target := b.pick(tried)
+			if target == nil {
+				break
+			}
+			tried[target] = true
+			if !target.breaker.allow(time.Now()) {
+				continue
+			}
+			resp, err := b.do(ctx, target, body)
+			if err != nil {
+				target.breaker.failure(time.Now())
+				lastErr = err
+				continue
+			}
+			if resp.StatusCode >= http.StatusInternalServerError {
+				target.breaker.failure(time.Now())
+				// 最後一次嘗試，直接把上游的錯誤返回給客戶端
+				if i < attempts-1 {
+					_ = resp.Body.Close()
+					continue
+				}
+			} else {
+				target.breaker.success()
+			}
+			b.writeResp(ctx, resp)
+			return
+		}
+
+		if lastErr != nil {
+			ctx.RespStatusCode = http.StatusBadGateway
+			ctx.RespData = []byte("web: proxy 上游請求失敗")
+			return
+		}
+		ctx.RespStatusCode = http.StatusServiceUnavailable
+		ctx.RespData = []byte("web: proxy 沒有可用的上游節點")
+	}
+}
+
+// pick 從健康且沒有熔斷的節點中挑選
+// 優先挑選這一次請求還沒嘗試過的節點
+func (b *HandlerBuilder) pick(tried map[*Target]bool) *Target {
+	now := time.Now()
+	candidates := make([]*Target, 0, len(b.targets))
+	for _, t := range b.targets {
+		if !tried[t] && t.Healthy() && t.breaker.available(now) {
+			candidates = append(candidates, t)
+		}
+	}
+	if len(candidates) == 0 {
+		for _, t := range b.targets {
+			if t.Healthy() && t.breaker.available(now) {
+				candidates = append(candidates, t)
+			}
+		}
+	}
+	return b.balancer.Pick(candidates)
+}
+
+func (b *HandlerBuilder) do(ctx *web.Context, target *Target, body []byte) (*http.Response, error) {
+	u := *target.URL
+	u.Path = joinPath(target.URL.Path, b.path(ctx))
+	u.RawPath = ""
+	u.RawQuery = ctx.Req.URL.RawQuery
+
+	var reader io.Reader = http.NoBody
+	if len(body) > 0 {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx.Req.Context(), ctx.Req.Method, u.String(), reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = ctx.Req.Header.Clone()
+	if req.Header == nil {
+		req.Header = make(http.Header)
+	}
+	removeHopHeaders(req.Header)
+	if ip, _, err := net.SplitHostPort(ctx.Req.RemoteAddr); err == nil {
+		if prior := req.Header.Get("X-Forwarded-For"); prior != "" {
+			ip = prior + ", " + ip
+		}
+		req.Header.Set("X-Forwarded-For", ip)
+	}
+	if ctx.Req.Host != "" {
+		req.Header.Set("X-Forwarded-Host", ctx.Req.Host)
+	}
+	for k, v := range b.setReqHeaders {
+		req.Header.Set(k, v)
+	}
+	for _, k := range b.delReqHeaders {
+		req.Header.Del(k)
+	}
+	return b.client.Do(req)
+}
+
+func (b *HandlerBuilder) writeResp(ctx *web.Context, resp *http.Response) {
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		ctx.RespStatusCode = http.StatusBadGateway
+		ctx.RespData = []byte("web: proxy 讀取上游響應失敗")
+		return
+	}
+	header := ctx.Resp.Header()
+	for k, vals := range resp.Header {
+		header[k] = vals
+	}
+	removeHopHeaders(header)
+	for k, v := range b.setRespHeaders {
+		header.Set(k, v)
+	}
+	for _, k := range b.delRespHeaders {
+		header.Del(k)
+	}
+	ctx.RespStatusCode = resp.StatusCode
+	ctx.RespData = data
+}
+
+// path 轉發到上游的路徑
+func (b *HandlerBuilder) path(ctx *web.Context) string {
+	if b.rewrite == "" {
+		return ctx.Req.URL.Path
+	}
+	segs := strings.Split(b.rewrite, "/")
+	for i, seg := range segs {
+		if len(seg) > 1 && seg[0] == ':' {
+			segs[i] = ctx.PathParams[seg[1:]]
+		}
+	}
+	return strings.Join(segs, "/")
+}
+
+func (b *HandlerBuilder) healthCheckLoop() {
+	ticker := time.NewTicker(b.healthInterval)
+	defer ticker.Stop()
+	client := &http.Client{
+		Transport: b.client.Transport,
+		Timeout:   b.healthInterval,
+	}
+	for {
+		select {
+		case <-ticker.C:
+			var wg sync.WaitGroup
+			wg.Add(len(b.targets))
+			for _, t := range b.targets {
+				go func(t *Target) {
+					defer wg.Done()
+					t.setHealthy(checkHealth(client, t, b.healthPath))
+				}(t)
+			}
+			wg.Wait()
+		case <-b.close:
+			return
+		}
+	}
+}
+
+func checkHealth(client *http.Client, target *Target, path string) bool {
+	u := *target.URL
+	u.Path = joinPath(target.URL.Path, path)
+	resp, err := client.Get(u.String())
+	if err != nil {
+		return false
+	}
+	_ = resp.Body.Close()
+	return resp.StatusCode < http.StatusBadRequest
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace,
+		http.MethodPut, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+func removeHopHeaders(header http.Header) {
+	for _, h := range hopHeaders {
+		header.Del(h)
+	}
+}
+
+func joinPath(a, b string) string {
+	aSlash := strings.HasSuffix(a, "/")
+	bSlash := strings.HasPrefix(b, "/")
+	switch {
+	case aSlash && bSlash:
+		return a + b[1:]
+	case !aSlash && !bSlash:
+		return a + "/" + b
+	}
+	return a + b
+}
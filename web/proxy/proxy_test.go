@@ -0,0 +1,260 @@
+package proxy
+
+import (
+	"geektime-go/web"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHandlerBuilder_Build(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Upstream", "user")
+		w.Header().Set("X-Secret", "secret")
+		_, _ = w.Write([]byte(r.Method + " " + r.URL.String() + " " +
+			r.Header.Get("X-Gateway") + " " + r.Header.Get("Authorization") + " " + string(body)))
+	}))
+	defer upstream.Close()
+
+	testCases := []struct {
+		name    string
+		builder func() *HandlerBuilder
+		route   string
+		req     func() *http.Request
+
+		wantCode   int
+		wantData   string
+		wantHeader http.Header
+	}{
+		{
+			name: "forward",
+			builder: func() *HandlerBuilder {
+				b, err := NewBuilder(upstream.URL)
+				require.NoError(t, err)
+				return b
+			},
+			route: "/user/:id",
+			req: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, "/user/123?name=Tom", nil)
+			},
+			wantCode: http.StatusOK,
+			wantData: "GET /user/123?name=Tom   ",
+			wantHeader: http.Header{
+				"X-Upstream": []string{"user"},
+				"X-Secret":   []string{"secret"},
+			},
+		},
+		{
+			name: "rewrite",
+			builder: func() *HandlerBuilder {
+				b, err := NewBuilder(upstream.URL + "/api")
+				require.NoError(t, err)
+				return b.Rewrite("/users/:id/profile")
+			},
+			route: "/user/:id",
+			req: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, "/user/123", nil)
+			},
+			wantCode: http.StatusOK,
+			wantData: "GET /api/users/123/profile   ",
+			wantHeader: http.Header{
+				"X-Upstream": []string{"user"},
+				"X-Secret":   []string{"secret"},
+			},
+		},
+		{
+			name: "headers",
+			builder: func() *HandlerBuilder {
+				b, err := NewBuilder(upstream.URL)
+				require.NoError(t, err)
+				return b.SetRequestHeader("X-Gateway", "gw").
+					DelRequestHeader("Authorization").
+					SetResponseHeader("X-Proxy", "web").
+					DelResponseHeader("X-Secret")
+			},
+			route: "/user",
+			req: func() *http.Request {
+				req := httptest.NewRequest(http.MethodPost, "/user", strings.NewReader("Tom"))
+				req.Header.Set("Authorization", "token")
+				return req
+			},
+			wantCode: http.StatusOK,
+			wantData: "POST /user gw  Tom",
+			wantHeader: http.Header{
+				"X-Upstream": []string{"user"},
+				"X-Proxy":    []string{"web"},
+				"X-Secret":   nil,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := web.NewHttpServer()
+			req := tc.req()
+			server.Get(tc.route, tc.builder().Build())
+			server.Post(tc.route, tc.builder().Build())
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, req)
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantData, recorder.Body.String())
+			for k := range tc.wantHeader {
+				assert.Equal(t, tc.wantHeader.Get(k), recorder.Header().Get(k))
+			}
+		})
+	}
+}
+
+func TestHandlerBuilder_LoadBalance(t *testing.T) {
+	newUpstream := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(name))
+		}))
+	}
+	s1, s2 := newUpstream("s1"), newUpstream("s2")
+	defer s1.Close()
+	defer s2.Close()
+
+	b, err := NewBuilder(s1.URL, s2.URL)
+	require.NoError(t, err)
+	server := web.NewHttpServer()
+	server.Get("/", b.Build())
+
+	var res []string
+	for i := 0; i < 4; i++ {
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+		res = append(res, recorder.Body.String())
+	}
+	assert.Equal(t, []string{"s1", "s2", "s1", "s2"}, res)
+}
+
+func TestHandlerBuilder_Retry(t *testing.T) {
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer bad.Close()
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(append([]byte("good "), body...))
+	}))
+	defer good.Close()
+
+	testCases := []struct {
+		name    string
+		retries int
+		method  string
+
+		wantCode int
+		wantData string
+	}{
+		{
+			name:     "retry idempotent",
+			retries:  1,
+			method:   http.MethodGet,
+			wantCode: http.StatusOK,
+			wantData: "good Tom",
+		},
+		{
+			name:     "no retry",
+			method:   http.MethodGet,
+			wantCode: http.StatusBadGateway,
+		},
+		{
+			name:     "not idempotent",
+			retries:  1,
+			method:   http.MethodPost,
+			wantCode: http.StatusBadGateway,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			b, err := NewBuilder(bad.URL, good.URL)
+			require.NoError(t, err)
+			server := web.NewHttpServer()
+			handler := b.Retry(tc.retries).Build()
+			server.Get("/user", handler)
+			server.Post("/user", handler)
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, httptest.NewRequest(tc.method, "/user", strings.NewReader("Tom")))
+			assert.Equal(t, tc.wantCode, recorder.Code)
+			assert.Equal(t, tc.wantData, recorder.Body.String())
+		})
+	}
+}
+
+func TestHandlerBuilder_CircuitBreaker(t *testing.T) {
+	var cnt int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&cnt, 1) <= 2 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+
+	b, err := NewBuilder(upstream.URL)
+	require.NoError(t, err)
+	server := web.NewHttpServer()
+	server.Get("/", b.CircuitBreaker(2, time.Millisecond*100).Build())
+	serve := func() int {
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+		return recorder.Code
+	}
+
+	assert.Equal(t, http.StatusInternalServerError, serve())
+	assert.Equal(t, http.StatusInternalServerError, serve())
+	// 連續失敗兩次，熔斷，不會再請求上游
+	assert.Equal(t, http.StatusServiceUnavailable, serve())
+	assert.Equal(t, int32(2), atomic.LoadInt32(&cnt))
+
+	// 冷卻之後放行試探請求，成功就恢復
+	time.Sleep(time.Millisecond * 150)
+	assert.Equal(t, http.StatusOK, serve())
+	assert.Equal(t, http.StatusOK, serve())
+}
+
+func TestHandlerBuilder_HealthCheck(t *testing.T) {
+	var healthy int32 = 1
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" && atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+
+	b, err := NewBuilder(upstream.URL)
+	require.NoError(t, err)
+	defer func() {
+		_ = b.Close()
+	}()
+	server := web.NewHttpServer()
+	server.Get("/", b.HealthCheck("/health", time.Millisecond*10).Build())
+	target := b.Targets()[0]
+
+	atomic.StoreInt32(&healthy, 0)
+	assert.Eventually(t, func() bool {
+		return !target.Healthy()
+	}, time.Second, time.Millisecond*10)
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+
+	atomic.StoreInt32(&healthy, 1)
+	assert.Eventually(t, target.Healthy, time.Second, time.Millisecond*10)
+	recorder = httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+}
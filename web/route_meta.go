@@ -0,0 +1,101 @@
+package web
+
+import (
+	"sort"
+)
+
+// RouteMeta 路由的描述信息，不影響路由匹配，用於生成 API 文檔
+type RouteMeta struct {
+	Summary     string
+	Description string
+	Tags        []string
+	// Request 請求 body 對應的 Go 類型的值，e.g. User{}、&User{}
+	Request any
+	// Responses 狀態碼與響應 body 對應的 Go 類型的值
+	// 值為 nil 代表該狀態碼沒有 body
+	Responses map[int]any
+}
+
+// RouteInfo 已註冊的路由
+type RouteInfo struct {
+	// Host 虛擬主機的 pattern，e.g. aaa.com、*.example.com，默認路由為空
+	Host   string
+	Method string
+	// Path 註冊時候的路由，e.g. /user/:id、/order/:id(^[0-9]+$)、/static/*
+	Path string
+	Meta *RouteMeta
+}
+
+// Describe 為路由添加描述信息
+// 和 UseV1 一樣，與 Get/Post 等方法的調用順序不影響結果
+// 描述信息單獨保存，不會在路由樹上創建節點，所以不會影響路由匹配
+func (h *HttpServer) Describe(method string, path string, meta RouteMeta) {
+	h.router.describe(method, path, meta)
+}
+
+// Routes 返回所有註冊了 handler 的路由，包括虛擬主機上的路由
+// 按照 host、path、method 排序，默認路由排在最前面
+func (h *HttpServer) Routes() []RouteInfo {
+	res := h.router.routes("")
+	for _, vh := range h.hosts.exact {
+		res = append(res, vh.router.routes(vh.pattern)...)
+	}
+	for _, vh := range h.hosts.patterns {
+		res = append(res, vh.router.routes(vh.pattern)...)
+	}
+	sortRoutes(res)
+	return res
+}
+
+// Describe 為虛擬主機上的路由添加描述信息
+func (v *VirtualHost) Describe(method string, path string, meta RouteMeta) {
+	v.router.describe(method, path, meta)
+}
+
+func (r *Router) describe(method string, path string, meta RouteMeta) {
+	if r.metas == nil {
+		r.metas = make(map[string]*RouteMeta)
+	}
+	r.metas[method+" "+path] = &meta
+}
+
+func (r *Router) routes(host string) []RouteInfo {
+	res := make([]RouteInfo, 0, 16)
+	for method, root := range r.trees {
+		// DFS 遍歷整棵樹
+		stack := []*node{root}
+		for len(stack) > 0 {
+			n := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if n.handler != nil {
+				res = append(res, RouteInfo{
+					Host:   host,
+					Method: method,
+					Path:   n.route,
+					Meta:   r.metas[method+" "+n.route],
+				})
+			}
+			for _, c := range n.children {
+				stack = append(stack, c)
+			}
+			for _, c := range []*node{n.paramChild, n.regChild, n.starChild} {
+				if c != nil {
+					stack = append(stack, c)
+				}
+			}
+		}
+	}
+	return res
+}
+
+func sortRoutes(res []RouteInfo) {
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Host != res[j].Host {
+			return res[i].Host < res[j].Host
+		}
+		if res[i].Path != res[j].Path {
+			return res[i].Path < res[j].Path
+		}
+		return res[i].Method < res[j].Method
+	})
+}
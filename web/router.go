@@ -47,6 +47,8 @@ type node struct {
 // Router tree
 type Router struct {
 	trees map[string]*node
+	// 路由的描述信息，用於生成 API 文檔，key 為 method + " " + path
+	metas map[string]*RouteMeta
 }
 
 type matchInfo struct {
@@ -63,6 +65,20 @@ func NewRouter() *Router {
 // and same parameter path covered by the behind one,
 // method as http method
 func (r *Router) addRoute(method string, path string, handlerFunc HandleFunc, mdls ...Middleware) {
+	root := r.nodeOrCreate(method, path)
+	if root.handler != nil && handlerFunc != nil {
+		// route "/" register twice
+		if path == "/" {
+			panic("web: the route conflicts, register twice")
+		}
+		panic(fmt.Sprintf("web: the route conflicts, %s register twice", path))
+	}
+	// there is a handleFunc at the leaf
+	root.setHandler(path, handlerFunc, mdls)
+}
+
+// nodeOrCreate 找到 path 對應的節點，不存在的節點會被創建
+func (r *Router) nodeOrCreate(method string, path string) *node {
 	if path == "" {
 		panic("web: path is empty")
 	}
@@ -89,14 +105,7 @@ func (r *Router) addRoute(method string, path string, handlerFunc HandleFunc, md
 
 	// handle root "/"
 	if path == "/" {
-		// route "/" register twice
-		if root.handler != nil {
-			panic("web: the route conflicts, register twice")
-		}
-		root.handler = handlerFunc
-		root.route = "/"
-		root.middlewares = mdls
-		return
+		return root
 	}
 
 	// avoid first segment "/"
@@ -110,13 +119,18 @@ func (r *Router) addRoute(method string, path string, handlerFunc HandleFunc, md
 		// create node if it does not exist
 		root = root.childOrCreate(seg)
 	}
-	if root.handler != nil {
-		panic(fmt.Sprintf("web: the route conflicts, %s register twice", path))
+	return root
+}
+
+// setHandler 註冊 handler 與路由級別的 middleware
+// handler 為 nil 時，代表只註冊 middleware (e.g. UseV1)，不覆蓋已有的 handler
+// 所以 UseV1 與 Get/Post 等註冊順序不影響結果
+func (n *node) setHandler(path string, handlerFunc HandleFunc, mdls []Middleware) {
+	if handlerFunc != nil {
+		n.handler = handlerFunc
 	}
-	// there is a handleFunc at the leaf
-	root.handler = handlerFunc
-	root.route = path
-	root.middlewares = mdls
+	n.route = path
+	n.middlewares = append(n.middlewares, mdls...)
 }
 
 func (r *Router) findRoute(method string, path string) (*matchInfo, bool) {
@@ -387,6 +401,8 @@ func (n *node) childOrCreateWithParam(path string, paraString string) *node {
 		if n.paramChild.path != path {
 			panic(fmt.Sprintf("web: parameter route conflict, had %s, new %s", n.paramChild.path, path))
 		}
+		// 同一個參數路由重複註冊 (e.g. 先 UseV1 再 Get)，沿用已有節點
+		return n.paramChild
 	}
 	if n.regChild != nil {
 		panic(fmt.Sprintf("web: regexpr route conflict, had %s, new %s", n.regChild.path, path))
@@ -406,9 +422,10 @@ func (n *node) childOrCreateWithRegExp(path string, paraString string, regExpPat
 		}
 	}
 	if n.regChild != nil {
-		if n.regChild.reqExpPattern.String() != regExpPattern || n.paramString != paraString {
+		if n.regChild.reqExpPattern.String() != regExpPattern || n.regChild.paramString != paraString {
 			panic(fmt.Sprintf("web: regexpr route conflict, had %s, new %s", n.regChild.path, path))
 		}
+		return n.regChild
 	}
 	regExp, err := regexp.Compile(regExpPattern)
 	if err != nil {
@@ -21,6 +21,8 @@ var _ Server = &HttpServer{}
 type HttpServer struct {
 	router      *Router
 	middlewares []Middleware
+	// 虛擬主機，匹配不到的請求交給 router 處理
+	hosts hostRouter
 
 	log       func(msg string, args ...any)
 	tplEngine TemplateEngine
@@ -85,6 +87,11 @@ func (h *HttpServer) ServeHTTP(writer http.ResponseWriter, request *http.Request
 	//h.serve(ctx)
 	// server級別的中間件(middleware)
 	root := h.serve // last one
+	// 按照 Host 找虛擬主機，虛擬主機有自己的路由樹和 middleware
+	if vh, params, ok := h.hosts.find(request.Host); ok {
+		ctx.HostParams = params
+		root = vh.handler()
+	}
 	// bind the middlewares
 	// 從後到前組裝
 	for i := len(h.middlewares) - 1; i >= 0; i-- {
@@ -109,6 +116,13 @@ func (h *HttpServer) Use(mdls ...Middleware) {
 	h.middlewares = append(h.middlewares, mdls...)
 }
 
+// Host 返回 pattern 對應的虛擬主機，不存在則創建
+// pattern 支持完全匹配 (aaa.com)、參數 (:tenant.example.com) 和最左邊的通配符 (*.example.com)
+// server 級別的 middleware 同樣作用在虛擬主機上
+func (h *HttpServer) Host(pattern string) *VirtualHost {
+	return h.hosts.hostOrCreate(pattern)
+}
+
 func (h *HttpServer) UseV1(method string, path string, mdls ...Middleware) {
 	h.addRoute(method, path, nil, mdls...)
 }
@@ -134,20 +148,28 @@ func (h *HttpServer) addRoute(method string, path string, handler HandleFunc, md
 	h.router.addRoute(method, path, handler, mdls...)
 }
 
-func (h *HttpServer) Get(path string, handleFunc HandleFunc) {
-	h.addRoute(http.MethodGet, path, handleFunc)
+// Get 註冊 GET 路由，mdls 為路由級別的 middleware
+// 會被同一個方法下面的子路由繼承，e.g. 註冊在 /user 上的也會作用在 /user/:id，祖先的先執行
+func (h *HttpServer) Get(path string, handleFunc HandleFunc, mdls ...Middleware) {
+	h.addRoute(http.MethodGet, path, handleFunc, mdls...)
 }
 
-func (h *HttpServer) Post(path string, handleFunc HandleFunc) {
-	h.addRoute(http.MethodPost, path, handleFunc)
+// Post 註冊 POST 路由，mdls 為路由級別的 middleware
+// 會被同一個方法下面的子路由繼承，e.g. 註冊在 /user 上的也會作用在 /user/:id，祖先的先執行
+func (h *HttpServer) Post(path string, handleFunc HandleFunc, mdls ...Middleware) {
+	h.addRoute(http.MethodPost, path, handleFunc, mdls...)
 }
 
 func (h *HttpServer) serve(ctx *Context) {
+	serveRouter(h.router, ctx)
+}
+
+func serveRouter(router *Router, ctx *Context) {
 	// find route
 	// before route
-	route, ok := h.router.findRouteWithMiddleware(ctx.Req.Method, ctx.Req.URL.Path)
+	route, ok := router.findRouteWithMiddleware(ctx.Req.Method, ctx.Req.URL.Path)
 	// after route
-	if !ok || route.node.handler == nil || route.node == nil {
+	if !ok || route.node == nil || route.node.handler == nil {
 		ctx.Resp.WriteHeader(http.StatusNotFound)
 		ctx.Resp.Write([]byte("Not found"))
 		return
@@ -156,8 +178,13 @@ func (h *HttpServer) serve(ctx *Context) {
 	if route.node != nil {
 		ctx.MatchedRoute = route.node.route
 	}
+	// 路由級別的 middleware，從後到前組裝
+	root := route.node.handler
+	for i := len(route.middlewares) - 1; i >= 0; i-- {
+		root = route.middlewares[i](root)
+	}
 	// before execute
-	route.node.handler(ctx)
+	root(ctx)
 	// after execute
 }
 
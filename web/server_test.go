@@ -2,7 +2,9 @@ package web
 
 import (
 	"fmt"
+	"github.com/stretchr/testify/assert"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 )
 
@@ -36,3 +38,46 @@ func TestHTTPServer_ServeHTTP(t *testing.T) {
 	}
 	server.ServeHTTP(nil, &http.Request{})
 }
+
+// TestHttpServer_RouteMiddleware 路由級別的 middleware 會被子路由繼承
+func TestHttpServer_RouteMiddleware(t *testing.T) {
+	mdlBuilder := func(name string) Middleware {
+		return func(next HandleFunc) HandleFunc {
+			return func(ctx *Context) {
+				ctx.Resp.Header().Add("X-Mdl", name)
+				next(ctx)
+			}
+		}
+	}
+	handler := func(ctx *Context) {
+		_ = ctx.RespOk("ok")
+	}
+	server := NewHttpServer()
+	server.Get("/user", handler, mdlBuilder("user"))
+	server.Get("/user/:id", handler, mdlBuilder("id"))
+	server.Get("/user/:id/profile", handler)
+	server.Get("/order", handler)
+	server.Post("/user/:id", handler)
+
+	testCases := []struct {
+		name     string
+		method   string
+		path     string
+		wantMdls []string
+	}{
+		{name: "own", method: http.MethodGet, path: "/user", wantMdls: []string{"user"}},
+		{name: "child", method: http.MethodGet, path: "/user/123", wantMdls: []string{"user", "id"}},
+		{name: "descendant", method: http.MethodGet, path: "/user/123/profile", wantMdls: []string{"user", "id"}},
+		{name: "sibling", method: http.MethodGet, path: "/order"},
+		// 不同的方法是不同的路由樹
+		{name: "other method", method: http.MethodPost, path: "/user/123"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, httptest.NewRequest(tc.method, tc.path, nil))
+			assert.Equal(t, http.StatusOK, recorder.Code)
+			assert.Equal(t, tc.wantMdls, recorder.Header().Values("X-Mdl"))
+		})
+	}
+}
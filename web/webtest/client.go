@@ -0,0 +1,152 @@
+package webtest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// defaultHost 請求只有 path 的時候使用的 host
+const defaultHost = "example.com"
+
+// Client 不監聽端口，直接在進程內調用 http.Handler (e.g. *web.HttpServer) 的 ServeHTTP
+// 支持 cookie、重定向，也可以按照 Host 把請求分發到不同的 server，模擬多個站點
+//
+//	c := webtest.NewClient(t, server)
+//	c.Get("/user/123").Do().AssertStatus(http.StatusOK).AssertJSON("name", "Tom")
+type Client struct {
+	t testing.TB
+	// host 到 handler 的映射，host 可以帶端口
+	hosts map[string]http.Handler
+	// 匹配不到 host 的時候使用，可以為 nil
+	def http.Handler
+
+	jar             http.CookieJar
+	followRedirects bool
+	maxRedirects    int
+}
+
+// NewClient handler 為預設的 server，可以為 nil，只透過 Host 註冊
+func NewClient(t testing.TB, handler http.Handler) *Client {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatalf("webtest: 創建 cookie jar 失敗: %v", err)
+	}
+	return &Client{
+		t:               t,
+		hosts:           map[string]http.Handler{},
+		def:             handler,
+		jar:             jar,
+		followRedirects: true,
+		maxRedirects:    10,
+	}
+}
+
+// Host 把發往 host 的請求交給 handler 處理
+// host 帶端口的時候優先完全匹配，其次匹配不帶端口的部分
+func (c *Client) Host(host string, handler http.Handler) *Client {
+	c.hosts[host] = handler
+	return c
+}
+
+// FollowRedirects 是否自動跟隨重定向，預設為 true
+func (c *Client) FollowRedirects(follow bool) *Client {
+	c.followRedirects = follow
+	return c
+}
+
+// Jar 返回 client 使用的 cookie jar
+func (c *Client) Jar() http.CookieJar {
+	return c.jar
+}
+
+// Transport 返回在進程內分發請求的 http.RoundTripper
+// 可以注入到業務代碼使用的 http.Client，讓 server 之間的調用也不需要監聽端口
+func (c *Client) Transport() http.RoundTripper {
+	return roundTripper{c: c}
+}
+
+// HTTPClient 返回使用 Transport 的 http.Client，不攜帶 cookie，也不跟隨重定向
+// 用於注入到 server 端的代碼裡面
+func (c *Client) HTTPClient() *http.Client {
+	return &http.Client{
+		Transport: c.Transport(),
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func (c *Client) Get(url string) *Request {
+	return c.NewRequest(http.MethodGet, url)
+}
+
+func (c *Client) Post(url string) *Request {
+	return c.NewRequest(http.MethodPost, url)
+}
+
+func (c *Client) Put(url string) *Request {
+	return c.NewRequest(http.MethodPut, url)
+}
+
+func (c *Client) Delete(url string) *Request {
+	return c.NewRequest(http.MethodDelete, url)
+}
+
+// NewRequest url 可以只有 path，此時 host 為 example.com
+func (c *Client) NewRequest(method string, url string) *Request {
+	if strings.HasPrefix(url, "/") {
+		url = "http://" + defaultHost + url
+	}
+	return &Request{
+		c:      c,
+		method: method,
+		url:    url,
+		header: http.Header{},
+	}
+}
+
+func (c *Client) handler(host string) (http.Handler, error) {
+	if h, ok := c.hosts[host]; ok {
+		return h, nil
+	}
+	if idx := strings.LastIndex(host, ":"); idx > 0 {
+		if h, ok := c.hosts[host[:idx]]; ok {
+			return h, nil
+		}
+	}
+	if c.def != nil {
+		return c.def, nil
+	}
+	return nil, fmt.Errorf("webtest: 沒有處理 host %s 的 server", host)
+}
+
+type roundTripper struct {
+	c *Client
+}
+
+func (r roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	h, err := r.c.handler(req.URL.Host)
+	if err != nil {
+		return nil, err
+	}
+	// 轉換成 server 端收到的請求
+	sreq := req.Clone(req.Context())
+	if sreq.Host == "" {
+		sreq.Host = req.URL.Host
+	}
+	sreq.RequestURI = req.URL.RequestURI()
+	sreq.RemoteAddr = "192.0.2.1:1234"
+	if sreq.Body == nil {
+		sreq.Body = http.NoBody
+	}
+
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, sreq)
+	resp := recorder.Result()
+	resp.Request = req
+	return resp, nil
+}
@@ -0,0 +1,95 @@
+package webtest
+
+import (
+	"geektime-go/web"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"html/template"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+type User struct {
+	Name string   `json:"name"`
+	Tags []string `json:"tags"`
+}
+
+func TestClient(t *testing.T) {
+	tpl, err := template.New("hello.gohtml").Parse(`hello, {{.Name}}`)
+	require.NoError(t, err)
+	server := web.NewHttpServer(web.ServerWithTemplateEngine(
+		NewTemplateRecorder(&web.GoTemplateEngine{T: tpl})))
+	server.Post("/user", func(ctx *web.Context) {
+		var u User
+		if err := ctx.BindJSON(&u); err != nil {
+			_ = ctx.RespServerError(err.Error())
+			return
+		}
+		ctx.Resp.Header().Set("X-User", u.Name)
+		_ = ctx.RespJSONOK(map[string]any{"user": u, "id": 123})
+	})
+	server.Post("/login", func(ctx *web.Context) {
+		name, _ := ctx.FormValue("name")
+		ctx.SetCookie(&http.Cookie{Name: "sessid", Value: name})
+		ctx.Redirect("/profile")
+	})
+	server.Get("/profile", func(ctx *web.Context) {
+		ck, err := ctx.Req.Cookie("sessid")
+		if err != nil {
+			_ = ctx.RespString(http.StatusUnauthorized, "not login")
+			return
+		}
+		_ = ctx.Render("hello.gohtml", User{Name: ck.Value})
+	})
+
+	c := NewClient(t, server)
+
+	c.Post("/user").JSON(User{Name: "Tom", Tags: []string{"a", "b"}}).Do().
+		AssertStatus(http.StatusOK).
+		AssertHeader("X-User", "Tom").
+		AssertJSON("id", 123).
+		AssertJSON("user.name", "Tom").
+		AssertJSON("user.tags.1", "b").
+		AssertJSON("user", User{Name: "Tom", Tags: []string{"a", "b"}})
+
+	c.Get("/profile").Do().AssertStatus(http.StatusUnauthorized).AssertBody("not login")
+
+	// 不跟隨重定向
+	c.FollowRedirects(false)
+	c.Post("/login").Form(url.Values{"name": []string{"Tom"}}).Do().
+		AssertStatus(http.StatusFound).
+		AssertRedirect("/profile")
+
+	// 跟隨重定向，並且帶上 cookie
+	c.FollowRedirects(true)
+	resp := c.Post("/login").Form(url.Values{"name": []string{"Jerry"}}).Do().
+		AssertStatus(http.StatusOK).
+		AssertURL("http://example.com/profile").
+		AssertBody("hello, Jerry")
+	assert.Equal(t, User{Name: "Jerry"}, resp.AssertTemplate("hello.gohtml"))
+
+	// 單次請求的 cookie
+	c.Get("/profile").Cookie(&http.Cookie{Name: "sessid", Value: "Tom"}).Do().
+		AssertBody("hello, Tom")
+}
+
+func TestClient_Host(t *testing.T) {
+	newServer := func(name string) *web.HttpServer {
+		server := web.NewHttpServer()
+		server.Get("/", func(ctx *web.Context) {
+			_ = ctx.RespOk(name + " " + ctx.Req.Host)
+		})
+		return server
+	}
+	c := NewClient(t, nil).
+		Host("aaa.com:8081", newServer("a")).
+		Host("bbb.com", newServer("b"))
+
+	c.Get("http://aaa.com:8081/").Do().AssertBody("a aaa.com:8081")
+	c.Get("http://bbb.com:8082/").Do().AssertBody("b bbb.com:8082")
+
+	// 沒有對應 host 的 server
+	_, err := c.HTTPClient().Get("http://ccc.com/")
+	assert.Error(t, err)
+}
@@ -0,0 +1,126 @@
+package webtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// Request 鏈式構造請求，最後調用 Do 發送
+type Request struct {
+	c       *Client
+	method  string
+	url     string
+	header  http.Header
+	query   url.Values
+	cookies []*http.Cookie
+	body    []byte
+}
+
+func (r *Request) Header(key, val string) *Request {
+	r.header.Set(key, val)
+	return r
+}
+
+func (r *Request) Query(key, val string) *Request {
+	if r.query == nil {
+		r.query = url.Values{}
+	}
+	r.query.Add(key, val)
+	return r
+}
+
+// Cookie 只在這一次請求攜帶的 cookie，不會寫進 cookie jar
+func (r *Request) Cookie(ck *http.Cookie) *Request {
+	r.cookies = append(r.cookies, ck)
+	return r
+}
+
+// JSON 把 val 序列化為請求 body
+func (r *Request) JSON(val any) *Request {
+	data, err := json.Marshal(val)
+	if err != nil {
+		r.c.t.Fatalf("webtest: 序列化 JSON 失敗: %v", err)
+	}
+	r.body = data
+	r.header.Set("Content-Type", "application/json")
+	return r
+}
+
+// Form 以 application/x-www-form-urlencoded 發送表單
+func (r *Request) Form(vals url.Values) *Request {
+	r.body = []byte(vals.Encode())
+	r.header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+func (r *Request) Body(body []byte) *Request {
+	r.body = body
+	return r
+}
+
+// Do 發送請求，失敗的時候直接讓測試失敗
+func (r *Request) Do() *Response {
+	r.c.t.Helper()
+	u, err := url.Parse(r.url)
+	if err != nil {
+		r.c.t.Fatalf("webtest: url %s 不合法: %v", r.url, err)
+	}
+	if len(r.query) > 0 {
+		q := u.Query()
+		for k, vals := range r.query {
+			for _, v := range vals {
+				q.Add(k, v)
+			}
+		}
+		u.RawQuery = q.Encode()
+	}
+
+	rs := &renders{}
+	req, err := http.NewRequestWithContext(withRenders(context.Background(), rs),
+		r.method, u.String(), bytes.NewReader(r.body))
+	if err != nil {
+		r.c.t.Fatalf("webtest: 創建請求失敗: %v", err)
+	}
+	req.Header = r.header.Clone()
+	for _, ck := range r.cookies {
+		req.AddCookie(ck)
+	}
+
+	client := &http.Client{
+		Transport: r.c.Transport(),
+		Jar:       r.c.jar,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if !r.c.followRedirects {
+				return http.ErrUseLastResponse
+			}
+			if len(via) >= r.c.maxRedirects {
+				return errors.New("webtest: 重定向次數過多")
+			}
+			return nil
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		r.c.t.Fatalf("webtest: 請求 %s %s 失敗: %v", r.method, r.url, err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		r.c.t.Fatalf("webtest: 讀取響應失敗: %v", err)
+	}
+	return &Response{
+		t:          r.c.t,
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       body,
+		URL:        resp.Request.URL,
+		renders:    rs,
+	}
+}
@@ -0,0 +1,140 @@
+package webtest
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Response 跟隨重定向之後，最後一個響應
+// 所有 Assert 開頭的方法，失敗時標記測試失敗，並返回自身方便鏈式調用
+type Response struct {
+	t          testing.TB
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	// URL 最後一次請求的地址，跟隨重定向時與原本請求的地址不同
+	URL *url.URL
+
+	renders *renders
+}
+
+func (r *Response) AssertStatus(code int) *Response {
+	r.t.Helper()
+	assert.Equal(r.t, code, r.StatusCode, "webtest: 狀態碼不符合預期, body: %s", r.Body)
+	return r
+}
+
+func (r *Response) AssertHeader(key string, val string) *Response {
+	r.t.Helper()
+	assert.Equal(r.t, val, r.Header.Get(key), "webtest: header %s 不符合預期", key)
+	return r
+}
+
+func (r *Response) AssertBody(body string) *Response {
+	r.t.Helper()
+	assert.Equal(r.t, body, string(r.Body))
+	return r
+}
+
+func (r *Response) AssertBodyContains(sub string) *Response {
+	r.t.Helper()
+	assert.Contains(r.t, string(r.Body), sub)
+	return r
+}
+
+// AssertURL 斷言最後一次請求的地址，用於檢查重定向的結果
+func (r *Response) AssertURL(u string) *Response {
+	r.t.Helper()
+	assert.Equal(r.t, u, r.URL.String())
+	return r
+}
+
+// AssertRedirect 斷言重定向的地址，需要關閉 FollowRedirects
+func (r *Response) AssertRedirect(location string) *Response {
+	r.t.Helper()
+	assert.Equal(r.t, location, r.Header.Get("Location"), "webtest: 重定向地址不符合預期")
+	return r
+}
+
+// AssertJSON 斷言 JSON body 裡 path 對應的值
+// path 以 . 分隔，數組使用下標，e.g. data.users.0.name
+// 空字符串代表整個 body
+// want 會先序列化為 JSON 再比較，所以數字類型不需要和 JSON 解析的 float64 一致
+func (r *Response) AssertJSON(path string, want any) *Response {
+	r.t.Helper()
+	got, ok := r.JSONPath(path)
+	if !assert.True(r.t, ok, "webtest: JSON 路徑 %s 不存在, body: %s", path, r.Body) {
+		return r
+	}
+	wantBs, err := json.Marshal(want)
+	if !assert.NoError(r.t, err) {
+		return r
+	}
+	gotBs, err := json.Marshal(got)
+	if !assert.NoError(r.t, err) {
+		return r
+	}
+	assert.JSONEq(r.t, string(wantBs), string(gotBs), "webtest: JSON 路徑 %s 不符合預期", path)
+	return r
+}
+
+// JSONPath 返回 JSON body 裡 path 對應的值
+func (r *Response) JSONPath(path string) (any, bool) {
+	var val any
+	if err := json.Unmarshal(r.Body, &val); err != nil {
+		return nil, false
+	}
+	if path == "" {
+		return val, true
+	}
+	for _, seg := range strings.Split(path, ".") {
+		switch v := val.(type) {
+		case map[string]any:
+			var ok bool
+			val, ok = v[seg]
+			if !ok {
+				return nil, false
+			}
+		case []any:
+			idx, err := strconv.Atoi(seg)
+			if err != nil || idx < 0 || idx >= len(v) {
+				return nil, false
+			}
+			val = v[idx]
+		default:
+			return nil, false
+		}
+	}
+	return val, true
+}
+
+// DecodeJSON 把 body 反序列化到 val
+func (r *Response) DecodeJSON(val any) *Response {
+	r.t.Helper()
+	assert.NoError(r.t, json.Unmarshal(r.Body, val), "webtest: 反序列化 JSON 失敗, body: %s", r.Body)
+	return r
+}
+
+// Templates 這一次請求(包含重定向)渲染過的模板
+// 需要 server 使用 TemplateRecorder
+func (r *Response) Templates() []Render {
+	return r.renders.all()
+}
+
+// AssertTemplate 斷言最後渲染的模板名字，返回渲染時使用的數據
+// 需要 server 使用 TemplateRecorder
+func (r *Response) AssertTemplate(name string) any {
+	r.t.Helper()
+	rs := r.renders.all()
+	if !assert.NotEmpty(r.t, rs, "webtest: 沒有渲染任何模板") {
+		return nil
+	}
+	last := rs[len(rs)-1]
+	assert.Equal(r.t, name, last.Name, "webtest: 渲染的模板不符合預期")
+	return last.Data
+}
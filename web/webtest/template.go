@@ -0,0 +1,60 @@
+package webtest
+
+import (
+	"context"
+	"geektime-go/web"
+	"sync"
+)
+
+type rendersKey struct{}
+
+// Render 一次模板渲染的記錄
+type Render struct {
+	Name string
+	Data any
+}
+
+// renders 記錄一次 Do (包含重定向) 期間渲染過的模板
+type renders struct {
+	mu   sync.Mutex
+	list []Render
+}
+
+func (r *renders) add(name string, data any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.list = append(r.list, Render{Name: name, Data: data})
+}
+
+func (r *renders) all() []Render {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := make([]Render, len(r.list))
+	copy(res, r.list)
+	return res
+}
+
+func withRenders(ctx context.Context, rs *renders) context.Context {
+	return context.WithValue(ctx, rendersKey{}, rs)
+}
+
+// TemplateRecorder 裝飾 web.TemplateEngine，記錄渲染了哪個模板以及使用的數據
+// 搭配 Response.AssertTemplate 使用
+//
+//	engine := webtest.NewTemplateRecorder(&web.GoTemplateEngine{T: tpl})
+//	server := web.NewHttpServer(web.ServerWithTemplateEngine(engine))
+type TemplateRecorder struct {
+	web.TemplateEngine
+}
+
+func NewTemplateRecorder(engine web.TemplateEngine) *TemplateRecorder {
+	return &TemplateRecorder{TemplateEngine: engine}
+}
+
+func (t *TemplateRecorder) Render(ctx context.Context, tplName string, data any) ([]byte, error) {
+	// 不是透過 webtest.Client 發起的請求，不需要記錄
+	if rs, ok := ctx.Value(rendersKey{}).(*renders); ok {
+		rs.add(tplName, data)
+	}
+	return t.TemplateEngine.Render(ctx, tplName, data)
+}